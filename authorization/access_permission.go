@@ -3,15 +3,17 @@ package authorization
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
+	bizerrors "github.com/crypto-zero/go-biz/errors"
 	"github.com/go-kratos/kratos/v2/middleware"
 	"github.com/go-kratos/kratos/v2/middleware/selector"
 	"github.com/go-kratos/kratos/v2/transport"
 )
 
 // ErrHTTPHeaderNotFound is the error that the header is not found.
-var ErrHTTPHeaderNotFound = errors.New("header not found")
+var ErrHTTPHeaderNotFound = bizerrors.New(401, "AUTHORIZATION_HEADER_NOT_FOUND", "header not found")
 
 // userKey is the context key for the User value.
 type userKey struct{}
@@ -34,6 +36,35 @@ func NewUserContext[T any](ctx context.Context, u *T) context.Context {
 	return context.WithValue(ctx, userKey{}, u)
 }
 
+// userIDKey is the context key for the authenticated user id.
+type userIDKey struct{}
+
+// UserIDFromContext returns the id of the user authenticated by an access permission.
+func UserIDFromContext(ctx context.Context) (int64, bool) {
+	userID, ok := ctx.Value(userIDKey{}).(int64)
+	return userID, ok
+}
+
+// NewUserIDContext returns a new Context that carries the authenticated user id.
+func NewUserIDContext(ctx context.Context, userID int64) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// sessionIDKey is the context key for the authenticated session id.
+type sessionIDKey struct{}
+
+// SessionIDFromContext returns the id of the session authenticated by an
+// HTTPHeaderAccessPermission.
+func SessionIDFromContext(ctx context.Context) (string, bool) {
+	sessionID, ok := ctx.Value(sessionIDKey{}).(string)
+	return sessionID, ok
+}
+
+// NewSessionIDContext returns a new Context that carries the authenticated session id.
+func NewSessionIDContext(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey{}, sessionID)
+}
+
 // AccessPermission is the interface that accesses permission.
 type AccessPermission interface {
 	// UserAuthenticateBuilder returns the user authenticate builder.
@@ -55,15 +86,61 @@ type HTTPHeaderAccessPermissionHeader string
 // is the HTTP header user access permission refresh session expire time.
 type HTTPHeaderAccessPermissionRefreshSessionExpireTime time.Duration
 
+// httpHeaderAccessPermissionOptions are the options of NewHTTPHeaderAccessPermission.
+type httpHeaderAccessPermissionOptions struct {
+	sessionOptions []SessionOption
+	bearer         bool
+}
+
+// HTTPHeaderAccessPermissionOption configures a HTTPHeaderAccessPermission.
+type HTTPHeaderAccessPermissionOption func(*httpHeaderAccessPermissionOptions)
+
+// WithMaxSessionLifetime ends sessions d after they were created however active they
+// are, the refresh session expire time is the idle timeout. Zero keeps them unlimited.
+func WithMaxSessionLifetime(d time.Duration) HTTPHeaderAccessPermissionOption {
+	return func(o *httpHeaderAccessPermissionOptions) {
+		if d > 0 {
+			o.sessionOptions = append(o.sessionOptions, WithMaxLifetime(d))
+		}
+	}
+}
+
+// WithBearerToken reads the token from a standard "Authorization: Bearer <token>" header
+// first, and from the access permission header when there is none, so mobile clients
+// and API gateways can use the conventional header.
+func WithBearerToken() HTTPHeaderAccessPermissionOption {
+	return func(o *httpHeaderAccessPermissionOptions) { o.bearer = true }
+}
+
+// requestToken returns the token of the request headers, see WithBearerToken.
+func requestToken(h transport.Header, header HTTPHeaderAccessPermissionHeader, bearer bool) string {
+	if bearer {
+		scheme, token, ok := strings.Cut(strings.TrimSpace(h.Get("Authorization")), " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			if token = strings.TrimSpace(token); token != "" {
+				return token
+			}
+		}
+	}
+	return h.Get(string(header))
+}
+
 // HTTPHeaderAccessPermission is the HTTP header user access permission.
 type HTTPHeaderAccessPermission[T any] struct {
 	header       HTTPHeaderAccessPermissionHeader
 	expire       HTTPHeaderAccessPermissionRefreshSessionExpireTime
 	sessionCache SessionCache
 	provisioner  AccessPermissionProvisioner[T]
+	opts         httpHeaderAccessPermissionOptions
 }
 
 func (u *HTTPHeaderAccessPermission[T]) ErrorMappingMiddleware(errorMap map[error]error) middleware.Middleware {
+	return errorMappingMiddleware(errorMap)
+}
+
+// errorMappingMiddleware replaces the errors of the handler matching a key of errorMap
+// with its value.
+func errorMappingMiddleware(errorMap map[error]error) middleware.Middleware {
 	errorReplaceMiddleware := func(handler middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req any) (any, error) {
 			reply, err := handler(ctx, req)
@@ -100,11 +177,12 @@ func (u *HTTPHeaderAccessPermission[T]) optionalUserAuthenticateMiddleware(
 		if !ok {
 			return handler(ctx, req)
 		}
-		token := tr.RequestHeader().Get(string(u.header))
+		token := requestToken(tr.RequestHeader(), u.header, u.opts.bearer)
 		if token == "" {
 			return handler(ctx, req)
 		}
-		userID, err := u.sessionCache.GetUserIDBySessionID(ctx, token, time.Duration(u.expire))
+		userID, err := u.sessionCache.GetUserIDBySessionID(ctx, token, time.Duration(u.expire),
+			u.opts.sessionOptions...)
 		if errors.Is(err, ErrSessionNotFound) {
 			return handler(ctx, req)
 		}
@@ -115,7 +193,8 @@ func (u *HTTPHeaderAccessPermission[T]) optionalUserAuthenticateMiddleware(
 		if err != nil {
 			return nil, err
 		}
-		return handler(NewUserContext(ctx, user), req)
+		ctx = NewSessionIDContext(NewUserIDContext(NewUserContext(ctx, user), userID), token)
+		return handler(ctx, req)
 	}
 }
 
@@ -130,11 +209,12 @@ func (u *HTTPHeaderAccessPermission[T]) userAuthenticateMiddleware(handler middl
 		if !ok {
 			return nil, ErrHTTPHeaderNotFound
 		}
-		token := tr.RequestHeader().Get(string(u.header))
+		token := requestToken(tr.RequestHeader(), u.header, u.opts.bearer)
 		if token == "" {
 			return nil, ErrHTTPHeaderNotFound
 		}
-		userID, err := u.sessionCache.GetUserIDBySessionID(ctx, token, time.Duration(u.expire))
+		userID, err := u.sessionCache.GetUserIDBySessionID(ctx, token, time.Duration(u.expire),
+			u.opts.sessionOptions...)
 		if err != nil {
 			return nil, err
 		}
@@ -142,7 +222,8 @@ func (u *HTTPHeaderAccessPermission[T]) userAuthenticateMiddleware(handler middl
 		if err != nil {
 			return nil, err
 		}
-		return handler(NewUserContext(ctx, user), req)
+		ctx = NewSessionIDContext(NewUserIDContext(NewUserContext(ctx, user), userID), token)
+		return handler(ctx, req)
 	}
 }
 
@@ -158,11 +239,16 @@ func NewHTTPHeaderAccessPermission[T any](
 	expire HTTPHeaderAccessPermissionRefreshSessionExpireTime,
 	sessionCache SessionCache,
 	provisioner AccessPermissionProvisioner[T],
+	opts ...HTTPHeaderAccessPermissionOption,
 ) AccessPermission {
-	return &HTTPHeaderAccessPermission[T]{
+	u := &HTTPHeaderAccessPermission[T]{
 		header:       header,
 		expire:       expire,
 		sessionCache: sessionCache,
 		provisioner:  provisioner,
 	}
+	for _, opt := range opts {
+		opt(&u.opts)
+	}
+	return u
 }
@@ -0,0 +1,193 @@
+package authorization
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/redis/go-redis/v9"
+)
+
+// APIKeyHeader is the default header carrying the API key of machine clients.
+const APIKeyHeader HTTPHeaderAccessPermissionHeader = "X-API-Key"
+
+// ErrAPIKeyNotFound is the error that the API key does not exist or expired.
+var ErrAPIKeyNotFound = bizerrors.New(401, "AUTHORIZATION_API_KEY_NOT_FOUND", "api key not found")
+
+// APIKey is the principal of a machine client authenticated by an API key.
+type APIKey struct {
+	// ID identifies the key in logs and listings, it is not the secret.
+	ID string `json:"id"`
+	// Principal is the client the key belongs to, e.g. "service:billing".
+	Principal string   `json:"principal"`
+	Scopes    []string `json:"scopes,omitempty"`
+	CreatedAt int64    `json:"created_at"`
+	// ExpiresAt is zero for keys without expiry.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
+// HasScope reports whether the key was granted scope.
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// GenerateAPIKey returns a new random API key, 32 bytes base64url encoded.
+func GenerateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate api key failed: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// APIKeyCache The API key cache interface
+type APIKeyCache interface {
+	// SetAPIKey sets the principal of key for expire, zero for no expiry.
+	SetAPIKey(ctx context.Context, key string, apiKey *APIKey, expire time.Duration) error
+	// GetAPIKey gets the principal of key.
+	GetAPIKey(ctx context.Context, key string) (*APIKey, error)
+	// DeleteAPIKey revokes key.
+	DeleteAPIKey(ctx context.Context, key string) error
+}
+
+// APIKeyCacheImpl is an APIKeyCache implementation, it stores the keys as SHA-256
+// digests so a Redis dump does not leak them.
+type APIKeyCacheImpl struct {
+	prefix SessionCachePrefix
+	client redis.UniversalClient
+}
+
+func (c APIKeyCacheImpl) apiKeyKey(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return fmt.Sprintf("%s:API:KEY:%s", c.prefix, hex.EncodeToString(digest[:]))
+}
+
+func (c APIKeyCacheImpl) SetAPIKey(ctx context.Context, key string, apiKey *APIKey, expire time.Duration) error {
+	v := *apiKey
+	n := time.Now()
+	v.CreatedAt, v.ExpiresAt = n.Unix(), 0
+	if expire > 0 {
+		v.ExpiresAt = n.Add(expire).Unix()
+	}
+	data, err := json.Marshal(&v)
+	if err != nil {
+		return fmt.Errorf("marshal api key failed: %w", err)
+	}
+	if err = c.client.Set(ctx, c.apiKeyKey(key), data, max(expire, 0)).Err(); err != nil {
+		return fmt.Errorf("set api key failed: %w", err)
+	}
+	return nil
+}
+
+func (c APIKeyCacheImpl) GetAPIKey(ctx context.Context, key string) (*APIKey, error) {
+	data, err := c.client.Get(ctx, c.apiKeyKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get api key failed: %w", err)
+	}
+	var apiKey APIKey
+	if err = json.Unmarshal(data, &apiKey); err != nil {
+		return nil, fmt.Errorf("unmarshal api key failed: %w", err)
+	}
+	return &apiKey, nil
+}
+
+func (c APIKeyCacheImpl) DeleteAPIKey(ctx context.Context, key string) error {
+	if err := c.client.Del(ctx, c.apiKeyKey(key)).Err(); err != nil {
+		return fmt.Errorf("delete api key failed: %w", err)
+	}
+	return nil
+}
+
+// NewAPIKeyCacheImpl returns a new APIKeyCacheImpl.
+func NewAPIKeyCacheImpl(prefix SessionCachePrefix, client redis.UniversalClient) APIKeyCache {
+	return &APIKeyCacheImpl{prefix: prefix, client: client}
+}
+
+// apiKeyKey is the context key for the APIKey value.
+type apiKeyKey struct{}
+
+// APIKeyFromContext returns the APIKey principal stored in ctx, nil for requests not
+// authenticated by an API key.
+func APIKeyFromContext(ctx context.Context) *APIKey {
+	apiKey, _ := ctx.Value(apiKeyKey{}).(*APIKey)
+	return apiKey
+}
+
+// NewAPIKeyContext returns a new Context that carries apiKey.
+func NewAPIKeyContext(ctx context.Context, apiKey *APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyKey{}, apiKey)
+}
+
+// APIKeyAccessPermission authenticates machine clients by the API key of a header. The
+// principal is stored next to the user, so routes can accept either.
+type APIKeyAccessPermission struct {
+	header HTTPHeaderAccessPermissionHeader
+	cache  APIKeyCache
+}
+
+// NewAPIKeyAccessPermission creates a new API key access permission, reading APIKeyHeader
+// when header is empty.
+func NewAPIKeyAccessPermission(header HTTPHeaderAccessPermissionHeader, cache APIKeyCache) *APIKeyAccessPermission {
+	if header == "" {
+		header = APIKeyHeader
+	}
+	return &APIKeyAccessPermission{header: header, cache: cache}
+}
+
+// APIKeyAuthenticateBuilder returns the builder of the middleware requiring an API key.
+func (a *APIKeyAccessPermission) APIKeyAuthenticateBuilder(errorMap map[error]error) *selector.Builder {
+	return selector.Server(errorMappingMiddleware(errorMap), a.middleware(false))
+}
+
+// OptionalAPIKeyAuthenticateBuilder returns the builder of the middleware authenticating
+// an API key when the request has one.
+func (a *APIKeyAccessPermission) OptionalAPIKeyAuthenticateBuilder(errorMap map[error]error) *selector.Builder {
+	return selector.Server(errorMappingMiddleware(errorMap), a.middleware(true))
+}
+
+// middleware authenticates the API key of the request.
+func (a *APIKeyAccessPermission) middleware(optional bool) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			// Skip if the principal is already in the context.
+			if APIKeyFromContext(ctx) != nil {
+				return handler(ctx, req)
+			}
+			var key string
+			if tr, ok := transport.FromServerContext(ctx); ok {
+				key = tr.RequestHeader().Get(string(a.header))
+			}
+			if key == "" {
+				if optional {
+					return handler(ctx, req)
+				}
+				return nil, ErrHTTPHeaderNotFound
+			}
+			apiKey, err := a.cache.GetAPIKey(ctx, key)
+			if err == nil && apiKey.ExpiresAt > 0 && time.Now().Unix() >= apiKey.ExpiresAt {
+				err = ErrAPIKeyNotFound
+			}
+			if optional && errors.Is(err, ErrAPIKeyNotFound) {
+				return handler(ctx, req)
+			}
+			if err != nil {
+				return nil, err
+			}
+			return handler(NewAPIKeyContext(ctx, apiKey), req)
+		}
+	}
+}
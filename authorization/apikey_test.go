@@ -0,0 +1,80 @@
+package authorization
+
+import (
+	"context"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyCache(t *testing.T) {
+	ctx := context.Background()
+	_, client, s := newTestSessionCache(t)
+	cache := NewAPIKeyCacheImpl("TEST", client)
+
+	key, err := GenerateAPIKey()
+	require.NoError(t, err)
+	require.NoError(t, cache.SetAPIKey(ctx, key, &APIKey{ID: "key-1", Principal: "service:billing",
+		Scopes: []string{"orders:read"}}, time.Hour))
+	apiKey, err := cache.GetAPIKey(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, "service:billing", apiKey.Principal)
+	assert.True(t, apiKey.HasScope("orders:read"))
+	assert.False(t, apiKey.HasScope("orders:write"))
+	assert.NotZero(t, apiKey.ExpiresAt)
+
+	// The key itself is not stored.
+	for _, k := range s.Keys() {
+		assert.NotContains(t, k, key)
+	}
+
+	require.NoError(t, cache.DeleteAPIKey(ctx, key))
+	_, err = cache.GetAPIKey(ctx, key)
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+}
+
+func TestAPIKeyAccessPermission(t *testing.T) {
+	ctx := context.Background()
+	_, client, _ := newTestSessionCache(t)
+	cache := NewAPIKeyCacheImpl("TEST", client)
+	require.NoError(t, cache.SetAPIKey(ctx, "secret-key", &APIKey{ID: "key-1", Principal: "service:billing"}, 0))
+
+	errorMap := map[error]error{
+		ErrHTTPHeaderNotFound: errors.Unauthorized("UNAUTHORIZED", "api key required"),
+		ErrAPIKeyNotFound:     errors.Unauthorized("UNAUTHORIZED", "api key not found"),
+	}
+	srv := http.NewServer(http.Middleware(
+		NewAPIKeyAccessPermission("", cache).APIKeyAuthenticateBuilder(errorMap).Path("/v1/orders").Build(),
+	))
+	srv.Route("/v1").GET("/orders", func(c http.Context) error {
+		h := c.Middleware(func(ctx context.Context, req any) (any, error) {
+			return APIKeyFromContext(ctx).Principal, nil
+		})
+		out, err := h(c, nil)
+		if err != nil {
+			return err
+		}
+		return c.Result(stdhttp.StatusOK, out)
+	})
+	get := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(stdhttp.MethodGet, "http://127.0.0.1:8000/v1/orders", nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw := get("secret-key")
+	assert.Equal(t, stdhttp.StatusOK, rw.Code)
+	assert.Equal(t, `"service:billing"`, rw.Body.String())
+	assert.Equal(t, stdhttp.StatusUnauthorized, get("").Code)
+	assert.Equal(t, stdhttp.StatusUnauthorized, get("other-key").Code)
+}
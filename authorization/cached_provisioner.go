@@ -0,0 +1,124 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/crypto-zero/go-biz/cache"
+	"github.com/redis/go-redis/v9"
+)
+
+// CachedAccessPermissionProvisioner is an AccessPermissionProvisioner caching the users of
+// another one, so authenticated requests don't hit the user service each time. Call
+// Invalidate after changing a user, other changes show once the cache expires. The
+// cached users are shared, callers must not modify them.
+type CachedAccessPermissionProvisioner[T any] interface {
+	AccessPermissionProvisioner[T]
+	// Invalidate drops the cached user.
+	Invalidate(ctx context.Context, userID int64) error
+}
+
+// memoryProvisionerEntry is a user cached in memory until expiresAt.
+type memoryProvisionerEntry[T any] struct {
+	user      *T
+	expiresAt time.Time
+}
+
+// MemoryCachedProvisioner caches the users in process memory, invalidations are local to
+// the instance.
+type MemoryCachedProvisioner[T any] struct {
+	next   AccessPermissionProvisioner[T]
+	expire time.Duration
+
+	mu      sync.Mutex
+	entries map[int64]memoryProvisionerEntry[T]
+	sweepAt int // Size at which the expired entries are swept
+}
+
+// Compile-time assertion: MemoryCachedProvisioner implements CachedAccessPermissionProvisioner.
+var _ CachedAccessPermissionProvisioner[struct{}] = (*MemoryCachedProvisioner[struct{}])(nil)
+
+// NewMemoryCachedProvisioner returns a new MemoryCachedProvisioner in front of next,
+// caching for expire.
+func NewMemoryCachedProvisioner[T any](next AccessPermissionProvisioner[T], expire time.Duration,
+) *MemoryCachedProvisioner[T] {
+	return &MemoryCachedProvisioner[T]{
+		next: next, expire: expire, entries: map[int64]memoryProvisionerEntry[T]{}, sweepAt: 1024,
+	}
+}
+
+func (c *MemoryCachedProvisioner[T]) GetUserByID(ctx context.Context, userID int64) (*T, error) {
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[userID]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.user, nil
+	}
+	user, err := c.next.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.sweepAt {
+		for id, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+		c.sweepAt = max(c.sweepAt, 2*len(c.entries))
+	}
+	c.entries[userID] = memoryProvisionerEntry[T]{user: user, expiresAt: now.Add(c.expire)}
+	return user, nil
+}
+
+func (c *MemoryCachedProvisioner[T]) Invalidate(_ context.Context, userID int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, userID)
+	return nil
+}
+
+// RedisCachedProvisioner caches the users JSON encoded in Redis, shared by the instances.
+// A Redis failure falls through to the next provisioner.
+type RedisCachedProvisioner[T any] struct {
+	users  *cache.Cache[T]
+	next   AccessPermissionProvisioner[T]
+	expire time.Duration
+}
+
+// Compile-time assertion: RedisCachedProvisioner implements CachedAccessPermissionProvisioner.
+var _ CachedAccessPermissionProvisioner[struct{}] = (*RedisCachedProvisioner[struct{}])(nil)
+
+// NewRedisCachedProvisioner returns a new RedisCachedProvisioner in front of next, caching
+// for expire.
+func NewRedisCachedProvisioner[T any](prefix SessionCachePrefix, client redis.UniversalClient,
+	next AccessPermissionProvisioner[T], expire time.Duration,
+) *RedisCachedProvisioner[T] {
+	users := cache.New[T](client, cache.Options{Prefix: fmt.Sprintf("%s:USER:PROVISION:", prefix), TTL: expire})
+	return &RedisCachedProvisioner[T]{users: users, next: next, expire: expire}
+}
+
+func (c *RedisCachedProvisioner[T]) GetUserByID(ctx context.Context, userID int64) (*T, error) {
+	key := strconv.FormatInt(userID, 10)
+	if user, err := c.users.Get(ctx, key); err == nil {
+		return user, nil
+	}
+	user, err := c.next.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	_ = c.users.Set(ctx, key, user, c.expire)
+	return user, nil
+}
+
+func (c *RedisCachedProvisioner[T]) Invalidate(ctx context.Context, userID int64) error {
+	if err := c.users.Delete(ctx, strconv.FormatInt(userID, 10)); err != nil {
+		return fmt.Errorf("invalidate user failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package authorization
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingProvisioner counts the lookups of the test users.
+type countingProvisioner struct {
+	names map[int64]string
+	calls int
+}
+
+type testNamedUser struct {
+	ID   int64
+	Name string
+}
+
+func (p *countingProvisioner) GetUserByID(_ context.Context, userID int64) (*testNamedUser, error) {
+	p.calls++
+	return &testNamedUser{ID: userID, Name: p.names[userID]}, nil
+}
+
+func TestCachedAccessPermissionProvisioner(t *testing.T) {
+	ctx := context.Background()
+	_, client, s := newTestSessionCache(t)
+	for name, newCache := range map[string]func(p *countingProvisioner) CachedAccessPermissionProvisioner[testNamedUser]{
+		"memory": func(p *countingProvisioner) CachedAccessPermissionProvisioner[testNamedUser] {
+			return NewMemoryCachedProvisioner[testNamedUser](p, time.Hour)
+		},
+		"redis": func(p *countingProvisioner) CachedAccessPermissionProvisioner[testNamedUser] {
+			return NewRedisCachedProvisioner[testNamedUser]("TEST", client, p, time.Hour)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s.FlushAll()
+			provisioner := &countingProvisioner{names: map[int64]string{1: "alice"}}
+			cache := newCache(provisioner)
+
+			for range 2 {
+				user, err := cache.GetUserByID(ctx, 1)
+				require.NoError(t, err)
+				assert.Equal(t, "alice", user.Name)
+			}
+			assert.Equal(t, 1, provisioner.calls)
+
+			provisioner.names[1] = "bob"
+			require.NoError(t, cache.Invalidate(ctx, 1))
+			user, err := cache.GetUserByID(ctx, 1)
+			require.NoError(t, err)
+			assert.Equal(t, "bob", user.Name)
+			assert.Equal(t, 2, provisioner.calls)
+		})
+	}
+}
+
+func TestMemoryCachedProvisioner_Expire(t *testing.T) {
+	provisioner := &countingProvisioner{}
+	cache := NewMemoryCachedProvisioner[testNamedUser](provisioner, time.Millisecond)
+	_, err := cache.GetUserByID(context.Background(), 1)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+	_, err = cache.GetUserByID(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, provisioner.calls)
+}
@@ -0,0 +1,151 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/crypto-zero/go-kit/text"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/redis/go-redis/v9"
+)
+
+// Enforcer is the policy check of a Casbin enforcer, *casbin.Enforcer and
+// *casbin.SyncedEnforcer implement it.
+type Enforcer interface {
+	Enforce(rvals ...any) (bool, error)
+}
+
+// CasbinRequestFunc returns the subject, object and action of the Casbin request of ctx.
+type CasbinRequestFunc func(ctx context.Context) (sub, obj, act string, err error)
+
+// DefaultCasbinRequest is the subject, object and action of an authenticated request:
+// the user id, the transport operation, and the HTTP method or "CALL" for other
+// transports. It returns ErrUnauthenticated without user.
+func DefaultCasbinRequest(ctx context.Context) (string, string, string, error) {
+	userID, ok := UserIDFromContext(ctx)
+	if !ok {
+		return "", "", "", ErrUnauthenticated
+	}
+	tr, ok := transport.FromServerContext(ctx)
+	if !ok {
+		return "", "", "", ErrUnauthenticated
+	}
+	act := "CALL"
+	if ht, ok := tr.(http.Transporter); ok {
+		act = ht.Request().Method
+	}
+	return strconv.FormatInt(userID, 10), tr.Operation(), act, nil
+}
+
+// CasbinAuthorizer authorizes the requests authenticated by an access permission with a
+// Casbin enforcer.
+type CasbinAuthorizer struct {
+	enforcer Enforcer
+	request  CasbinRequestFunc
+}
+
+// NewCasbinAuthorizer creates a new CasbinAuthorizer, request is DefaultCasbinRequest
+// when nil.
+func NewCasbinAuthorizer(enforcer Enforcer, request CasbinRequestFunc) *CasbinAuthorizer {
+	if request == nil {
+		request = DefaultCasbinRequest
+	}
+	return &CasbinAuthorizer{enforcer: enforcer, request: request}
+}
+
+// AuthorizeBuilder returns the builder of the middleware enforcing the policy, it
+// returns ErrPermissionDenied for denied requests.
+func (a *CasbinAuthorizer) AuthorizeBuilder(errorMap map[error]error) *selector.Builder {
+	return selector.Server(errorMappingMiddleware(errorMap), a.middleware)
+}
+
+func (a *CasbinAuthorizer) middleware(handler middleware.Handler) middleware.Handler {
+	return func(ctx context.Context, req any) (any, error) {
+		sub, obj, act, err := a.request(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := a.enforcer.Enforce(sub, obj, act)
+		if err != nil {
+			return nil, fmt.Errorf("casbin enforce failed: %w", err)
+		}
+		if !ok {
+			return nil, ErrPermissionDenied
+		}
+		return handler(ctx, req)
+	}
+}
+
+// RedisWatcher is a Casbin watcher over Redis pub/sub, so a policy change on one
+// instance reloads the policy of the others. It implements persist.Watcher, pass it to
+// the SetWatcher of the enforcer, which calls Update after saving a policy change.
+type RedisWatcher struct {
+	client  redis.UniversalClient
+	channel string
+	id      string // Skips the updates of this instance
+	pubsub  *redis.PubSub
+
+	mu       sync.Mutex
+	callback func(string)
+	done     chan struct{}
+}
+
+// NewRedisWatcher subscribes to channel and returns the watcher, Close stops it.
+func NewRedisWatcher(ctx context.Context, client redis.UniversalClient, channel string) (*RedisWatcher, error) {
+	pubsub := client.Subscribe(ctx, channel)
+	// Wait for the subscription, so updates published after the return are received.
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return nil, fmt.Errorf("casbin watcher subscribe failed: %w", err)
+	}
+	w := &RedisWatcher{
+		client: client, channel: channel, id: text.RandString(16), pubsub: pubsub,
+		done: make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// run calls the callback with the updates of the other instances until Close.
+func (w *RedisWatcher) run() {
+	defer close(w.done)
+	for msg := range w.pubsub.Channel() {
+		if msg.Payload == w.id {
+			continue
+		}
+		w.mu.Lock()
+		callback := w.callback
+		w.mu.Unlock()
+		if callback != nil {
+			callback(msg.Payload)
+		}
+	}
+}
+
+// SetUpdateCallback sets the callback of the policy updates of other instances,
+// typically calling the LoadPolicy of the enforcer.
+func (w *RedisWatcher) SetUpdateCallback(callback func(string)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.callback = callback
+	return nil
+}
+
+// Update notifies the other instances of a policy change.
+func (w *RedisWatcher) Update() error {
+	if err := w.client.Publish(context.Background(), w.channel, w.id).Err(); err != nil {
+		return fmt.Errorf("casbin watcher publish failed: %w", err)
+	}
+	return nil
+}
+
+// Close unsubscribes and waits for the running callback.
+func (w *RedisWatcher) Close() {
+	_ = w.pubsub.Close()
+	<-w.done
+}
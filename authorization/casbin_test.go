@@ -0,0 +1,84 @@
+package authorization
+
+import (
+	"context"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testEnforcer allows the requests of its policy, "sub obj act" tuples.
+type testEnforcer map[[3]string]bool
+
+func (e testEnforcer) Enforce(rvals ...any) (bool, error) {
+	return e[[3]string{rvals[0].(string), rvals[1].(string), rvals[2].(string)}], nil
+}
+
+func TestCasbinAuthorizer(t *testing.T) {
+	enforcer := testEnforcer{{"1", "/v1/orders", "GET"}: true}
+	authorizer := NewCasbinAuthorizer(enforcer, nil)
+	errorMap := map[error]error{
+		ErrUnauthenticated:  errors.Unauthorized("UNAUTHORIZED", "unauthenticated"),
+		ErrPermissionDenied: errors.Forbidden("FORBIDDEN", "permission denied"),
+	}
+	srv := http.NewServer(http.Middleware(
+		testUserIDMiddleware,
+		authorizer.AuthorizeBuilder(errorMap).Prefix("/v1/").Build(),
+	))
+	srv.Route("/v1").GET("/orders", func(c http.Context) error {
+		http.SetOperation(c, "/v1/orders")
+		h := c.Middleware(func(ctx context.Context, req any) (any, error) { return "ok", nil })
+		out, err := h(c, nil)
+		if err != nil {
+			return err
+		}
+		return c.Result(stdhttp.StatusOK, out)
+	})
+	get := func(userID string) int {
+		req := httptest.NewRequest(stdhttp.MethodGet, "http://127.0.0.1:8000/v1/orders", nil)
+		req.Header.Set("X-User-ID", userID)
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	assert.Equal(t, stdhttp.StatusOK, get("1"))
+	assert.Equal(t, stdhttp.StatusForbidden, get("2"))
+	assert.Equal(t, stdhttp.StatusUnauthorized, get(""))
+}
+
+func TestRedisWatcher(t *testing.T) {
+	ctx := context.Background()
+	_, client, _ := newTestSessionCache(t)
+
+	a, err := NewRedisWatcher(ctx, client, "TEST:CASBIN")
+	require.NoError(t, err)
+	defer a.Close()
+	b, err := NewRedisWatcher(ctx, client, "TEST:CASBIN")
+	require.NoError(t, err)
+	defer b.Close()
+
+	reloads := make(chan string, 2)
+	require.NoError(t, a.SetUpdateCallback(func(msg string) { reloads <- "a" }))
+	require.NoError(t, b.SetUpdateCallback(func(msg string) { reloads <- "b" }))
+
+	// Only the other instance reloads.
+	require.NoError(t, a.Update())
+	select {
+	case who := <-reloads:
+		assert.Equal(t, "b", who)
+	case <-time.After(time.Second):
+		t.Fatal("no policy reload")
+	}
+	select {
+	case who := <-reloads:
+		t.Fatalf("unexpected reload of %s", who)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
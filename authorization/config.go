@@ -0,0 +1,88 @@
+package authorization
+
+import (
+	"fmt"
+	"time"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrInvalidConfig is returned when the session config is invalid.
+var ErrInvalidConfig = bizerrors.New(500, "AUTHORIZATION_INVALID_CONFIG", "invalid authorization config")
+
+// Duration is a time.Duration decoded from strings like "24h".
+type Duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", text, err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// SessionConfig is the session config, loadable from YAML or env.
+type SessionConfig struct {
+	// Prefix is the session cache key prefix.
+	Prefix string `json:"prefix" yaml:"prefix"`
+	// Header is the HTTP header carrying the session id.
+	Header string `json:"header" yaml:"header"`
+	// Expiration is the sliding session expiration, zero is UserSessionExpiration.
+	Expiration Duration `json:"expiration" yaml:"expiration"`
+	// MaxLifetime is the absolute session lifetime since login, zero is unlimited.
+	MaxLifetime Duration `json:"max_lifetime" yaml:"max_lifetime"`
+	// Bearer reads the session id from "Authorization: Bearer" first, see WithBearerToken.
+	Bearer bool `json:"bearer" yaml:"bearer"`
+}
+
+// Validate checks the prefix and header are set and the durations are not negative.
+func (c SessionConfig) Validate() error {
+	if c.Prefix == "" {
+		return fmt.Errorf("%w: prefix is empty", ErrInvalidConfig)
+	}
+	if c.Header == "" {
+		return fmt.Errorf("%w: header is empty", ErrInvalidConfig)
+	}
+	if c.Expiration < 0 {
+		return fmt.Errorf("%w: expiration is negative", ErrInvalidConfig)
+	}
+	if c.MaxLifetime < 0 {
+		return fmt.Errorf("%w: max lifetime is negative", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// AccessPermissionHeader returns the header of NewHTTPHeaderAccessPermission.
+func (c SessionConfig) AccessPermissionHeader() HTTPHeaderAccessPermissionHeader {
+	return HTTPHeaderAccessPermissionHeader(c.Header)
+}
+
+// RefreshSessionExpireTime returns the session expiration of NewHTTPHeaderAccessPermission.
+func (c SessionConfig) RefreshSessionExpireTime() HTTPHeaderAccessPermissionRefreshSessionExpireTime {
+	if c.Expiration == 0 {
+		return NewHTTPHeaderAccessPermissionRefreshSessionExpireTime()
+	}
+	return HTTPHeaderAccessPermissionRefreshSessionExpireTime(c.Expiration)
+}
+
+// AccessPermissionOptions returns the options of NewHTTPHeaderAccessPermission.
+func (c SessionConfig) AccessPermissionOptions() []HTTPHeaderAccessPermissionOption {
+	opts := []HTTPHeaderAccessPermissionOption{WithMaxSessionLifetime(time.Duration(c.MaxLifetime))}
+	if c.Bearer {
+		opts = append(opts, WithBearerToken())
+	}
+	return opts
+}
+
+// NewSessionCache creates the SessionCache with the configured prefix.
+func (c SessionConfig) NewSessionCache(client redis.UniversalClient) SessionCache {
+	return NewSessionCacheImpl(SessionCachePrefix(c.Prefix), client)
+}
@@ -4,24 +4,43 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/crypto-zero/go-biz/cache"
 	"github.com/redis/go-redis/v9"
 )
 
 // userSetSessionIDScript is a redis lua script to set user session id,
-// it set user session id, set a user session map, and remove expired session id from a session map.
+// it set user session id and its metadata, set a user session map, and remove expired session id from a session map.
+// With a session key prefix it first deletes the other sessions of the user, their keys are built from the
+// prefixes so they must live on the same node, e.g. a standalone redis.
 //
 // KEYS[1] = user session key
 // KEYS[2] = user session map key
+// KEYS[3] = user session metadata key
 // ARGV[1] = user id
 // ARGV[2] = session id
 // ARGV[3] = expire timestamp
 // ARGV[4] = current timestamp
+// ARGV[5] = user session key prefix to delete the other sessions, empty to keep them
+// ARGV[6] = user session metadata key prefix
+// ARGV[7...] = metadata field and value pairs
 var userSetSessionIDScript = redis.NewScript(
 	`
+if ARGV[5] ~= "" then
+    for _, field in ipairs(redis.call("HKEYS", KEYS[2])) do
+        if field ~= ARGV[2] then
+            redis.call("DEL", ARGV[5] .. field, ARGV[6] .. field)
+        end
+    end
+    redis.call("DEL", KEYS[2])
+end
 redis.call("SET", KEYS[1], ARGV[1])
 redis.call("EXPIREAT", KEYS[1], ARGV[3])
+redis.call("DEL", KEYS[3])
+redis.call("HSET", KEYS[3], unpack(ARGV, 7))
+redis.call("EXPIREAT", KEYS[3], ARGV[3])
 redis.call("HSET", KEYS[2], ARGV[2], ARGV[3])
 local expire_timestamp = tonumber(ARGV[3])
 local current_timestamp = tonumber(ARGV[4])
@@ -38,10 +57,91 @@ end
 return redis.call("EXPIREAT", KEYS[2], expire_timestamp)`,
 )
 
+// userDeleteSessionScript is a redis lua script to delete a user session,
+// it deletes the session id, its metadata and its entry in the user session map if the session still belongs to the user.
+//
+// KEYS[1] = user session key
+// KEYS[2] = user session map key
+// KEYS[3] = user session metadata key
+// ARGV[1] = user id
+// ARGV[2] = session id
+var userDeleteSessionScript = redis.NewScript(
+	`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+    return 0
+end
+redis.call("DEL", KEYS[1], KEYS[3])
+redis.call("HDEL", KEYS[2], ARGV[2])
+return 1`,
+)
+
+// userSetSessionAuthLevelScript is a redis lua script to set the auth level of a session,
+// it stores the level and the verification time in the session metadata expiring with the session.
+//
+// KEYS[1] = user session key
+// KEYS[2] = user session metadata key
+// ARGV[1] = auth level
+// ARGV[2] = current timestamp
+var userSetSessionAuthLevelScript = redis.NewScript(
+	`
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl == -2 then
+    return 0
+end
+redis.call("HSET", KEYS[2], "auth_level", ARGV[1], "auth_verified_at", ARGV[2])
+if ttl > 0 then
+    redis.call("PEXPIRE", KEYS[2], ttl)
+end
+return 1`,
+)
+
+// userRefreshSessionScript is a redis lua script to refresh a user session,
+// it extends the session by the idle expiration but not beyond its max lifetime since it was created,
+// and deletes the session once the max lifetime is over.
+// Sessions set without a creation time have no max lifetime.
+//
+// KEYS[1] = user session key
+// KEYS[2] = user session metadata key
+// KEYS[3] = user session map key
+// ARGV[1] = user id
+// ARGV[2] = session id
+// ARGV[3] = idle expiration seconds
+// ARGV[4] = current timestamp
+// ARGV[5] = max lifetime seconds, 0 for none
+var userRefreshSessionScript = redis.NewScript(
+	`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+    return 0
+end
+local current_timestamp = tonumber(ARGV[4])
+local expire_timestamp = current_timestamp + tonumber(ARGV[3])
+local max_lifetime = tonumber(ARGV[5])
+if max_lifetime > 0 then
+    local created_at = tonumber(redis.call("HGET", KEYS[2], "created_at"))
+    if created_at then
+        local deadline = created_at + max_lifetime
+        if deadline <= current_timestamp then
+            redis.call("DEL", KEYS[1], KEYS[2])
+            redis.call("HDEL", KEYS[3], ARGV[2])
+            return 0
+        elseif deadline < expire_timestamp then
+            expire_timestamp = deadline
+        end
+    end
+end
+redis.call("EXPIREAT", KEYS[1], expire_timestamp)
+redis.call("EXPIREAT", KEYS[2], expire_timestamp)
+redis.call("EXPIRE", KEYS[3], ARGV[3])
+redis.call("HSET", KEYS[3], ARGV[2], expire_timestamp)
+return 1`,
+)
+
 // SessionCacheImpl is a SessionCache implementation.
 type SessionCacheImpl struct {
 	prefix SessionCachePrefix
 	client redis.UniversalClient
+	// userIDs reads the user ids of the user session keys, which the scripts write.
+	userIDs *cache.Cache[int64]
 }
 
 func (s SessionCacheImpl) userSessionKey(sessionID string) string {
@@ -52,17 +152,34 @@ func (s SessionCacheImpl) userSessionMapKey(userID int64) string {
 	return fmt.Sprintf("%s:USER:SESSION:MAP:%d", s.prefix, userID)
 }
 
+func (s SessionCacheImpl) userSessionMetadataKey(sessionID string) string {
+	return fmt.Sprintf("%s:USER:SESSION:META:%s", s.prefix, sessionID)
+}
+
 func (s SessionCacheImpl) SetUserSessionID(ctx context.Context, sessionID string,
-	userID int64, expire time.Duration,
+	userID int64, expire time.Duration, opts ...SessionOption,
 ) error {
+	var o sessionOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 	n := time.Now()
 	expireAt := n.Add(expire)
 	currentTimestamp, expireTimestamp := n.Unix(), expireAt.Unix()
 	key, mapKey := s.userSessionKey(sessionID), s.userSessionMapKey(userID)
+	var kickPrefix string
+	if o.single {
+		kickPrefix = s.userSessionKey("")
+	}
+	md := o.metadata
+	args := []any{
+		userID, sessionID, expireTimestamp, currentTimestamp, kickPrefix, s.userSessionMetadataKey(""),
+		"ip", md.IP, "user_agent", md.UserAgent, "device_name", md.DeviceName, "created_at", currentTimestamp,
+	}
 	err := userSetSessionIDScript.Run(
 		ctx, s.client,
-		[]string{key, mapKey},
-		userID, sessionID, expireTimestamp, currentTimestamp,
+		[]string{key, mapKey, s.userSessionMetadataKey(sessionID)},
+		args...,
 	).Err()
 	if err != nil {
 		return fmt.Errorf("set user session id failed: %w", err)
@@ -70,6 +187,14 @@ func (s SessionCacheImpl) SetUserSessionID(ctx context.Context, sessionID string
 	return nil
 }
 
+// Check pings Redis, it implements the health checker of the session cache.
+func (s SessionCacheImpl) Check(ctx context.Context) error {
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("session cache redis ping failed: %w", err)
+	}
+	return nil
+}
+
 func (s SessionCacheImpl) DeleteUserSession(ctx context.Context, userID int64) error {
 	mapKey := s.userSessionMapKey(userID)
 	sessionIDs, err := s.client.HKeys(ctx, mapKey).Result()
@@ -78,8 +203,7 @@ func (s SessionCacheImpl) DeleteUserSession(ctx context.Context, userID int64) e
 	}
 	pipe := s.client.Pipeline()
 	for _, sessionID := range sessionIDs {
-		key := s.userSessionKey(sessionID)
-		pipe.Del(ctx, key)
+		pipe.Del(ctx, s.userSessionKey(sessionID), s.userSessionMetadataKey(sessionID))
 	}
 	pipe.Del(ctx, mapKey)
 	_, err = pipe.Exec(ctx)
@@ -89,35 +213,122 @@ func (s SessionCacheImpl) DeleteUserSession(ctx context.Context, userID int64) e
 	return nil
 }
 
-func (s SessionCacheImpl) GetUserIDBySessionID(ctx context.Context, sessionID string,
-	expire time.Duration,
-) (userID int64, err error) {
+func (s SessionCacheImpl) DeleteSession(ctx context.Context, sessionID string) error {
 	key := s.userSessionKey(sessionID)
-	if userID, err = s.client.Get(ctx, key).Int64(); errors.Is(err, redis.Nil) {
-		return 0, ErrSessionNotFound
+	userID, err := s.userID(ctx, sessionID)
+	if err != nil {
+		return err
 	}
+	deleted, err := userDeleteSessionScript.Run(
+		ctx, s.client,
+		[]string{key, s.userSessionMapKey(userID), s.userSessionMetadataKey(sessionID)},
+		userID, sessionID,
+	).Int()
 	if err != nil {
-		return 0, fmt.Errorf("get user id by session id failed: %w", err)
+		return fmt.Errorf("delete user session id failed: %w", err)
 	}
-	mapKey := s.userSessionMapKey(userID)
-	expireAt := time.Now().Add(expire)
-	_, err = s.client.Pipelined(
+	if deleted == 0 {
+		// The session expired or was deleted since it was read.
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s SessionCacheImpl) SetSessionAuthLevel(ctx context.Context, sessionID string, level AuthLevel) error {
+	set, err := userSetSessionAuthLevelScript.Run(
+		ctx, s.client,
+		[]string{s.userSessionKey(sessionID), s.userSessionMetadataKey(sessionID)},
+		int(level), time.Now().Unix(),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("set session auth level failed: %w", err)
+	}
+	if set == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s SessionCacheImpl) GetSession(ctx context.Context, sessionID string) (*Session, error) {
+	var (
+		userID *redis.StringCmd
+		fields *redis.MapStringStringCmd
+	)
+	_, err := s.client.Pipelined(
 		ctx, func(pipe redis.Pipeliner) error {
-			pipe.Expire(ctx, key, expire)
-			pipe.Expire(ctx, mapKey, expire)
-			pipe.HSet(ctx, mapKey, sessionID, expireAt.Unix())
+			userID = pipe.Get(ctx, s.userSessionKey(sessionID))
+			fields = pipe.HGetAll(ctx, s.userSessionMetadataKey(sessionID))
 			return nil
 		},
 	)
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get session failed: %w", err)
+	}
+	session := &Session{ID: sessionID}
+	if session.UserID, err = userID.Int64(); err != nil {
+		return nil, fmt.Errorf("get session failed: %w", err)
+	}
+	// Sessions set before the metadata was stored have none.
+	md := fields.Val()
+	session.Metadata = SessionMetadata{IP: md["ip"], UserAgent: md["user_agent"], DeviceName: md["device_name"]}
+	if createdAt, err := strconv.ParseInt(md["created_at"], 10, 64); err == nil {
+		session.Metadata.CreatedAt = time.Unix(createdAt, 0)
+	}
+	if level, err := strconv.Atoi(md["auth_level"]); err == nil {
+		session.Metadata.AuthLevel = AuthLevel(level)
+	}
+	if verifiedAt, err := strconv.ParseInt(md["auth_verified_at"], 10, 64); err == nil {
+		session.Metadata.AuthVerifiedAt = time.Unix(verifiedAt, 0)
+	}
+	return session, nil
+}
+
+func (s SessionCacheImpl) GetUserIDBySessionID(ctx context.Context, sessionID string,
+	expire time.Duration, opts ...SessionOption,
+) (userID int64, err error) {
+	key := s.userSessionKey(sessionID)
+	if userID, err = s.userID(ctx, sessionID); err != nil {
+		return 0, err
+	}
+	var o sessionOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	n := time.Now()
+	refreshed, err := userRefreshSessionScript.Run(
+		ctx, s.client,
+		[]string{key, s.userSessionMetadataKey(sessionID), s.userSessionMapKey(userID)},
+		userID, sessionID, int64(expire.Seconds()), n.Unix(), int64(o.maxLifetime.Seconds()),
+	).Int()
 	if err != nil {
 		return 0, fmt.Errorf("failed to refresh user session: %w", err)
 	}
+	if refreshed == 0 {
+		return 0, ErrSessionNotFound
+	}
 	return userID, nil
 }
 
+// userID returns the user id of the session, or ErrSessionNotFound.
+func (s SessionCacheImpl) userID(ctx context.Context, sessionID string) (int64, error) {
+	userID, err := s.userIDs.Get(ctx, sessionID)
+	if errors.Is(err, cache.ErrNotFound) {
+		return 0, ErrSessionNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get user id by session id failed: %w", err)
+	}
+	return *userID, nil
+}
+
 // NewSessionCacheImpl returns a new SessionCacheImpl.
 func NewSessionCacheImpl(
 	prefix SessionCachePrefix, client redis.UniversalClient,
 ) SessionCache {
-	return &SessionCacheImpl{prefix: prefix, client: client}
+	s := &SessionCacheImpl{prefix: prefix, client: client}
+	s.userIDs = cache.New[int64](client, cache.Options{Prefix: s.userSessionKey("")})
+	return s
 }
@@ -0,0 +1,127 @@
+package authorization
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSessionCache(t *testing.T) (SessionCache, redis.UniversalClient, *mr.Miniredis) {
+	s := mr.RunT(t)
+	client := redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{s.Addr()}})
+	return NewSessionCacheImpl("TEST", client), client, s
+}
+
+func TestSessionCache_DeleteSession(t *testing.T) {
+	ctx := context.Background()
+	cache, client, _ := newTestSessionCache(t)
+
+	require.NoError(t, cache.SetUserSessionID(ctx, "SESSION_A", 1, time.Hour))
+	require.NoError(t, cache.SetUserSessionID(ctx, "SESSION_B", 1, time.Hour))
+
+	require.NoError(t, cache.DeleteSession(ctx, "SESSION_A"))
+	_, err := cache.GetUserIDBySessionID(ctx, "SESSION_A", time.Hour)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	assert.ErrorIs(t, cache.DeleteSession(ctx, "SESSION_A"), ErrSessionNotFound)
+
+	// The other session of the user is untouched.
+	userID, err := cache.GetUserIDBySessionID(ctx, "SESSION_B", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), userID)
+	sessions, err := client.HKeys(ctx, "TEST:USER:SESSION:MAP:1").Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SESSION_B"}, sessions)
+}
+
+func TestSessionCache_GetSession(t *testing.T) {
+	ctx := context.Background()
+	cache, client, _ := newTestSessionCache(t)
+
+	md := SessionMetadata{IP: "203.0.113.7", UserAgent: "Mozilla/5.0", DeviceName: "iPhone"}
+	require.NoError(t, cache.SetUserSessionID(ctx, "SESSION_A", 1, time.Hour, WithSessionMetadata(md)))
+	session, err := cache.GetSession(ctx, "SESSION_A")
+	require.NoError(t, err)
+	assert.Equal(t, "SESSION_A", session.ID)
+	assert.Equal(t, int64(1), session.UserID)
+	assert.Equal(t, md.IP, session.Metadata.IP)
+	assert.Equal(t, md.DeviceName, session.Metadata.DeviceName)
+	assert.WithinDuration(t, time.Now(), session.Metadata.CreatedAt, time.Minute)
+
+	// Sessions set before the metadata was stored still resolve.
+	require.NoError(t, client.Set(ctx, "TEST:USER:SESSION:SESSION_B", 2, time.Hour).Err())
+	session, err = cache.GetSession(ctx, "SESSION_B")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), session.UserID)
+	assert.Zero(t, session.Metadata)
+
+	require.NoError(t, cache.DeleteSession(ctx, "SESSION_A"))
+	_, err = cache.GetSession(ctx, "SESSION_A")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	n, err := client.Exists(ctx, "TEST:USER:SESSION:META:SESSION_A").Result()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestSessionCache_SingleSession(t *testing.T) {
+	ctx := context.Background()
+	cache, client, _ := newTestSessionCache(t)
+
+	require.NoError(t, cache.SetUserSessionID(ctx, "SESSION_A", 1, time.Hour))
+	require.NoError(t, cache.SetUserSessionID(ctx, "SESSION_B", 1, time.Hour))
+	require.NoError(t, cache.SetUserSessionID(ctx, "SESSION_C", 2, time.Hour))
+	require.NoError(t, cache.SetUserSessionID(ctx, "SESSION_D", 1, time.Hour, WithSingleSession()))
+
+	for _, sessionID := range []string{"SESSION_A", "SESSION_B"} {
+		_, err := cache.GetUserIDBySessionID(ctx, sessionID, time.Hour)
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+		_, err = cache.GetSession(ctx, sessionID)
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+	}
+	userID, err := cache.GetUserIDBySessionID(ctx, "SESSION_D", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), userID)
+	sessions, err := client.HKeys(ctx, "TEST:USER:SESSION:MAP:1").Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SESSION_D"}, sessions)
+
+	// Other users are untouched.
+	userID, err = cache.GetUserIDBySessionID(ctx, "SESSION_C", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), userID)
+}
+
+func TestSessionCache_MaxLifetime(t *testing.T) {
+	ctx := context.Background()
+	cache, client, s := newTestSessionCache(t)
+
+	require.NoError(t, cache.SetUserSessionID(ctx, "SESSION_A", 1, time.Hour))
+	metaKey := "TEST:USER:SESSION:META:SESSION_A"
+	createdAt := time.Now().Add(-50 * time.Minute).Unix()
+	require.NoError(t, client.HSet(ctx, metaKey, "created_at", createdAt).Err())
+
+	// The refresh is capped at the max lifetime.
+	userID, err := cache.GetUserIDBySessionID(ctx, "SESSION_A", time.Hour, WithMaxLifetime(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), userID)
+	assert.InDelta(t, 10*time.Minute, s.TTL("TEST:USER:SESSION:SESSION_A"), float64(5*time.Second))
+
+	// Without a max lifetime the idle expiration applies.
+	_, err = cache.GetUserIDBySessionID(ctx, "SESSION_A", time.Hour)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour, s.TTL("TEST:USER:SESSION:SESSION_A"), float64(5*time.Second))
+
+	// Past the max lifetime the session ends.
+	require.NoError(t, client.HSet(ctx, metaKey, "created_at", time.Now().Add(-2*time.Hour).Unix()).Err())
+	_, err = cache.GetUserIDBySessionID(ctx, "SESSION_A", time.Hour, WithMaxLifetime(time.Hour))
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	_, err = cache.GetSession(ctx, "SESSION_A")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	sessions, err := client.HKeys(ctx, "TEST:USER:SESSION:MAP:1").Result()
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
@@ -0,0 +1,141 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// ImpersonateUserHeader is the default header carrying the id of the user to act as.
+const ImpersonateUserHeader HTTPHeaderAccessPermissionHeader = "X-Impersonate-User"
+
+// ErrInvalidImpersonation is the error that the impersonated user id is malformed.
+var ErrInvalidImpersonation = bizerrors.New(400, "AUTHORIZATION_INVALID_IMPERSONATION", "invalid impersonation")
+
+// ImpersonationEvent is the audit record of a request made as another user.
+type ImpersonationEvent struct {
+	// ActorID is the id of the authenticated user acting as UserID.
+	ActorID   int64
+	UserID    int64
+	Operation string
+	Time      time.Time
+}
+
+// ImpersonationAuditor records the impersonation events, e.g. in an audit log table. A
+// failed record fails the request, so no impersonation goes unrecorded.
+type ImpersonationAuditor interface {
+	AuditImpersonation(ctx context.Context, event *ImpersonationEvent) error
+}
+
+// ImpersonationAuditorFunc is an ImpersonationAuditor function.
+type ImpersonationAuditorFunc func(ctx context.Context, event *ImpersonationEvent) error
+
+// AuditImpersonation implements ImpersonationAuditor.
+func (f ImpersonationAuditorFunc) AuditImpersonation(ctx context.Context, event *ImpersonationEvent) error {
+	return f(ctx, event)
+}
+
+// ImpersonationPermissionFunc reports whether the user may act as other users, e.g. with
+// rbac.HasPermission(ctx, actorID, "users:impersonate").
+type ImpersonationPermissionFunc func(ctx context.Context, actorID int64) (bool, error)
+
+// impersonatorKey is the context key for the impersonator value.
+type impersonatorKey struct{}
+
+// impersonator is the authenticated user acting as another user.
+type impersonator struct {
+	id   int64
+	user any
+}
+
+// ImpersonatorIDFromContext returns the id of the authenticated user of an impersonated
+// request, UserIDFromContext returns the impersonated user.
+func ImpersonatorIDFromContext(ctx context.Context) (int64, bool) {
+	i, ok := ctx.Value(impersonatorKey{}).(impersonator)
+	return i.id, ok
+}
+
+// ImpersonatorFromContext returns the authenticated user of an impersonated request,
+// UserFromContext returns the impersonated user.
+func ImpersonatorFromContext[T any](ctx context.Context) *T {
+	i, _ := ctx.Value(impersonatorKey{}).(impersonator)
+	user, _ := i.user.(*T)
+	return user
+}
+
+// Impersonation lets permitted users act as other users with the user id of a header.
+// Its builder is used after the authenticate builders and before the authorization
+// ones, which then check the impersonated user.
+type Impersonation[T any] struct {
+	header      HTTPHeaderAccessPermissionHeader
+	provisioner AccessPermissionProvisioner[T]
+	allowed     ImpersonationPermissionFunc
+	auditor     ImpersonationAuditor
+}
+
+// NewImpersonation creates a new Impersonation, reading ImpersonateUserHeader when header
+// is empty.
+func NewImpersonation[T any](
+	header HTTPHeaderAccessPermissionHeader,
+	provisioner AccessPermissionProvisioner[T],
+	allowed ImpersonationPermissionFunc,
+	auditor ImpersonationAuditor,
+) *Impersonation[T] {
+	if header == "" {
+		header = ImpersonateUserHeader
+	}
+	return &Impersonation[T]{header: header, provisioner: provisioner, allowed: allowed, auditor: auditor}
+}
+
+// ImpersonateBuilder returns the builder of the middleware switching to the user of the
+// header, it returns ErrPermissionDenied when the user may not impersonate.
+func (i *Impersonation[T]) ImpersonateBuilder(errorMap map[error]error) *selector.Builder {
+	return selector.Server(errorMappingMiddleware(errorMap), i.middleware)
+}
+
+func (i *Impersonation[T]) middleware(handler middleware.Handler) middleware.Handler {
+	return func(ctx context.Context, req any) (any, error) {
+		tr, ok := transport.FromServerContext(ctx)
+		if !ok {
+			return handler(ctx, req)
+		}
+		value := tr.RequestHeader().Get(string(i.header))
+		if value == "" {
+			return handler(ctx, req)
+		}
+		actorID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthenticated
+		}
+		userID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidImpersonation
+		}
+		if userID == actorID {
+			return handler(ctx, req)
+		}
+		allowed, err := i.allowed(ctx, actorID)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, ErrPermissionDenied
+		}
+		user, err := i.provisioner.GetUserByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		event := &ImpersonationEvent{ActorID: actorID, UserID: userID, Operation: tr.Operation(), Time: time.Now()}
+		if err = i.auditor.AuditImpersonation(ctx, event); err != nil {
+			return nil, fmt.Errorf("audit impersonation failed: %w", err)
+		}
+		ctx = context.WithValue(ctx, impersonatorKey{}, impersonator{id: actorID, user: UserFromContext[T](ctx)})
+		return handler(NewUserIDContext(NewUserContext(ctx, user), userID), req)
+	}
+}
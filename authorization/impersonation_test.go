@@ -0,0 +1,97 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImpersonation(t *testing.T) {
+	rbac := NewRBAC(&testRoleProvider{
+		roles:       map[int64][]string{1: {"support"}},
+		permissions: map[string][]string{"support": {"users:impersonate"}},
+	})
+	var events []*ImpersonationEvent
+	impersonation := NewImpersonation("", NewTestUserAccessPermissionProvisioner(),
+		func(ctx context.Context, actorID int64) (bool, error) {
+			return rbac.HasPermission(ctx, actorID, "users:impersonate")
+		},
+		ImpersonationAuditorFunc(func(ctx context.Context, event *ImpersonationEvent) error {
+			events = append(events, event)
+			return nil
+		}),
+	)
+	errorMap := map[error]error{
+		ErrUnauthenticated:      errors.Unauthorized("UNAUTHORIZED", "unauthenticated"),
+		ErrPermissionDenied:     errors.Forbidden("FORBIDDEN", "permission denied"),
+		ErrInvalidImpersonation: errors.BadRequest("BAD_REQUEST", "invalid impersonation"),
+	}
+	// testUserMiddleware authenticates the TestUser of the X-User-ID header.
+	testUserMiddleware := func(handler middleware.Handler) middleware.Handler {
+		return testUserIDMiddleware(func(ctx context.Context, req any) (any, error) {
+			if userID, ok := UserIDFromContext(ctx); ok {
+				ctx = NewUserContext(ctx, &TestUser{ID: userID})
+			}
+			return handler(ctx, req)
+		})
+	}
+	srv := http.NewServer(http.Middleware(
+		testUserMiddleware,
+		impersonation.ImpersonateBuilder(errorMap).Path("/v1/me").Build(),
+	))
+	srv.Route("/v1").GET("/me", func(c http.Context) error {
+		http.SetOperation(c, "/v1/me")
+		h := c.Middleware(func(ctx context.Context, req any) (any, error) {
+			out := map[string]int64{"user": UserFromContext[TestUser](ctx).ID}
+			if actorID, ok := ImpersonatorIDFromContext(ctx); ok {
+				out["actor"] = actorID
+				out["actor_user"] = ImpersonatorFromContext[TestUser](ctx).ID
+			}
+			return out, nil
+		})
+		out, err := h(c, nil)
+		if err != nil {
+			return err
+		}
+		return c.Result(stdhttp.StatusOK, out)
+	})
+	get := func(userID, impersonate string) (int, map[string]int64) {
+		req := httptest.NewRequest(stdhttp.MethodGet, "http://127.0.0.1:8000/v1/me", nil)
+		req.Header.Set("X-User-ID", userID)
+		req.Header.Set("X-Impersonate-User", impersonate)
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		var out map[string]int64
+		_ = json.Unmarshal(rw.Body.Bytes(), &out)
+		return rw.Code, out
+	}
+
+	code, out := get("1", "")
+	assert.Equal(t, stdhttp.StatusOK, code)
+	assert.Equal(t, map[string]int64{"user": 1}, out)
+	assert.Empty(t, events)
+
+	code, out = get("1", "7")
+	assert.Equal(t, stdhttp.StatusOK, code)
+	assert.Equal(t, map[string]int64{"user": 7, "actor": 1, "actor_user": 1}, out)
+	require.Len(t, events, 1)
+	assert.Equal(t, int64(1), events[0].ActorID)
+	assert.Equal(t, int64(7), events[0].UserID)
+	assert.Equal(t, "/v1/me", events[0].Operation)
+
+	code, _ = get("2", "7")
+	assert.Equal(t, stdhttp.StatusForbidden, code)
+	code, _ = get("", "7")
+	assert.Equal(t, stdhttp.StatusUnauthorized, code)
+	code, _ = get("1", "not-a-user")
+	assert.Equal(t, stdhttp.StatusBadRequest, code)
+	assert.Len(t, events, 1)
+}
@@ -0,0 +1,390 @@
+package authorization
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrInvalidToken is the error that the token is malformed or its signature is invalid.
+	ErrInvalidToken = bizerrors.New(401, "AUTHORIZATION_INVALID_TOKEN", "invalid token")
+	// ErrTokenExpired is the error that the token is expired.
+	ErrTokenExpired = bizerrors.New(401, "AUTHORIZATION_TOKEN_EXPIRED", "token expired")
+	// ErrTokenRevoked is the error that the token was revoked before it expired.
+	ErrTokenRevoked = bizerrors.New(401, "AUTHORIZATION_TOKEN_REVOKED", "token revoked")
+)
+
+// JWTAlgorithm is the signing algorithm of a JWTKey.
+type JWTAlgorithm string
+
+const (
+	// JWTHS256 is HMAC with SHA-256, the key is a shared Secret.
+	JWTHS256 JWTAlgorithm = "HS256"
+	// JWTRS256 is RSASSA-PKCS1-v1_5 with SHA-256, the key is an RSA key pair.
+	JWTRS256 JWTAlgorithm = "RS256"
+)
+
+// JWTKey is a signing key of a JWTSessionCodec. Verifying instances of RS256 keys only
+// need the PublicKey.
+type JWTKey struct {
+	ID         string // Key id, the kid header of the tokens
+	Algorithm  JWTAlgorithm
+	Secret     []byte          // HS256
+	PrivateKey *rsa.PrivateKey // RS256 signing
+	PublicKey  *rsa.PublicKey  // RS256 verification, the public key of PrivateKey when nil
+}
+
+// JWTConfig is the config of a JWTSessionCodec.
+type JWTConfig struct {
+	// CurrentKey is the id of the key signing new tokens. To rotate, add the new key,
+	// make it current once every instance has it, and remove the old one after the
+	// lifetime of the tokens.
+	CurrentKey string
+	Keys       []JWTKey
+	// Issuer and Audience are optional, when set they are written and required.
+	Issuer   string
+	Audience string
+	// Leeway is the clock skew tolerated on the expiry.
+	Leeway time.Duration
+}
+
+// JWTClaims are the claims of a session token.
+type JWTClaims struct {
+	ID        string `json:"jti"` // Session id, the key of a revocation
+	Subject   string `json:"sub"` // User id
+	Issuer    string `json:"iss,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// UserID returns the user id of the subject.
+func (c *JWTClaims) UserID() (int64, error) {
+	id, err := strconv.ParseInt(c.Subject, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: subject is not a user id", ErrInvalidToken)
+	}
+	return id, nil
+}
+
+// jwtHeader is the JOSE header of a token.
+type jwtHeader struct {
+	Algorithm JWTAlgorithm `json:"alg"`
+	Type      string       `json:"typ"`
+	KeyID     string       `json:"kid"`
+}
+
+// JWTSessionCodec issues and validates stateless session tokens, signed JWTs carrying
+// the session and user id. Validation needs no Redis hit.
+type JWTSessionCodec struct {
+	cfg  JWTConfig
+	keys map[string]JWTKey
+}
+
+// NewJWTSessionCodec creates a JWTSessionCodec, it returns ErrInvalidConfig when the
+// current key is missing or a key lacks the material of its algorithm.
+func NewJWTSessionCodec(cfg JWTConfig) (*JWTSessionCodec, error) {
+	keys := make(map[string]JWTKey, len(cfg.Keys))
+	for _, k := range cfg.Keys {
+		switch k.Algorithm {
+		case JWTHS256:
+			if len(k.Secret) < sha256.Size {
+				return nil, fmt.Errorf("%w: jwt key %q secret is shorter than 32 bytes", ErrInvalidConfig, k.ID)
+			}
+		case JWTRS256:
+			if k.PublicKey == nil && k.PrivateKey != nil {
+				k.PublicKey = &k.PrivateKey.PublicKey
+			}
+			if k.PublicKey == nil {
+				return nil, fmt.Errorf("%w: jwt key %q has no rsa key", ErrInvalidConfig, k.ID)
+			}
+		default:
+			return nil, fmt.Errorf("%w: jwt key %q has unsupported algorithm %q", ErrInvalidConfig, k.ID, k.Algorithm)
+		}
+		keys[k.ID] = k
+	}
+	current, ok := keys[cfg.CurrentKey]
+	if !ok {
+		return nil, fmt.Errorf("%w: current jwt key %q is missing", ErrInvalidConfig, cfg.CurrentKey)
+	}
+	if current.Algorithm == JWTRS256 && current.PrivateKey == nil {
+		return nil, fmt.Errorf("%w: current jwt key %q has no private key", ErrInvalidConfig, cfg.CurrentKey)
+	}
+	return &JWTSessionCodec{cfg: cfg, keys: keys}, nil
+}
+
+// Encode issues a token of the session of userID valid for expire, signed with the
+// current key.
+func (c *JWTSessionCodec) Encode(sessionID string, userID int64, expire time.Duration) (string, error) {
+	now := time.Now()
+	return c.sign(&JWTClaims{
+		ID: sessionID, Subject: strconv.FormatInt(userID, 10),
+		Issuer: c.cfg.Issuer, Audience: c.cfg.Audience,
+		IssuedAt: now.Unix(), ExpiresAt: now.Add(expire).Unix(),
+	})
+}
+
+// sign encodes and signs claims with the current key.
+func (c *JWTSessionCodec) sign(claims *JWTClaims) (string, error) {
+	key := c.keys[c.cfg.CurrentKey]
+	header, err := json.Marshal(jwtHeader{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	var signature []byte
+	switch key.Algorithm {
+	case JWTHS256:
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case JWTRS256:
+		digest := sha256.Sum256([]byte(signingInput))
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key.PrivateKey, crypto.SHA256, digest[:]); err != nil {
+			return "", fmt.Errorf("sign jwt failed: %w", err)
+		}
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Decode validates token and returns its claims. It returns ErrInvalidToken for
+// malformed tokens, unknown keys, invalid signatures or a wrong issuer or audience, and
+// ErrTokenExpired for expired tokens.
+func (c *JWTSessionCodec) Decode(token string) (*JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	var header jwtHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	key, ok := c.keys[header.KeyID]
+	// The algorithm is pinned by the key, not chosen by the token.
+	if !ok || header.Algorithm != key.Algorithm {
+		return nil, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	signingInput := parts[0] + "." + parts[1]
+	switch key.Algorithm {
+	case JWTHS256:
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, ErrInvalidToken
+		}
+	case JWTRS256:
+		digest := sha256.Sum256([]byte(signingInput))
+		if rsa.VerifyPKCS1v15(key.PublicKey, crypto.SHA256, digest[:], signature) != nil {
+			return nil, ErrInvalidToken
+		}
+	}
+	var claims JWTClaims
+	if err = decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if claims.Issuer != c.cfg.Issuer || claims.Audience != c.cfg.Audience {
+		return nil, ErrInvalidToken
+	}
+	if !time.Now().Before(time.Unix(claims.ExpiresAt, 0).Add(c.cfg.Leeway)) {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+// decodeJWTSegment decodes a base64url JSON segment of a token into v.
+func decodeJWTSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// JWTRevocationList records the tokens revoked before they expire, e.g. on logout.
+type JWTRevocationList interface {
+	// Revoke revokes the token of claims until it expires.
+	Revoke(ctx context.Context, claims *JWTClaims) error
+	// IsRevoked reports whether the token of claims was revoked.
+	IsRevoked(ctx context.Context, claims *JWTClaims) (bool, error)
+}
+
+// RedisJWTRevocationList is a JWTRevocationList keeping the revoked session ids in
+// Redis until the tokens expire.
+type RedisJWTRevocationList struct {
+	prefix SessionCachePrefix
+	client redis.UniversalClient
+}
+
+// Compile-time assertion: RedisJWTRevocationList implements JWTRevocationList.
+var _ JWTRevocationList = (*RedisJWTRevocationList)(nil)
+
+// NewRedisJWTRevocationList returns a new RedisJWTRevocationList.
+func NewRedisJWTRevocationList(prefix SessionCachePrefix, client redis.UniversalClient) *RedisJWTRevocationList {
+	return &RedisJWTRevocationList{prefix: prefix, client: client}
+}
+
+func (r *RedisJWTRevocationList) revokedKey(sessionID string) string {
+	return fmt.Sprintf("%s:USER:JWT:REVOKED:%s", r.prefix, sessionID)
+}
+
+func (r *RedisJWTRevocationList) Revoke(ctx context.Context, claims *JWTClaims) error {
+	expireAt := time.Unix(claims.ExpiresAt, 0)
+	if !time.Now().Before(expireAt) {
+		return nil
+	}
+	err := r.client.SetArgs(ctx, r.revokedKey(claims.ID), 1, redis.SetArgs{ExpireAt: expireAt}).Err()
+	if err != nil {
+		return fmt.Errorf("revoke jwt failed: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisJWTRevocationList) IsRevoked(ctx context.Context, claims *JWTClaims) (bool, error) {
+	n, err := r.client.Exists(ctx, r.revokedKey(claims.ID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("check jwt revocation failed: %w", err)
+	}
+	return n > 0, nil
+}
+
+// jwtClaimsKey is the context key for the JWTClaims value.
+type jwtClaimsKey struct{}
+
+// JWTClaimsFromContext returns the JWTClaims of the authenticated request, nil when the
+// request was not authenticated by a JWTAccessPermission.
+func JWTClaimsFromContext(ctx context.Context) *JWTClaims {
+	claims, _ := ctx.Value(jwtClaimsKey{}).(*JWTClaims)
+	return claims
+}
+
+// JWTAccessPermission is the access permission of stateless JWT sessions, the token is
+// read from the header and validated by the codec. With a revocation list every request
+// checks it, trading one Redis hit for immediate logout.
+type JWTAccessPermission[T any] struct {
+	header      HTTPHeaderAccessPermissionHeader
+	codec       *JWTSessionCodec
+	revocations JWTRevocationList
+	provisioner AccessPermissionProvisioner[T]
+	opts        httpHeaderAccessPermissionOptions
+}
+
+// Compile-time assertion: JWTAccessPermission implements AccessPermission.
+var _ AccessPermission = (*JWTAccessPermission[struct{}])(nil)
+
+// NewJWTAccessPermission creates a new JWT access permission, revocations is optional.
+// Of the options only WithBearerToken applies.
+func NewJWTAccessPermission[T any](
+	header HTTPHeaderAccessPermissionHeader,
+	codec *JWTSessionCodec,
+	revocations JWTRevocationList,
+	provisioner AccessPermissionProvisioner[T],
+	opts ...HTTPHeaderAccessPermissionOption,
+) AccessPermission {
+	u := &JWTAccessPermission[T]{
+		header:      header,
+		codec:       codec,
+		revocations: revocations,
+		provisioner: provisioner,
+	}
+	for _, opt := range opts {
+		opt(&u.opts)
+	}
+	return u
+}
+
+func (u *JWTAccessPermission[T]) UserAuthenticateBuilder(errorMap map[error]error) *selector.Builder {
+	return selector.Server(errorMappingMiddleware(errorMap), u.middleware(false))
+}
+
+func (u *JWTAccessPermission[T]) OptionalUserAuthenticateBuilder(errorMap map[error]error) *selector.Builder {
+	return selector.Server(errorMappingMiddleware(errorMap), u.middleware(true))
+}
+
+// middleware authenticates the token, optional requests without a valid token go on
+// without user.
+func (u *JWTAccessPermission[T]) middleware(optional bool) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			// Skip if the user is already in the context.
+			if originUser := UserFromContext[T](ctx); originUser != nil {
+				return handler(ctx, req)
+			}
+			var token string
+			if tr, ok := transport.FromServerContext(ctx); ok {
+				token = requestToken(tr.RequestHeader(), u.header, u.opts.bearer)
+			}
+			if token == "" {
+				if optional {
+					return handler(ctx, req)
+				}
+				return nil, ErrHTTPHeaderNotFound
+			}
+			claims, err := u.authenticate(ctx, token)
+			if optional && (errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrTokenExpired) ||
+				errors.Is(err, ErrTokenRevoked)) {
+				return handler(ctx, req)
+			}
+			if err != nil {
+				return nil, err
+			}
+			userID, err := claims.UserID()
+			if err != nil {
+				return nil, err
+			}
+			user, err := u.provisioner.GetUserByID(ctx, userID)
+			if err != nil {
+				return nil, err
+			}
+			ctx = context.WithValue(NewUserIDContext(NewUserContext(ctx, user), userID), jwtClaimsKey{}, claims)
+			return handler(ctx, req)
+		}
+	}
+}
+
+// authenticate decodes token and checks it was not revoked.
+func (u *JWTAccessPermission[T]) authenticate(ctx context.Context, token string) (*JWTClaims, error) {
+	claims, err := u.codec.Decode(token)
+	if err != nil {
+		return nil, err
+	}
+	if u.revocations == nil {
+		return claims, nil
+	}
+	revoked, err := u.revocations.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
@@ -0,0 +1,122 @@
+package authorization
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTSessionCodec(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	hs := JWTKey{ID: "hs-1", Algorithm: JWTHS256, Secret: []byte(strings.Repeat("s", 32))}
+	rs := JWTKey{ID: "rs-1", Algorithm: JWTRS256, PrivateKey: rsaKey}
+
+	old, err := NewJWTSessionCodec(JWTConfig{CurrentKey: "hs-1", Keys: []JWTKey{hs}, Issuer: "app"})
+	require.NoError(t, err)
+	token, err := old.Encode("SESSION_A", 7, time.Hour)
+	require.NoError(t, err)
+
+	// After the rotation the tokens of the previous key still validate.
+	codec, err := NewJWTSessionCodec(JWTConfig{CurrentKey: "rs-1", Keys: []JWTKey{hs, rs}, Issuer: "app"})
+	require.NoError(t, err)
+	claims, err := codec.Decode(token)
+	require.NoError(t, err)
+	assert.Equal(t, "SESSION_A", claims.ID)
+	userID, err := claims.UserID()
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), userID)
+
+	token, err = codec.Encode("SESSION_B", 8, time.Hour)
+	require.NoError(t, err)
+	claims, err = codec.Decode(token)
+	require.NoError(t, err)
+	assert.Equal(t, "8", claims.Subject)
+	_, err = old.Decode(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	parts := strings.Split(token, ".")
+	_, err = codec.Decode(parts[0] + "." + parts[1] + "x." + parts[2])
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	other, err := NewJWTSessionCodec(JWTConfig{CurrentKey: "rs-1", Keys: []JWTKey{rs}, Issuer: "other"})
+	require.NoError(t, err)
+	_, err = other.Decode(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	token, err = codec.Encode("SESSION_C", 9, -time.Minute)
+	require.NoError(t, err)
+	_, err = codec.Decode(token)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+
+	_, err = NewJWTSessionCodec(JWTConfig{CurrentKey: "hs-2", Keys: []JWTKey{hs}})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = NewJWTSessionCodec(JWTConfig{CurrentKey: "hs-1",
+		Keys: []JWTKey{{ID: "hs-1", Algorithm: JWTHS256, Secret: []byte("short")}}})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = NewJWTSessionCodec(JWTConfig{CurrentKey: "rs-1",
+		Keys: []JWTKey{{ID: "rs-1", Algorithm: JWTRS256, PublicKey: &rsaKey.PublicKey}}})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
+
+func TestJWTAccessPermission(t *testing.T) {
+	ctx := context.Background()
+	_, client, _ := newTestSessionCache(t)
+	codec, err := NewJWTSessionCodec(JWTConfig{CurrentKey: "hs-1",
+		Keys: []JWTKey{{ID: "hs-1", Algorithm: JWTHS256, Secret: []byte(strings.Repeat("s", 32))}}})
+	require.NoError(t, err)
+	revocations := NewRedisJWTRevocationList("TEST", client)
+	accessPermission := NewJWTAccessPermission[TestUser]("X-Session", codec, revocations,
+		NewTestUserAccessPermissionProvisioner(), WithBearerToken())
+
+	unauthorized := errors.Unauthorized("UNAUTHORIZED", "unauthorized")
+	errorMap := map[error]error{ErrInvalidToken: unauthorized, ErrTokenRevoked: unauthorized}
+	srv := http.NewServer(http.Middleware(accessPermission.UserAuthenticateBuilder(errorMap).Path("/v1/me").Build()))
+	srv.Route("/v1").GET("/me", func(c http.Context) error {
+		h := c.Middleware(func(ctx context.Context, req any) (any, error) {
+			return fmt.Sprintf("%d:%s", UserFromContext[TestUser](ctx).ID, JWTClaimsFromContext(ctx).ID), nil
+		})
+		out, err := h(c, nil)
+		if err != nil {
+			return err
+		}
+		return c.Result(stdhttp.StatusOK, out)
+	})
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(stdhttp.MethodGet, "http://127.0.0.1:8000/v1/me", nil)
+		req.Header.Set("Authorization", "bearer "+token)
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw
+	}
+
+	token, err := codec.Encode("SESSION_A", 7, time.Hour)
+	require.NoError(t, err)
+	rw := get(token)
+	assert.Equal(t, stdhttp.StatusOK, rw.Code)
+	assert.Equal(t, `"7:SESSION_A"`, rw.Body.String())
+	assert.Equal(t, stdhttp.StatusUnauthorized, get("not-a-token").Code)
+
+	// Without a bearer token the custom header is read.
+	req := httptest.NewRequest(stdhttp.MethodGet, "http://127.0.0.1:8000/v1/me", nil)
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	req.Header.Set("X-Session", token)
+	rw = httptest.NewRecorder()
+	srv.ServeHTTP(rw, req)
+	assert.Equal(t, stdhttp.StatusOK, rw.Code)
+
+	claims, err := codec.Decode(token)
+	require.NoError(t, err)
+	require.NoError(t, revocations.Revoke(ctx, claims))
+	assert.Equal(t, stdhttp.StatusUnauthorized, get(token).Code)
+}
@@ -0,0 +1,24 @@
+package authorization
+
+import (
+	"github.com/google/wire"
+	"go.uber.org/fx"
+)
+
+// ProviderSet is the wire provider set of the session components. The access permission
+// is generic over the user type and is provided by the application, e.g.
+// wire.NewSet(authorization.ProviderSet, authorization.NewHTTPHeaderAccessPermission[User]).
+var ProviderSet = wire.NewSet(
+	NewSessionCacheImpl,
+	NewDefaultSessionGenerator,
+	NewHTTPHeaderAccessPermissionRefreshSessionExpireTime,
+)
+
+// Module is the fx equivalent of ProviderSet.
+var Module = fx.Options(
+	fx.Provide(
+		NewSessionCacheImpl,
+		NewDefaultSessionGenerator,
+		NewHTTPHeaderAccessPermissionRefreshSessionExpireTime,
+	),
+)
@@ -0,0 +1,213 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrUnauthenticated is the error that an authorization check found no authenticated user.
+	ErrUnauthenticated = bizerrors.New(401, "AUTHORIZATION_UNAUTHENTICATED", "unauthenticated")
+	// ErrPermissionDenied is the error that the user lacks the required role or permission.
+	ErrPermissionDenied = bizerrors.New(403, "AUTHORIZATION_PERMISSION_DENIED", "permission denied")
+)
+
+// RoleProvider provides the roles of the users and the permissions of the roles, e.g.
+// from the user service.
+type RoleProvider interface {
+	// GetUserRoles gets the roles of the user.
+	GetUserRoles(ctx context.Context, userID int64) ([]string, error)
+	// GetRolePermissions gets the permissions granted by the role.
+	GetRolePermissions(ctx context.Context, role string) ([]string, error)
+}
+
+// RoleCache is a RoleProvider caching the roles and permissions of another one in Redis.
+// Call InvalidateUser after changing the roles of a user and InvalidateRole after
+// changing the permissions of a role, other changes show once the cache expires.
+type RoleCache struct {
+	prefix SessionCachePrefix
+	client redis.UniversalClient
+	next   RoleProvider
+	expire time.Duration
+}
+
+// Compile-time assertion: RoleCache implements RoleProvider.
+var _ RoleProvider = (*RoleCache)(nil)
+
+// NewRoleCache returns a new RoleCache in front of next, caching for expire.
+func NewRoleCache(prefix SessionCachePrefix, client redis.UniversalClient, next RoleProvider,
+	expire time.Duration,
+) *RoleCache {
+	return &RoleCache{prefix: prefix, client: client, next: next, expire: expire}
+}
+
+func (c *RoleCache) userRolesKey(userID int64) string {
+	return fmt.Sprintf("%s:USER:ROLES:%d", c.prefix, userID)
+}
+
+func (c *RoleCache) rolePermissionsKey(role string) string {
+	return fmt.Sprintf("%s:ROLE:PERMISSIONS:%s", c.prefix, role)
+}
+
+func (c *RoleCache) GetUserRoles(ctx context.Context, userID int64) ([]string, error) {
+	return c.cached(ctx, c.userRolesKey(userID), func() ([]string, error) {
+		return c.next.GetUserRoles(ctx, userID)
+	})
+}
+
+func (c *RoleCache) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	return c.cached(ctx, c.rolePermissionsKey(role), func() ([]string, error) {
+		return c.next.GetRolePermissions(ctx, role)
+	})
+}
+
+// InvalidateUser drops the cached roles of the user.
+func (c *RoleCache) InvalidateUser(ctx context.Context, userID int64) error {
+	if err := c.client.Del(ctx, c.userRolesKey(userID)).Err(); err != nil {
+		return fmt.Errorf("invalidate user roles failed: %w", err)
+	}
+	return nil
+}
+
+// InvalidateRole drops the cached permissions of the role.
+func (c *RoleCache) InvalidateRole(ctx context.Context, role string) error {
+	if err := c.client.Del(ctx, c.rolePermissionsKey(role)).Err(); err != nil {
+		return fmt.Errorf("invalidate role permissions failed: %w", err)
+	}
+	return nil
+}
+
+// cached returns the list under key, loading and caching it on a miss. A Redis failure
+// falls through to load.
+func (c *RoleCache) cached(ctx context.Context, key string, load func() ([]string, error)) ([]string, error) {
+	data, err := c.client.Get(ctx, key).Bytes()
+	if err == nil {
+		var values []string
+		if err = json.Unmarshal(data, &values); err == nil {
+			return values, nil
+		}
+	}
+	values, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if data, err = json.Marshal(values); err == nil {
+		_ = c.client.Set(ctx, key, data, c.expire).Err()
+	}
+	return values, nil
+}
+
+// RBAC authorizes the users authenticated by an access permission by their roles. Its
+// builders are used after the authenticate builders, e.g.
+// rbac.RequireRole(errorMap, "admin").Prefix("/admin/").Build().
+type RBAC struct {
+	provider RoleProvider
+}
+
+// NewRBAC creates a new RBAC.
+func NewRBAC(provider RoleProvider) *RBAC {
+	return &RBAC{provider: provider}
+}
+
+// RequireRole returns the builder of the middleware requiring one of roles.
+func (r *RBAC) RequireRole(errorMap map[error]error, roles ...string) *selector.Builder {
+	hasRole := func(ctx context.Context, userID int64) (bool, error) {
+		userRoles, err := r.provider.GetUserRoles(ctx, userID)
+		if err != nil {
+			return false, err
+		}
+		return slices.ContainsFunc(userRoles, func(role string) bool { return slices.Contains(roles, role) }), nil
+	}
+	return selector.Server(errorMappingMiddleware(errorMap), r.require(hasRole))
+}
+
+// RequirePermission returns the builder of the middleware requiring all permissions,
+// granted by any of the roles of the user.
+func (r *RBAC) RequirePermission(errorMap map[error]error, permissions ...string) *selector.Builder {
+	hasPermissions := func(ctx context.Context, userID int64) (bool, error) {
+		granted, err := r.permissions(ctx, userID)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range permissions {
+			if !granted[p] {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	return selector.Server(errorMappingMiddleware(errorMap), r.require(hasPermissions))
+}
+
+// HasPermission reports whether the user was granted permission by one of their roles,
+// for checks inside handlers.
+func (r *RBAC) HasPermission(ctx context.Context, userID int64, permission string) (bool, error) {
+	granted, err := r.permissions(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return granted[permission], nil
+}
+
+// GrantedScopes is the GrantedScopesFunc of the permissions of the authenticated user,
+// for OperationScopes declaring permissions as scopes.
+func (r *RBAC) GrantedScopes(ctx context.Context) ([]string, error) {
+	userID, ok := UserIDFromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	granted, err := r.permissions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Sorted(maps.Keys(granted)), nil
+}
+
+// permissions returns the set of the permissions of the roles of the user.
+func (r *RBAC) permissions(ctx context.Context, userID int64) (map[string]bool, error) {
+	roles, err := r.provider.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	granted := map[string]bool{}
+	for _, role := range roles {
+		permissions, err := r.provider.GetRolePermissions(ctx, role)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range permissions {
+			granted[p] = true
+		}
+	}
+	return granted, nil
+}
+
+// require returns the middleware calling the handler when allowed reports true for the
+// authenticated user.
+func (r *RBAC) require(allowed func(ctx context.Context, userID int64) (bool, error)) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			userID, ok := UserIDFromContext(ctx)
+			if !ok {
+				return nil, ErrUnauthenticated
+			}
+			ok, err := allowed(ctx, userID)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, ErrPermissionDenied
+			}
+			return handler(ctx, req)
+		}
+	}
+}
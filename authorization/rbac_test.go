@@ -0,0 +1,109 @@
+package authorization
+
+import (
+	"context"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testRoleProvider struct {
+	roles       map[int64][]string
+	permissions map[string][]string
+	calls       int
+}
+
+func (p *testRoleProvider) GetUserRoles(_ context.Context, userID int64) ([]string, error) {
+	p.calls++
+	return p.roles[userID], nil
+}
+
+func (p *testRoleProvider) GetRolePermissions(_ context.Context, role string) ([]string, error) {
+	p.calls++
+	return p.permissions[role], nil
+}
+
+// testUserIDMiddleware authenticates the user id of the X-User-ID header.
+func testUserIDMiddleware(handler middleware.Handler) middleware.Handler {
+	return func(ctx context.Context, req any) (any, error) {
+		if tr, ok := transport.FromServerContext(ctx); ok {
+			if userID, err := strconv.ParseInt(tr.RequestHeader().Get("X-User-ID"), 10, 64); err == nil {
+				ctx = NewUserIDContext(ctx, userID)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+func TestRoleCache(t *testing.T) {
+	ctx := context.Background()
+	_, client, _ := newTestSessionCache(t)
+	provider := &testRoleProvider{roles: map[int64][]string{1: {"admin"}}}
+	cache := NewRoleCache("TEST", client, provider, time.Hour)
+
+	for range 2 {
+		roles, err := cache.GetUserRoles(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"admin"}, roles)
+	}
+	assert.Equal(t, 1, provider.calls)
+
+	provider.roles[1] = []string{"viewer"}
+	require.NoError(t, cache.InvalidateUser(ctx, 1))
+	roles, err := cache.GetUserRoles(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"viewer"}, roles)
+	assert.Equal(t, 2, provider.calls)
+}
+
+func TestRBAC(t *testing.T) {
+	rbac := NewRBAC(&testRoleProvider{
+		roles:       map[int64][]string{1: {"admin"}, 2: {"editor", "viewer"}},
+		permissions: map[string][]string{"editor": {"posts:write"}, "viewer": {"posts:read"}},
+	})
+	errorMap := map[error]error{
+		ErrUnauthenticated:  errors.Unauthorized("UNAUTHORIZED", "unauthenticated"),
+		ErrPermissionDenied: errors.Forbidden("FORBIDDEN", "permission denied"),
+	}
+	srv := http.NewServer(http.Middleware(
+		testUserIDMiddleware,
+		rbac.RequireRole(errorMap, "admin").Path("/v1/admin").Build(),
+		rbac.RequirePermission(errorMap, "posts:read", "posts:write").Path("/v1/posts").Build(),
+	))
+	for _, path := range []string{"/admin", "/posts"} {
+		srv.Route("/v1").GET(path, func(c http.Context) error {
+			h := c.Middleware(func(ctx context.Context, req any) (any, error) { return "ok", nil })
+			out, err := h(c, nil)
+			if err != nil {
+				return err
+			}
+			return c.Result(stdhttp.StatusOK, out)
+		})
+	}
+	get := func(path, userID string) int {
+		req := httptest.NewRequest(stdhttp.MethodGet, "http://127.0.0.1:8000"+path, nil)
+		req.Header.Set("X-User-ID", userID)
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	assert.Equal(t, stdhttp.StatusOK, get("/v1/admin", "1"))
+	assert.Equal(t, stdhttp.StatusForbidden, get("/v1/admin", "2"))
+	assert.Equal(t, stdhttp.StatusUnauthorized, get("/v1/admin", ""))
+	assert.Equal(t, stdhttp.StatusOK, get("/v1/posts", "2"))
+	assert.Equal(t, stdhttp.StatusForbidden, get("/v1/posts", "1"))
+
+	ok, err := rbac.HasPermission(context.Background(), 2, "posts:write")
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,118 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"google.golang.org/grpc/status"
+)
+
+// ErrMissingScope is the error that the caller lacks a scope required by the operation,
+// the middleware returns a *MissingScopeError matching it.
+var ErrMissingScope = bizerrors.New(403, "AUTHORIZATION_MISSING_SCOPE", "missing scope")
+
+// MissingScopeError is the error naming the scope the caller lacks. It encodes as a 403
+// Kratos error with the scope in the metadata, so it needs no errorMap entry.
+type MissingScopeError struct {
+	Operation string
+	Scope     string
+}
+
+// Error implements the error interface.
+func (e *MissingScopeError) Error() string {
+	return fmt.Sprintf("missing scope %s for %s", e.Scope, e.Operation)
+}
+
+// Code returns the HTTP style code.
+func (e *MissingScopeError) Code() int { return 403 }
+
+// Reason returns the machine readable reason.
+func (e *MissingScopeError) Reason() string { return "AUTHORIZATION_MISSING_SCOPE" }
+
+// Metadata returns the missing scope and the operation.
+func (e *MissingScopeError) Metadata() map[string]string {
+	return map[string]string{"scope": e.Scope, "operation": e.Operation}
+}
+
+// Is reports whether target is ErrMissingScope.
+func (e *MissingScopeError) Is(target error) bool { return target == ErrMissingScope }
+
+// GRPCStatus returns the gRPC status, Kratos encodes HTTP errors from it.
+func (e *MissingScopeError) GRPCStatus() *status.Status {
+	return kerrors.New(e.Code(), e.Reason(), e.Error()).WithMetadata(e.Metadata()).GRPCStatus()
+}
+
+// GrantedScopesFunc returns the scopes granted to the caller of ctx, ErrUnauthenticated
+// when it is not authenticated.
+type GrantedScopesFunc func(ctx context.Context) ([]string, error)
+
+// APIKeyScopes is the GrantedScopesFunc of the scopes of the API key in ctx.
+func APIKeyScopes(ctx context.Context) ([]string, error) {
+	apiKey := APIKeyFromContext(ctx)
+	if apiKey == nil {
+		return nil, ErrUnauthenticated
+	}
+	return apiKey.Scopes, nil
+}
+
+// OperationScopes declares the scopes required by the Kratos operations, e.g.
+// "/api.order.v1.Order/CreateOrder": {"orders:write"}. Its builder is used after the
+// authenticate builders, operations not declared require no scope.
+type OperationScopes struct {
+	scopes  map[string][]string
+	granted GrantedScopesFunc
+}
+
+// NewOperationScopes creates a new OperationScopes of the required scopes by operation,
+// granted is APIKeyScopes when nil.
+func NewOperationScopes(scopes map[string][]string, granted GrantedScopesFunc) *OperationScopes {
+	if granted == nil {
+		granted = APIKeyScopes
+	}
+	return &OperationScopes{scopes: scopes, granted: granted}
+}
+
+// Require declares more scopes required by operation, it is not safe to call once
+// serving.
+func (o *OperationScopes) Require(operation string, scopes ...string) *OperationScopes {
+	if o.scopes == nil {
+		o.scopes = map[string][]string{}
+	}
+	o.scopes[operation] = append(o.scopes[operation], scopes...)
+	return o
+}
+
+// RequireScopeBuilder returns the builder of the middleware requiring all the scopes of
+// the operation, it returns a *MissingScopeError naming the first missing one.
+func (o *OperationScopes) RequireScopeBuilder(errorMap map[error]error) *selector.Builder {
+	return selector.Server(errorMappingMiddleware(errorMap), o.middleware)
+}
+
+func (o *OperationScopes) middleware(handler middleware.Handler) middleware.Handler {
+	return func(ctx context.Context, req any) (any, error) {
+		tr, ok := transport.FromServerContext(ctx)
+		if !ok {
+			return handler(ctx, req)
+		}
+		required := o.scopes[tr.Operation()]
+		if len(required) == 0 {
+			return handler(ctx, req)
+		}
+		granted, err := o.granted(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, scope := range required {
+			if !slices.Contains(granted, scope) {
+				return nil, &MissingScopeError{Operation: tr.Operation(), Scope: scope}
+			}
+		}
+		return handler(ctx, req)
+	}
+}
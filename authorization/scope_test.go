@@ -0,0 +1,81 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperationScopes(t *testing.T) {
+	ctx := context.Background()
+	_, client, _ := newTestSessionCache(t)
+	cache := NewAPIKeyCacheImpl("TEST", client)
+	require.NoError(t, cache.SetAPIKey(ctx, "reader", &APIKey{ID: "key-1", Scopes: []string{"orders:read"}}, 0))
+	require.NoError(t, cache.SetAPIKey(ctx, "writer", &APIKey{ID: "key-2",
+		Scopes: []string{"orders:read", "orders:write"}}, 0))
+
+	scopes := NewOperationScopes(map[string][]string{
+		"/api.order.v1.Order/ListOrders": {"orders:read"},
+	}, nil).Require("/api.order.v1.Order/CreateOrder", "orders:read", "orders:write")
+	errorMap := map[error]error{
+		ErrHTTPHeaderNotFound: errors.Unauthorized("UNAUTHORIZED", "api key required"),
+	}
+	srv := http.NewServer(http.Middleware(
+		NewAPIKeyAccessPermission("", cache).APIKeyAuthenticateBuilder(errorMap).Prefix("/api.order.v1.Order/").Build(),
+		scopes.RequireScopeBuilder(errorMap).Prefix("/api.order.v1.Order/").Build(),
+	))
+	for path, operation := range map[string]string{
+		"/list": "/api.order.v1.Order/ListOrders", "/create": "/api.order.v1.Order/CreateOrder",
+		"/ping": "/api.order.v1.Order/Ping",
+	} {
+		srv.Route("/v1/orders").GET(path, func(c http.Context) error {
+			http.SetOperation(c, operation)
+			h := c.Middleware(func(ctx context.Context, req any) (any, error) { return "ok", nil })
+			out, err := h(c, nil)
+			if err != nil {
+				return err
+			}
+			return c.Result(stdhttp.StatusOK, out)
+		})
+	}
+	get := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(stdhttp.MethodGet, "http://127.0.0.1:8000/v1/orders"+path, nil)
+		req.Header.Set("X-API-Key", key)
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw
+	}
+
+	assert.Equal(t, stdhttp.StatusOK, get("/list", "reader").Code)
+	assert.Equal(t, stdhttp.StatusOK, get("/ping", "reader").Code)
+	assert.Equal(t, stdhttp.StatusOK, get("/create", "writer").Code)
+
+	rw := get("/create", "reader")
+	assert.Equal(t, stdhttp.StatusForbidden, rw.Code)
+	var body struct {
+		Reason   string            `json:"reason"`
+		Metadata map[string]string `json:"metadata"`
+	}
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &body))
+	assert.Equal(t, "AUTHORIZATION_MISSING_SCOPE", body.Reason)
+	assert.Equal(t, "orders:write", body.Metadata["scope"])
+
+	assert.ErrorIs(t, &MissingScopeError{Scope: "orders:write"}, ErrMissingScope)
+
+	rbac := NewRBAC(&testRoleProvider{
+		roles:       map[int64][]string{1: {"editor"}},
+		permissions: map[string][]string{"editor": {"orders:write", "orders:read"}},
+	})
+	granted, err := rbac.GrantedScopes(NewUserIDContext(ctx, 1))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orders:read", "orders:write"}, granted)
+	_, err = rbac.GrantedScopes(ctx)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+}
@@ -2,9 +2,9 @@ package authorization
 
 import (
 	"context"
-	"errors"
 	"time"
 
+	bizerrors "github.com/crypto-zero/go-biz/errors"
 	"github.com/crypto-zero/go-kit/text"
 )
 
@@ -16,11 +16,70 @@ const (
 )
 
 // ErrSessionNotFound The session not found error
-var ErrSessionNotFound = errors.New("session not found")
+var ErrSessionNotFound = bizerrors.New(401, "AUTHORIZATION_SESSION_NOT_FOUND", "session not found")
 
 // SessionCachePrefix The session cache prefix
 type SessionCachePrefix string
 
+// AuthLevel is the strength of the authentication of a session.
+type AuthLevel int
+
+const (
+	// AuthLevelPassword is the level of a session authenticated by the first factor only,
+	// the level of every new session.
+	AuthLevelPassword AuthLevel = iota
+	// AuthLevelMFA is the level of a session that verified a second factor, e.g. an OTP.
+	AuthLevelMFA
+)
+
+// SessionMetadata describes where a session came from, for session lists and audit logs.
+type SessionMetadata struct {
+	IP         string `json:"ip,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	DeviceName string `json:"device_name,omitempty"`
+	// CreatedAt is set by SetUserSessionID.
+	CreatedAt time.Time `json:"created_at"`
+	// AuthLevel and AuthVerifiedAt are set by SetSessionAuthLevel.
+	AuthLevel      AuthLevel `json:"auth_level"`
+	AuthVerifiedAt time.Time `json:"auth_verified_at"`
+}
+
+// Session is a session with its user and metadata.
+type Session struct {
+	ID       string          `json:"id"`
+	UserID   int64           `json:"user_id"`
+	Metadata SessionMetadata `json:"metadata"`
+}
+
+// sessionOptions are the options of SetUserSessionID.
+type sessionOptions struct {
+	metadata    SessionMetadata
+	single      bool
+	maxLifetime time.Duration
+}
+
+// SessionOption configures a SetUserSessionID or GetUserIDBySessionID call.
+type SessionOption func(*sessionOptions)
+
+// WithSessionMetadata stores md with the session, its CreatedAt and auth level are ignored.
+func WithSessionMetadata(md SessionMetadata) SessionOption {
+	return func(o *sessionOptions) { o.metadata = md }
+}
+
+// WithSingleSession deletes the other sessions of the user in the same operation, for
+// products allowing one active login per account. The other devices are logged out on
+// their next request.
+func WithSingleSession() SessionOption {
+	return func(o *sessionOptions) { o.single = true }
+}
+
+// WithMaxLifetime limits the refresh of GetUserIDBySessionID to d since the session was
+// created, so an active session still ends. Sessions set before the creation time was
+// stored are not limited.
+func WithMaxLifetime(d time.Duration) SessionOption {
+	return func(o *sessionOptions) { o.maxLifetime = d }
+}
+
 // SessionIDGenerator The session id generator interface
 type SessionIDGenerator interface {
 	// GenerateSessionID generates a session id.
@@ -30,11 +89,22 @@ type SessionIDGenerator interface {
 // SessionCache The session cache interface
 type SessionCache interface {
 	// SetUserSessionID sets the user session id.
-	SetUserSessionID(ctx context.Context, sessionID string, userID int64, expire time.Duration) error
-	// GetUserIDBySessionID gets the user id by session id and refresh the session id expire time.
-	GetUserIDBySessionID(ctx context.Context, sessionID string, expire time.Duration) (int64, error)
+	SetUserSessionID(ctx context.Context, sessionID string, userID int64, expire time.Duration,
+		opts ...SessionOption) error
+	// GetSession gets the session with its metadata without refreshing it.
+	GetSession(ctx context.Context, sessionID string) (*Session, error)
+	// GetUserIDBySessionID gets the user id by session id and refresh the session id expire time,
+	// up to the max lifetime of WithMaxLifetime.
+	GetUserIDBySessionID(ctx context.Context, sessionID string, expire time.Duration,
+		opts ...SessionOption) (int64, error)
 	// DeleteUserSession deletes user all active sessions.
 	DeleteUserSession(ctx context.Context, userID int64) error
+	// DeleteSession deletes the session and its entry in the user session map, e.g. on
+	// logout. It returns ErrSessionNotFound if the session does not exist.
+	DeleteSession(ctx context.Context, sessionID string) error
+	// SetSessionAuthLevel records that the session was verified at level now, e.g. after a
+	// 2FA code. It returns ErrSessionNotFound if the session does not exist.
+	SetSessionAuthLevel(ctx context.Context, sessionID string, level AuthLevel) error
 }
 
 // FixedSessionIDGenerator The fixed session id generator
@@ -0,0 +1,152 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrSessionDataNotFound is the error that the session has no data.
+var ErrSessionDataNotFound = bizerrors.New(404, "AUTHORIZATION_SESSION_DATA_NOT_FOUND", "session data not found")
+
+// sessionDataSetScript is a redis lua script to set session data expiring with its session,
+// it deletes the data of a missing session.
+//
+// KEYS[1] = user session key
+// KEYS[2] = session data key
+// ARGV[1] = data
+var sessionDataSetScript = redis.NewScript(
+	`
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl == -2 then
+    redis.call("DEL", KEYS[2])
+    return 0
+end
+redis.call("SET", KEYS[2], ARGV[1])
+if ttl > 0 then
+    redis.call("PEXPIRE", KEYS[2], ttl)
+end
+return 1`,
+)
+
+// sessionDataGetScript is a redis lua script to get session data, it aligns the expiry of
+// the data with its session, refreshed since the data was set, and deletes the data of a
+// missing session. It returns nil without data and 0 without session.
+//
+// KEYS[1] = user session key
+// KEYS[2] = session data key
+var sessionDataGetScript = redis.NewScript(
+	`
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl == -2 then
+    redis.call("DEL", KEYS[2])
+    return 0
+end
+local data = redis.call("GET", KEYS[2])
+if data and ttl > 0 then
+    redis.call("PEXPIRE", KEYS[2], ttl)
+end
+return data`,
+)
+
+// SessionDataCache The typed per-session data cache interface, e.g. the cart id or the
+// locale of a session. The data expires with its session.
+type SessionDataCache[T any] interface {
+	// SetSessionData sets the data of the session, it returns ErrSessionNotFound for
+	// missing sessions.
+	SetSessionData(ctx context.Context, sessionID string, data *T) error
+	// GetSessionData gets the data of the session.
+	GetSessionData(ctx context.Context, sessionID string) (*T, error)
+	// DeleteSessionData deletes the data of the session.
+	DeleteSessionData(ctx context.Context, sessionID string) error
+}
+
+// SessionDataCacheImpl stores the session data JSON encoded next to the sessions of
+// SessionCacheImpl, it must use the same prefix and client.
+type SessionDataCacheImpl[T any] struct {
+	prefix SessionCachePrefix
+	client redis.UniversalClient
+}
+
+// Compile-time assertion: SessionDataCacheImpl implements SessionDataCache.
+var _ SessionDataCache[struct{}] = SessionDataCacheImpl[struct{}]{}
+
+func (c SessionDataCacheImpl[T]) userSessionKey(sessionID string) string {
+	return SessionCacheImpl{prefix: c.prefix}.userSessionKey(sessionID)
+}
+
+func (c SessionDataCacheImpl[T]) sessionDataKey(sessionID string) string {
+	return fmt.Sprintf("%s:USER:SESSION:DATA:%s", c.prefix, sessionID)
+}
+
+func (c SessionDataCacheImpl[T]) SetSessionData(ctx context.Context, sessionID string, data *T) error {
+	value, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshal session data failed: %w", err)
+	}
+	set, err := sessionDataSetScript.Run(ctx, c.client,
+		[]string{c.userSessionKey(sessionID), c.sessionDataKey(sessionID)}, value).Int()
+	if err != nil {
+		return fmt.Errorf("set session data failed: %w", err)
+	}
+	if set == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (c SessionDataCacheImpl[T]) GetSessionData(ctx context.Context, sessionID string) (*T, error) {
+	result, err := sessionDataGetScript.Run(ctx, c.client,
+		[]string{c.userSessionKey(sessionID), c.sessionDataKey(sessionID)}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSessionDataNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get session data failed: %w", err)
+	}
+	value, ok := result.(string)
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	data := new(T)
+	if err = json.Unmarshal([]byte(value), data); err != nil {
+		return nil, fmt.Errorf("unmarshal session data failed: %w", err)
+	}
+	return data, nil
+}
+
+func (c SessionDataCacheImpl[T]) DeleteSessionData(ctx context.Context, sessionID string) error {
+	if err := c.client.Del(ctx, c.sessionDataKey(sessionID)).Err(); err != nil {
+		return fmt.Errorf("delete session data failed: %w", err)
+	}
+	return nil
+}
+
+// NewSessionDataCacheImpl returns a new SessionDataCacheImpl.
+func NewSessionDataCacheImpl[T any](prefix SessionCachePrefix, client redis.UniversalClient) SessionDataCache[T] {
+	return SessionDataCacheImpl[T]{prefix: prefix, client: client}
+}
+
+// SessionDataFromContext gets the data of the session authenticated in ctx, it returns
+// ErrUnauthenticated without session.
+func SessionDataFromContext[T any](ctx context.Context, cache SessionDataCache[T]) (*T, error) {
+	sessionID, ok := SessionIDFromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	return cache.GetSessionData(ctx, sessionID)
+}
+
+// SetSessionDataFromContext sets the data of the session authenticated in ctx, it returns
+// ErrUnauthenticated without session.
+func SetSessionDataFromContext[T any](ctx context.Context, cache SessionDataCache[T], data *T) error {
+	sessionID, ok := SessionIDFromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+	return cache.SetSessionData(ctx, sessionID, data)
+}
@@ -0,0 +1,66 @@
+package authorization
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSessionData struct {
+	CartID string `json:"cart_id"`
+	Locale string `json:"locale"`
+}
+
+func TestSessionDataCache(t *testing.T) {
+	ctx := context.Background()
+	sessions, client, s := newTestSessionCache(t)
+	cache := NewSessionDataCacheImpl[testSessionData]("TEST", client)
+
+	assert.ErrorIs(t, cache.SetSessionData(ctx, "SESSION_A", &testSessionData{}), ErrSessionNotFound)
+
+	require.NoError(t, sessions.SetUserSessionID(ctx, "SESSION_A", 1, time.Hour))
+	_, err := cache.GetSessionData(ctx, "SESSION_A")
+	assert.ErrorIs(t, err, ErrSessionDataNotFound)
+	require.NoError(t, cache.SetSessionData(ctx, "SESSION_A", &testSessionData{CartID: "cart-1", Locale: "en"}))
+	data, err := cache.GetSessionData(ctx, "SESSION_A")
+	require.NoError(t, err)
+	assert.Equal(t, &testSessionData{CartID: "cart-1", Locale: "en"}, data)
+
+	// The data follows the expiry of its session.
+	assertSameTTL := func() {
+		sessionTTL, dataTTL := s.TTL("TEST:USER:SESSION:SESSION_A"), s.TTL("TEST:USER:SESSION:DATA:SESSION_A")
+		assert.InDelta(t, sessionTTL.Seconds(), dataTTL.Seconds(), 1)
+	}
+	assertSameTTL()
+	s.FastForward(30 * time.Minute)
+	_, err = sessions.GetUserIDBySessionID(ctx, "SESSION_A", 2*time.Hour)
+	require.NoError(t, err)
+	_, err = cache.GetSessionData(ctx, "SESSION_A")
+	require.NoError(t, err)
+	assertSameTTL()
+
+	// The data of a deleted session is gone.
+	require.NoError(t, sessions.DeleteSession(ctx, "SESSION_A"))
+	_, err = cache.GetSessionData(ctx, "SESSION_A")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	assert.False(t, s.Exists("TEST:USER:SESSION:DATA:SESSION_A"))
+}
+
+func TestSessionDataFromContext(t *testing.T) {
+	ctx := context.Background()
+	sessions, client, _ := newTestSessionCache(t)
+	cache := NewSessionDataCacheImpl[testSessionData]("TEST", client)
+	require.NoError(t, sessions.SetUserSessionID(ctx, "SESSION_A", 1, time.Hour))
+
+	_, err := SessionDataFromContext(ctx, cache)
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+
+	ctx = NewSessionIDContext(ctx, "SESSION_A")
+	require.NoError(t, SetSessionDataFromContext(ctx, cache, &testSessionData{Locale: "fr"}))
+	data, err := SessionDataFromContext(ctx, cache)
+	require.NoError(t, err)
+	assert.Equal(t, "fr", data.Locale)
+}
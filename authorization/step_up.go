@@ -0,0 +1,90 @@
+package authorization
+
+import (
+	"context"
+	"time"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+)
+
+// ErrStepUpRequired is the error that the session must verify a second factor, or verify
+// it again, for the operation.
+var ErrStepUpRequired = bizerrors.New(403, "AUTHORIZATION_STEP_UP_REQUIRED", "step-up authentication required")
+
+// StepUpVerifier verifies the second factor code of a user, e.g. with the OTP service of
+// the verification package:
+//
+//	StepUpVerifierFunc(func(ctx context.Context, userID int64, code string) error {
+//		return otp.Verify(ctx, code, &verification.MobileCode{Code: ..., Mobile: mobileOf(userID)})
+//	})
+type StepUpVerifier interface {
+	VerifyStepUp(ctx context.Context, userID int64, code string) error
+}
+
+// StepUpVerifierFunc is a StepUpVerifier function.
+type StepUpVerifierFunc func(ctx context.Context, userID int64, code string) error
+
+// VerifyStepUp implements StepUpVerifier.
+func (f StepUpVerifierFunc) VerifyStepUp(ctx context.Context, userID int64, code string) error {
+	return f(ctx, userID, code)
+}
+
+// StepUp raises the auth level of the sessions authenticated by an HTTPHeaderAccessPermission
+// and guards the sensitive operations with it.
+type StepUp struct {
+	sessionCache SessionCache
+	verifier     StepUpVerifier
+}
+
+// NewStepUp creates a new StepUp.
+func NewStepUp(sessionCache SessionCache, verifier StepUpVerifier) *StepUp {
+	return &StepUp{sessionCache: sessionCache, verifier: verifier}
+}
+
+// Verify verifies the second factor code of the authenticated user and raises their
+// session to AuthLevelMFA, called by the handler of the step-up endpoint. The errors of
+// the verifier are returned as is.
+func (s *StepUp) Verify(ctx context.Context, code string) error {
+	sessionID, ok := SessionIDFromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+	userID, ok := UserIDFromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+	if err := s.verifier.VerifyStepUp(ctx, userID, code); err != nil {
+		return err
+	}
+	return s.sessionCache.SetSessionAuthLevel(ctx, sessionID, AuthLevelMFA)
+}
+
+// RequireAuthLevel returns the builder of the middleware requiring the session to be
+// verified at level within maxAge, zero for any time. It returns ErrStepUpRequired
+// otherwise, so the client can call the step-up endpoint and retry.
+func (s *StepUp) RequireAuthLevel(errorMap map[error]error, level AuthLevel, maxAge time.Duration,
+) *selector.Builder {
+	return selector.Server(errorMappingMiddleware(errorMap), s.requireAuthLevel(level, maxAge))
+}
+
+func (s *StepUp) requireAuthLevel(level AuthLevel, maxAge time.Duration) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			sessionID, ok := SessionIDFromContext(ctx)
+			if !ok {
+				return nil, ErrUnauthenticated
+			}
+			session, err := s.sessionCache.GetSession(ctx, sessionID)
+			if err != nil {
+				return nil, err
+			}
+			md := session.Metadata
+			if md.AuthLevel < level || (maxAge > 0 && time.Since(md.AuthVerifiedAt) > maxAge) {
+				return nil, ErrStepUpRequired
+			}
+			return handler(ctx, req)
+		}
+	}
+}
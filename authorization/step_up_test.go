@@ -0,0 +1,99 @@
+package authorization
+
+import (
+	"context"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionCache_SetSessionAuthLevel(t *testing.T) {
+	ctx := context.Background()
+	cache, _, s := newTestSessionCache(t)
+
+	assert.ErrorIs(t, cache.SetSessionAuthLevel(ctx, "SESSION_A", AuthLevelMFA), ErrSessionNotFound)
+
+	require.NoError(t, cache.SetUserSessionID(ctx, "SESSION_A", 1, time.Hour))
+	session, err := cache.GetSession(ctx, "SESSION_A")
+	require.NoError(t, err)
+	assert.Equal(t, AuthLevelPassword, session.Metadata.AuthLevel)
+	assert.True(t, session.Metadata.AuthVerifiedAt.IsZero())
+
+	require.NoError(t, cache.SetSessionAuthLevel(ctx, "SESSION_A", AuthLevelMFA))
+	session, err = cache.GetSession(ctx, "SESSION_A")
+	require.NoError(t, err)
+	assert.Equal(t, AuthLevelMFA, session.Metadata.AuthLevel)
+	assert.WithinDuration(t, time.Now(), session.Metadata.AuthVerifiedAt, 2*time.Second)
+	sessionTTL, metaTTL := s.TTL("TEST:USER:SESSION:SESSION_A"), s.TTL("TEST:USER:SESSION:META:SESSION_A")
+	assert.InDelta(t, sessionTTL.Seconds(), metaTTL.Seconds(), 1)
+
+	// A new login starts at the password level.
+	require.NoError(t, cache.SetUserSessionID(ctx, "SESSION_A", 1, time.Hour))
+	session, err = cache.GetSession(ctx, "SESSION_A")
+	require.NoError(t, err)
+	assert.Equal(t, AuthLevelPassword, session.Metadata.AuthLevel)
+}
+
+func TestStepUp(t *testing.T) {
+	ctx := context.Background()
+	cache, _, _ := newTestSessionCache(t)
+	require.NoError(t, cache.SetUserSessionID(ctx, "SESSION_A", 1, time.Hour))
+
+	errInvalidCode := errors.BadRequest("INVALID_CODE", "invalid code")
+	stepUp := NewStepUp(cache, StepUpVerifierFunc(func(ctx context.Context, userID int64, code string) error {
+		if userID != 1 || code != "123456" {
+			return errInvalidCode
+		}
+		return nil
+	}))
+	errorMap := map[error]error{
+		ErrHTTPHeaderNotFound: errors.Unauthorized("UNAUTHORIZED", "header not found"),
+		ErrStepUpRequired:     errors.Forbidden("STEP_UP_REQUIRED", "step-up authentication required"),
+	}
+	accessPermission := NewHTTPHeaderAccessPermission("X-Session",
+		NewHTTPHeaderAccessPermissionRefreshSessionExpireTime(), cache, NewTestUserAccessPermissionProvisioner())
+	srv := http.NewServer(http.Middleware(
+		accessPermission.UserAuthenticateBuilder(errorMap).Prefix("/v1/").Build(),
+		stepUp.RequireAuthLevel(errorMap, AuthLevelMFA, 5*time.Minute).Path("/v1/withdraw").Build(),
+	))
+	route := srv.Route("/v1")
+	route.POST("/step-up", func(c http.Context) error {
+		http.SetOperation(c, "/v1/step-up")
+		h := c.Middleware(func(ctx context.Context, req any) (any, error) {
+			return "ok", stepUp.Verify(ctx, c.Request().URL.Query().Get("code"))
+		})
+		out, err := h(c, nil)
+		if err != nil {
+			return err
+		}
+		return c.Result(stdhttp.StatusOK, out)
+	})
+	route.POST("/withdraw", func(c http.Context) error {
+		http.SetOperation(c, "/v1/withdraw")
+		h := c.Middleware(func(ctx context.Context, req any) (any, error) { return "ok", nil })
+		out, err := h(c, nil)
+		if err != nil {
+			return err
+		}
+		return c.Result(stdhttp.StatusOK, out)
+	})
+	post := func(path string) int {
+		req := httptest.NewRequest(stdhttp.MethodPost, "http://127.0.0.1:8000"+path, nil)
+		req.Header.Set("X-Session", "SESSION_A")
+		rw := httptest.NewRecorder()
+		srv.ServeHTTP(rw, req)
+		return rw.Code
+	}
+
+	assert.Equal(t, stdhttp.StatusForbidden, post("/v1/withdraw"))
+	assert.Equal(t, stdhttp.StatusBadRequest, post("/v1/step-up?code=000000"))
+	assert.Equal(t, stdhttp.StatusForbidden, post("/v1/withdraw"))
+	assert.Equal(t, stdhttp.StatusOK, post("/v1/step-up?code=123456"))
+	assert.Equal(t, stdhttp.StatusOK, post("/v1/withdraw"))
+}
@@ -0,0 +1,234 @@
+// Package cache provides a typed Redis cache with pluggable codecs, singleflight
+// protected loaders and an optional local LRU in front of Redis.
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// defaultTTL is the default TTL of the cached values.
+	defaultTTL = time.Hour
+	// defaultLocalTTL is the default TTL of the local LRU entries.
+	defaultLocalTTL = time.Minute
+)
+
+type Options struct {
+	// Prefix is prepended to every key.
+	Prefix string
+	// TTL is the TTL of Set with a zero TTL and of loaded values.
+	TTL time.Duration
+	// Codec encodes the values, JSONCodec by default.
+	Codec Codec
+	// LocalSize enables a local LRU of the size in front of Redis. The local entries are
+	// not invalidated by other instances, LocalTTL bounds their staleness. The LRU keeps
+	// shallow copies of the values, so T must not share mutable state through pointers,
+	// slices or maps with the callers.
+	LocalSize int
+	// LocalTTL is the TTL of the local LRU entries.
+	LocalTTL time.Duration
+}
+
+func (o *Options) applyDefaultValue() {
+	if o.TTL == 0 {
+		o.TTL = defaultTTL
+	}
+	if o.Codec == nil {
+		o.Codec = JSONCodec
+	}
+	if o.LocalTTL == 0 {
+		o.LocalTTL = defaultLocalTTL
+	}
+}
+
+// Cache is a typed cache of T values backed by Redis.
+type Cache[T any] struct {
+	client  redis.UniversalClient
+	options Options
+	local   *expirable.LRU[string, *T]
+	group   singleflight.Group
+}
+
+// New creates a Cache.
+func New[T any](client redis.UniversalClient, options Options) *Cache[T] {
+	options.applyDefaultValue()
+	c := &Cache[T]{client: client, options: options}
+	if options.LocalSize > 0 {
+		c.local = expirable.NewLRU[string, *T](options.LocalSize, nil, options.LocalTTL)
+	}
+	return c
+}
+
+func (c *Cache[T]) key(key string) string {
+	return c.options.Prefix + key
+}
+
+// Get returns the value of key, ErrNotFound is returned when it is not cached.
+func (c *Cache[T]) Get(ctx context.Context, key string) (*T, error) {
+	if c.local != nil {
+		if v, ok := c.local.Get(key); ok {
+			return clone(v), nil
+		}
+	}
+	data, err := c.client.Get(ctx, c.key(key)).Bytes()
+	v, err := c.decode(data, err)
+	if err != nil {
+		return nil, err
+	}
+	c.addLocal(key, v)
+	return v, nil
+}
+
+// GetWithTTL returns the value of key with its remaining TTL, with GET and PTTL in one
+// pipeline. It reads Redis even with a local LRU, which doesn't know the TTL.
+func (c *Cache[T]) GetWithTTL(ctx context.Context, key string) (*T, time.Duration, error) {
+	var (
+		get  *redis.StringCmd
+		pttl *redis.DurationCmd
+	)
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, c.key(key))
+		pttl = pipe.PTTL(ctx, c.key(key))
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, 0, fmt.Errorf("cache: redis get failed: %w", err)
+	}
+	data, err := get.Bytes()
+	v, err := c.decode(data, err)
+	if err != nil {
+		return nil, 0, err
+	}
+	// A key expiring between GET and PTTL reports a negative duration.
+	ttl := pttl.Val()
+	if ttl < 0 {
+		return nil, 0, ErrNotFound
+	}
+	return v, ttl, nil
+}
+
+// Set caches the value for ttl, zero uses the default TTL.
+func (c *Cache[T]) Set(ctx context.Context, key string, v *T, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = c.options.TTL
+	}
+	data, err := c.options.Codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("cache: encode failed: %w", err)
+	}
+	if err = c.client.Set(ctx, c.key(key), data, ttl).Err(); err != nil {
+		return fmt.Errorf("cache: redis set failed: %w", err)
+	}
+	c.addLocal(key, v)
+	return nil
+}
+
+// GetDel returns and deletes the value of key atomically.
+func (c *Cache[T]) GetDel(ctx context.Context, key string) (*T, error) {
+	if c.local != nil {
+		c.local.Remove(key)
+	}
+	data, err := c.client.GetDel(ctx, c.key(key)).Bytes()
+	return c.decode(data, err)
+}
+
+// TTL returns the remaining TTL of key.
+func (c *Cache[T]) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.client.PTTL(ctx, c.key(key)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("cache: redis pttl failed: %w", err)
+	}
+	if ttl == -2 {
+		// go-redis reports a missing key as -2 regardless of the precision.
+		return 0, ErrNotFound
+	}
+	return ttl, nil
+}
+
+// Delete deletes the keys.
+func (c *Cache[T]) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	full := make([]string, len(keys))
+	for i, key := range keys {
+		full[i] = c.key(key)
+		if c.local != nil {
+			c.local.Remove(key)
+		}
+	}
+	if err := c.client.Del(ctx, full...).Err(); err != nil {
+		return fmt.Errorf("cache: redis del failed: %w", err)
+	}
+	return nil
+}
+
+// GetOrLoad returns the cached value of key or loads and caches it. Concurrent loads of
+// the same key in this process share a single loader call, which runs with the values
+// but without the cancellation of ctx, so one canceled caller doesn't fail the others.
+// A canceled caller returns ctx.Err() without waiting for the load.
+func (c *Cache[T]) GetOrLoad(ctx context.Context, key string,
+	loader func(ctx context.Context) (*T, error),
+) (*T, error) {
+	v, err := c.Get(ctx, key)
+	if !errors.Is(err, ErrNotFound) {
+		return v, err
+	}
+	loadCtx := context.WithoutCancel(ctx)
+	ch := c.group.DoChan(key, func() (any, error) {
+		v, err := loader(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+		if err = c.Set(loadCtx, key, v, 0); err != nil {
+			return nil, err
+		}
+		return v, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		if res.Shared {
+			return clone(res.Val.(*T)), nil
+		}
+		return res.Val.(*T), nil
+	}
+}
+
+// addLocal adds a copy of v to the local LRU, if any, so the callers can't modify it.
+func (c *Cache[T]) addLocal(key string, v *T) {
+	if c.local != nil {
+		c.local.Add(key, clone(v))
+	}
+}
+
+// clone returns a shallow copy of v.
+func clone[T any](v *T) *T {
+	cp := *v
+	return &cp
+}
+
+func (c *Cache[T]) decode(data []byte, err error) (*T, error) {
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cache: redis get failed: %w", err)
+	}
+	v := new(T)
+	if err = c.options.Codec.Unmarshal(data, v); err != nil {
+		return nil, fmt.Errorf("cache: decode failed: %w", err)
+	}
+	return v, nil
+}
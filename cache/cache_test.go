@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type user struct {
+	ID   int64
+	Name string
+}
+
+func newClient(t *testing.T) (redis.UniversalClient, *mr.Miniredis) {
+	s := mr.RunT(t)
+	return redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{s.Addr()}}), s
+}
+
+func TestCacheCodecs(t *testing.T) {
+	client, _ := newClient(t)
+	ctx := context.Background()
+	for name, codec := range map[string]Codec{"json": JSONCodec, "gob": GobCodec, "msgpack": MsgpackCodec} {
+		t.Run(name, func(t *testing.T) {
+			c := New[user](client, Options{Prefix: "TEST:" + name + ":", Codec: codec})
+			require.NoError(t, c.Set(ctx, "1", &user{ID: 1, Name: "alice"}, time.Minute))
+			v, err := c.Get(ctx, "1")
+			require.NoError(t, err)
+			assert.Equal(t, &user{ID: 1, Name: "alice"}, v)
+
+			v, err = c.GetDel(ctx, "1")
+			require.NoError(t, err)
+			assert.Equal(t, "alice", v.Name)
+			_, err = c.Get(ctx, "1")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestCacheTTLAndDelete(t *testing.T) {
+	client, s := newClient(t)
+	ctx := context.Background()
+	c := New[user](client, Options{Prefix: "TEST:", TTL: time.Minute})
+
+	require.NoError(t, c.Set(ctx, "1", &user{ID: 1}, 0))
+	ttl, err := c.TTL(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, ttl)
+
+	s.FastForward(2 * time.Minute)
+	_, err = c.Get(ctx, "1")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, c.Set(ctx, "2", &user{ID: 2}, 0))
+	require.NoError(t, c.Delete(ctx, "2"))
+	_, err = c.TTL(ctx, "2")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCacheGetOrLoad(t *testing.T) {
+	client, _ := newClient(t)
+	ctx := context.Background()
+	c := New[user](client, Options{Prefix: "TEST:"})
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (*user, error) {
+		loads.Add(1)
+		<-release
+		return &user{ID: 1, Name: "alice"}, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.GetOrLoad(ctx, "1", loader)
+			assert.NoError(t, err)
+			assert.Equal(t, "alice", v.Name)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), loads.Load())
+
+	_, err := c.GetOrLoad(ctx, "1", loader)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), loads.Load())
+}
+
+func TestCacheLocal(t *testing.T) {
+	client, s := newClient(t)
+	ctx := context.Background()
+	c := New[user](client, Options{Prefix: "TEST:", LocalSize: 10})
+
+	require.NoError(t, c.Set(ctx, "1", &user{ID: 1}, 0))
+	s.FlushAll()
+	v, err := c.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), v.ID)
+
+	require.NoError(t, c.Delete(ctx, "1"))
+	_, err = c.Get(ctx, "1")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCacheGetOrLoadCanceled(t *testing.T) {
+	client, _ := newClient(t)
+	c := New[user](client, Options{Prefix: "TEST:"})
+
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (*user, error) {
+		<-release
+		return &user{ID: 1}, ctx.Err()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.GetOrLoad(ctx, "1", loader)
+		first <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	second := make(chan error, 1)
+	go func() {
+		_, err := c.GetOrLoad(context.Background(), "1", loader)
+		second <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-first, context.Canceled)
+	close(release)
+	assert.NoError(t, <-second)
+}
+
+func TestCacheLocalCopies(t *testing.T) {
+	client, _ := newClient(t)
+	ctx := context.Background()
+	c := New[user](client, Options{Prefix: "TEST:", LocalSize: 10})
+
+	v := &user{ID: 1, Name: "alice"}
+	require.NoError(t, c.Set(ctx, "1", v, 0))
+	v.Name = "bob"
+	got, err := c.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", got.Name)
+	got.Name = "carol"
+	got, err = c.Get(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", got.Name)
+}
@@ -0,0 +1,6 @@
+package cache
+
+import "errors"
+
+// ErrNotFound is returned when the key is not cached.
+var ErrNotFound = errors.New("cache key not found")
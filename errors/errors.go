@@ -0,0 +1,165 @@
+// Package errors defines the coded errors shared by the go-biz modules and converts
+// them to Kratos errors and gRPC statuses.
+//
+// The sentinel errors of the verification, authorization and idempotency modules
+// implement Coder, so they keep working with errors.Is while carrying a code and a
+// reason. The transport-agnostic modules, cache, scheduler and NATS, keep plain errors
+// that the services convert at their boundary.
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// UnknownCode is the code of errors that carry no code.
+	UnknownCode = 500
+	// UnknownReason is the reason of errors that carry no reason.
+	UnknownReason = "UNKNOWN"
+)
+
+// Coder is implemented by errors carrying an HTTP style code and a machine readable reason.
+type Coder interface {
+	Code() int
+	Reason() string
+}
+
+// Error is a coded, wrappable business error.
+type Error struct {
+	code     int
+	reason   string
+	message  string
+	metadata map[string]string
+	cause    error
+}
+
+// New returns an error with the code, reason and message.
+func New(code int, reason, message string) *Error {
+	return &Error{code: code, reason: reason, message: message}
+}
+
+// Newf returns New(code, reason, fmt.Sprintf(format, a...)).
+func Newf(code int, reason, format string, a ...any) *Error {
+	return New(code, reason, fmt.Sprintf(format, a...))
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.cause == nil {
+		return e.message
+	}
+	return fmt.Sprintf("%s: %s", e.message, e.cause)
+}
+
+// Code returns the HTTP style code.
+func (e *Error) Code() int { return e.code }
+
+// Reason returns the machine readable reason.
+func (e *Error) Reason() string { return e.reason }
+
+// Message returns the human readable message.
+func (e *Error) Message() string { return e.message }
+
+// Metadata returns the metadata.
+func (e *Error) Metadata() map[string]string { return e.metadata }
+
+// Unwrap returns the cause.
+func (e *Error) Unwrap() error { return e.cause }
+
+// Is reports whether err is a coded error with the same code and reason.
+func (e *Error) Is(err error) bool {
+	var c Coder
+	if errors.As(err, &c) {
+		return c.Code() == e.code && c.Reason() == e.reason
+	}
+	return false
+}
+
+// WithCause returns a copy of the error wrapping cause.
+func (e *Error) WithCause(cause error) *Error {
+	err := e.clone()
+	err.cause = cause
+	return err
+}
+
+// WithMetadata returns a copy of the error with the metadata merged in.
+func (e *Error) WithMetadata(md map[string]string) *Error {
+	err := e.clone()
+	if err.metadata == nil {
+		err.metadata = make(map[string]string, len(md))
+	}
+	maps.Copy(err.metadata, md)
+	return err
+}
+
+// GRPCStatus returns the gRPC status of the error.
+func (e *Error) GRPCStatus() *status.Status {
+	return e.Kratos().GRPCStatus()
+}
+
+// Kratos returns the Kratos error of the error.
+func (e *Error) Kratos() *kerrors.Error {
+	return kerrors.New(e.code, e.reason, e.message).WithMetadata(e.metadata).WithCause(e.cause)
+}
+
+func (e *Error) clone() *Error {
+	err := *e
+	err.metadata = maps.Clone(e.metadata)
+	return &err
+}
+
+// FromError converts err to an Error. Coded errors keep their code and reason, Kratos
+// errors are converted and other errors become UnknownCode errors wrapping err.
+func FromError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	if e := new(Error); errors.As(err, &e) {
+		return e
+	}
+	if ke := new(kerrors.Error); errors.As(err, &ke) {
+		return New(int(ke.Code), ke.Reason, ke.Message).WithMetadata(ke.Metadata).WithCause(ke.Unwrap())
+	}
+	var c Coder
+	if errors.As(err, &c) {
+		return New(c.Code(), c.Reason(), err.Error()).WithCause(err)
+	}
+	return New(UnknownCode, UnknownReason, err.Error()).WithCause(err)
+}
+
+// Code returns the code of err, 200 for nil.
+func Code(err error) int {
+	if err == nil {
+		return 200
+	}
+	return FromError(err).Code()
+}
+
+// Reason returns the reason of err, empty for nil.
+func Reason(err error) string {
+	if err == nil {
+		return ""
+	}
+	return FromError(err).Reason()
+}
+
+// ToKratos converts err to a Kratos error.
+func ToKratos(err error) *kerrors.Error {
+	if err == nil {
+		return nil
+	}
+	return FromError(err).Kratos()
+}
+
+// ToGRPCStatus converts err to a gRPC status.
+func ToGRPCStatus(err error) *status.Status {
+	if err == nil {
+		return status.New(0, "")
+	}
+	return FromError(err).GRPCStatus()
+}
@@ -0,0 +1,54 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"google.golang.org/grpc/codes"
+)
+
+type sentinel struct{}
+
+func (sentinel) Error() string  { return "session not found" }
+func (sentinel) Code() int      { return 401 }
+func (sentinel) Reason() string { return "SESSION_NOT_FOUND" }
+
+func TestError(t *testing.T) {
+	notFound := New(404, "CODE_NOT_FOUND", "code not found")
+	err := fmt.Errorf("verify: %w", notFound.WithCause(errors.New("redis nil")).
+		WithMetadata(map[string]string{"sequence": "1"}))
+	if !errors.Is(err, notFound) {
+		t.Error("expected the wrapped error to match the sentinel")
+	}
+	e := FromError(err)
+	if e.Code() != 404 || e.Reason() != "CODE_NOT_FOUND" || e.Metadata()["sequence"] != "1" {
+		t.Errorf("unexpected error %+v", e)
+	}
+	if notFound.Metadata() != nil {
+		t.Error("expected WithMetadata to copy the error")
+	}
+	if s := ToGRPCStatus(err); s.Code() != codes.NotFound {
+		t.Errorf("unexpected grpc code %s", s.Code())
+	}
+	if ke := ToKratos(err); ke.Code != 404 || ke.Reason != "CODE_NOT_FOUND" {
+		t.Errorf("unexpected kratos error %v", ke)
+	}
+}
+
+func TestFromError(t *testing.T) {
+	err := fmt.Errorf("auth: %w", sentinel{})
+	if Code(err) != 401 || Reason(err) != "SESSION_NOT_FOUND" {
+		t.Errorf("unexpected coder conversion %d %s", Code(err), Reason(err))
+	}
+	if !errors.Is(FromError(err), sentinel{}) {
+		t.Error("expected the converted error to wrap the sentinel")
+	}
+	if e := FromError(kerrors.Forbidden("FORBIDDEN", "forbidden")); e.Code() != 403 || e.Reason() != "FORBIDDEN" {
+		t.Errorf("unexpected kratos conversion %+v", e)
+	}
+	if Code(errors.New("boom")) != UnknownCode || Code(nil) != 200 {
+		t.Error("unexpected codes of plain errors")
+	}
+}
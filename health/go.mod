@@ -0,0 +1,3 @@
+module github.com/crypto-zero/go-biz/health
+
+go 1.23.2
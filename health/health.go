@@ -0,0 +1,183 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultTimeout is the timeout of a single check.
+const defaultTimeout = 3 * time.Second
+
+// ErrNotRegistered is returned by CheckOne for an unknown dependency.
+var ErrNotRegistered = errors.New("health check not registered")
+
+// Status is the status of a dependency.
+type Status string
+
+const (
+	StatusUp   Status = "UP"
+	StatusDown Status = "DOWN"
+)
+
+// Checker checks a dependency, a nil error means it is healthy. The Redis caches,
+// NATS publishers and subscribers and senders of go-biz implement it.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc is a function adapter of Checker.
+type CheckerFunc func(ctx context.Context) error
+
+// Check implements Checker.
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Result is the check result of a dependency.
+type Result struct {
+	Status   Status        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Report is the aggregated result of all dependencies.
+type Report struct {
+	Status       Status            `json:"status"`
+	Dependencies map[string]Result `json:"dependencies"`
+}
+
+// Registry runs the registered checks concurrently.
+type Registry struct {
+	mu       sync.RWMutex
+	checkers map[string]Checker
+	timeout  time.Duration
+}
+
+// NewRegistry creates a Registry, timeout bounds every check and defaults to 3s.
+func NewRegistry(timeout time.Duration) *Registry {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Registry{checkers: make(map[string]Checker), timeout: timeout}
+}
+
+// Register registers the checker of a dependency, replacing the one with the same name.
+func (r *Registry) Register(name string, checker Checker) *Registry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkers[name] = checker
+	return r
+}
+
+// RegisterFunc registers a check function.
+func (r *Registry) RegisterFunc(name string, check func(ctx context.Context) error) *Registry {
+	return r.Register(name, CheckerFunc(check))
+}
+
+// Unregister removes the checker of a dependency.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.checkers, name)
+}
+
+// Names returns the sorted names of the registered dependencies.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.checkers))
+	for name := range r.checkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckOne checks a single dependency.
+func (r *Registry) CheckOne(ctx context.Context, name string) (Result, error) {
+	r.mu.RLock()
+	checker, ok := r.checkers[name]
+	r.mu.RUnlock()
+	if !ok {
+		return Result{}, ErrNotRegistered
+	}
+	return r.check(ctx, checker), nil
+}
+
+// Check checks all dependencies, the report is down when any dependency is down.
+func (r *Registry) Check(ctx context.Context) Report {
+	r.mu.RLock()
+	checkers := make(map[string]Checker, len(r.checkers))
+	for name, checker := range r.checkers {
+		checkers[name] = checker
+	}
+	r.mu.RUnlock()
+
+	report := Report{Status: StatusUp, Dependencies: make(map[string]Result, len(checkers))}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, checker := range checkers {
+		wg.Add(1)
+		go func(name string, checker Checker) {
+			defer wg.Done()
+			result := r.check(ctx, checker)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Dependencies[name] = result
+			if result.Status == StatusDown {
+				report.Status = StatusDown
+			}
+		}(name, checker)
+	}
+	wg.Wait()
+	return report
+}
+
+func (r *Registry) check(ctx context.Context, checker Checker) (result Result) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+		if p := recover(); p != nil {
+			result.Status, result.Error = StatusDown, "check panicked"
+		}
+	}()
+	if err := checker.Check(ctx); err != nil {
+		return Result{Status: StatusDown, Error: err.Error()}
+	}
+	return Result{Status: StatusUp}
+}
+
+// Handler returns the HTTP handler of the readiness probe. It responds with the JSON
+// Report, 200 when all dependencies are up and 503 otherwise. The query parameter
+// "name" checks a single dependency.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		report := Report{Status: StatusUp}
+		if name := req.URL.Query().Get("name"); name != "" {
+			result, err := r.CheckOne(req.Context(), name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			report.Status, report.Dependencies = result.Status, map[string]Result{name: result}
+		} else {
+			report = r.Check(req.Context())
+		}
+		status := http.StatusOK
+		if report.Status == StatusDown {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
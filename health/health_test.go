@@ -0,0 +1,66 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry(50*time.Millisecond).
+		RegisterFunc("redis", func(ctx context.Context) error { return nil }).
+		RegisterFunc("nats", func(ctx context.Context) error { return errors.New("disconnected") })
+
+	report := registry.Check(context.Background())
+	if report.Status != StatusDown {
+		t.Errorf("expected down report, got %s", report.Status)
+	}
+	if report.Dependencies["redis"].Status != StatusUp || report.Dependencies["nats"].Error != "disconnected" {
+		t.Errorf("unexpected dependencies %+v", report.Dependencies)
+	}
+
+	registry.RegisterFunc("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	result, err := registry.CheckOne(context.Background(), "slow")
+	if err != nil || result.Status != StatusDown {
+		t.Errorf("expected timed out check, got %+v %v", result, err)
+	}
+	if _, err = registry.CheckOne(context.Background(), "missing"); !errors.Is(err, ErrNotRegistered) {
+		t.Errorf("expected ErrNotRegistered, got %v", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	registry := NewRegistry(0).RegisterFunc("redis", func(ctx context.Context) error { return nil })
+	server := httptest.NewServer(registry.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report Report
+	if err = json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || report.Dependencies["redis"].Status != StatusUp {
+		t.Errorf("unexpected response %d %+v", resp.StatusCode, report)
+	}
+
+	registry.RegisterFunc("nats", func(ctx context.Context) error { return errors.New("disconnected") })
+	resp, err = http.Get(server.URL + "?name=nats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", resp.StatusCode)
+	}
+}
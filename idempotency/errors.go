@@ -0,0 +1,12 @@
+package idempotency
+
+import bizerrors "github.com/crypto-zero/go-biz/errors"
+
+var (
+	// ErrKeyRequired is returned when Required is set and the request has no idempotency key.
+	ErrKeyRequired = bizerrors.New(400, "IDEMPOTENCY_KEY_REQUIRED", "idempotency key is required")
+	// ErrKeyTooLong is returned when the idempotency key exceeds MaxKeyLength.
+	ErrKeyTooLong = bizerrors.New(400, "IDEMPOTENCY_KEY_TOO_LONG", "idempotency key is too long")
+	// ErrInProgress is returned for a retry while the first request is still being handled.
+	ErrInProgress = bizerrors.New(409, "IDEMPOTENCY_IN_PROGRESS", "request with the same idempotency key is in progress")
+)
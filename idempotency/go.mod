@@ -0,0 +1,27 @@
+module github.com/crypto-zero/go-biz/idempotency
+
+go 1.23.2
+
+require (
+	github.com/alicebob/miniredis/v2 v2.35.0
+	github.com/crypto-zero/go-biz/errors v0.0.0-20261017044233-fe84fbec5feb
+	github.com/go-kratos/kratos/v2 v2.8.4
+	github.com/redis/go-redis/v9 v9.10.0
+	github.com/stretchr/testify v1.10.0
+	google.golang.org/protobuf v1.33.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/go-playground/form/v4 v4.2.0 // indirect
+	github.com/golang/protobuf v1.5.4 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240102182953-50ed04b92917 // indirect
+	google.golang.org/grpc v1.61.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
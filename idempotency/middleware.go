@@ -0,0 +1,192 @@
+// Package idempotency provides a Kratos middleware that replays the first response
+// of requests sharing an Idempotency-Key header, so clients can safely retry.
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	// DefaultHeader is the default header carrying the idempotency key.
+	DefaultHeader = "Idempotency-Key"
+	// defaultTTL is the default time a response is replayed.
+	defaultTTL = 24 * time.Hour
+	// defaultLockTTL is the default time a request is considered in progress.
+	defaultLockTTL = time.Minute
+	// defaultMaxKeyLength is the default max length of an idempotency key.
+	defaultMaxKeyLength = 255
+)
+
+// Options is the options of the middleware.
+type Options struct {
+	// Prefix is the redis key prefix.
+	Prefix string
+	// Header is the header carrying the idempotency key, DefaultHeader by default.
+	Header string
+	// TTL is the time the first response is replayed.
+	TTL time.Duration
+	// LockTTL bounds the time a request is in progress, retries within it get ErrInProgress.
+	LockTTL time.Duration
+	// MaxKeyLength is the max length of an idempotency key.
+	MaxKeyLength int
+	// Required rejects requests without an idempotency key with ErrKeyRequired.
+	Required bool
+	// Scope returns the scope of the key, e.g. the user id, so keys of different users
+	// never collide. The operation is always part of the key.
+	Scope func(ctx context.Context) string
+}
+
+func (o *Options) applyDefaultValue() {
+	if o.Header == "" {
+		o.Header = DefaultHeader
+	}
+	if o.TTL == 0 {
+		o.TTL = defaultTTL
+	}
+	if o.LockTTL == 0 {
+		o.LockTTL = defaultLockTTL
+	}
+	if o.MaxKeyLength == 0 {
+		o.MaxKeyLength = defaultMaxKeyLength
+	}
+}
+
+// response is the stored first response, either the reply or the error status.
+type response struct {
+	InProgress bool              `json:"in_progress,omitempty"`
+	Reply      []byte            `json:"reply,omitempty"`
+	Code       int32             `json:"code,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+	Message    string            `json:"message,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// Server returns the middleware. The first request of a key is handled and its reply, or
+// its error when the code is below 500, is stored for TTL and replayed to the retries.
+// Server errors are not stored so the request can be retried. Replies must be proto
+// messages, other replies are passed through without being stored.
+func Server(client redis.UniversalClient, opts Options) middleware.Middleware {
+	opts.applyDefaultValue()
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+			idempotencyKey := tr.RequestHeader().Get(opts.Header)
+			if idempotencyKey == "" {
+				if opts.Required {
+					return nil, ErrKeyRequired
+				}
+				return handler(ctx, req)
+			}
+			if len(idempotencyKey) > opts.MaxKeyLength {
+				return nil, ErrKeyTooLong
+			}
+			key := opts.key(ctx, tr.Operation(), idempotencyKey)
+
+			lock, _ := json.Marshal(response{InProgress: true})
+			acquired, err := client.SetNX(ctx, key, lock, opts.LockTTL).Result()
+			if err != nil {
+				return nil, fmt.Errorf("failed to lock idempotency key: %w", err)
+			}
+			if !acquired {
+				return replay(ctx, client, key)
+			}
+
+			reply, err := handler(ctx, req)
+			save(ctx, client, key, opts.TTL, reply, err)
+			return reply, err
+		}
+	}
+}
+
+func (o *Options) key(ctx context.Context, operation, idempotencyKey string) string {
+	scope := ""
+	if o.Scope != nil {
+		scope = o.Scope(ctx)
+	}
+	return fmt.Sprintf("%s:IDEMPOTENCY:%s:%s:%s", o.Prefix, operation, scope, idempotencyKey)
+}
+
+// save stores the response of the handler, responses that can not be replayed release
+// the key instead. It runs even when the request context is canceled.
+func save(ctx context.Context, client redis.UniversalClient, key string, ttl time.Duration,
+	reply any, handlerErr error,
+) {
+	ctx = context.WithoutCancel(ctx)
+	resp, ok := newResponse(reply, handlerErr)
+	if !ok {
+		client.Del(ctx, key)
+		return
+	}
+	data, _ := json.Marshal(resp)
+	client.Set(ctx, key, data, ttl)
+}
+
+// newResponse encodes the reply or the error, it reports false for server errors and
+// replies that are not proto messages.
+func newResponse(reply any, err error) (response, bool) {
+	if err != nil {
+		se := kerrors.FromError(err)
+		if se.Code >= 500 {
+			return response{}, false
+		}
+		return response{Code: se.Code, Reason: se.Reason, Message: se.Message, Metadata: se.Metadata}, true
+	}
+	msg, ok := reply.(proto.Message)
+	if !ok {
+		return response{}, false
+	}
+	value, err := anypb.New(msg)
+	if err != nil {
+		return response{}, false
+	}
+	data, err := proto.Marshal(value)
+	if err != nil {
+		return response{}, false
+	}
+	return response{Reply: data}, true
+}
+
+// replay returns the stored response of key.
+func replay(ctx context.Context, client redis.UniversalClient, key string) (any, error) {
+	data, err := client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		// The first request failed and released the key in between.
+		return nil, ErrInProgress
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotent response: %w", err)
+	}
+	var resp response
+	if err = json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode idempotent response: %w", err)
+	}
+	if resp.InProgress {
+		return nil, ErrInProgress
+	}
+	if resp.Code != 0 {
+		return nil, kerrors.New(int(resp.Code), resp.Reason, resp.Message).WithMetadata(resp.Metadata)
+	}
+	var value anypb.Any
+	if err = proto.Unmarshal(resp.Reply, &value); err != nil {
+		return nil, fmt.Errorf("failed to decode idempotent reply: %w", err)
+	}
+	reply, err := value.UnmarshalNew()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode idempotent reply: %w", err)
+	}
+	return reply, nil
+}
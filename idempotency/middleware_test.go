@@ -0,0 +1,109 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	mr "github.com/alicebob/miniredis/v2"
+	kerrors "github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type headerCarrier map[string]string
+
+func (h headerCarrier) Get(key string) string      { return h[key] }
+func (h headerCarrier) Set(key, value string)      { h[key] = value }
+func (h headerCarrier) Add(key, value string)      { h[key] = value }
+func (h headerCarrier) Keys() []string             { return nil }
+func (h headerCarrier) Values(key string) []string { return []string{h[key]} }
+
+type testTransport struct {
+	header headerCarrier
+}
+
+func (t *testTransport) Kind() transport.Kind            { return transport.KindHTTP }
+func (t *testTransport) Endpoint() string                { return "" }
+func (t *testTransport) Operation() string               { return "/payment.v1.Payment/Pay" }
+func (t *testTransport) RequestHeader() transport.Header { return t.header }
+func (t *testTransport) ReplyHeader() transport.Header   { return headerCarrier{} }
+
+func newContext(key string) context.Context {
+	header := headerCarrier{}
+	if key != "" {
+		header[DefaultHeader] = key
+	}
+	return transport.NewServerContext(context.Background(), &testTransport{header: header})
+}
+
+func newClient(t *testing.T) redis.UniversalClient {
+	s := mr.RunT(t)
+	return redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{s.Addr()}})
+}
+
+func TestServerReplaysReply(t *testing.T) {
+	calls := 0
+	handler := Server(newClient(t), Options{Prefix: "TEST"})(func(ctx context.Context, req any) (any, error) {
+		calls++
+		return wrapperspb.String("paid"), nil
+	})
+
+	for i := 0; i < 2; i++ {
+		reply, err := handler(newContext("key-1"), nil)
+		require.NoError(t, err)
+		assert.True(t, proto.Equal(wrapperspb.String("paid"), reply.(proto.Message)))
+	}
+	assert.Equal(t, 1, calls)
+
+	_, err := handler(newContext(""), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestServerReplaysClientError(t *testing.T) {
+	calls := 0
+	handler := Server(newClient(t), Options{Prefix: "TEST"})(func(ctx context.Context, req any) (any, error) {
+		calls++
+		if calls == 1 {
+			return nil, kerrors.BadRequest("INSUFFICIENT_BALANCE", "insufficient balance")
+		}
+		return nil, errors.New("database unavailable")
+	})
+
+	_, err := handler(newContext("key-1"), nil)
+	assert.True(t, kerrors.IsBadRequest(err))
+	_, err = handler(newContext("key-1"), nil)
+	assert.Equal(t, "INSUFFICIENT_BALANCE", kerrors.Reason(err))
+	assert.Equal(t, 1, calls)
+
+	// Server errors are not stored, the retry runs the handler again.
+	_, err = handler(newContext("key-2"), nil)
+	require.Error(t, err)
+	_, err = handler(newContext("key-2"), nil)
+	require.Error(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestServerInProgress(t *testing.T) {
+	client := newClient(t)
+	var handler func(ctx context.Context, req any) (any, error)
+	handler = Server(client, Options{Prefix: "TEST"})(func(ctx context.Context, req any) (any, error) {
+		_, err := handler(newContext("key-1"), nil)
+		assert.ErrorIs(t, err, ErrInProgress)
+		return wrapperspb.String("paid"), nil
+	})
+	_, err := handler(newContext("key-1"), nil)
+	require.NoError(t, err)
+}
+
+func TestServerRequired(t *testing.T) {
+	handler := Server(newClient(t), Options{Prefix: "TEST", Required: true})(
+		func(ctx context.Context, req any) (any, error) { return wrapperspb.String("paid"), nil })
+	_, err := handler(newContext(""), nil)
+	assert.ErrorIs(t, err, ErrKeyRequired)
+}
@@ -0,0 +1,59 @@
+package publisher
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+)
+
+const (
+	// ChunkIDHeader is the header carrying the message id of a chunked payload.
+	ChunkIDHeader = "Nats-Chunk-Id"
+	// ChunkIndexHeader is the header carrying the zero based index of the chunk.
+	ChunkIndexHeader = "Nats-Chunk-Index"
+	// ChunkFinalHeader marks the last chunk of a chunked payload.
+	ChunkFinalHeader = "Nats-Chunk-Final"
+)
+
+// chunkHeaderReserve is the part of the server max payload reserved for the message headers.
+const chunkHeaderReserve = 4 * 1024
+
+// chunkSize returns the max payload size of a message, larger payloads are chunked.
+func (c *JetStreamPublisher) chunkSize() int {
+	if c.options.ChunkSize > 0 {
+		return c.options.ChunkSize
+	}
+	return int(c.conn.MaxPayload()) - chunkHeaderReserve
+}
+
+// chunk splits the message into chunks of at most chunkSize bytes. Every chunk keeps the
+// headers of the message, carries the chunk headers and has the message id suffixed
+// with its index, so retried chunks are de-duplicated by the stream.
+func (c *JetStreamPublisher) chunk(msg *nats.Msg) []*nats.Msg {
+	size := c.chunkSize()
+	if size <= 0 || len(msg.Data) <= size {
+		return []*nats.Msg{msg}
+	}
+	msgID := msg.Header.Get(nats.MsgIdHdr)
+	if msgID == "" {
+		msgID = nuid.Next()
+	}
+	chunks := make([]*nats.Msg, 0, (len(msg.Data)+size-1)/size)
+	for index, offset := 0, 0; offset < len(msg.Data); index, offset = index+1, offset+size {
+		chunk := nats.NewMsg(msg.Subject)
+		for key, values := range msg.Header {
+			chunk.Header[key] = values
+		}
+		chunk.Header.Set(nats.MsgIdHdr, fmt.Sprintf("%s-%d", msgID, index))
+		chunk.Header.Set(ChunkIDHeader, msgID)
+		chunk.Header.Set(ChunkIndexHeader, strconv.Itoa(index))
+		chunk.Data = msg.Data[offset:min(offset+size, len(msg.Data))]
+		if offset+size >= len(msg.Data) {
+			chunk.Header.Set(ChunkFinalHeader, "true")
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
@@ -0,0 +1,53 @@
+package publisher
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/nats-io/nats.go"
+)
+
+// ContentEncodingHeader is the header carrying the payload compression algorithm.
+const ContentEncodingHeader = "Content-Encoding"
+
+// defaultCompressionThreshold is the min payload size compressed when compression is enabled.
+const defaultCompressionThreshold = 1024
+
+// Compression is the payload compression algorithm.
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionS2   Compression = "s2"
+	CompressionGzip Compression = "gzip"
+)
+
+// compress compresses the message payload when it exceeds the threshold
+// and records the algorithm in the ContentEncodingHeader.
+func (c Compression) compress(msg *nats.Msg, threshold int) error {
+	if c == CompressionNone || len(msg.Data) < threshold {
+		return nil
+	}
+	var data []byte
+	switch c {
+	case CompressionS2:
+		data = s2.Encode(nil, msg.Data)
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(msg.Data); err != nil {
+			return fmt.Errorf("gzip compress failed: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("gzip compress failed: %w", err)
+		}
+		data = buf.Bytes()
+	default:
+		return fmt.Errorf("unsupported compression: %s", c)
+	}
+	msg.Data = data
+	msg.Header.Set(ContentEncodingHeader, string(c))
+	return nil
+}
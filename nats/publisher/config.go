@@ -0,0 +1,84 @@
+package publisher
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidConfig is returned when the publisher config is invalid.
+var ErrInvalidConfig = errors.New("invalid publisher config")
+
+// Duration is a time.Duration decoded from strings like "720h".
+type Duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", text, err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Config is the publisher config, loadable from YAML or env. Zero values use the
+// defaults of JetStreamPublisherOptions. Encryption keys are not part of the config.
+type Config struct {
+	StreamName           string      `json:"stream_name" yaml:"stream_name"`
+	SubjectPattern       string      `json:"subject_pattern" yaml:"subject_pattern"`
+	RepublishSource      string      `json:"republish_source" yaml:"republish_source"`
+	RepublishDestination string      `json:"republish_destination" yaml:"republish_destination"`
+	StreamReplicasSize   int         `json:"stream_replicas_size" yaml:"stream_replicas_size"`
+	StreamMaxAge         Duration    `json:"stream_max_age" yaml:"stream_max_age"`
+	StreamMaxBytes       int64       `json:"stream_max_bytes" yaml:"stream_max_bytes"`
+	RequireAck           bool        `json:"require_ack" yaml:"require_ack"`
+	PendingBufferSize    int         `json:"pending_buffer_size" yaml:"pending_buffer_size"`
+	PublishRetries       int         `json:"publish_retries" yaml:"publish_retries"`
+	PublishRetryWait     Duration    `json:"publish_retry_wait" yaml:"publish_retry_wait"`
+	Compression          Compression `json:"compression" yaml:"compression"`
+	CompressionThreshold int         `json:"compression_threshold" yaml:"compression_threshold"`
+	ChunkSize            int         `json:"chunk_size" yaml:"chunk_size"`
+}
+
+// Validate checks the stream is named, the compression is supported and no value is negative.
+func (c Config) Validate() error {
+	if c.StreamName == "" || c.SubjectPattern == "" {
+		return fmt.Errorf("%w: stream name or subject pattern is empty", ErrInvalidConfig)
+	}
+	switch c.Compression {
+	case CompressionNone, CompressionS2, CompressionGzip:
+	default:
+		return fmt.Errorf("%w: unsupported compression %s", ErrInvalidConfig, c.Compression)
+	}
+	if c.StreamReplicasSize < 0 || c.StreamMaxAge < 0 || c.StreamMaxBytes < 0 || c.PendingBufferSize < 0 ||
+		c.PublishRetries < 0 || c.PublishRetryWait < 0 || c.CompressionThreshold < 0 || c.ChunkSize < 0 {
+		return fmt.Errorf("%w: negative value", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Options converts the config to the options of NewJetStreamPublisher.
+func (c Config) Options() JetStreamPublisherOptions {
+	return JetStreamPublisherOptions{
+		StreamName:           c.StreamName,
+		SubjectPattern:       c.SubjectPattern,
+		RepublishSource:      c.RepublishSource,
+		RepublishDestination: c.RepublishDestination,
+		StreamReplicasSize:   c.StreamReplicasSize,
+		StreamMaxAge:         time.Duration(c.StreamMaxAge),
+		StreamMaxBytes:       c.StreamMaxBytes,
+		RequireAck:           c.RequireAck,
+		PendingBufferSize:    c.PendingBufferSize,
+		PublishRetries:       c.PublishRetries,
+		PublishRetryWait:     time.Duration(c.PublishRetryWait),
+		Compression:          c.Compression,
+		CompressionThreshold: c.CompressionThreshold,
+		ChunkSize:            c.ChunkSize,
+	}
+}
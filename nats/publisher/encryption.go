@@ -0,0 +1,96 @@
+package publisher
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats.go"
+)
+
+// EncryptionKeyIDHeader is the header carrying the id of the key that encrypted the payload.
+const EncryptionKeyIDHeader = "Nats-Encryption-Key-Id"
+
+// ErrEncryptionKeysNotSet is returned when subject encryption is configured without a KeyProvider.
+var ErrEncryptionKeysNotSet = errors.New("encryption key provider is not set")
+
+// KeyProvider resolves AES-128/192/256 keys by key id.
+type KeyProvider interface {
+	Key(id string) ([]byte, error)
+}
+
+// KeyProviderFunc is a function adapter of KeyProvider.
+type KeyProviderFunc func(id string) ([]byte, error)
+
+// Key implements KeyProvider.
+func (f KeyProviderFunc) Key(id string) ([]byte, error) {
+	return f(id)
+}
+
+// SubjectEncryption encrypts the payload of subjects matching SubjectPattern with the key KeyID.
+type SubjectEncryption struct {
+	SubjectPattern string
+	KeyID          string
+}
+
+// encryptor encrypts payloads with AES-GCM for the configured subject patterns.
+type encryptor struct {
+	rules []SubjectEncryption
+	keys  KeyProvider
+}
+
+func newEncryptor(rules []SubjectEncryption, keys KeyProvider) (*encryptor, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	if keys == nil {
+		return nil, ErrEncryptionKeysNotSet
+	}
+	e := &encryptor{rules: rules, keys: keys}
+	for _, rule := range rules {
+		if _, err := e.aead(rule.KeyID); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (e *encryptor) aead(keyID string) (cipher.AEAD, error) {
+	key, err := e.keys.Key(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encryption key %s: %w", keyID, err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key %s: %w", keyID, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt seals the payload as nonce|ciphertext when the subject matches a rule
+// and records the key id in the EncryptionKeyIDHeader.
+func (e *encryptor) encrypt(msg *nats.Msg) error {
+	if e == nil {
+		return nil
+	}
+	for _, rule := range e.rules {
+		if !jsm.SubjectIsSubsetMatch(msg.Subject, rule.SubjectPattern) {
+			continue
+		}
+		aead, err := e.aead(rule.KeyID)
+		if err != nil {
+			return err
+		}
+		nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(msg.Data)+aead.Overhead())
+		if _, err = rand.Read(nonce); err != nil {
+			return fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		msg.Data = aead.Seal(nonce, nonce, msg.Data, []byte(rule.KeyID))
+		msg.Header.Set(EncryptionKeyIDHeader, rule.KeyID)
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+)
+
+// Partitioner maps message keys to a fixed number of partition subjects, e.g. key
+// "order-42" to ORDERS.5, so the messages of one entity always land on the same
+// partition and keep their order while partitions are consumed by different workers.
+type Partitioner struct {
+	// Prefix is the subject prefix, the partition number is appended as the last token.
+	Prefix string
+	// Partitions is the number of partitions, it must not change once messages are published.
+	Partitions int
+}
+
+// Partition returns the partition of the key.
+func (p Partitioner) Partition(key string) int {
+	if p.Partitions <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(p.Partitions))
+}
+
+// Subject returns the partition subject of the key.
+func (p Partitioner) Subject(key string) string {
+	return fmt.Sprintf("%s.%d", p.Prefix, p.Partition(key))
+}
+
+// PublishByKey publishes the message to the partition subject of the key.
+func (c *JetStreamPublisher) PublishByKey(ctx context.Context, partitioner Partitioner, key, msgID string,
+	data []byte,
+) error {
+	return c.Publish(ctx, partitioner.Subject(key), msgID, data)
+}
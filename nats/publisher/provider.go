@@ -0,0 +1,21 @@
+package publisher
+
+import (
+	"github.com/google/wire"
+	"go.uber.org/fx"
+)
+
+// ProviderSet is the wire provider set of the publishers. The application provides
+// the *nats.Conn and the JetStreamPublisherOptions.
+var ProviderSet = wire.NewSet(
+	NewJetStreamPublisher,
+	NewJetStreamMessagePublisher,
+)
+
+// Module is the fx equivalent of ProviderSet.
+var Module = fx.Options(
+	fx.Provide(
+		NewJetStreamPublisher,
+		NewJetStreamMessagePublisher,
+	),
+)
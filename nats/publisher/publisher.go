@@ -2,7 +2,9 @@ package publisher
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/nats-io/jsm.go"
@@ -17,8 +19,41 @@ const (
 	defaultStreamMaxAge = 3 * 31 * 24 * time.Hour // equivalent to 3 months.
 	// defaultStreamMaxBytes the max bytes of the nats stream. equivalent to 20GB
 	defaultStreamMaxBytes = 20 * 1 << 30
+	// defaultPendingBufferSize is the max number of messages buffered while reconnecting.
+	defaultPendingBufferSize = 1024
+	// defaultPublishRetryWait is the wait between two publish attempts.
+	defaultPublishRetryWait = 200 * time.Millisecond
+	// defaultPublishTimeout is the publish timeout used when the context has no deadline.
+	defaultPublishTimeout = 5 * time.Second
 )
 
+var (
+	// ErrPendingBufferFull is returned when the connection is down and the pending buffer is full.
+	ErrPendingBufferFull = errors.New("publisher pending buffer is full")
+	// ErrAckRequired is returned by publishes that need the stream ack without RequireAck.
+	ErrAckRequired = errors.New("publisher requires stream ack")
+	// ErrWrongLastSequence is returned when the expected last subject sequence does not match.
+	ErrWrongLastSequence = errors.New("wrong last subject sequence")
+)
+
+// PublishError reports a buffered message that could not be delivered after reconnecting.
+type PublishError struct {
+	Subject string
+	MsgID   string
+	Data    []byte
+	Err     error
+}
+
+// Error implements the error interface.
+func (e *PublishError) Error() string {
+	return fmt.Sprintf("failed to publish message %s to %s: %s", e.MsgID, e.Subject, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
 type JetStreamPublisherOptions struct {
 	StreamName           string
 	SubjectPattern       string
@@ -27,6 +62,29 @@ type JetStreamPublisherOptions struct {
 	StreamReplicasSize   int
 	StreamMaxAge         time.Duration
 	StreamMaxBytes       int64
+	// RequireAck creates the stream with acknowledgements enabled, or enables them on an
+	// existing stream, and waits for the stream ack on every publish, which gives
+	// at-least-once delivery. Retried publishes are de-duplicated by the stream through
+	// the message id.
+	RequireAck bool
+	// PendingBufferSize is the max number of messages buffered while the connection is
+	// reconnecting, they are published once the connection is re-established.
+	PendingBufferSize int
+	// PublishRetries is the number of retries of a failed publish.
+	PublishRetries int
+	// PublishRetryWait is the wait between two publish attempts.
+	PublishRetryWait time.Duration
+	// Compression compresses payloads of at least CompressionThreshold bytes,
+	// subscribers decompress them transparently.
+	Compression          Compression
+	CompressionThreshold int
+	// Encryption encrypts the payload of the matching subjects with AES-GCM using the
+	// keys resolved by EncryptionKeys, the first matching rule wins.
+	Encryption     []SubjectEncryption
+	EncryptionKeys KeyProvider
+	// ChunkSize is the max payload size of a message, larger payloads are split into
+	// chunks that subscribers reassemble. Zero derives it from the server max payload.
+	ChunkSize int
 }
 
 func (o *JetStreamPublisherOptions) applyDefaultValue() {
@@ -39,22 +97,230 @@ func (o *JetStreamPublisherOptions) applyDefaultValue() {
 	if o.StreamMaxBytes == 0 {
 		o.StreamMaxBytes = defaultStreamMaxBytes
 	}
+	if o.PendingBufferSize == 0 {
+		o.PendingBufferSize = defaultPendingBufferSize
+	}
+	if o.PublishRetryWait == 0 {
+		o.PublishRetryWait = defaultPublishRetryWait
+	}
+	if o.CompressionThreshold == 0 {
+		o.CompressionThreshold = defaultCompressionThreshold
+	}
 }
 
 type JetStreamPublisher struct {
-	conn *nats.Conn
+	conn      *nats.Conn
+	js        nats.JetStreamContext
+	options   JetStreamPublisherOptions
+	encryptor *encryptor
+	pending   chan *nats.Msg
+	errs      chan *PublishError
+
+	mu       sync.Mutex
+	flushing bool // Whether a flushPending goroutine runs
+}
+
+// Publish publishes the message. While the connection is reconnecting the message is
+// buffered and published after the reconnection, failures of buffered messages are
+// reported through Errors. Payloads exceeding the max payload size are chunked.
+func (c *JetStreamPublisher) Publish(ctx context.Context, subject string, msgID string, data []byte) error {
+	msg, err := c.newMsg(subject, msgID, data)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range c.chunk(msg) {
+		if err = c.publish(ctx, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (c *JetStreamPublisher) Publish(_ context.Context, subject string, msgID string, data []byte) error {
+func (c *JetStreamPublisher) publish(ctx context.Context, msg *nats.Msg) error {
+	if c.conn.IsReconnecting() {
+		return c.buffer(msg)
+	}
+	err := c.publishWithRetry(ctx, msg)
+	if err != nil && c.conn.IsReconnecting() {
+		return c.buffer(msg)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	return nil
+}
+
+// PublishExpectLastSequence publishes the message only when lastSequence is the stream
+// sequence of the last message on the subject (0 when the subject has no message), and
+// returns the stream sequence of the published message. ErrWrongLastSequence is returned
+// when another writer appended to the subject concurrently, the caller should reload the
+// aggregate and retry. It requires RequireAck and is never buffered.
+func (c *JetStreamPublisher) PublishExpectLastSequence(ctx context.Context, subject, msgID string, data []byte,
+	lastSequence uint64,
+) (uint64, error) {
+	if !c.options.RequireAck {
+		return 0, ErrAckRequired
+	}
+	msg, err := c.newMsg(subject, msgID, data)
+	if err != nil {
+		return 0, err
+	}
+	opts := []nats.PubOpt{nats.ExpectLastSequencePerSubject(lastSequence)}
+	if _, ok := ctx.Deadline(); ok {
+		opts = append(opts, nats.Context(ctx))
+	} else {
+		opts = append(opts, nats.AckWait(defaultPublishTimeout))
+	}
+	ack, err := c.js.PublishMsg(msg, opts...)
+	var apiErr *nats.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence {
+		return 0, fmt.Errorf("%w: %w", ErrWrongLastSequence, err)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to publish message: %w", err)
+	}
+	return ack.Sequence, nil
+}
+
+// newMsg creates the message with the payload compressed and encrypted per the options.
+func (c *JetStreamPublisher) newMsg(subject, msgID string, data []byte) (*nats.Msg, error) {
 	msg := nats.NewMsg(subject)
 	msg.Header.Add(nats.MsgIdHdr, msgID)
 	msg.Data = data
-	if err := c.conn.PublishMsg(msg); err != nil {
-		return fmt.Errorf("failed to publish message: %w", err)
+	if err := c.options.Compression.compress(msg, c.options.CompressionThreshold); err != nil {
+		return nil, err
+	}
+	if err := c.encryptor.encrypt(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Errors returns the channel of buffered messages that could not be delivered.
+// The channel is never closed, reports are dropped when nobody drains it.
+func (c *JetStreamPublisher) Errors() <-chan *PublishError {
+	return c.errs
+}
+
+// Check checks the connection is up and the stream is reachable, it implements the
+// health checker of the publisher.
+func (c *JetStreamPublisher) Check(ctx context.Context) error {
+	if !c.conn.IsConnected() {
+		return fmt.Errorf("nats connection is %s", c.conn.Status())
+	}
+	if _, err := c.js.StreamInfo(c.options.StreamName, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("failed to get stream info: %w", err)
+	}
+	return nil
+}
+
+// buffer buffers the message until the connection is re-established. A message buffered
+// once the reconnection flush started, or after it, is flushed too.
+func (c *JetStreamPublisher) buffer(msg *nats.Msg) error {
+	select {
+	case c.pending <- msg:
+	default:
+		return ErrPendingBufferFull
+	}
+	if c.conn.IsConnected() {
+		c.startFlush()
 	}
 	return nil
 }
 
+// startFlush starts flushPending unless it is running, so a single goroutine publishes
+// the buffered messages in order.
+func (c *JetStreamPublisher) startFlush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.flushing {
+		return
+	}
+	c.flushing = true
+	go c.flushPending()
+}
+
+// flushPending publishes the messages buffered during the reconnection, until the buffer
+// is empty or the connection is down again.
+func (c *JetStreamPublisher) flushPending() {
+	for {
+		c.drainPending()
+		c.mu.Lock()
+		if len(c.pending) == 0 || !c.conn.IsConnected() {
+			c.flushing = false
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *JetStreamPublisher) drainPending() {
+	for {
+		select {
+		case msg := <-c.pending:
+			if err := c.publishWithRetry(context.Background(), msg); err != nil {
+				c.report(msg, err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (c *JetStreamPublisher) report(msg *nats.Msg, err error) {
+	pubErr := &PublishError{
+		Subject: msg.Subject,
+		MsgID:   msg.Header.Get(nats.MsgIdHdr),
+		Data:    msg.Data,
+		Err:     err,
+	}
+	select {
+	case c.errs <- pubErr:
+	default:
+	}
+}
+
+func (c *JetStreamPublisher) publishWithRetry(ctx context.Context, msg *nats.Msg) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = c.publishMsg(ctx, msg); err == nil {
+			return nil
+		}
+		if attempt >= c.options.PublishRetries || errors.Is(err, nats.ErrConnectionClosed) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.options.PublishRetryWait):
+		}
+	}
+}
+
+func (c *JetStreamPublisher) publishMsg(ctx context.Context, msg *nats.Msg) error {
+	if !c.options.RequireAck {
+		return c.conn.PublishMsg(msg)
+	}
+	opt := nats.PubOpt(nats.AckWait(defaultPublishTimeout))
+	if _, ok := ctx.Deadline(); ok {
+		opt = nats.Context(ctx)
+	}
+	_, err := c.js.PublishMsg(msg, opt)
+	return err
+}
+
+// onReconnected chains the reconnected handler of the connection with flushPending.
+func (c *JetStreamPublisher) onReconnected() {
+	origin := c.conn.Opts.ReconnectedCB
+	c.conn.SetReconnectHandler(func(conn *nats.Conn) {
+		if origin != nil {
+			origin(conn)
+		}
+		c.startFlush()
+	})
+}
+
 func (c *JetStreamPublisher) setup(opt JetStreamPublisherOptions) error {
 	if c.conn == nil {
 		return fmt.Errorf("nats conn is not set")
@@ -63,11 +329,21 @@ func (c *JetStreamPublisher) setup(opt JetStreamPublisherOptions) error {
 	if err != nil {
 		return fmt.Errorf("create jetstream manager failed: %w", err)
 	}
-	_, err = manager.LoadOrNewStream(
+	if c.encryptor, err = newEncryptor(opt.Encryption, opt.EncryptionKeys); err != nil {
+		return err
+	}
+	if c.js, err = c.conn.JetStream(); err != nil {
+		return fmt.Errorf("create jetstream context failed: %w", err)
+	}
+	ackOption := jsm.NoAck() // require by jsm.ErrAckStreamIngestsAll
+	if opt.RequireAck {
+		ackOption = func(*api.StreamConfig) error { return nil }
+	}
+	stream, err := manager.LoadOrNewStream(
 		opt.StreamName,
 		jsm.FileStorage(),
 		jsm.Subjects(opt.SubjectPattern),
-		jsm.NoAck(), // require by jsm.ErrAckStreamIngestsAll
+		ackOption,
 		jsm.Replicas(opt.StreamReplicasSize),
 		jsm.LimitsRetention(),
 		jsm.MaxAge(opt.StreamMaxAge),
@@ -87,17 +363,31 @@ func (c *JetStreamPublisher) setup(opt JetStreamPublisherOptions) error {
 	if err != nil {
 		return fmt.Errorf("failed to create jetstream: %w", err)
 	}
+	// A stream created without acknowledgements never acks the publishes waiting for it.
+	if opt.RequireAck && stream.NoAck() {
+		err = stream.UpdateConfiguration(stream.Configuration(), func(cfg *api.StreamConfig) error {
+			cfg.NoAck = false
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to enable jetstream acks: %w", err)
+		}
+	}
 	return nil
 }
 
 func NewJetStreamPublisher(conn *nats.Conn, opt JetStreamPublisherOptions) (*JetStreamPublisher, error) {
+	opt.applyDefaultValue()
 	pub := &JetStreamPublisher{
-		conn: conn,
+		conn:    conn,
+		options: opt,
+		pending: make(chan *nats.Msg, opt.PendingBufferSize),
+		errs:    make(chan *PublishError, opt.PendingBufferSize),
 	}
-	opt.applyDefaultValue()
 	if err := pub.setup(opt); err != nil {
 		return nil, err
 	}
+	pub.onReconnected()
 	return pub, nil
 }
 
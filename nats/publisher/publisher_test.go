@@ -1,9 +1,19 @@
 package publisher
 
 import (
+	"bytes"
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"testing"
+	"time"
 
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/jsm.go/api"
 	natsserver "github.com/nats-io/nats-server/v2/test"
 	"github.com/nats-io/nats.go"
 )
@@ -12,6 +22,7 @@ func TestPublisher(t *testing.T) {
 	opt := natsserver.DefaultTestOptions
 	opt.Port = -1
 	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
 	srv := natsserver.RunServer(&opt)
 
 	nc, err := nats.Connect(srv.ClientURL())
@@ -36,4 +47,504 @@ func TestPublisher(t *testing.T) {
 	if err = pub.Publish(context.Background(), "TEST.1", "123", []byte("hello world")); err != nil {
 		t.Error(err)
 	}
+	if err = pub.Check(context.Background()); err != nil {
+		t.Errorf("expected healthy publisher, got %v", err)
+	}
+	nc.Close()
+	if err = pub.Check(context.Background()); err == nil {
+		t.Error("expected unhealthy publisher after close")
+	}
+}
+
+func TestPublisherReconnectBuffering(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+	defer srv.Shutdown()
+
+	nc, err := nats.Connect(srv.ClientURL(), nats.MaxReconnects(-1), nats.ReconnectWait(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	pub, err := NewJetStreamPublisher(nc, JetStreamPublisherOptions{
+		StreamName:         "TEST",
+		SubjectPattern:     "TEST.*",
+		StreamReplicasSize: 1,
+		RequireAck:         true,
+		PublishRetries:     2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pub.Publish(context.Background(), "TEST.1", "1", []byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+
+	opt.Port = srv.Addr().(*net.TCPAddr).Port
+	srv.Shutdown()
+	deadline := time.Now().Add(2 * time.Second)
+	for !nc.IsReconnecting() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err = pub.Publish(context.Background(), "TEST.1", "2", []byte("buffered")); err != nil {
+		t.Fatal(err)
+	}
+
+	srv = natsserver.RunServer(&opt)
+	defer srv.Shutdown()
+
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for time.Now().Before(deadline.Add(5 * time.Second)) {
+		info, err := js.StreamInfo("TEST")
+		if err == nil && info.State.Msgs == 2 {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Error("buffered message was not published after reconnect")
+}
+
+func TestPublisherBufferAfterReconnect(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+	defer srv.Shutdown()
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	pub, err := NewJetStreamPublisher(nc, JetStreamPublisherOptions{
+		StreamName:         "TEST",
+		SubjectPattern:     "TEST.*",
+		StreamReplicasSize: 1,
+		RequireAck:         true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A publish that saw the connection reconnecting buffers after the reconnection flush.
+	msg, err := pub.newMsg("TEST.1", "1", []byte("late"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pub.buffer(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		info, err := js.StreamInfo("TEST")
+		if err == nil && info.State.Msgs == 1 {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Error("message buffered after the reconnection was not published")
+}
+
+func TestPublisherCompression(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+	defer srv.Shutdown()
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	pub, err := NewJetStreamPublisher(nc, JetStreamPublisherOptions{
+		StreamName:           "TEST",
+		SubjectPattern:       "TEST.*",
+		StreamReplicasSize:   1,
+		RequireAck:           true,
+		Compression:          CompressionS2,
+		CompressionThreshold: 16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	large := bytes.Repeat([]byte("hello world "), 100)
+	if err = pub.Publish(context.Background(), "TEST.large", "1", large); err != nil {
+		t.Fatal(err)
+	}
+	if err = pub.Publish(context.Background(), "TEST.small", "2", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := js.GetLastMsg("TEST", "TEST.large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get(ContentEncodingHeader) != string(CompressionS2) || len(msg.Data) >= len(large) {
+		t.Errorf("expected s2 compressed payload, got %d bytes", len(msg.Data))
+	}
+	msg, err = js.GetLastMsg("TEST", "TEST.small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get(ContentEncodingHeader) != "" || string(msg.Data) != "hello" {
+		t.Errorf("expected uncompressed payload, got %q", msg.Data)
+	}
+}
+
+func TestPublisherEncryption(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+	defer srv.Shutdown()
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	key := bytes.Repeat([]byte{1}, 32)
+	pub, err := NewJetStreamPublisher(nc, JetStreamPublisherOptions{
+		StreamName:         "TEST",
+		SubjectPattern:     "TEST.>",
+		StreamReplicasSize: 1,
+		RequireAck:         true,
+		Encryption:         []SubjectEncryption{{SubjectPattern: "TEST.USER.*", KeyID: "v1"}},
+		EncryptionKeys: KeyProviderFunc(func(id string) ([]byte, error) {
+			return key, nil
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pub.Publish(context.Background(), "TEST.USER.1", "1", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err = pub.Publish(context.Background(), "TEST.ORDER.1", "2", []byte("public")); err != nil {
+		t.Fatal(err)
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := js.GetLastMsg("TEST", "TEST.USER.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get(EncryptionKeyIDHeader) != "v1" || bytes.Contains(msg.Data, []byte("secret")) {
+		t.Fatalf("expected encrypted payload, got %q", msg.Data)
+	}
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	plaintext, err := aead.Open(nil, msg.Data[:aead.NonceSize()], msg.Data[aead.NonceSize():], []byte("v1"))
+	if err != nil || string(plaintext) != "secret" {
+		t.Errorf("failed to decrypt payload: %v", err)
+	}
+	msg, err = js.GetLastMsg("TEST", "TEST.ORDER.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get(EncryptionKeyIDHeader) != "" || string(msg.Data) != "public" {
+		t.Errorf("expected plaintext payload, got %q", msg.Data)
+	}
+}
+
+func TestSubjectMatches(t *testing.T) {
+	cases := []struct {
+		pattern, subject string
+		match            bool
+	}{
+		{"TEST.*", "TEST.1", true},
+		{"TEST.*", "TEST.1.2", false},
+		{"TEST.>", "TEST.1.2", true},
+		{"TEST.>", "TEST", false},
+		{"TEST.1", "TEST.1", true},
+		{"TEST.1", "TEST.2", false},
+	}
+	for _, c := range cases {
+		if got := jsm.SubjectIsSubsetMatch(c.subject, c.pattern); got != c.match {
+			t.Errorf("SubjectIsSubsetMatch(%q, %q) = %v", c.subject, c.pattern, got)
+		}
+	}
+}
+
+func TestSetupStreamTopology(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+	defer srv.Shutdown()
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	for _, name := range []string{"ORDERS", "USERS"} {
+		_, err = NewJetStreamPublisher(nc, JetStreamPublisherOptions{
+			StreamName:         name,
+			SubjectPattern:     name + ".*",
+			StreamReplicasSize: 1,
+			StreamMaxBytes:     1 << 20,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mirror := StreamTopologyOptions{
+		StreamName:         "ORDERS_DR",
+		Mirror:             &StreamSource{Name: "ORDERS"},
+		StreamReplicasSize: 1,
+		StreamMaxBytes:     1 << 20,
+	}
+	for i := 0; i < 2; i++ {
+		if err = SetupStreamTopology(nc, mirror); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mirror.Mirror = &StreamSource{Name: "USERS"}
+	if err = SetupStreamTopology(nc, mirror); !errors.Is(err, ErrMirrorChanged) {
+		t.Errorf("expected ErrMirrorChanged, got %v", err)
+	}
+
+	sourced := StreamTopologyOptions{
+		StreamName:         "AGGREGATE",
+		Sources:            []StreamSource{{Name: "ORDERS"}},
+		StreamReplicasSize: 1,
+		StreamMaxBytes:     1 << 20,
+	}
+	if err = SetupStreamTopology(nc, sourced); err != nil {
+		t.Fatal(err)
+	}
+	sourced.Sources = append(sourced.Sources, StreamSource{Name: "USERS", FilterSubject: "USERS.*"})
+	if err = SetupStreamTopology(nc, sourced); err != nil {
+		t.Fatal(err)
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := js.StreamInfo("AGGREGATE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Config.Sources) != 2 {
+		t.Errorf("expected 2 sources, got %d", len(info.Config.Sources))
+	}
+}
+
+func TestSameSources(t *testing.T) {
+	want := []*api.StreamSource{
+		{Name: "ORDERS"},
+		{Name: "USERS", FilterSubject: "USERS.*", External: &api.ExternalStream{ApiPrefix: "$JS.hub.API"}},
+	}
+	// The server fills in the fields the publisher doesn't set and may reorder the sources.
+	got := []*api.StreamSource{
+		{Name: "USERS", FilterSubject: "USERS.*", OptStartSeq: 10,
+			External: &api.ExternalStream{ApiPrefix: "$JS.hub.API", DeliverPrefix: "deliver"}},
+		{Name: "ORDERS", External: &api.ExternalStream{}},
+	}
+	if !sameSources(got, want) {
+		t.Error("expected the same sources")
+	}
+	got[0].FilterSubject = "USERS.created"
+	if sameSources(got, want) {
+		t.Error("expected different sources")
+	}
+	if sameSources(got[:1], want) {
+		t.Error("expected different sources")
+	}
+}
+
+func TestPublisherRequireAckExistingStream(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+	defer srv.Shutdown()
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	options := JetStreamPublisherOptions{
+		StreamName:         "TEST",
+		SubjectPattern:     "TEST.*",
+		StreamReplicasSize: 1,
+	}
+	if _, err = NewJetStreamPublisher(nc, options); err != nil {
+		t.Fatal(err)
+	}
+	options.RequireAck = true
+	pub, err := NewJetStreamPublisher(nc, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err = pub.PublishExpectLastSequence(ctx, "TEST.1", "1", []byte("hello world"), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishExpectLastSequence(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+	defer srv.Shutdown()
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	pub, err := NewJetStreamPublisher(nc, JetStreamPublisherOptions{
+		StreamName:         "ORDERS",
+		SubjectPattern:     "ORDERS.*",
+		StreamReplicasSize: 1,
+		RequireAck:         true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	seq, err := pub.PublishExpectLastSequence(ctx, "ORDERS.1", "1", []byte("created"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pub.PublishExpectLastSequence(ctx, "ORDERS.2", "2", []byte("created"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pub.PublishExpectLastSequence(ctx, "ORDERS.1", "3", []byte("paid"), seq); err != nil {
+		t.Fatal(err)
+	}
+	_, err = pub.PublishExpectLastSequence(ctx, "ORDERS.1", "4", []byte("cancelled"), seq)
+	if !errors.Is(err, ErrWrongLastSequence) {
+		t.Errorf("expected ErrWrongLastSequence, got %v", err)
+	}
+}
+
+func TestPartitioner(t *testing.T) {
+	p := Partitioner{Prefix: "ORDERS", Partitions: 8}
+	seen := make(map[int]bool)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("order-%d", i)
+		partition := p.Partition(key)
+		if partition < 0 || partition >= p.Partitions {
+			t.Fatalf("partition %d out of range", partition)
+		}
+		if p.Partition(key) != partition {
+			t.Fatalf("partition of %s is not stable", key)
+		}
+		if p.Subject(key) != fmt.Sprintf("ORDERS.%d", partition) {
+			t.Fatalf("unexpected subject %s", p.Subject(key))
+		}
+		seen[partition] = true
+	}
+	if len(seen) != p.Partitions {
+		t.Errorf("expected keys spread over %d partitions, got %d", p.Partitions, len(seen))
+	}
+}
+
+func TestPublisherChunking(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+	defer srv.Shutdown()
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	pub, err := NewJetStreamPublisher(nc, JetStreamPublisherOptions{
+		StreamName:         "TEST",
+		SubjectPattern:     "TEST.*",
+		StreamReplicasSize: 1,
+		RequireAck:         true,
+		ChunkSize:          100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	large := bytes.Repeat([]byte("a"), 250)
+	if err = pub.Publish(context.Background(), "TEST.large", "1", large); err != nil {
+		t.Fatal(err)
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data []byte
+	for seq := uint64(1); seq <= 3; seq++ {
+		msg, err := js.GetMsg("TEST", seq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Header.Get(ChunkIDHeader) != "1" || msg.Header.Get(ChunkIndexHeader) != fmt.Sprint(seq-1) {
+			t.Errorf("unexpected chunk headers %v", msg.Header)
+		}
+		if final := msg.Header.Get(ChunkFinalHeader) != ""; final != (seq == 3) {
+			t.Errorf("unexpected final marker on chunk %d", seq)
+		}
+		data = append(data, msg.Data...)
+	}
+	if !bytes.Equal(data, large) {
+		t.Errorf("unexpected chunked payload %d bytes", len(data))
+	}
+}
+
+func TestConfig(t *testing.T) {
+	var cfg Config
+	err := json.Unmarshal([]byte(`{"stream_name":"TEST","subject_pattern":"TEST.*",
+		"stream_max_age":"720h","compression":"s2"}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if opts := cfg.Options(); opts.StreamMaxAge != 720*time.Hour || opts.Compression != CompressionS2 {
+		t.Errorf("unexpected options %+v", opts)
+	}
+	cfg.Compression = "zstd"
+	if err = cfg.Validate(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig, got %v", err)
+	}
 }
@@ -0,0 +1,143 @@
+package publisher
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/jsm.go/api"
+	"github.com/nats-io/nats.go"
+)
+
+// ErrMirrorChanged is returned when an existing stream mirrors a different source,
+// the server does not allow changing the mirror of a stream.
+var ErrMirrorChanged = errors.New("stream mirror configuration can not be changed")
+
+// StreamSource is an upstream stream replicated into a mirror or sourced stream.
+type StreamSource struct {
+	// Name is the upstream stream name.
+	Name string
+	// FilterSubject only replicates the matching subjects, empty replicates all.
+	FilterSubject string
+	// Domain is the JetStream domain of the upstream stream, used across clusters/leaf nodes.
+	Domain string
+}
+
+func (s StreamSource) source() *api.StreamSource {
+	source := &api.StreamSource{Name: s.Name, FilterSubject: s.FilterSubject}
+	if s.Domain != "" {
+		source.External = &api.ExternalStream{ApiPrefix: fmt.Sprintf("$JS.%s.API", s.Domain)}
+	}
+	return source
+}
+
+// StreamTopologyOptions declares a stream that mirrors or sources other streams, e.g. a DR
+// copy of the primary stream in another cluster. Mirror and Sources are mutually exclusive.
+type StreamTopologyOptions struct {
+	StreamName         string
+	Mirror             *StreamSource
+	Sources            []StreamSource
+	StreamReplicasSize int
+	StreamMaxAge       time.Duration
+	StreamMaxBytes     int64
+}
+
+func (o *StreamTopologyOptions) applyDefaultValue() {
+	if o.StreamReplicasSize == 0 {
+		o.StreamReplicasSize = defaultStreamReplicasSize
+	}
+	if o.StreamMaxAge == 0 {
+		o.StreamMaxAge = defaultStreamMaxAge
+	}
+	if o.StreamMaxBytes == 0 {
+		o.StreamMaxBytes = defaultStreamMaxBytes
+	}
+}
+
+func (o *StreamTopologyOptions) sources() []*api.StreamSource {
+	sources := make([]*api.StreamSource, 0, len(o.Sources))
+	for _, source := range o.Sources {
+		sources = append(sources, source.source())
+	}
+	return sources
+}
+
+// SetupStreamTopology creates the mirrored/sourced stream, or reconciles the sources of
+// an existing stream with the options.
+func SetupStreamTopology(conn *nats.Conn, opt StreamTopologyOptions) error {
+	if conn == nil {
+		return fmt.Errorf("nats conn is not set")
+	}
+	if (opt.Mirror == nil) == (len(opt.Sources) == 0) {
+		return fmt.Errorf("exactly one of mirror or sources must be set")
+	}
+	opt.applyDefaultValue()
+	manager, err := jsm.New(conn)
+	if err != nil {
+		return fmt.Errorf("create jetstream manager failed: %w", err)
+	}
+	topology := jsm.Sources(opt.sources()...)
+	if opt.Mirror != nil {
+		topology = jsm.Mirror(opt.Mirror.source())
+	}
+	stream, err := manager.LoadOrNewStream(
+		opt.StreamName,
+		jsm.FileStorage(),
+		topology,
+		jsm.Replicas(opt.StreamReplicasSize),
+		jsm.LimitsRetention(),
+		jsm.MaxAge(opt.StreamMaxAge),
+		jsm.MaxBytes(opt.StreamMaxBytes),
+		jsm.DiscardOld(),
+		jsm.AllowDirect(),
+		jsm.Compression(api.S2Compression),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create jetstream: %w", err)
+	}
+
+	cfg := stream.Configuration()
+	if opt.Mirror != nil {
+		if cfg.Mirror == nil || sourceKey(cfg.Mirror) != sourceKey(opt.Mirror.source()) {
+			return ErrMirrorChanged
+		}
+		return nil
+	}
+	if sameSources(cfg.Sources, opt.sources()) {
+		return nil
+	}
+	if err = stream.UpdateConfiguration(cfg, jsm.Sources(opt.sources()...)); err != nil {
+		return fmt.Errorf("failed to update jetstream sources: %w", err)
+	}
+	return nil
+}
+
+// sourceKey identifies a stream source by the fields this package sets, the server fills
+// in others like the start sequence.
+func sourceKey(source *api.StreamSource) string {
+	var apiPrefix string
+	if source.External != nil {
+		apiPrefix = source.External.ApiPrefix
+	}
+	return fmt.Sprintf("%s\x00%s\x00%s", source.Name, source.FilterSubject, apiPrefix)
+}
+
+// sameSources reports whether a and b have the same sources in any order.
+func sameSources(a, b []*api.StreamSource) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	keys := make(map[string]int, len(a))
+	for _, source := range a {
+		keys[sourceKey(source)]++
+	}
+	for _, source := range b {
+		key := sourceKey(source)
+		if keys[key] == 0 {
+			return false
+		}
+		keys[key]--
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+package subscriber
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// ChunkIDHeader is the header carrying the message id of a chunked payload.
+	ChunkIDHeader = "Nats-Chunk-Id"
+	// ChunkIndexHeader is the header carrying the zero based index of the chunk.
+	ChunkIndexHeader = "Nats-Chunk-Index"
+	// ChunkFinalHeader marks the last chunk of a chunked payload.
+	ChunkFinalHeader = "Nats-Chunk-Final"
+)
+
+// defaultChunkTimeout is the time a partially received chunked payload is kept.
+const defaultChunkTimeout = time.Minute
+
+const (
+	// chunkHeaderReserve is the part of the server max payload the publisher reserves for
+	// the message headers.
+	chunkHeaderReserve = 4 * 1024
+	// defaultServerMaxPayload is the default max payload of the server.
+	defaultServerMaxPayload = 1024 * 1024
+)
+
+// maxChunks returns the chunk count of a payload of maxPayloadSize bytes, chunked by the
+// publisher at the server max payload.
+func maxChunks(serverMaxPayload int64, maxPayloadSize int) uint {
+	if serverMaxPayload <= chunkHeaderReserve {
+		serverMaxPayload = defaultServerMaxPayload
+	}
+	size := int(serverMaxPayload) - chunkHeaderReserve
+	return uint(max((maxPayloadSize+size-1)/size, 1))
+}
+
+// errChunkIncomplete is returned by reassembler.add until all chunks are received.
+var errChunkIncomplete = errors.New("chunked payload is incomplete")
+
+type chunkBuffer struct {
+	chunks  map[int]*nats.Msg
+	count   int
+	size    int
+	started time.Time
+}
+
+// reassembler buffers the chunks of chunked payloads until they are complete. The chunks
+// are not acknowledged until the payload is handled, so a restart or a failed handler
+// redelivers all of them, and the buffered ones are kept in progress meanwhile. Buffers
+// older than the timeout are dropped, their chunks are redelivered after the ack wait.
+// Payloads larger than maxSize are dropped with all their chunks.
+type reassembler struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	maxSize int
+	buffers map[string]*chunkBuffer
+}
+
+func newReassembler(timeout time.Duration, maxSize int) *reassembler {
+	return &reassembler{timeout: timeout, maxSize: maxSize, buffers: make(map[string]*chunkBuffer)}
+}
+
+// add buffers the chunk and returns the payload id, data and chunks once all chunks are
+// received. A payload exceeding maxSize returns its chunks with an error.
+func (r *reassembler) add(msg *nats.Msg) (string, []byte, []*nats.Msg, error) {
+	id := msg.Header.Get(ChunkIDHeader)
+	index, err := strconv.Atoi(msg.Header.Get(ChunkIndexHeader))
+	if err != nil || index < 0 {
+		return "", nil, nil, fmt.Errorf("invalid chunk index %q of %s", msg.Header.Get(ChunkIndexHeader), id)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for key, buffer := range r.buffers {
+		if now.Sub(buffer.started) > r.timeout {
+			delete(r.buffers, key)
+		}
+	}
+	buffer, ok := r.buffers[id]
+	if !ok {
+		buffer = &chunkBuffer{chunks: make(map[int]*nats.Msg), started: now}
+		r.buffers[id] = buffer
+	}
+	// A redelivered chunk replaces the previous delivery.
+	if previous, ok := buffer.chunks[index]; ok {
+		buffer.size -= len(previous.Data)
+	}
+	buffer.chunks[index] = msg
+	buffer.size += len(msg.Data)
+	if buffer.size > r.maxSize {
+		delete(r.buffers, id)
+		msgs := make([]*nats.Msg, 0, len(buffer.chunks))
+		for _, chunk := range buffer.chunks {
+			msgs = append(msgs, chunk)
+		}
+		return id, nil, msgs, fmt.Errorf("chunked payload %s exceeds %d bytes", id, r.maxSize)
+	}
+	if msg.Header.Get(ChunkFinalHeader) != "" {
+		buffer.count = index + 1
+	}
+	if buffer.count == 0 || len(buffer.chunks) < buffer.count {
+		return id, nil, nil, errChunkIncomplete
+	}
+	var data []byte
+	msgs := make([]*nats.Msg, 0, buffer.count)
+	for i := 0; i < buffer.count; i++ {
+		chunk, ok := buffer.chunks[i]
+		if !ok {
+			return id, nil, nil, errChunkIncomplete
+		}
+		data = append(data, chunk.Data...)
+		msgs = append(msgs, chunk)
+	}
+	return id, data, msgs, nil
+}
+
+// pending returns the number of buffered chunks.
+func (r *reassembler) pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int
+	for _, buffer := range r.buffers {
+		n += len(buffer.chunks)
+	}
+	return n
+}
+
+// chunks returns the buffered chunks, and drops the buffers when release is set.
+func (r *reassembler) chunks(release bool) []*nats.Msg {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var msgs []*nats.Msg
+	for _, buffer := range r.buffers {
+		for _, msg := range buffer.chunks {
+			msgs = append(msgs, msg)
+		}
+	}
+	if release {
+		clear(r.buffers)
+	}
+	return msgs
+}
+
+// done releases the buffer of the handled payload.
+func (r *reassembler) done(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.buffers, id)
+}
@@ -0,0 +1,52 @@
+package subscriber
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/nats-io/nats.go"
+)
+
+// ContentEncodingHeader is the header carrying the payload compression algorithm.
+const ContentEncodingHeader = "Content-Encoding"
+
+// decompress returns the payload decompressed according to the ContentEncodingHeader, a
+// payload that can not be decompressed or exceeds maxSize once decompressed is malformed.
+func decompress(msg *nats.Msg, data []byte, maxSize int) ([]byte, error) {
+	switch encoding := msg.Header.Get(ContentEncodingHeader); encoding {
+	case "":
+		return data, nil
+	case "s2":
+		size, err := s2.DecodedLen(data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: s2 decompress failed: %w", errMalformedPayload, err)
+		}
+		if size > maxSize {
+			return nil, fmt.Errorf("%w: decompressed payload exceeds %d bytes", errMalformedPayload, maxSize)
+		}
+		data, err = s2.Decode(nil, data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: s2 decompress failed: %w", errMalformedPayload, err)
+		}
+		return data, nil
+	case "gzip":
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: gzip decompress failed: %w", errMalformedPayload, err)
+		}
+		defer r.Close()
+		data, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+		if err != nil {
+			return nil, fmt.Errorf("%w: gzip decompress failed: %w", errMalformedPayload, err)
+		}
+		if len(data) > maxSize {
+			return nil, fmt.Errorf("%w: decompressed payload exceeds %d bytes", errMalformedPayload, maxSize)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported content encoding: %s", errMalformedPayload, encoding)
+	}
+}
@@ -0,0 +1,114 @@
+package subscriber
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidConfig is returned when the subscriber config is invalid.
+var ErrInvalidConfig = errors.New("invalid subscriber config")
+
+// Duration is a time.Duration decoded from strings like "10s".
+type Duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", text, err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+var deliverOptions = map[string]DeliverOption{
+	"":                 DeliverOptionUnspecified,
+	"all":              DeliverOptionAllAvailable,
+	"last_per_subject": DeliverOptionLastPerSubject,
+	"start_time":       DeliverOptionStartAtTime,
+	"start_sequence":   DeliverOptionStartAtSequence,
+}
+
+var panicActions = map[string]PanicAction{
+	"":     PanicActionNone,
+	"none": PanicActionNone,
+	"nak":  PanicActionNak,
+	"term": PanicActionTerm,
+}
+
+// Config is the subscriber config, loadable from YAML or env. Zero values use the
+// defaults of JetStreamSubscriberOptions. Callbacks and encryption keys are not part
+// of the config.
+type Config struct {
+	ConsumerPrefix     string   `json:"consumer_prefix" yaml:"consumer_prefix"`
+	StreamName         string   `json:"stream_name" yaml:"stream_name"`
+	AckWait            Duration `json:"ack_wait" yaml:"ack_wait"`
+	MaxDeliverAttempts int      `json:"max_deliver_attempts" yaml:"max_deliver_attempts"`
+	MaxWaiting         uint     `json:"max_waiting" yaml:"max_waiting"`
+	MaxAckPending      uint     `json:"max_ack_pending" yaml:"max_ack_pending"`
+	// DeliverOption is one of all, last_per_subject, start_time and start_sequence.
+	DeliverOption        string    `json:"deliver_option" yaml:"deliver_option"`
+	DeliverStartTime     time.Time `json:"deliver_start_time" yaml:"deliver_start_time"`
+	DeliverStartSequence uint64    `json:"deliver_start_sequence" yaml:"deliver_start_sequence"`
+	OrderedConsumer      bool      `json:"ordered_consumer" yaml:"ordered_consumer"`
+	InactiveThreshold    Duration  `json:"inactive_threshold" yaml:"inactive_threshold"`
+	// PanicAction is one of none, nak and term.
+	PanicAction    string   `json:"panic_action" yaml:"panic_action"`
+	PullHeartbeat  Duration `json:"pull_heartbeat" yaml:"pull_heartbeat"`
+	IdleTimeout    Duration `json:"idle_timeout" yaml:"idle_timeout"`
+	ChunkTimeout   Duration `json:"chunk_timeout" yaml:"chunk_timeout"`
+	MaxPayloadSize int      `json:"max_payload_size" yaml:"max_payload_size"`
+}
+
+// Validate checks the stream is named, the enums are known and the deliver start is set.
+func (c Config) Validate() error {
+	if c.StreamName == "" {
+		return fmt.Errorf("%w: stream name is empty", ErrInvalidConfig)
+	}
+	deliver, ok := deliverOptions[c.DeliverOption]
+	if !ok {
+		return fmt.Errorf("%w: unsupported deliver option %s", ErrInvalidConfig, c.DeliverOption)
+	}
+	if deliver == DeliverOptionStartAtTime && c.DeliverStartTime.IsZero() {
+		return fmt.Errorf("%w: deliver start time is empty", ErrInvalidConfig)
+	}
+	if deliver == DeliverOptionStartAtSequence && c.DeliverStartSequence == 0 {
+		return fmt.Errorf("%w: deliver start sequence is empty", ErrInvalidConfig)
+	}
+	if _, ok = panicActions[c.PanicAction]; !ok {
+		return fmt.Errorf("%w: unsupported panic action %s", ErrInvalidConfig, c.PanicAction)
+	}
+	if c.AckWait < 0 || c.MaxDeliverAttempts < 0 || c.InactiveThreshold < 0 || c.PullHeartbeat < 0 ||
+		c.IdleTimeout < 0 || c.ChunkTimeout < 0 || c.MaxPayloadSize < 0 {
+		return fmt.Errorf("%w: negative value", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Options converts the config to the options of NewJetStreamSubscriber.
+func (c Config) Options() JetStreamSubscriberOptions {
+	return JetStreamSubscriberOptions{
+		ConsumerPrefix:       c.ConsumerPrefix,
+		StreamName:           c.StreamName,
+		AckWait:              time.Duration(c.AckWait),
+		MaxDeliverAttempts:   c.MaxDeliverAttempts,
+		MaxWaiting:           c.MaxWaiting,
+		MaxAckPending:        c.MaxAckPending,
+		DeliverOption:        deliverOptions[c.DeliverOption],
+		DeliverStartTime:     c.DeliverStartTime,
+		DeliverStartSequence: c.DeliverStartSequence,
+		OrderedConsumer:      c.OrderedConsumer,
+		InactiveThreshold:    time.Duration(c.InactiveThreshold),
+		PanicAction:          panicActions[c.PanicAction],
+		PullHeartbeat:        time.Duration(c.PullHeartbeat),
+		IdleTimeout:          time.Duration(c.IdleTimeout),
+		ChunkTimeout:         time.Duration(c.ChunkTimeout),
+		MaxPayloadSize:       c.MaxPayloadSize,
+	}
+}
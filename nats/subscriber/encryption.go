@@ -0,0 +1,64 @@
+package subscriber
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// EncryptionKeyIDHeader is the header carrying the id of the key that encrypted the payload.
+const EncryptionKeyIDHeader = "Nats-Encryption-Key-Id"
+
+// ErrEncryptionKeysNotSet is returned when an encrypted payload is received without a KeyProvider.
+var ErrEncryptionKeysNotSet = errors.New("encryption key provider is not set")
+
+// KeyProvider resolves AES-128/192/256 keys by key id.
+type KeyProvider interface {
+	Key(id string) ([]byte, error)
+}
+
+// KeyProviderFunc is a function adapter of KeyProvider.
+type KeyProviderFunc func(id string) ([]byte, error)
+
+// Key implements KeyProvider.
+func (f KeyProviderFunc) Key(id string) ([]byte, error) {
+	return f(id)
+}
+
+// decrypt opens the nonce|ciphertext payload sealed with the key of the EncryptionKeyIDHeader.
+// Only a payload that can not be opened is malformed, a key that can not be resolved, e.g.
+// during a key store outage or before a rotated key is known, fails the delivery so the
+// message is redelivered.
+func decrypt(msg *nats.Msg, data []byte, keys KeyProvider) ([]byte, error) {
+	keyID := msg.Header.Get(EncryptionKeyIDHeader)
+	if keyID == "" {
+		return data, nil
+	}
+	if keys == nil {
+		return nil, ErrEncryptionKeysNotSet
+	}
+	key, err := keys.Key(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get encryption key %s: %w", keyID, err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key %s: %w", keyID, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key %s: %w", keyID, err)
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: encrypted payload is too short", errMalformedPayload)
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decrypt payload: %w", errMalformedPayload, err)
+	}
+	return plaintext, nil
+}
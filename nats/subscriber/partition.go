@@ -0,0 +1,72 @@
+package subscriber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/nats.go"
+)
+
+// Partitions describes a subject partitioned by the publisher Partitioner, e.g. ORDERS.0 .. ORDERS.7.
+type Partitions struct {
+	// Prefix is the subject prefix, the partition number is the last token.
+	Prefix string
+	// Count is the number of partitions, it must match the publisher.
+	Count int
+}
+
+// Subject returns the subject of the partition.
+func (p Partitions) Subject(partition int) string {
+	return fmt.Sprintf("%s.%d", p.Prefix, partition)
+}
+
+// Assign returns the partitions consumed by the worker out of workers, assigned round-robin.
+func (p Partitions) Assign(worker, workers int) []int {
+	var assigned []int
+	for partition := 0; partition < p.Count; partition++ {
+		if workers <= 1 || partition%workers == worker {
+			assigned = append(assigned, partition)
+		}
+	}
+	return assigned
+}
+
+// SubscribePartitions consumes the assigned partitions, each one with its own durable
+// consumer named "<consumer>_<partition>" filtered to the partition subject. With MaxAckPending 1 the messages of a
+// partition are handled strictly in order while the partitions are handled concurrently.
+// It blocks until ctx is done or a partition subscription fails, which stops the others.
+func (s *JetStreamSubscriber) SubscribePartitions(ctx context.Context, partitions Partitions, assigned []int,
+	consumer string, handler Handler, subOpts ...nats.SubOpt,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for _, partition := range assigned {
+		wg.Add(1)
+		go func(partition int) {
+			defer wg.Done()
+			subject := partitions.Subject(partition)
+			err := s.subscribe(ctx, subject, fmt.Sprintf("%s_%d", consumer, partition), handler,
+				[]jsm.ConsumerOption{jsm.FilterStreamBySubject(subject)}, subOpts...)
+			if err == nil || errors.Is(err, context.Canceled) {
+				return
+			}
+			once.Do(func() {
+				firstErr = err
+				cancel()
+			})
+		}(partition)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
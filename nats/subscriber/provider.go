@@ -0,0 +1,23 @@
+package subscriber
+
+import (
+	"github.com/google/wire"
+	"go.uber.org/fx"
+)
+
+// ProviderSet is the wire provider set of the subscriber and its transport server. The
+// application provides the *nats.Conn, the JetStreamSubscriberOptions and the *slog.Logger.
+var ProviderSet = wire.NewSet(
+	NewJetStreamSubscriber,
+	NewServer,
+	NewRouter,
+)
+
+// Module is the fx equivalent of ProviderSet.
+var Module = fx.Options(
+	fx.Provide(
+		NewJetStreamSubscriber,
+		NewServer,
+		NewRouter,
+	),
+)
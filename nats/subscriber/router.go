@@ -0,0 +1,88 @@
+package subscriber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/jsm.go"
+)
+
+// ErrNoRoute is returned by the Router when no handler matches the message subject.
+var ErrNoRoute = errors.New("no route for subject")
+
+// Router is a Handler dispatching messages to the handler registered for the matching
+// subject pattern, so one consumer can serve many message types.
+// Patterns support the NATS wildcards * and >, a literal pattern takes precedence over
+// wildcard patterns, which are matched in registration order.
+type Router struct {
+	mu       sync.RWMutex
+	literals map[string]Handler
+	routes   []route
+	notFound Handler
+}
+
+type route struct {
+	pattern string
+	handler Handler
+}
+
+// Compile-time assertion: Router implements Handler.
+var _ Handler = (*Router)(nil)
+
+// NewRouter creates an empty Router.
+func NewRouter() *Router {
+	return &Router{literals: make(map[string]Handler)}
+}
+
+// Route registers the handler for the subject pattern.
+func (r *Router) Route(pattern string, handler Handler) *Router {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !strings.ContainsAny(pattern, "*>") {
+		r.literals[pattern] = handler
+		return r
+	}
+	r.routes = append(r.routes, route{pattern: pattern, handler: handler})
+	return r
+}
+
+// RouteFunc registers the handler function for the subject pattern.
+func (r *Router) RouteFunc(pattern string, handler HandlerFunc) *Router {
+	return r.Route(pattern, handler)
+}
+
+// NotFound sets the handler of messages matching no route, by default ErrNoRoute is returned.
+func (r *Router) NotFound(handler Handler) *Router {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notFound = handler
+	return r
+}
+
+// Handle implements Handler.
+func (r *Router) Handle(ctx context.Context, subject, id string, data []byte,
+	inProgress func(ctx context.Context) error,
+) error {
+	handler := r.match(subject)
+	if handler == nil {
+		return fmt.Errorf("%w: %s", ErrNoRoute, subject)
+	}
+	return handler.Handle(ctx, subject, id, data, inProgress)
+}
+
+func (r *Router) match(subject string) Handler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if handler, ok := r.literals[subject]; ok {
+		return handler
+	}
+	for _, route := range r.routes {
+		if jsm.SubjectIsSubsetMatch(subject, route.pattern) {
+			return route.handler
+		}
+	}
+	return r.notFound
+}
@@ -0,0 +1,102 @@
+package subscriber
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/nats-io/nats.go"
+)
+
+// Compile-time assertion: Server implements kratos transport.Server.
+var _ transport.Server = (*Server)(nil)
+
+// Server runs the registered subscriptions of a JetStreamSubscriber as a kratos
+// transport.Server, so consumers share the application lifecycle with HTTP/gRPC servers.
+type Server struct {
+	subscriber    *JetStreamSubscriber
+	subscriptions []subscription
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type subscription struct {
+	subject  string
+	consumer string
+	handler  Handler
+	subOpts  []nats.SubOpt
+}
+
+// NewServer creates a Server consuming with the subscriber.
+func NewServer(subscriber *JetStreamSubscriber) *Server {
+	return &Server{subscriber: subscriber}
+}
+
+// Subscribe registers a subscription started by Start.
+func (s *Server) Subscribe(subject, consumer string, handler Handler, subOpts ...nats.SubOpt) *Server {
+	s.subscriptions = append(s.subscriptions, subscription{
+		subject:  subject,
+		consumer: consumer,
+		handler:  handler,
+		subOpts:  subOpts,
+	})
+	return s
+}
+
+// Start runs all subscriptions and blocks until Stop is called or a subscription fails,
+// in which case the other subscriptions are stopped and the error is returned.
+func (s *Server) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	s.mu.Lock()
+	s.cancel, s.done = cancel, done
+	s.mu.Unlock()
+	defer close(done)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for _, sub := range s.subscriptions {
+		wg.Add(1)
+		go func(sub subscription) {
+			defer wg.Done()
+			err := s.subscriber.Subscribe(ctx, sub.subject, sub.consumer, sub.handler, sub.subOpts...)
+			if err == nil || errors.Is(err, context.Canceled) {
+				return
+			}
+			s.subscriber.logger.ErrorContext(ctx, "subscription stopped", "subject", sub.subject,
+				"consumer", sub.consumer, "err", err)
+			once.Do(func() {
+				firstErr = err
+				cancel()
+			})
+		}(sub)
+	}
+	s.subscriber.logger.InfoContext(ctx, "subscriber server started", "subscriptions", len(s.subscriptions))
+	wg.Wait()
+	return firstErr
+}
+
+// Stop cancels the subscriptions and waits for the in-flight handlers until ctx is done.
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	select {
+	case <-done:
+		s.subscriber.logger.InfoContext(ctx, "subscriber server stopped")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"log/slog"
 	"math/rand/v2"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/nats-io/jsm.go"
+	"github.com/nats-io/jsm.go/api"
 	"github.com/nats-io/nats.go"
 )
 
@@ -19,29 +23,70 @@ const (
 	defaultMaxDeliverAttempts = 400
 	// defaultMaxWaiting is the default max waiting
 	defaultMaxWaiting = 1
-	// defaultMaxAckPending is the default max pending
-	defaultMaxAckPending = 1
+	// defaultMaxPayloadSize is the default max decompressed payload size
+	defaultMaxPayloadSize = 64 << 20
 	// jitterMillis the consumer jitter millis
 	jitterMillis = 100
 )
 
+// errHandlerPanic is returned by handle when the handler panicked.
+var errHandlerPanic = errors.New("handler panicked")
+
+// errMalformedPayload is returned by handle when the payload can not be decoded.
+var errMalformedPayload = errors.New("malformed payload")
+
 type DeliverOption int
 
 const (
 	DeliverOptionUnspecified DeliverOption = iota
 	DeliverOptionAllAvailable
 	DeliverOptionLastPerSubject
+	// DeliverOptionStartAtTime delivers from the first message at or after DeliverStartTime.
+	DeliverOptionStartAtTime
+	// DeliverOptionStartAtSequence delivers from the stream sequence DeliverStartSequence.
+	DeliverOptionStartAtSequence
 )
 
-func (o DeliverOption) option() jsm.ConsumerOption {
-	switch o {
+// deliverOption returns the deliver policy of new consumers.
+func (o *JetStreamSubscriberOptions) deliverOption() jsm.ConsumerOption {
+	switch o.DeliverOption {
 	case DeliverOptionLastPerSubject:
 		return jsm.DeliverLastPerSubject()
+	case DeliverOptionStartAtTime:
+		return jsm.StartAtTime(o.DeliverStartTime)
+	case DeliverOptionStartAtSequence:
+		return jsm.StartAtSequence(o.DeliverStartSequence)
 	default:
 		return jsm.DeliverAllAvailable()
 	}
 }
 
+// deliverSubOption returns the deliver policy of ordered consumers.
+func (o *JetStreamSubscriberOptions) deliverSubOption() nats.SubOpt {
+	switch o.DeliverOption {
+	case DeliverOptionLastPerSubject:
+		return nats.DeliverLastPerSubject()
+	case DeliverOptionStartAtTime:
+		return nats.StartTime(o.DeliverStartTime)
+	case DeliverOptionStartAtSequence:
+		return nats.StartSequence(o.DeliverStartSequence)
+	default:
+		return nats.DeliverAll()
+	}
+}
+
+// PanicAction is the action taken on a message whose handler panicked.
+type PanicAction int
+
+const (
+	// PanicActionNone leaves the message unacknowledged, it is redelivered after AckWait.
+	PanicActionNone PanicAction = iota
+	// PanicActionNak negatively acknowledges the message for an immediate redelivery.
+	PanicActionNak
+	// PanicActionTerm terminates the message, it is never redelivered.
+	PanicActionTerm
+)
+
 type JetStreamSubscriberOptions struct {
 	ConsumerPrefix     string
 	StreamName         string
@@ -50,6 +95,40 @@ type JetStreamSubscriberOptions struct {
 	MaxWaiting         uint
 	MaxAckPending      uint
 	DeliverOption      DeliverOption
+	// DeliverStartTime is the start time of DeliverOptionStartAtTime.
+	DeliverStartTime time.Time
+	// DeliverStartSequence is the start stream sequence of DeliverOptionStartAtSequence.
+	DeliverStartSequence uint64
+	// OrderedConsumer consumes with an ordered consumer: an ephemeral, flow-controlled
+	// push consumer that is recreated on gaps and delivers messages strictly in stream
+	// order without acks. Handler errors are logged and the message is skipped.
+	OrderedConsumer bool
+	// InactiveThreshold lets the server remove the created consumers after they have
+	// been inactive for the duration, zero keeps them until they are deleted.
+	InactiveThreshold time.Duration
+	// PanicAction is the action taken on a message whose handler panicked.
+	PanicAction PanicAction
+	// EncryptionKeys resolves the keys of payloads encrypted by the publisher.
+	EncryptionKeys KeyProvider
+	// PullHeartbeat asks the server to send idle heartbeats during a fetch, a missed
+	// heartbeat recreates the subscription and calls OnStalled. It must be less than
+	// half of the fetch wait (5s).
+	PullHeartbeat time.Duration
+	// OnStalled is called with the consumer name when a pull heartbeat is missed.
+	OnStalled func(consumer string, err error)
+	// IdleTimeout calls OnIdle when no message has been received for the duration.
+	IdleTimeout time.Duration
+	// OnIdle is called with the consumer name and idle duration when IdleTimeout elapses.
+	OnIdle func(consumer string, idle time.Duration)
+	// ChunkTimeout is the time the chunks of a chunked payload are kept until the
+	// payload is complete. The chunks are acknowledged once the payload is handled, so
+	// MaxAckPending must be at least the chunk count of the payloads, and the chunks of a
+	// payload must reach one worker of the consumer. Zero MaxAckPending defaults to the
+	// chunk count of a MaxPayloadSize payload split at the server max payload.
+	ChunkTimeout time.Duration
+	// MaxPayloadSize is the max size of a decompressed payload, larger payloads are
+	// malformed so a small compressed payload can't exhaust the memory.
+	MaxPayloadSize int
 }
 
 func (o *JetStreamSubscriberOptions) applyDefaultValue() {
@@ -63,8 +142,11 @@ func (o *JetStreamSubscriberOptions) applyDefaultValue() {
 	if o.MaxWaiting == 0 {
 		o.MaxWaiting = defaultMaxWaiting
 	}
-	if o.MaxAckPending == 0 {
-		o.MaxAckPending = defaultMaxAckPending
+	if o.ChunkTimeout == 0 {
+		o.ChunkTimeout = defaultChunkTimeout
+	}
+	if o.MaxPayloadSize == 0 {
+		o.MaxPayloadSize = defaultMaxPayloadSize
 	}
 }
 
@@ -72,6 +154,7 @@ type JetStreamSubscriber struct {
 	conn    *nats.Conn
 	options JetStreamSubscriberOptions
 	logger  *slog.Logger
+	panics  atomic.Uint64
 }
 
 type Handler interface {
@@ -89,8 +172,17 @@ func (f HandlerFunc) Handle(ctx context.Context, subject, id string, data []byte
 func (s *JetStreamSubscriber) Subscribe(ctx context.Context, subject, consumer string, handler Handler,
 	subOpts ...nats.SubOpt,
 ) error {
+	return s.subscribe(ctx, subject, consumer, handler, nil, subOpts...)
+}
+
+func (s *JetStreamSubscriber) subscribe(ctx context.Context, subject, consumer string, handler Handler,
+	consumerOpts []jsm.ConsumerOption, subOpts ...nats.SubOpt,
+) error {
+	if s.options.OrderedConsumer {
+		return s.subscribeOrdered(ctx, subject, handler, subOpts...)
+	}
 	var err error
-	consumer, err = s.initialConsumer(consumer)
+	consumer, err = s.initialConsumer(consumer, consumerOpts...)
 	if err != nil {
 		return err
 	}
@@ -103,90 +195,383 @@ func (s *JetStreamSubscriber) Subscribe(ctx context.Context, subject, consumer s
 		return fmt.Errorf("failed to pull subcription: %w", err)
 	}
 
-	defer func(subscription *nats.Subscription) {
+	defer func() {
 		err = subscription.Unsubscribe()
 		if err != nil {
 			s.logger.ErrorContext(ctx, "failed to unsubscribe from jetstream", "err", err)
 		}
-	}(subscription)
+	}()
 
+	chunks := newReassembler(s.options.ChunkTimeout, s.options.MaxPayloadSize)
+	go s.keepChunksInProgress(ctx, chunks)
+
+	lastReceived := time.Now()
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			if err = s.fetchMessage(ctx, subscription, handler); err != nil {
+			received, err := s.fetchMessage(ctx, subscription, handler, chunks)
+			if errors.Is(err, nats.ErrNoHeartbeat) {
+				// The consumer is wedged, recreate the subscription.
+				s.logger.WarnContext(ctx, "missed pull heartbeat, recreating subscription", "consumer", consumer)
+				if s.options.OnStalled != nil {
+					s.options.OnStalled(consumer, err)
+				}
+				if err = subscription.Unsubscribe(); err != nil {
+					s.logger.ErrorContext(ctx, "failed to unsubscribe from jetstream", "err", err)
+				}
+				if subscription, err = jsc.PullSubscribe(subject, consumer, subOpts...); err != nil {
+					return fmt.Errorf("failed to pull subcription: %w", err)
+				}
+				continue
+			}
+			if err != nil {
 				return err
 			}
+			if received {
+				lastReceived = time.Now()
+			} else if idle := time.Since(lastReceived); s.options.IdleTimeout > 0 && idle >= s.options.IdleTimeout {
+				if s.options.OnIdle != nil {
+					s.options.OnIdle(consumer, idle)
+				}
+				lastReceived = time.Now()
+			}
 		}
 	}
 }
 
-func (s *JetStreamSubscriber) fetchMessage(ctx context.Context, subscription *nats.Subscription,
-	handler Handler,
+// subscribeOrdered consumes subject with an ordered consumer until ctx is done.
+func (s *JetStreamSubscriber) subscribeOrdered(ctx context.Context, subject string, handler Handler,
+	subOpts ...nats.SubOpt,
 ) error {
-	messages, err := subscription.Fetch(1)
+	jsc, err := s.conn.JetStream()
+	if err != nil {
+		return fmt.Errorf("failed to create jetstream context: %w", err)
+	}
+	opts := append([]nats.SubOpt{
+		nats.BindStream(s.options.StreamName),
+		nats.OrderedConsumer(),
+		s.options.deliverSubOption(),
+	}, subOpts...)
+	subscription, err := jsc.SubscribeSync(subject, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to ordered subscription: %w", err)
+	}
+	defer func(subscription *nats.Subscription) {
+		if err := subscription.Unsubscribe(); err != nil {
+			s.logger.ErrorContext(ctx, "failed to unsubscribe from jetstream", "err", err)
+		}
+	}(subscription)
+
+	noProgress := func(context.Context) error { return nil }
+	chunks := newReassembler(s.options.ChunkTimeout, s.options.MaxPayloadSize)
+	for {
+		msg, err := subscription.NextMsgWithContext(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("next ordered message failed: %w", err)
+		}
+		_, err = s.handle(ctx, handler, msg, chunks, noProgress)
+		if errors.Is(err, errChunkIncomplete) || errors.Is(err, errHandlerPanic) {
+			continue
+		}
+		if err != nil {
+			s.logger.ErrorContext(ctx, "failed to handle message", "err", err)
+		}
+	}
+}
+
+// fetchMessage fetches and handles one message, it reports whether a message was fetched.
+func (s *JetStreamSubscriber) fetchMessage(ctx context.Context, subscription *nats.Subscription,
+	handler Handler, chunks *reassembler,
+) (bool, error) {
+	var fetchOpts []nats.PullOpt
+	if s.options.PullHeartbeat > 0 {
+		fetchOpts = append(fetchOpts, nats.PullHeartbeat(s.options.PullHeartbeat))
+	}
+	messages, err := subscription.Fetch(1, fetchOpts...)
 	if errors.Is(err, nats.ErrConsumerLeadershipChanged) {
 		select {
 		case <-ctx.Done():
-			return nil
+			return false, nil
 		case <-time.After(s.jitterDuration()):
 		}
-		return nil
+		return false, nil
 	}
 	if errors.Is(err, context.DeadlineExceeded) ||
 		errors.Is(err, context.Canceled) ||
 		errors.Is(err, nats.ErrTimeout) {
-		return nil
+		return false, nil
+	}
+	if errors.Is(err, nats.ErrNoHeartbeat) {
+		return false, err
 	}
 
 	if err != nil {
-		return fmt.Errorf("fetch message failed: %w", err)
+		return false, fmt.Errorf("fetch message failed: %w", err)
 	}
 	if len(messages) == 0 {
-		return nil
+		return false, nil
 	}
 	msg := messages[0]
-	err = handler.Handle(ctx, msg.Subject, msg.Header.Get(nats.MsgIdHdr), msg.Data, func(ctx context.Context) error {
+	// msgs are the chunks of a chunked payload, settled together.
+	msgs, err := s.handle(ctx, handler, msg, chunks, func(ctx context.Context) error {
 		return msg.InProgress(nats.Context(ctx))
 	})
+	if msgs == nil {
+		msgs = []*nats.Msg{msg}
+	}
+	if errors.Is(err, errChunkIncomplete) {
+		// The consumer delivers no more than MaxAckPending unacknowledged chunks, the
+		// payload can not complete then. Release the chunks rather than stalling.
+		if chunks.pending() >= int(s.options.MaxAckPending) {
+			s.logger.ErrorContext(ctx, "chunked payload exceeds max ack pending, releasing its chunks",
+				"max_ack_pending", s.options.MaxAckPending)
+			for _, chunk := range chunks.chunks(true) {
+				if err := chunk.NakWithDelay(s.options.AckWait, nats.Context(ctx)); err != nil {
+					s.logger.ErrorContext(ctx, "failed to nak message", "err", err)
+				}
+			}
+		}
+		return true, nil
+	}
+	if errors.Is(err, errHandlerPanic) {
+		s.onPanic(ctx, msgs)
+		return true, nil
+	}
+	if errors.Is(err, errMalformedPayload) {
+		s.logger.ErrorContext(ctx, "failed to decode message", "err", err)
+		for _, msg := range msgs {
+			if err := msg.Term(nats.Context(ctx)); err != nil {
+				s.logger.ErrorContext(ctx, "failed to term message", "err", err)
+			}
+		}
+		return true, nil
+	}
 	if err != nil {
 		s.logger.ErrorContext(ctx, "failed to handle message", "err", err)
-		return nil
+		return true, nil
+	}
+	for _, msg := range msgs {
+		if err := msg.Ack(nats.Context(ctx)); err != nil {
+			s.logger.ErrorContext(ctx, "failed to ack message", "err", err)
+		}
+	}
+	return true, nil
+}
+
+// keepChunksInProgress extends the ack wait of the buffered chunks until ctx is done.
+func (s *JetStreamSubscriber) keepChunksInProgress(ctx context.Context, chunks *reassembler) {
+	ticker := time.NewTicker(s.options.AckWait / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, chunk := range chunks.chunks(false) {
+				if err := chunk.InProgress(nats.Context(ctx)); err != nil {
+					s.logger.ErrorContext(ctx, "failed to mark chunk in progress", "err", err)
+				}
+			}
+		}
+	}
+}
+
+// handle invokes the handler, a panic inside the handler is recovered and reported as errHandlerPanic.
+// It returns the chunks of a chunked payload, errChunkIncomplete until the payload is complete.
+func (s *JetStreamSubscriber) handle(ctx context.Context, handler Handler, msg *nats.Msg,
+	chunks *reassembler, inProgress func(ctx context.Context) error,
+) (msgs []*nats.Msg, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.panics.Add(1)
+			s.logger.ErrorContext(ctx, "handler panicked", "subject", msg.Subject,
+				"id", msg.Header.Get(nats.MsgIdHdr), "panic", r, "stack", string(debug.Stack()))
+			err = errHandlerPanic
+		}
+	}()
+	id, data := msg.Header.Get(nats.MsgIdHdr), msg.Data
+	chunked := msg.Header.Get(ChunkIDHeader) != ""
+	if chunked {
+		// The handler gets the reassembled payload, the chunks are settled with it. The
+		// buffer is dropped whatever the outcome, the unsettled chunks are redelivered.
+		id, data, msgs, err = chunks.add(msg)
+		if errors.Is(err, errChunkIncomplete) {
+			return nil, err
+		}
+		if err != nil {
+			return msgs, fmt.Errorf("%w: %w", errMalformedPayload, err)
+		}
+		defer chunks.done(id)
+		if !s.options.OrderedConsumer {
+			inProgress = chunksInProgress(msg, msgs, inProgress)
+		}
+	}
+	if data, err = s.decode(msg, data); err != nil {
+		return msgs, err
+	}
+	return msgs, handler.Handle(ctx, msg.Subject, id, data, inProgress)
+}
+
+// chunksInProgress returns inProgress of msg also extending the ack wait of the other chunks.
+func chunksInProgress(msg *nats.Msg, msgs []*nats.Msg, inProgress func(ctx context.Context) error,
+) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		for _, chunk := range msgs {
+			if chunk == msg {
+				continue
+			}
+			if err := chunk.InProgress(nats.Context(ctx)); err != nil {
+				return err
+			}
+		}
+		return inProgress(ctx)
+	}
+}
+
+// decode decrypts and decompresses the payload, it returns errMalformedPayload for payloads
+// that can never be decoded.
+func (s *JetStreamSubscriber) decode(msg *nats.Msg, data []byte) ([]byte, error) {
+	data, err := decrypt(msg, data, s.options.EncryptionKeys)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(msg, data, s.options.MaxPayloadSize)
+}
+
+// onPanic applies the PanicAction to the messages whose handler panicked.
+func (s *JetStreamSubscriber) onPanic(ctx context.Context, msgs []*nats.Msg) {
+	for _, msg := range msgs {
+		var err error
+		switch s.options.PanicAction {
+		case PanicActionNak:
+			err = msg.Nak(nats.Context(ctx))
+		case PanicActionTerm:
+			err = msg.Term(nats.Context(ctx))
+		default:
+			return
+		}
+		if err != nil {
+			s.logger.ErrorContext(ctx, "failed to settle panicked message", "err", err)
+		}
 	}
-	if err := msg.Ack(nats.Context(ctx)); err != nil {
-		s.logger.ErrorContext(ctx, "failed to ack message", "err", err)
-		return nil
+}
+
+// Check checks the connection is up and the stream is reachable, it implements the
+// health checker of the subscriber.
+func (s *JetStreamSubscriber) Check(ctx context.Context) error {
+	if !s.conn.IsConnected() {
+		return fmt.Errorf("nats connection is %s", s.conn.Status())
+	}
+	jsc, err := s.conn.JetStream()
+	if err != nil {
+		return fmt.Errorf("failed to create jetstream context: %w", err)
+	}
+	if _, err = jsc.StreamInfo(s.options.StreamName, nats.Context(ctx)); err != nil {
+		return fmt.Errorf("failed to get stream info: %w", err)
 	}
 	return nil
 }
 
-func (s *JetStreamSubscriber) initialConsumer(consumer string) (string, error) {
+// Panics returns the number of handler panics recovered by the subscriber.
+func (s *JetStreamSubscriber) Panics() uint64 {
+	return s.panics.Load()
+}
+
+func (s *JetStreamSubscriber) initialConsumer(consumer string, extra ...jsm.ConsumerOption) (string, error) {
 	consumerName := s.options.ConsumerPrefix + consumer
 	manager, err := jsm.New(s.conn)
 	if err != nil {
 		return "", fmt.Errorf("failed to create jet stream manager: %w", err)
 	}
 	consumerConfig := jsm.DefaultConsumer
-	_, err = manager.LoadOrNewConsumerFromDefault(
-		s.options.StreamName,
-		consumerName,
-		consumerConfig,
+	opts := []jsm.ConsumerOption{
 		jsm.DurableName(consumerName),
 		jsm.AcknowledgeExplicit(),
 		jsm.AckWait(s.options.AckWait),
 		jsm.MaxAckPending(s.options.MaxAckPending),
-		s.options.DeliverOption.option(),
+		s.options.deliverOption(),
 		jsm.MaxDeliveryAttempts(s.options.MaxDeliverAttempts),
 		jsm.ReplayInstantly(),
 		jsm.MaxWaiting(s.options.MaxWaiting),
-	)
+	}
+	if s.options.InactiveThreshold > 0 {
+		opts = append(opts, jsm.InactiveThreshold(s.options.InactiveThreshold))
+	}
+	opts = append(opts, extra...)
+	_, err = manager.LoadOrNewConsumerFromDefault(s.options.StreamName, consumerName, consumerConfig, opts...)
 	if err != nil {
 		return "", fmt.Errorf("failed to create jetstream consumer: %w", err)
 	}
 	return consumerName, nil
 }
 
+// ErrConsumerPrefixNotSet is the error that Cleanup is called without a ConsumerPrefix,
+// which would match every consumer of the stream.
+var ErrConsumerPrefixNotSet = errors.New("consumer prefix is not set")
+
+// Cleanup deletes the durable consumers of the stream named ConsumerPrefix followed by a
+// consumer name, as this subscriber names them, that have had no activity for longer than
+// inactive, and returns the deleted consumer names. Consumers with waiting pull requests
+// are considered active. It returns ErrConsumerPrefixNotSet when ConsumerPrefix is empty.
+func (s *JetStreamSubscriber) Cleanup(ctx context.Context, inactive time.Duration) ([]string, error) {
+	if s.options.ConsumerPrefix == "" {
+		return nil, ErrConsumerPrefixNotSet
+	}
+	manager, err := jsm.New(s.conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create jet stream manager: %w", err)
+	}
+	consumers, _, err := manager.Consumers(s.options.StreamName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jetstream consumers: %w", err)
+	}
+	var deleted []string
+	now := time.Now()
+	for _, consumer := range consumers {
+		if err = ctx.Err(); err != nil {
+			return deleted, err
+		}
+		if !consumer.IsDurable() || !s.ownsConsumer(consumer.Name()) {
+			continue
+		}
+		state, err := consumer.LatestState()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to load consumer %s state: %w", consumer.Name(), err)
+		}
+		if state.NumWaiting > 0 || now.Sub(lastActive(state)) < inactive {
+			continue
+		}
+		if err = consumer.Delete(); err != nil {
+			return deleted, fmt.Errorf("failed to delete consumer %s: %w", consumer.Name(), err)
+		}
+		deleted = append(deleted, consumer.Name())
+	}
+	return deleted, nil
+}
+
+// ownsConsumer reports whether name is a consumer name generated by this subscriber, the
+// ConsumerPrefix followed by a non-empty consumer name.
+func (s *JetStreamSubscriber) ownsConsumer(name string) bool {
+	consumer, ok := strings.CutPrefix(name, s.options.ConsumerPrefix)
+	return ok && consumer != ""
+}
+
+// lastActive returns the time of the latest delivery or ack of the consumer.
+func lastActive(state api.ConsumerInfo) time.Time {
+	last := state.Created
+	for _, t := range []*time.Time{state.Delivered.Last, state.AckFloor.Last} {
+		if t != nil && t.After(last) {
+			last = *t
+		}
+	}
+	return last
+}
+
 func (s *JetStreamSubscriber) jitterDuration() time.Duration {
 	duration := jitterMillis + rand.IntN(jitterMillis)
 	return time.Duration(duration) * time.Millisecond
@@ -197,6 +582,9 @@ func NewJetStreamSubscriber(conn *nats.Conn, options JetStreamSubscriberOptions,
 	logger *slog.Logger,
 ) *JetStreamSubscriber {
 	options.applyDefaultValue()
+	if options.MaxAckPending == 0 {
+		options.MaxAckPending = maxChunks(conn.MaxPayload(), options.MaxPayloadSize)
+	}
 	return &JetStreamSubscriber{
 		conn:    conn,
 		options: options,
@@ -1,21 +1,32 @@
 package subscriber
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"reflect"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/klauspost/compress/s2"
 	"github.com/nats-io/jsm.go"
 	natsserver "github.com/nats-io/nats-server/v2/test"
 	"github.com/nats-io/nats.go"
+	"go.uber.org/fx"
 )
 
 func TestPublisher(t *testing.T) {
 	opt := natsserver.DefaultTestOptions
 	opt.Port = -1
 	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
 	srv := natsserver.RunServer(&opt)
 
 	nc, err := nats.Connect(srv.ClientURL())
@@ -70,6 +81,7 @@ func TestSubscribeContext(t *testing.T) {
 	opt := natsserver.DefaultTestOptions
 	opt.Port = -1
 	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
 	srv := natsserver.RunServer(&opt)
 
 	nc, err := nats.Connect(srv.ClientURL())
@@ -77,6 +89,13 @@ func TestSubscribeContext(t *testing.T) {
 		t.Fatal(err)
 	}
 	defer nc.Close()
+	m, err := jsm.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.NewStream("HELLO", jsm.Subjects("HELLO.*")); err != nil {
+		t.Fatal(err)
+	}
 	{
 		sub := NewJetStreamSubscriber(nc, JetStreamSubscriberOptions{
 			ConsumerPrefix: "SUB_",
@@ -111,3 +130,778 @@ func TestSubscribeContext(t *testing.T) {
 		}
 	}
 }
+
+func TestSubscribeOrdered(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	m, err := jsm.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.NewStream("ORDERED", jsm.Subjects("ORDERED.*")); err != nil {
+		t.Fatal(err)
+	}
+	messages := []string{"1", "2", "3"}
+	for _, message := range messages {
+		if err = nc.Publish("ORDERED.1", []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sub := NewJetStreamSubscriber(nc, JetStreamSubscriberOptions{
+		StreamName:      "ORDERED",
+		OrderedConsumer: true,
+	}, slog.Default().With("subscriber", "test"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ch := make(chan []byte, len(messages))
+	go sub.Subscribe(ctx, "ORDERED.1", "", HandlerFunc(func(ctx context.Context, subject, id string,
+		data []byte, inProgress func(ctx context.Context) error) error {
+		ch <- data
+		return nil
+	}))
+	for _, message := range messages {
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case data := <-ch:
+			if string(data) != message {
+				t.Errorf("expected %s, got %s", message, data)
+			}
+		}
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	m, err := jsm.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.NewStream("CLEANUP", jsm.Subjects("CLEANUP.*")); err != nil {
+		t.Fatal(err)
+	}
+
+	preview := NewJetStreamSubscriber(nc, JetStreamSubscriberOptions{
+		ConsumerPrefix:    "PREVIEW_",
+		StreamName:        "CLEANUP",
+		InactiveThreshold: time.Hour,
+	}, slog.Default().With("subscriber", "test"))
+	live := NewJetStreamSubscriber(nc, JetStreamSubscriberOptions{
+		ConsumerPrefix: "LIVE_",
+		StreamName:     "CLEANUP",
+	}, slog.Default().With("subscriber", "test"))
+	for _, sub := range []*JetStreamSubscriber{preview, live} {
+		if _, err = sub.initialConsumer("TEST"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	unprefixed := NewJetStreamSubscriber(nc, JetStreamSubscriberOptions{StreamName: "CLEANUP"},
+		slog.Default().With("subscriber", "test"))
+	if _, err = unprefixed.Cleanup(context.Background(), 0); !errors.Is(err, ErrConsumerPrefixNotSet) {
+		t.Errorf("expected ErrConsumerPrefixNotSet, got %v", err)
+	}
+	deleted, err := preview.Cleanup(context.Background(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("expected no stale consumer, got %v", deleted)
+	}
+	deleted, err = preview.Cleanup(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0] != "PREVIEW_TEST" {
+		t.Errorf("expected PREVIEW_TEST to be deleted, got %v", deleted)
+	}
+	names, err := m.ConsumerNames("CLEANUP")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "LIVE_TEST" {
+		t.Errorf("expected only LIVE_TEST to remain, got %v", names)
+	}
+}
+
+func TestSubscribePanicRecovery(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	m, err := jsm.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.NewStream("PANIC", jsm.Subjects("PANIC.*")); err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range []string{"poison", "hello world"} {
+		if err = nc.Publish("PANIC.1", []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sub := NewJetStreamSubscriber(nc, JetStreamSubscriberOptions{
+		ConsumerPrefix: "SUB_",
+		StreamName:     "PANIC",
+		PanicAction:    PanicActionTerm,
+	}, slog.Default().With("subscriber", "test"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ch := make(chan []byte, 1)
+	go sub.Subscribe(ctx, "PANIC.1", "TEST", HandlerFunc(func(ctx context.Context, subject, id string,
+		data []byte, inProgress func(ctx context.Context) error) error {
+		if string(data) == "poison" {
+			panic("poison payload")
+		}
+		ch <- data
+		return nil
+	}))
+	select {
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	case data := <-ch:
+		if string(data) != "hello world" {
+			t.Errorf("unexpected message %s", data)
+		}
+	}
+	if sub.Panics() != 1 {
+		t.Errorf("expected 1 panic, got %d", sub.Panics())
+	}
+}
+
+func TestSubscribeDecompress(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	m, err := jsm.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.NewStream("COMPRESS", jsm.Subjects("COMPRESS.*")); err != nil {
+		t.Fatal(err)
+	}
+	var message = "hello world"
+	var gzipped bytes.Buffer
+	w := gzip.NewWriter(&gzipped)
+	_, _ = w.Write([]byte(message))
+	_ = w.Close()
+	for encoding, data := range map[string][]byte{"s2": s2.Encode(nil, []byte(message)), "gzip": gzipped.Bytes()} {
+		msg := nats.NewMsg("COMPRESS.1")
+		msg.Header.Set(ContentEncodingHeader, encoding)
+		msg.Data = data
+		if err = nc.PublishMsg(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sub := NewJetStreamSubscriber(nc, JetStreamSubscriberOptions{
+		ConsumerPrefix: "SUB_",
+		StreamName:     "COMPRESS",
+	}, slog.Default().With("subscriber", "test"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ch := make(chan []byte, 2)
+	go sub.Subscribe(ctx, "COMPRESS.1", "TEST", HandlerFunc(func(ctx context.Context, subject, id string,
+		data []byte, inProgress func(ctx context.Context) error) error {
+		ch <- data
+		return nil
+	}))
+	for i := 0; i < 2; i++ {
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case data := <-ch:
+			if string(data) != message {
+				t.Errorf("expected %s, got %s", message, data)
+			}
+		}
+	}
+}
+
+func TestDecompressMaxPayloadSize(t *testing.T) {
+	payload := bytes.Repeat([]byte("a"), 1024)
+	var gzipped bytes.Buffer
+	w := gzip.NewWriter(&gzipped)
+	_, _ = w.Write(payload)
+	_ = w.Close()
+	for encoding, data := range map[string][]byte{"s2": s2.Encode(nil, payload), "gzip": gzipped.Bytes()} {
+		msg := nats.NewMsg("COMPRESS.1")
+		msg.Header.Set(ContentEncodingHeader, encoding)
+		if got, err := decompress(msg, data, len(payload)); err != nil || !bytes.Equal(got, payload) {
+			t.Errorf("%s: expected the payload, got %d bytes, %v", encoding, len(got), err)
+		}
+		if _, err := decompress(msg, data, len(payload)-1); !errors.Is(err, errMalformedPayload) {
+			t.Errorf("%s: expected errMalformedPayload, got %v", encoding, err)
+		}
+	}
+}
+
+func TestSubscribeDecrypt(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	m, err := jsm.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.NewStream("SECRET", jsm.Subjects("SECRET.*")); err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Repeat([]byte{1}, 32)
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	nonce := make([]byte, aead.NonceSize())
+	var message = "hello world"
+	msg := nats.NewMsg("SECRET.1")
+	msg.Header.Set(EncryptionKeyIDHeader, "v1")
+	msg.Data = aead.Seal(nonce, nonce, []byte(message), []byte("v1"))
+	if err = nc.PublishMsg(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	var lookups atomic.Int32
+	sub := NewJetStreamSubscriber(nc, JetStreamSubscriberOptions{
+		ConsumerPrefix: "SUB_",
+		StreamName:     "SECRET",
+		AckWait:        300 * time.Millisecond,
+		EncryptionKeys: KeyProviderFunc(func(id string) ([]byte, error) {
+			// A key store outage redelivers the message rather than dropping it.
+			if lookups.Add(1) == 1 {
+				return nil, errors.New("key store unavailable")
+			}
+			return key, nil
+		}),
+	}, slog.Default().With("subscriber", "test"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ch := make(chan []byte, 1)
+	go sub.Subscribe(ctx, "SECRET.1", "TEST", HandlerFunc(func(ctx context.Context, subject, id string,
+		data []byte, inProgress func(ctx context.Context) error) error {
+		ch <- data
+		return nil
+	}))
+	select {
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	case data := <-ch:
+		if string(data) != message {
+			t.Errorf("expected %s, got %s", message, data)
+		}
+	}
+}
+
+func TestSubscribeIdle(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	m, err := jsm.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.NewStream("IDLE", jsm.Subjects("IDLE.*")); err != nil {
+		t.Fatal(err)
+	}
+
+	idle := make(chan string, 1)
+	sub := NewJetStreamSubscriber(nc, JetStreamSubscriberOptions{
+		ConsumerPrefix: "SUB_",
+		StreamName:     "IDLE",
+		PullHeartbeat:  time.Second,
+		IdleTimeout:    100 * time.Millisecond,
+		OnIdle: func(consumer string, _ time.Duration) {
+			select {
+			case idle <- consumer:
+			default:
+			}
+		},
+	}, slog.Default().With("subscriber", "test"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	go sub.Subscribe(ctx, "IDLE.1", "TEST", HandlerFunc(func(ctx context.Context, subject, id string,
+		data []byte, inProgress func(ctx context.Context) error) error {
+		return nil
+	}))
+	select {
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	case consumer := <-idle:
+		if consumer != "SUB_TEST" {
+			t.Errorf("unexpected idle consumer %s", consumer)
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	var got string
+	route := func(name string) HandlerFunc {
+		return func(ctx context.Context, subject, id string, data []byte,
+			inProgress func(ctx context.Context) error) error {
+			got = name
+			return nil
+		}
+	}
+	router := NewRouter().
+		RouteFunc("ORDERS.*.created", route("created")).
+		RouteFunc("ORDERS.>", route("orders")).
+		RouteFunc("ORDERS.1.created", route("order-1"))
+
+	cases := map[string]string{
+		"ORDERS.2.created": "created",
+		"ORDERS.1.created": "order-1",
+		"ORDERS.2.paid":    "orders",
+	}
+	for subject, want := range cases {
+		got = ""
+		if err := router.Handle(context.Background(), subject, "", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("subject %s routed to %s, want %s", subject, got, want)
+		}
+	}
+	if err := router.Handle(context.Background(), "USERS.1", "", nil, nil); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("expected ErrNoRoute, got %v", err)
+	}
+	router.NotFound(route("not-found"))
+	if err := router.Handle(context.Background(), "USERS.1", "", nil, nil); err != nil || got != "not-found" {
+		t.Errorf("expected not found handler, got %s %v", got, err)
+	}
+}
+
+func TestServer(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	m, err := jsm.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.NewStream("SERVER", jsm.Subjects("SERVER.*")); err != nil {
+		t.Fatal(err)
+	}
+	if err = nc.Publish("SERVER.1", []byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := NewJetStreamSubscriber(nc, JetStreamSubscriberOptions{
+		ConsumerPrefix: "SUB_",
+		StreamName:     "SERVER",
+	}, slog.Default().With("subscriber", "test"))
+	ch := make(chan []byte, 1)
+	server := NewServer(sub).Subscribe("SERVER.1", "TEST", HandlerFunc(func(ctx context.Context,
+		subject, id string, data []byte, inProgress func(ctx context.Context) error) error {
+		ch <- data
+		return nil
+	}))
+
+	started := make(chan error, 1)
+	go func() { started <- server.Start(context.Background()) }()
+	select {
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not received")
+	case data := <-ch:
+		if string(data) != "hello world" {
+			t.Errorf("unexpected message %s", data)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err = server.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-started; err != nil {
+		t.Errorf("expected Start to return nil after Stop, got %v", err)
+	}
+}
+
+func TestSubscribeStartAtSequence(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	m, err := jsm.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.NewStream("REPLAY", jsm.Subjects("REPLAY.*")); err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range []string{"1", "2", "3"} {
+		if err = nc.Publish("REPLAY.1", []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, ordered := range []bool{false, true} {
+		sub := NewJetStreamSubscriber(nc, JetStreamSubscriberOptions{
+			ConsumerPrefix:       "SUB_",
+			StreamName:           "REPLAY",
+			DeliverOption:        DeliverOptionStartAtSequence,
+			DeliverStartSequence: 2,
+			OrderedConsumer:      ordered,
+		}, slog.Default().With("subscriber", "test"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		ch := make(chan []byte, 3)
+		go sub.Subscribe(ctx, "REPLAY.1", "TEST", HandlerFunc(func(ctx context.Context, subject, id string,
+			data []byte, inProgress func(ctx context.Context) error) error {
+			ch <- data
+			return nil
+		}))
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case data := <-ch:
+			if string(data) != "2" {
+				t.Errorf("expected replay from 2, got %s", data)
+			}
+		}
+		cancel()
+	}
+}
+
+func TestSubscribePartitions(t *testing.T) {
+	partitions := Partitions{Prefix: "PARTS", Count: 4}
+	if got := partitions.Assign(1, 2); !reflect.DeepEqual(got, []int{1, 3}) {
+		t.Errorf("unexpected assignment %v", got)
+	}
+
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	m, err := jsm.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.NewStream("PARTS", jsm.Subjects("PARTS.*")); err != nil {
+		t.Fatal(err)
+	}
+	for partition := 0; partition < partitions.Count; partition++ {
+		if err = nc.Publish(partitions.Subject(partition), []byte("hello world")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sub := NewJetStreamSubscriber(nc, JetStreamSubscriberOptions{
+		ConsumerPrefix: "SUB_",
+		StreamName:     "PARTS",
+	}, slog.Default().With("subscriber", "test"))
+	ch := make(chan string, partitions.Count)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = sub.SubscribePartitions(ctx, partitions, partitions.Assign(1, 2), "TEST",
+			HandlerFunc(func(ctx context.Context, subject, id string, data []byte,
+				inProgress func(ctx context.Context) error) error {
+				ch <- subject
+				return nil
+			}))
+	}()
+
+	received := map[string]bool{}
+	for len(received) < 2 {
+		select {
+		case <-time.After(2 * time.Second):
+			t.Fatalf("messages not received, got %v", received)
+		case subject := <-ch:
+			received[subject] = true
+		}
+	}
+	if !received["PARTS.1"] || !received["PARTS.3"] {
+		t.Errorf("unexpected partitions consumed %v", received)
+	}
+}
+
+func TestSubscribeChunked(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	m, err := jsm.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.NewStream("CHUNK", jsm.Subjects("CHUNK.*")); err != nil {
+		t.Fatal(err)
+	}
+	// The chunks are published out of order, the payload is reassembled by index.
+	for _, index := range []int{1, 0, 2} {
+		msg := nats.NewMsg("CHUNK.1")
+		msg.Header.Set(nats.MsgIdHdr, fmt.Sprintf("1-%d", index))
+		msg.Header.Set(ChunkIDHeader, "1")
+		msg.Header.Set(ChunkIndexHeader, fmt.Sprint(index))
+		if index == 2 {
+			msg.Header.Set(ChunkFinalHeader, "true")
+		}
+		msg.Data = []byte([]string{"hello", " ", "world"}[index])
+		if err = nc.PublishMsg(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = nc.Publish("CHUNK.1", []byte("plain")); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := NewJetStreamSubscriber(nc, JetStreamSubscriberOptions{
+		ConsumerPrefix: "SUB_",
+		StreamName:     "CHUNK",
+		AckWait:        500 * time.Millisecond,
+		MaxAckPending:  8,
+	}, slog.Default().With("subscriber", "test"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ch := make(chan string, 4)
+	var failed bool
+	go sub.Subscribe(ctx, "CHUNK.1", "TEST", HandlerFunc(func(ctx context.Context, subject, id string,
+		data []byte, inProgress func(ctx context.Context) error) error {
+		// The first failure redelivers all the chunks, none was acknowledged.
+		if id == "1" && !failed {
+			failed = true
+			return errors.New("handler failed")
+		}
+		ch <- id + ":" + string(data)
+		return nil
+	}))
+	received := map[string]bool{}
+	for range 2 {
+		select {
+		case <-ctx.Done():
+			t.Fatal(ctx.Err())
+		case got := <-ch:
+			received[got] = true
+		}
+	}
+	if !received["1:hello world"] || !received[":plain"] {
+		t.Errorf("unexpected payloads %v", received)
+	}
+	time.Sleep(100 * time.Millisecond)
+	consumer, err := m.LoadConsumer("CHUNK", "SUB_TEST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := consumer.LatestState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.NumAckPending != 0 || state.AckFloor.Stream != 4 {
+		t.Errorf("expected all chunks acknowledged, got %+v", state)
+	}
+}
+
+func TestSubscribeChunkedDefaultOptions(t *testing.T) {
+	opt := natsserver.DefaultTestOptions
+	opt.Port = -1
+	opt.JetStream = true
+	opt.StoreDir = t.TempDir()
+	srv := natsserver.RunServer(&opt)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	m, err := jsm.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.NewStream("CHUNK", jsm.Subjects("CHUNK.*")); err != nil {
+		t.Fatal(err)
+	}
+	for index, data := range []string{"hello", " ", "world"} {
+		msg := nats.NewMsg("CHUNK.1")
+		msg.Header.Set(nats.MsgIdHdr, fmt.Sprintf("1-%d", index))
+		msg.Header.Set(ChunkIDHeader, "1")
+		msg.Header.Set(ChunkIndexHeader, fmt.Sprint(index))
+		if index == 2 {
+			msg.Header.Set(ChunkFinalHeader, "true")
+		}
+		msg.Data = []byte(data)
+		if err = nc.PublishMsg(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The default max ack pending covers the chunks of a max size payload.
+	sub := NewJetStreamSubscriber(nc, JetStreamSubscriberOptions{
+		ConsumerPrefix: "SUB_",
+		StreamName:     "CHUNK",
+	}, slog.Default().With("subscriber", "test"))
+	if want := maxChunks(nc.MaxPayload(), defaultMaxPayloadSize); sub.options.MaxAckPending != want {
+		t.Errorf("expected max ack pending %d, got %d", want, sub.options.MaxAckPending)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ch := make(chan string, 1)
+	go sub.Subscribe(ctx, "CHUNK.1", "TEST", HandlerFunc(func(ctx context.Context, subject, id string,
+		data []byte, inProgress func(ctx context.Context) error) error {
+		ch <- id + ":" + string(data)
+		return nil
+	}))
+	select {
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	case got := <-ch:
+		if got != "1:hello world" {
+			t.Errorf("unexpected payload %s", got)
+		}
+	}
+}
+
+func TestReassemblerMaxSize(t *testing.T) {
+	chunks := newReassembler(time.Minute, 8)
+	newChunk := func(index int, data string) *nats.Msg {
+		msg := nats.NewMsg("CHUNK.1")
+		msg.Header.Set(ChunkIDHeader, "1")
+		msg.Header.Set(ChunkIndexHeader, fmt.Sprint(index))
+		msg.Data = []byte(data)
+		return msg
+	}
+	if _, _, _, err := chunks.add(newChunk(0, "hello")); !errors.Is(err, errChunkIncomplete) {
+		t.Fatalf("expected errChunkIncomplete, got %v", err)
+	}
+	// A redelivered chunk doesn't count twice.
+	if _, _, _, err := chunks.add(newChunk(0, "hello")); !errors.Is(err, errChunkIncomplete) {
+		t.Fatalf("expected errChunkIncomplete, got %v", err)
+	}
+	_, _, msgs, err := chunks.add(newChunk(1, "world"))
+	if err == nil || errors.Is(err, errChunkIncomplete) {
+		t.Fatalf("expected the payload to exceed the max size, got %v", err)
+	}
+	if len(msgs) != 2 || chunks.pending() != 0 {
+		t.Errorf("expected the 2 chunks to be dropped, got %d, %d pending", len(msgs), chunks.pending())
+	}
+}
+
+func TestModule(t *testing.T) {
+	err := fx.ValidateApp(
+		Module,
+		fx.Supply(&nats.Conn{}, JetStreamSubscriberOptions{}, slog.Default()),
+		fx.Invoke(func(*Server, *Router) {}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	var cfg Config
+	err := json.Unmarshal([]byte(`{"stream_name":"TEST","ack_wait":"30s",
+		"deliver_option":"start_sequence","deliver_start_sequence":10,"panic_action":"term"}`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	opts := cfg.Options()
+	if opts.AckWait != 30*time.Second || opts.DeliverOption != DeliverOptionStartAtSequence ||
+		opts.PanicAction != PanicActionTerm {
+		t.Errorf("unexpected options %+v", opts)
+	}
+	cfg.DeliverStartSequence = 0
+	if err = cfg.Validate(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected ErrInvalidConfig, got %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+package scheduler
+
+import "errors"
+
+var (
+	// ErrLockNotAcquired is returned when the lock is held by another owner.
+	ErrLockNotAcquired = errors.New("lock is held by another owner")
+	// ErrLockNotHeld is returned when releasing or extending a lock that expired or was taken over.
+	ErrLockNotHeld = errors.New("lock is not held")
+	// ErrJobNotFound is returned for an unknown job.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrInvalidJob is returned for a job without name or with an invalid cron spec.
+	ErrInvalidJob = errors.New("invalid job")
+)
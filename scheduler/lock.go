@@ -0,0 +1,84 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// releaseScript deletes the lock only when it is still held by the token.
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// extendScript extends the lock only when it is still held by the token.
+var extendScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// Locker acquires distributed locks backed by Redis.
+type Locker struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewLocker creates a Locker whose lock keys start with prefix.
+func NewLocker(client redis.UniversalClient, prefix string) *Locker {
+	return &Locker{client: client, prefix: prefix}
+}
+
+// Lock is an acquired lock, it expires after its TTL unless extended.
+type Lock struct {
+	client redis.UniversalClient
+	key    string
+	token  string
+}
+
+// Acquire acquires the lock of name for ttl, ErrLockNotAcquired is returned when it is held.
+func (l *Locker) Acquire(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	lock := &Lock{client: l.client, key: l.prefix + ":LOCK:" + name, token: hex.EncodeToString(b)}
+	ok, err := l.client.SetNX(ctx, lock.key, lock.token, ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	if !ok {
+		return nil, ErrLockNotAcquired
+	}
+	return lock, nil
+}
+
+// Extend resets the TTL of the lock.
+func (l *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	n, err := extendScript.Run(ctx, l.client, []string{l.key}, l.token, ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to extend lock: %w", err)
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Release releases the lock.
+func (l *Lock) Release(ctx context.Context) error {
+	n, err := releaseScript.Run(ctx, l.client, []string{l.key}, l.token).Int()
+	if err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+// Package scheduler runs cron jobs across service instances. Job definitions and their
+// next run times are stored in Redis, a distributed lock makes every run exclusive and
+// due runs are handled locally and/or published to JetStream for workers to consume.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// defaultPollInterval is the default interval the due jobs are polled.
+	defaultPollInterval = time.Second
+	// defaultJobTimeout is the default timeout of a job run, it is also the lock TTL.
+	defaultJobTimeout = time.Minute
+)
+
+// parser parses standard cron specs with an optional seconds field and descriptors like @every 1m.
+var parser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month |
+	cron.Dow | cron.Descriptor)
+
+// Job is a job definition.
+type Job struct {
+	// Name identifies the job.
+	Name string `json:"name"`
+	// Spec is the cron spec, e.g. "0 */5 * * * *" or "@every 1m".
+	Spec string `json:"spec"`
+	// Jitter delays every run by a random duration up to Jitter.
+	Jitter time.Duration `json:"jitter,omitempty"`
+	// Timeout bounds a run and the time the run lock is held.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Subject publishes a JSON Event to the subject on every run when a Publisher is set.
+	Subject string `json:"subject,omitempty"`
+	// Payload is passed to the handler and carried by the Event.
+	Payload []byte `json:"payload,omitempty"`
+}
+
+func (j Job) validate() (cron.Schedule, error) {
+	if j.Name == "" {
+		return nil, fmt.Errorf("%w: name is empty", ErrInvalidJob)
+	}
+	schedule, err := parser.Parse(j.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidJob, err)
+	}
+	return schedule, nil
+}
+
+func (j Job) next(schedule cron.Schedule, after time.Time) time.Time {
+	next := schedule.Next(after)
+	if j.Jitter > 0 {
+		next = next.Add(rand.N(j.Jitter))
+	}
+	return next
+}
+
+// Event is published to the job subject on every run.
+type Event struct {
+	Name        string    `json:"name"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	Payload     []byte    `json:"payload,omitempty"`
+}
+
+// Publisher publishes due-job events, the NATS JetStreamPublisher implements it.
+type Publisher interface {
+	Publish(ctx context.Context, subject string, msgID string, data []byte) error
+}
+
+// Handler runs a job.
+type Handler func(ctx context.Context, job Job, scheduledAt time.Time) error
+
+type Options struct {
+	// Prefix is the redis key prefix.
+	Prefix string
+	// PollInterval is the interval the due jobs are polled.
+	PollInterval time.Duration
+	// Publisher publishes the events of jobs with a Subject.
+	Publisher Publisher
+}
+
+func (o *Options) applyDefaultValue() {
+	if o.PollInterval == 0 {
+		o.PollInterval = defaultPollInterval
+	}
+}
+
+// Scheduler runs the registered handlers of due jobs.
+type Scheduler struct {
+	client   redis.UniversalClient
+	options  Options
+	locker   *Locker
+	logger   *slog.Logger
+	mu       sync.RWMutex
+	handlers map[string]Handler
+}
+
+// NewScheduler creates a Scheduler.
+func NewScheduler(client redis.UniversalClient, options Options, logger *slog.Logger) *Scheduler {
+	options.applyDefaultValue()
+	return &Scheduler{
+		client:   client,
+		options:  options,
+		locker:   NewLocker(client, options.Prefix+":SCHEDULER"),
+		logger:   logger,
+		handlers: make(map[string]Handler),
+	}
+}
+
+func (s *Scheduler) jobsKey() string {
+	return s.options.Prefix + ":SCHEDULER:JOBS"
+}
+
+func (s *Scheduler) dueKey() string {
+	return s.options.Prefix + ":SCHEDULER:DUE"
+}
+
+// Handle registers the handler of the job name on this instance.
+func (s *Scheduler) Handle(name string, handler Handler) *Scheduler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[name] = handler
+	return s
+}
+
+// AddJob stores the job definition and schedules its next run, replacing the job with
+// the same name.
+func (s *Scheduler) AddJob(ctx context.Context, job Job) error {
+	schedule, err := job.validate()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+	next := job.next(schedule, time.Now())
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, s.jobsKey(), job.Name, data)
+		pipe.ZAdd(ctx, s.dueKey(), redis.Z{Score: float64(next.UnixMilli()), Member: job.Name})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add job: %w", err)
+	}
+	return nil
+}
+
+// RemoveJob removes the job definition and its schedule.
+func (s *Scheduler) RemoveJob(ctx context.Context, name string) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, s.jobsKey(), name)
+		pipe.ZRem(ctx, s.dueKey(), name)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove job: %w", err)
+	}
+	return nil
+}
+
+// Job returns the job definition.
+func (s *Scheduler) Job(ctx context.Context, name string) (*Job, error) {
+	data, err := s.client.HGet(ctx, s.jobsKey(), name).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	var job Job
+	if err = json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode job: %w", err)
+	}
+	return &job, nil
+}
+
+// Jobs returns all job definitions.
+func (s *Scheduler) Jobs(ctx context.Context) ([]Job, error) {
+	values, err := s.client.HGetAll(ctx, s.jobsKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	jobs := make([]Job, 0, len(values))
+	for _, data := range values {
+		var job Job
+		if err = json.Unmarshal([]byte(data), &job); err != nil {
+			return nil, fmt.Errorf("failed to decode job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// NextRun returns the next scheduled run of the job.
+func (s *Scheduler) NextRun(ctx context.Context, name string) (time.Time, error) {
+	score, err := s.client.ZScore(ctx, s.dueKey(), name).Result()
+	if errors.Is(err, redis.Nil) {
+		return time.Time{}, ErrJobNotFound
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get next run: %w", err)
+	}
+	return time.UnixMilli(int64(score)), nil
+}
+
+// Run polls and runs the due jobs until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.options.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.RunDue(ctx); err != nil {
+			s.logger.ErrorContext(ctx, "failed to run due jobs", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue runs the jobs due now once.
+func (s *Scheduler) RunDue(ctx context.Context) error {
+	now := time.Now()
+	names, err := s.client.ZRangeByScore(ctx, s.dueKey(), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get due jobs: %w", err)
+	}
+	for _, name := range names {
+		if err = s.runJob(ctx, name, now); err != nil && !errors.Is(err, ErrLockNotAcquired) {
+			s.logger.ErrorContext(ctx, "failed to run job", "job", name, "err", err)
+		}
+	}
+	return nil
+}
+
+// runJob runs the job while holding its lock, the next run is scheduled before the job
+// runs so a run is never repeated by another instance.
+func (s *Scheduler) runJob(ctx context.Context, name string, now time.Time) error {
+	job, err := s.Job(ctx, name)
+	if errors.Is(err, ErrJobNotFound) {
+		return s.client.ZRem(ctx, s.dueKey(), name).Err()
+	}
+	if err != nil {
+		return err
+	}
+	timeout := job.Timeout
+	if timeout <= 0 {
+		timeout = defaultJobTimeout
+	}
+	lock, err := s.locker.Acquire(ctx, name, timeout)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := lock.Release(context.WithoutCancel(ctx)); err != nil {
+			s.logger.WarnContext(ctx, "failed to release job lock", "job", name, "err", err)
+		}
+	}()
+
+	// Another instance may have run the job between the poll and the lock.
+	score, err := s.client.ZScore(ctx, s.dueKey(), name).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get next run: %w", err)
+	}
+	scheduledAt := time.UnixMilli(int64(score))
+	if scheduledAt.After(now) {
+		return nil
+	}
+	schedule, err := job.validate()
+	if err != nil {
+		return err
+	}
+	next := job.next(schedule, now)
+	if err = s.client.ZAdd(ctx, s.dueKey(), redis.Z{Score: float64(next.UnixMilli()), Member: name}).Err(); err != nil {
+		return fmt.Errorf("failed to schedule next run: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if job.Subject != "" && s.options.Publisher != nil {
+		data, _ := json.Marshal(Event{Name: name, ScheduledAt: scheduledAt, Payload: job.Payload})
+		msgID := fmt.Sprintf("%s-%d", name, scheduledAt.UnixMilli())
+		if err = s.options.Publisher.Publish(ctx, job.Subject, msgID, data); err != nil {
+			return fmt.Errorf("failed to publish job event: %w", err)
+		}
+	}
+	s.mu.RLock()
+	handler, ok := s.handlers[name]
+	s.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return handler(ctx, *job, scheduledAt)
+}
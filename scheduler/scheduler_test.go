@@ -0,0 +1,91 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type publisherFunc func(ctx context.Context, subject string, msgID string, data []byte) error
+
+func (f publisherFunc) Publish(ctx context.Context, subject string, msgID string, data []byte) error {
+	return f(ctx, subject, msgID, data)
+}
+
+func newClient(t *testing.T) redis.UniversalClient {
+	s := mr.RunT(t)
+	return redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{s.Addr()}})
+}
+
+func TestLocker(t *testing.T) {
+	ctx := context.Background()
+	locker := NewLocker(newClient(t), "TEST")
+
+	lock, err := locker.Acquire(ctx, "job", time.Minute)
+	require.NoError(t, err)
+	_, err = locker.Acquire(ctx, "job", time.Minute)
+	assert.ErrorIs(t, err, ErrLockNotAcquired)
+
+	require.NoError(t, lock.Extend(ctx, time.Minute))
+	require.NoError(t, lock.Release(ctx))
+	assert.ErrorIs(t, lock.Release(ctx), ErrLockNotHeld)
+	_, err = locker.Acquire(ctx, "job", time.Minute)
+	assert.NoError(t, err)
+}
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+	client := newClient(t)
+	var events []Event
+	opts := Options{
+		Prefix: "TEST",
+		Publisher: publisherFunc(func(ctx context.Context, subject, msgID string, data []byte) error {
+			var event Event
+			require.NoError(t, json.Unmarshal(data, &event))
+			events = append(events, event)
+			return nil
+		}),
+	}
+	first := NewScheduler(client, opts, slog.Default())
+	second := NewScheduler(client, opts, slog.Default())
+	runs := 0
+	handler := func(ctx context.Context, job Job, scheduledAt time.Time) error {
+		runs++
+		return nil
+	}
+	first.Handle("report", handler)
+	second.Handle("report", handler)
+
+	err := first.AddJob(ctx, Job{Name: "report", Spec: "not a spec"})
+	assert.ErrorIs(t, err, ErrInvalidJob)
+	require.NoError(t, first.AddJob(ctx, Job{Name: "report", Spec: "@every 1h", Subject: "JOBS.report",
+		Payload: []byte("daily")}))
+
+	// Nothing is due yet.
+	require.NoError(t, first.RunDue(ctx))
+	assert.Equal(t, 0, runs)
+
+	// Make the job due, both instances poll but it runs once.
+	require.NoError(t, client.ZAdd(ctx, first.dueKey(), redis.Z{Score: 0, Member: "report"}).Err())
+	require.NoError(t, first.RunDue(ctx))
+	require.NoError(t, second.RunDue(ctx))
+	assert.Equal(t, 1, runs)
+	require.Len(t, events, 1)
+	assert.Equal(t, "report", events[0].Name)
+	assert.Equal(t, []byte("daily"), events[0].Payload)
+
+	next, err := first.NextRun(ctx, "report")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), next, time.Minute)
+
+	require.NoError(t, first.RemoveJob(ctx, "report"))
+	_, err = first.Job(ctx, "report")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
@@ -0,0 +1,316 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Categories of the keys of a target, see TargetKey.
+const (
+	KeyCategoryCode        = "VERIFICATION_CODE"
+	KeyCategoryFailure     = "VERIFICATION_FAILURE"
+	KeyCategoryLockout     = "VERIFICATION_LOCKOUT"
+	KeyCategorySendLimit   = "VERIFICATION_SEND_LIMIT"
+	KeyCategoryResend      = "VERIFICATION_RESEND"
+	KeyCategoryLatest      = "VERIFICATION_LATEST"
+	KeyCategoryRecent      = "VERIFICATION_RECENT"
+	KeyCategoryIdempotency = "VERIFICATION_IDEMPOTENCY"
+)
+
+// TargetKey is a Redis key an OTPService keeps for a target.
+type TargetKey struct {
+	Key      string        `json:"key"`
+	Category string        `json:"category"`           // e.g. KeyCategoryCode
+	Type     CodeType      `json:"type"`               // Upper case as in the key
+	Sequence string        `json:"sequence,omitempty"` // Empty for keys of the whole target
+	TTL      time.Duration `json:"ttl"`                // -1 for a key without expiry
+	// Count is the value of a fixed or sliding window send limit and of a verify
+	// failure counter.
+	Count int64 `json:"count,omitempty"`
+	// Tokens is the remaining tokens of a token bucket send limit.
+	Tokens float64 `json:"tokens,omitempty"`
+	// Limit is the configured limit of a send limit or a failure counter.
+	Limit int64 `json:"limit,omitempty"`
+	// Locked reports whether a send limit or a failure counter reached its limit.
+	Locked bool `json:"locked,omitempty"`
+
+	tierWindow int64 // Window in milliseconds of an extra send limit tier
+}
+
+// TargetState is the state of a target in Redis, as returned by AdminService.Inspect.
+type TargetState struct {
+	Medium    string      `json:"medium"`
+	Target    []string    `json:"target"`
+	Codes     []TargetKey `json:"codes"`     // Outstanding codes
+	Failures  []TargetKey `json:"failures"`  // Verify failure counters per sequence or target
+	Lockouts  []TargetKey `json:"lockouts"`  // Sequences or targets locked after exceeding the verify limit
+	Limits    []TargetKey `json:"limits"`    // Send limits per code type and tier
+	Cooldowns []TargetKey `json:"cooldowns"` // Resend cooldowns per sequence
+	Other     []TargetKey `json:"other"`     // Latest and recent code indexes and idempotency records
+}
+
+// AdminService inspects and clears the Redis state of single targets for support
+// tooling, e.g. to tell why a user receives no code and to lift their limits. It finds
+// the keys with SCAN, on a Redis Cluster on every master, so it is not meant for hot
+// paths.
+type AdminService struct {
+	client redis.UniversalClient
+	keys   *CacheKeyBuilder
+	cfg    OTPConfig
+}
+
+// NewAdminService creates an AdminService for the keys of the OTPService of cfg, whose
+// send and verify limits are reported along the counters.
+func NewAdminService(client redis.UniversalClient, cfg OTPConfig) *AdminService {
+	return &AdminService{client: client, keys: NewCacheKeyBuilder(cfg.Prefix), cfg: cfg}
+}
+
+// Inspect returns the keys of the target identified by medium and the LimitKeyParts of
+// its codes, e.g. Inspect(ctx, "MOBILE", "13800138000", "86"), with their TTLs and
+// counters.
+func (a *AdminService) Inspect(ctx context.Context, medium string, parts ...string) (*TargetState, error) {
+	keys, err := a.targetKeys(ctx, medium, parts)
+	if err != nil {
+		return nil, err
+	}
+	pipe := a.client.Pipeline()
+	ttls := make([]*redis.DurationCmd, len(keys))
+	types := make([]*redis.StatusCmd, len(keys))
+	for i, k := range keys {
+		ttls[i], types[i] = pipe.PTTL(ctx, k.Key), pipe.Type(ctx, k.Key)
+	}
+	if _, err = pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("verification: redis pttl failed: %w", err)
+	}
+
+	state := &TargetState{Medium: medium, Target: parts}
+	for i, k := range keys {
+		k.TTL = ttls[i].Val()
+		if k.TTL == -2 {
+			continue // expired since the scan
+		}
+		switch k.Category {
+		case KeyCategoryCode:
+			state.Codes = append(state.Codes, k)
+		case KeyCategoryFailure:
+			k.Count, _ = a.client.Get(ctx, k.Key).Int64()
+			k.Limit = a.cfg.Verify.Limit
+			k.Locked = k.Limit > 0 && k.Count >= k.Limit
+			state.Failures = append(state.Failures, k)
+		case KeyCategoryLockout:
+			k.Locked = true
+			state.Lockouts = append(state.Lockouts, k)
+		case KeyCategorySendLimit:
+			if err = a.readLimit(ctx, &k, types[i].Val()); err != nil {
+				return nil, err
+			}
+			state.Limits = append(state.Limits, k)
+		case KeyCategoryResend:
+			state.Cooldowns = append(state.Cooldowns, k)
+		default:
+			state.Other = append(state.Other, k)
+		}
+	}
+	return state, nil
+}
+
+// readLimit reads the counter of a send limit of typ, the Redis type of its key.
+func (a *AdminService) readLimit(ctx context.Context, k *TargetKey, typ string) error {
+	var err error
+	k.Limit = a.cfg.Send.Limit
+	for _, tier := range a.cfg.Send.Tiers {
+		if k.tierWindow == tier.Window.Milliseconds() {
+			k.Limit = tier.Limit
+		}
+	}
+	switch typ {
+	case "string":
+		k.Count, err = a.client.Get(ctx, k.Key).Int64()
+		k.Locked = k.Limit > 0 && k.Count >= k.Limit
+	case "zset":
+		k.Count, err = a.client.ZCard(ctx, k.Key).Result()
+		k.Locked = k.Limit > 0 && k.Count >= k.Limit
+	case "hash":
+		k.Tokens, err = a.client.HGet(ctx, k.Key, "tokens").Float64()
+		k.Locked = k.Tokens < 1
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("verification: redis read limit failed: %w", err)
+	}
+	return nil
+}
+
+// Clear deletes every key of the target: its outstanding codes, failure counters,
+// lockouts, send limits, cooldowns and idempotency records. It returns the number of deleted keys.
+func (a *AdminService) Clear(ctx context.Context, medium string, parts ...string) (int64, error) {
+	keys, err := a.targetKeys(ctx, medium, parts)
+	if err != nil {
+		return 0, err
+	}
+	return a.delete(ctx, keys)
+}
+
+// ClearLimits deletes the send limits, failure counters, lockouts and cooldowns of the target,
+// so it can request and verify codes again, and keeps its outstanding codes. It returns
+// the number of deleted keys.
+func (a *AdminService) ClearLimits(ctx context.Context, medium string, parts ...string) (int64, error) {
+	keys, err := a.targetKeys(ctx, medium, parts)
+	if err != nil {
+		return 0, err
+	}
+	limits := keys[:0]
+	for _, k := range keys {
+		switch k.Category {
+		case KeyCategoryFailure, KeyCategoryLockout, KeyCategorySendLimit, KeyCategoryResend:
+			limits = append(limits, k)
+		}
+	}
+	return a.delete(ctx, limits)
+}
+
+// delete deletes keys one by one, they may live in different slots of a cluster.
+func (a *AdminService) delete(ctx context.Context, keys []TargetKey) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	pipe := a.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(keys))
+	for i, k := range keys {
+		cmds[i] = pipe.Del(ctx, k.Key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("verification: redis del failed: %w", err)
+	}
+	var n int64
+	for _, cmd := range cmds {
+		n += cmd.Val()
+	}
+	return n, nil
+}
+
+// targetKeys scans the keys of the target and parses them, sorted by key.
+func (a *AdminService) targetKeys(ctx context.Context, medium string, parts []string) ([]TargetKey, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%w: target is empty", ErrInvalidConfig)
+	}
+	target := strings.Join(parts, ":")
+	base := escapeGlob(string(a.keys.prefix)) + ":VERIFICATION_*:" + escapeGlob(medium) + ":*"
+	found := map[string]TargetKey{}
+	for _, pattern := range []string{base + escapeGlob(target), base + escapeGlob(target) + ":*"} {
+		err := scanKeys(ctx, a.client, pattern, func(key string) {
+			if k, ok := a.parseKey(key, medium, target); ok {
+				found[key] = k
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	keys := make([]TargetKey, 0, len(found))
+	for _, k := range found {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+	return keys, nil
+}
+
+// parseKey parses key of the layout of CacheKeyBuilder, it reports false for keys of
+// other targets matching the scan pattern.
+func (a *AdminService) parseKey(key, medium, target string) (TargetKey, bool) {
+	rest, ok := strings.CutPrefix(key, string(a.keys.prefix)+":")
+	if !ok {
+		return TargetKey{}, false
+	}
+	fields := strings.SplitN(rest, ":", 4)
+	if len(fields) != 4 || fields[1] != medium {
+		return TargetKey{}, false
+	}
+	k := TargetKey{Key: key, Category: fields[0], Type: CodeType(fields[2])}
+	rest = fields[3]
+	switch k.Category {
+	case KeyCategoryFailure, KeyCategoryLockout:
+		// sequence:target, or target with VerifyByTarget
+		if rest == target {
+			break
+		}
+		seq, ok := strings.CutSuffix(rest, ":"+target)
+		if !ok || seq == "" || strings.Contains(seq, ":") {
+			return TargetKey{}, false
+		}
+		k.Sequence = seq
+	case KeyCategoryCode, KeyCategoryResend:
+		// sequence:target
+		seq, ok := strings.CutSuffix(rest, ":"+target)
+		if !ok || seq == "" || strings.Contains(seq, ":") {
+			return TargetKey{}, false
+		}
+		k.Sequence = seq
+	case KeyCategorySendLimit:
+		// target, or target:window of an extra tier
+		if rest != target {
+			tier, ok := strings.CutPrefix(rest, target+":")
+			window, err := strconv.ParseInt(tier, 10, 64)
+			if !ok || err != nil {
+				return TargetKey{}, false
+			}
+			k.tierWindow = window
+		}
+	case KeyCategoryLatest, KeyCategoryRecent:
+		if rest != target {
+			return TargetKey{}, false
+		}
+	case KeyCategoryIdempotency:
+		// target:idempotency key
+		if !strings.HasPrefix(rest, target+":") {
+			return TargetKey{}, false
+		}
+	default:
+		return TargetKey{}, false
+	}
+	return k, true
+}
+
+// scanKeys calls fn with the keys matching pattern, on every master of a cluster. fn
+// is not called concurrently.
+func scanKeys(ctx context.Context, client redis.UniversalClient, pattern string, fn func(key string)) error {
+	var mu sync.Mutex
+	scanNode := func(ctx context.Context, client *redis.Client) error {
+		iter := client.Scan(ctx, 0, pattern, 100).Iterator()
+		for iter.Next(ctx) {
+			mu.Lock()
+			fn(iter.Val())
+			mu.Unlock()
+		}
+		return iter.Err()
+	}
+	var err error
+	switch c := client.(type) {
+	case *redis.ClusterClient:
+		err = c.ForEachMaster(ctx, scanNode)
+	case *redis.Client:
+		err = scanNode(ctx, c)
+	default:
+		iter := client.Scan(ctx, 0, pattern, 100).Iterator()
+		for iter.Next(ctx) {
+			fn(iter.Val())
+		}
+		err = iter.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("verification: redis scan failed: %w", err)
+	}
+	return nil
+}
+
+// escapeGlob escapes the special characters of a SCAN MATCH pattern in s.
+func escapeGlob(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`).Replace(s)
+}
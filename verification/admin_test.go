@@ -0,0 +1,68 @@
+package verification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_AdminService(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	cfg := mobileTestConfig(2, 3)
+	cfg.Send.Tiers = []LimitTier{{Limit: 5, Window: time.Hour}}
+	cfg.ResendCooldown = time.Minute
+	gen := NewTestCodeGenerator("666666")
+	svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+	send := func(mobile string) string {
+		mc, err := gen.NewMobileCode("login", 1, mobile, "86")
+		require.NoError(t, err)
+		seq, err := svc.Send(ctx, mc)
+		require.NoError(t, err)
+		return seq
+	}
+	seq := send("13800138000")
+	send("13800138000")
+	other := send("113800138000") // ends like the target, must not match
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", mobileProbe(seq, "13800138000", "86")), ErrCodeIncorrect)
+
+	admin := NewAdminService(client, cfg)
+	state, err := admin.Inspect(ctx, "MOBILE", "13800138000", "86")
+	require.NoError(t, err)
+	assert.Len(t, state.Codes, 2)
+	assert.Len(t, state.Cooldowns, 2)
+	for _, k := range state.Codes {
+		assert.NotEqual(t, other, k.Sequence)
+		assert.Equal(t, CodeType("LOGIN"), k.Type)
+		assert.Positive(t, k.TTL)
+	}
+	require.Len(t, state.Failures, 1)
+	assert.Equal(t, TargetKey{Key: state.Failures[0].Key, Category: KeyCategoryFailure, Type: "LOGIN",
+		Sequence: seq, TTL: state.Failures[0].TTL, Count: 1, Limit: 3}, state.Failures[0])
+	require.Len(t, state.Limits, 2)
+	assert.Equal(t, int64(2), state.Limits[0].Count)
+	assert.Equal(t, int64(2), state.Limits[0].Limit)
+	assert.True(t, state.Limits[0].Locked)
+	assert.Equal(t, int64(5), state.Limits[1].Limit)
+	assert.False(t, state.Limits[1].Locked)
+
+	// Lifting the limits keeps the codes, clearing removes everything of the target only.
+	n, err := admin.ClearLimits(ctx, "MOBILE", "13800138000", "86")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	send("13800138000")
+	n, err = admin.Clear(ctx, "MOBILE", "13800138000", "86")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), n)
+	state, err = admin.Inspect(ctx, "MOBILE", "13800138000", "86")
+	require.NoError(t, err)
+	assert.Empty(t, state.Codes)
+	state, err = admin.Inspect(ctx, "MOBILE", "113800138000", "86")
+	require.NoError(t, err)
+	assert.Len(t, state.Codes, 1)
+}
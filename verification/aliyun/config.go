@@ -0,0 +1,61 @@
+package aliyun
+
+import (
+	"fmt"
+
+	dysms "github.com/alibabacloud-go/dysmsapi-20170525/v3/client"
+	"github.com/crypto-zero/go-biz/verification"
+)
+
+// Config holds the Dysms client configuration, loadable from YAML or env.
+type Config struct {
+	AccessKeyID     string `json:"access_key_id" yaml:"access_key_id"`
+	AccessKeySecret string `json:"access_key_secret" yaml:"access_key_secret"`
+	RegionID        string `json:"region_id" yaml:"region_id"`
+	Endpoint        string `json:"endpoint" yaml:"endpoint"`
+	// IntlRegionID and IntlEndpoint locate the international SMS API, they default to
+	// DefaultIntlRegionID and DefaultIntlEndpoint.
+	IntlRegionID string `json:"intl_region_id" yaml:"intl_region_id"`
+	IntlEndpoint string `json:"intl_endpoint" yaml:"intl_endpoint"`
+}
+
+// Defaults of the international SMS API.
+const (
+	DefaultIntlRegionID = "ap-southeast-1"
+	DefaultIntlEndpoint = "dysmsapi.ap-southeast-1.aliyuncs.com"
+)
+
+// Validate checks the credentials and endpoint are set.
+func (c *Config) Validate() error {
+	if c.AccessKeyID == "" || c.AccessKeySecret == "" {
+		return fmt.Errorf("%w: aliyun access key is empty", verification.ErrInvalidConfig)
+	}
+	if c.Endpoint == "" {
+		return fmt.Errorf("%w: aliyun endpoint is empty", verification.ErrInvalidConfig)
+	}
+	return nil
+}
+
+// NewClient validates the config and creates the Dysms client.
+func (c *Config) NewClient() (*dysms.Client, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return NewAliyunMainlandSMSClient(c.AccessKeyID, c.AccessKeySecret, c.RegionID, c.Endpoint)
+}
+
+// NewInternationalClient validates the config and creates the Dysms client of the
+// international endpoint, see WithInternationalClient.
+func (c *Config) NewInternationalClient() (*dysms.Client, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	regionID, endpoint := c.IntlRegionID, c.IntlEndpoint
+	if regionID == "" {
+		regionID = DefaultIntlRegionID
+	}
+	if endpoint == "" {
+		endpoint = DefaultIntlEndpoint
+	}
+	return NewAliyunMainlandSMSClient(c.AccessKeyID, c.AccessKeySecret, regionID, endpoint)
+}
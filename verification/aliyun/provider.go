@@ -0,0 +1,22 @@
+package aliyun
+
+import (
+	"github.com/crypto-zero/go-biz/verification"
+	"github.com/google/wire"
+	"go.uber.org/fx"
+)
+
+// ProviderSet is the wire provider set of the SMS sender bound to CodeSender[MobileCode].
+// The application provides the Dysms client, e.g. from NewAliyunMainlandSMSClient, and
+// the SMS TemplateProvider.
+var ProviderSet = wire.NewSet(
+	NewSMS,
+	wire.Bind(new(verification.CodeSender[verification.MobileCode]), new(*SMS)),
+)
+
+// Module is the fx equivalent of ProviderSet.
+var Module = fx.Options(
+	fx.Provide(
+		fx.Annotate(NewSMS, fx.As(fx.Self()), fx.As(new(verification.CodeSender[verification.MobileCode]))),
+	),
+)
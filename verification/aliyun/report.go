@@ -0,0 +1,56 @@
+package aliyun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/crypto-zero/go-biz/verification"
+)
+
+// DeliveryReporter updates deliveries from receipts, *verification.DeliveryStatusService
+// implements it.
+type DeliveryReporter interface {
+	Report(ctx context.Context, sequence string, state verification.DeliveryState, errCode string) error
+}
+
+// smsReport is an item of the SmsReport push of Dysms.
+type smsReport struct {
+	PhoneNumber string `json:"phone_number"`
+	Success     bool   `json:"success"`
+	ErrCode     string `json:"err_code"`
+	BizID       string `json:"biz_id"`
+	OutID       string `json:"out_id"`
+}
+
+// NewReportHandler creates the http.Handler of the SmsReport (delivery receipt) HTTP
+// push of Dysms. The OutId set by WithDeliveryRecorder maps a receipt to its sequence,
+// receipts of unknown sequences are ignored.
+func NewReportHandler(reporter DeliveryReporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reports []smsReport
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&reports); err != nil {
+			http.Error(w, "malformed sms report", http.StatusBadRequest)
+			return
+		}
+		for _, report := range reports {
+			if report.OutID == "" {
+				continue
+			}
+			state, errCode := verification.DeliveryDelivered, ""
+			if !report.Success {
+				state, errCode = verification.DeliveryFailed, report.ErrCode
+			}
+			err := reporter.Report(r.Context(), report.OutID, state, errCode)
+			if err != nil && !errors.Is(err, verification.ErrDeliveryNotFound) {
+				// Dysms retries the push unless it is acknowledged with code 0.
+				http.Error(w, "report failed", http.StatusInternalServerError)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"code":0,"msg":"success"}`))
+	})
+}
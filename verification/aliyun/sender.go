@@ -3,12 +3,13 @@ package aliyun
 import (
 	"context"
 	"fmt"
-	"strings"
 	"sync"
-	"text/template"
+	"time"
 
 	openapi "github.com/alibabacloud-go/darabonba-openapi/v2/client"
 	dysms "github.com/alibabacloud-go/dysmsapi-20170525/v3/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
 	"github.com/crypto-zero/go-biz/verification"
 )
 
@@ -16,25 +17,80 @@ import (
 type SMS struct {
 	mainlandClient *dysms.Client
 	provider       verification.TemplateProvider[verification.SMSTemplate]
-	tmplCache      sync.Map // map[CodeType]*cachedSMSTemplate
+	intlClient     *dysms.Client
+	intlProvider   verification.TemplateProvider[verification.SMSTemplate]
+	recorder       verification.DeliveryRecorder
+	render         verification.RenderConfig
+	tmplCache      sync.Map // map[templateKey]*cachedSMSTemplate
+}
+
+// Providers of the delivery records, the mainland records can be polled with QueryStatus.
+const (
+	ProviderMainland      = "aliyun"
+	ProviderInternational = "aliyun-intl"
+)
+
+// templateKey identifies a cached template, mainland and international templates of a
+// code type differ.
+type templateKey struct {
+	typ    verification.CodeType
+	locale string
+	intl   bool
+}
+
+// SMSOption configures an SMS.
+type SMSOption func(*SMS)
+
+// WithInternationalClient enables sending to country codes other than 86 through the
+// international API (SendMessageToGlobe) with a client of the international endpoint,
+// see Config.NewInternationalClient. The ParamsFormat of the international templates
+// renders the message text, SignName is the optional sender ID and TaskID is passed
+// through. A nil provider uses the templates of the mainland provider.
+func WithInternationalClient(client *dysms.Client,
+	provider verification.TemplateProvider[verification.SMSTemplate],
+) SMSOption {
+	return func(a *SMS) { a.intlClient, a.intlProvider = client, provider }
 }
 
 // cachedSMSTemplate holds a pre-parsed SMS template alongside its metadata.
 type cachedSMSTemplate struct {
-	tmpl         *template.Template
+	tmpl         *verification.ContentTemplate
 	signName     string
 	templateCode string // Alibaba Cloud SMS template ID, e.g. "SMS_123456"
+	taskID       string // International task ID
 }
 
 // Compile-time assertion: SMS implements CodeSender[MobileCode].
 var _ verification.CodeSender[verification.MobileCode] = (*SMS)(nil)
 
-// NewSMS creates a new SMS with the given Dysms client.
-func NewSMS(client *dysms.Client, provider verification.TemplateProvider[verification.SMSTemplate]) *SMS {
-	return &SMS{
+// WithDeliveryRecorder records the BizId of every accepted message with recorder, e.g. a
+// verification.DeliveryStatusService. The sequence of the code is passed as OutId so
+// receipts map back to it, see NewReportHandler.
+func WithDeliveryRecorder(recorder verification.DeliveryRecorder) SMSOption {
+	return func(a *SMS) { a.recorder = recorder }
+}
+
+// WithRenderConfig sets {{.AppName}} and {{.TTLMinutes}} of the templates.
+func WithRenderConfig(cfg verification.RenderConfig) SMSOption {
+	return func(a *SMS) { a.render = cfg }
+}
+
+// NewSMS creates a new SMS with the given Dysms client, which sends to mainland China only
+// unless WithInternationalClient is given.
+func NewSMS(client *dysms.Client, provider verification.TemplateProvider[verification.SMSTemplate],
+	opts ...SMSOption,
+) *SMS {
+	a := &SMS{
 		mainlandClient: client,
 		provider:       provider,
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.intlProvider == nil {
+		a.intlProvider = provider
+	}
+	return a
 }
 
 // Send sends a mobile code using the appropriate template based on the MobileCode type.
@@ -42,58 +98,158 @@ func NewSMS(client *dysms.Client, provider verification.TemplateProvider[verific
 // Note: The Alibaba Cloud Dysms SDK (v3) does not accept context.Context in
 // SendSms. Consider upgrading to SendSmsWithOptions + RuntimeOptions for
 // timeout control when the SDK supports it.
-func (a *SMS) Send(_ context.Context, mobileCode *verification.MobileCode) error {
-	if mobileCode.CountryCode != verification.ChinaCountryCode {
+func (a *SMS) Send(ctx context.Context, mobileCode *verification.MobileCode) error {
+	intl := mobileCode.CountryCode != verification.ChinaCountryCode
+	if intl && a.intlClient == nil {
 		return verification.ErrUnsupportedCountryCode
 	}
-	ct, err := a.getTemplate(mobileCode.Type)
+	ct, err := a.getTemplate(mobileCode.Type, mobileCode.Locale, intl)
 	if err != nil {
 		return err
 	}
 
-	var buf strings.Builder
-	if err = ct.tmpl.Execute(&buf, mobileCode); err != nil {
-		return fmt.Errorf("failed to execute sms template: %w", err)
+	params, err := ct.tmpl.Render(verification.NewTemplateData(mobileCode, a.render))
+	if err != nil {
+		return err
 	}
 
-	return a.sendMessage(ct.signName, mobileCode.Mobile, ct.templateCode, buf.String())
+	status := &verification.DeliveryStatus{Sequence: mobileCode.Sequence, OutID: mobileCode.Sequence,
+		State: verification.DeliveryPending, SentAt: time.Now()}
+	if intl {
+		status.Provider, status.Target = ProviderInternational, mobileCode.CountryCode+mobileCode.Mobile
+		status.BizID, err = a.sendGlobeMessage(ct.signName, status.Target, ct.taskID, params)
+	} else {
+		status.Provider, status.Target = ProviderMainland, mobileCode.Mobile
+		status.BizID, err = a.sendMessage(ct.signName, mobileCode.Mobile, ct.templateCode, params,
+			mobileCode.Sequence)
+	}
+	if err != nil {
+		return err
+	}
+	if a.recorder != nil {
+		// The message is accepted, a lost record must not fail and roll back the send.
+		_ = a.recorder.Record(ctx, status)
+	}
+	return nil
 }
 
-// getTemplate returns a cached, pre-parsed template for the given code type.
-func (a *SMS) getTemplate(typ verification.CodeType) (*cachedSMSTemplate, error) {
-	if cached, ok := a.tmplCache.Load(typ); ok {
+// getTemplate returns a cached, pre-parsed template for the given code type and locale.
+func (a *SMS) getTemplate(typ verification.CodeType, locale string, intl bool) (*cachedSMSTemplate, error) {
+	key := templateKey{typ: typ, locale: locale, intl: intl}
+	if cached, ok := a.tmplCache.Load(key); ok {
 		return cached.(*cachedSMSTemplate), nil
 	}
-	tmpl, err := a.provider.GetTemplate(typ)
+	provider := a.provider
+	if intl {
+		provider = a.intlProvider
+	}
+	tmpl, err := verification.LookupTemplate(provider, typ, locale)
 	if err != nil {
 		return nil, err
 	}
-	t, err := template.New("sms").Parse(tmpl.ParamsFormat)
+	t, err := verification.ParseContentTemplate("sms", tmpl.ParamsFormat)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse sms template: %w", err)
 	}
-	ct := &cachedSMSTemplate{tmpl: t, signName: tmpl.SignName, templateCode: tmpl.Code}
-	a.tmplCache.Store(typ, ct)
+	ct := &cachedSMSTemplate{tmpl: t, signName: tmpl.SignName, templateCode: tmpl.Code, taskID: tmpl.TaskID}
+	a.tmplCache.Store(key, ct)
 	return ct, nil
 }
 
-// sendMessage sends an SMS message using the specified template.
-func (a *SMS) sendMessage(signName, phoneNumber, templateCode, templateParam string) error {
+// sendMessage sends an SMS message using the specified template and returns its BizId.
+func (a *SMS) sendMessage(signName, phoneNumber, templateCode, templateParam, outID string) (string, error) {
 	request := &dysms.SendSmsRequest{}
 	request.SetSignName(signName)
 	request.SetPhoneNumbers(phoneNumber)
 	request.SetTemplateCode(templateCode)
 	request.SetTemplateParam(templateParam)
+	request.SetOutId(outID)
 	response, err := a.mainlandClient.SendSms(request)
 	if err != nil {
-		return fmt.Errorf("%w: %w", verification.ErrSendFailed, err)
+		return "", fmt.Errorf("%w: %w", verification.ErrSendFailed, err)
+	}
+	if response.Body == nil {
+		return "", nil
+	}
+	if response.Body.Code != nil && *response.Body.Code != "OK" {
+		return "", fmt.Errorf("%w, response: %s", verification.ErrSendFailed, response.Body.GoString())
+	}
+	return tea.StringValue(response.Body.BizId), nil
+}
+
+// chinaTime is the time zone of the SendDate of QuerySendDetails.
+var chinaTime = time.FixedZone("CST", 8*60*60)
+
+// QueryStatus polls QuerySendDetails for a mainland delivery, it implements
+// verification.DeliveryStatusQuerier for ProviderMainland.
+func (a *SMS) QueryStatus(_ context.Context, status *verification.DeliveryStatus) error {
+	request := &dysms.QuerySendDetailsRequest{}
+	request.SetPhoneNumber(status.Target)
+	request.SetBizId(status.BizID)
+	request.SetSendDate(status.SentAt.In(chinaTime).Format("20060102"))
+	request.SetPageSize(10)
+	request.SetCurrentPage(1)
+	response, err := a.mainlandClient.QuerySendDetails(request)
+	if err != nil {
+		return fmt.Errorf("aliyun query send details failed: %w", err)
+	}
+	body := response.Body
+	if body == nil || body.SmsSendDetailDTOs == nil {
+		return nil
 	}
-	if response.Body != nil && response.Body.Code != nil && *response.Body.Code != "OK" {
-		return fmt.Errorf("%w, response: %s", verification.ErrSendFailed, response.Body.GoString())
+	if body.Code != nil && *body.Code != "OK" {
+		return fmt.Errorf("aliyun query send details failed, response: %s", body.GoString())
+	}
+	for _, detail := range body.SmsSendDetailDTOs.SmsSendDetailDTO {
+		if detail == nil || (detail.OutId != nil && *detail.OutId != status.OutID) {
+			continue
+		}
+		// SendStatus 1 is waiting for the receipt, 2 failed and 3 delivered.
+		switch tea.Int64Value(detail.SendStatus) {
+		case 2:
+			status.State, status.ErrCode = verification.DeliveryFailed, tea.StringValue(detail.ErrCode)
+		case 3:
+			status.State, status.ErrCode = verification.DeliveryDelivered, ""
+		}
+		return nil
 	}
 	return nil
 }
 
+// sendGlobeMessage sends an SMS message to an international number, to includes the
+// country code, through SendMessageToGlobe of the 2018-05-01 API and returns its MessageId.
+func (a *SMS) sendGlobeMessage(from, to, taskID, message string) (string, error) {
+	query := map[string]*string{"To": tea.String(to), "Message": tea.String(message)}
+	if from != "" {
+		query["From"] = tea.String(from)
+	}
+	if taskID != "" {
+		query["TaskId"] = tea.String(taskID)
+	}
+	params := &openapi.Params{
+		Action:      tea.String("SendMessageToGlobe"),
+		Version:     tea.String("2018-05-01"),
+		Protocol:    tea.String("HTTPS"),
+		Pathname:    tea.String("/"),
+		Method:      tea.String("POST"),
+		AuthType:    tea.String("AK"),
+		Style:       tea.String("RPC"),
+		ReqBodyType: tea.String("formData"),
+		BodyType:    tea.String("json"),
+	}
+	request := &openapi.OpenApiRequest{Query: query}
+	response, err := a.intlClient.CallApi(params, request, &util.RuntimeOptions{})
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", verification.ErrSendFailed, err)
+	}
+	body, _ := response["body"].(map[string]interface{})
+	if code, _ := body["ResponseCode"].(string); code != "OK" {
+		return "", fmt.Errorf("%w, response: %v", verification.ErrSendFailed, body)
+	}
+	messageID, _ := body["MessageId"].(string)
+	return messageID, nil
+}
+
 // NewAliyunMainlandSMSClient creates a new Dysms client for mainland China.
 func NewAliyunMainlandSMSClient(accessKeyID, accessKeySecret, regionID, endpoint string) (*dysms.Client, error) {
 	config := new(openapi.Config)
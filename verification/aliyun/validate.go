@@ -0,0 +1,122 @@
+package aliyun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	dysms "github.com/alibabacloud-go/dysmsapi-20170525/v3/client"
+	"github.com/alibabacloud-go/tea/tea"
+
+	"github.com/crypto-zero/go-biz/verification"
+)
+
+// templateApproved is the TemplateStatus of an approved Dysms template.
+const templateApproved = 1
+
+// templateVariable matches the ${name} variables of the content of a Dysms template.
+var templateVariable = regexp.MustCompile(`\$\{(\w+)}`)
+
+// ValidateTemplates checks the templates of types without calling Aliyun, e.g. at
+// startup: the mainland templates need SignName and Code and their ParamsFormat must
+// render the code as a JSON object, the international templates must render the code.
+// It returns the errors of all invalid templates.
+func (a *SMS) ValidateTemplates(types ...verification.CodeType) error {
+	var errs []error
+	for _, typ := range types {
+		if _, _, err := a.mainlandParams(typ); err != nil {
+			errs = append(errs, fmt.Errorf("aliyun sms template %s: %w", typ, err))
+		}
+		if a.intlClient == nil {
+			continue
+		}
+		tmpl, err := a.intlProvider.GetTemplate(typ)
+		if err == nil {
+			err = tmpl.Validate()
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("aliyun international sms template %s: %w", typ, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckTemplates validates the templates of types like ValidateTemplates and queries
+// Aliyun that every mainland template exists, is approved and gets all its variables
+// from ParamsFormat.
+func (a *SMS) CheckTemplates(ctx context.Context, types ...verification.CodeType) error {
+	if err := a.ValidateTemplates(types...); err != nil {
+		return err
+	}
+	var errs []error
+	for _, typ := range types {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := a.checkRemoteTemplate(typ); err != nil {
+			errs = append(errs, fmt.Errorf("aliyun sms template %s: %w", typ, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// mainlandParams validates the mainland template of typ and returns it with its
+// params rendered with a sample code.
+func (a *SMS) mainlandParams(typ verification.CodeType) (*verification.SMSTemplate, map[string]any, error) {
+	tmpl, err := a.provider.GetTemplate(typ)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tmpl.SignName == "" || tmpl.Code == "" {
+		return nil, nil, fmt.Errorf("%w: sign name or template code is empty", verification.ErrTemplateInvalid)
+	}
+	if err = tmpl.Validate(); err != nil {
+		return nil, nil, err
+	}
+	t, err := verification.ParseContentTemplate("sms", tmpl.ParamsFormat)
+	if err != nil {
+		return nil, nil, err
+	}
+	out, err := t.Render(verification.TemplateData{Code: "123456", Value: "123456", AppName: "app", TTLMinutes: 5})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", verification.ErrTemplateInvalid, err)
+	}
+	var params map[string]any
+	if err = json.Unmarshal([]byte(out), &params); err != nil {
+		return nil, nil, fmt.Errorf("%w: params are not a JSON object: %w", verification.ErrTemplateInvalid, err)
+	}
+	return tmpl, params, nil
+}
+
+// checkRemoteTemplate queries the mainland template of typ with QuerySmsTemplate.
+func (a *SMS) checkRemoteTemplate(typ verification.CodeType) error {
+	tmpl, params, err := a.mainlandParams(typ)
+	if err != nil {
+		return err
+	}
+	request := &dysms.QuerySmsTemplateRequest{}
+	request.SetTemplateCode(tmpl.Code)
+	response, err := a.mainlandClient.QuerySmsTemplate(request)
+	if err != nil {
+		return fmt.Errorf("aliyun query sms template failed: %w", err)
+	}
+	body := response.Body
+	if body == nil {
+		return fmt.Errorf("aliyun query sms template failed: empty response")
+	}
+	if tea.StringValue(body.Code) != "OK" {
+		return fmt.Errorf("%w: %s: %s", verification.ErrTemplateInvalid, tmpl.Code, body.GoString())
+	}
+	if tea.Int32Value(body.TemplateStatus) != templateApproved {
+		return fmt.Errorf("%w: %s is not approved (status %d)", verification.ErrTemplateInvalid,
+			tmpl.Code, tea.Int32Value(body.TemplateStatus))
+	}
+	for _, m := range templateVariable.FindAllStringSubmatch(tea.StringValue(body.TemplateContent), -1) {
+		if _, ok := params[m[1]]; !ok {
+			return fmt.Errorf("%w: params of %s miss ${%s}", verification.ErrTemplateInvalid, tmpl.Code, m[1])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package verification
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// MessagePublisher publishes a message deduplicated by msgID, nats/publisher's
+// JetStreamPublisher implements it.
+type MessagePublisher interface {
+	Publish(ctx context.Context, subject, msgID string, data []byte) error
+}
+
+// deliveryMessage is the payload of a code queued for delivery. The plaintext code is
+// part of it, enable the subject encryption of the publisher for it.
+type deliveryMessage[T VerificationCode] struct {
+	Code       *T     `json:"code"`
+	Value      string `json:"value"`
+	EnqueuedAt int64  `json:"enqueued_at"` // Unix milliseconds
+}
+
+// AsyncSender is a CodeSender queueing codes on a JetStream subject instead of calling
+// the provider, a DeliveryWorker subscribed to the subject delivers them. API latency
+// is decoupled from provider latency, a failed delivery no longer fails Send.
+type AsyncSender[T VerificationCode] struct {
+	publisher MessagePublisher
+	subject   string
+}
+
+// Compile-time assertion: AsyncSender implements CodeSender[MobileCode].
+var _ CodeSender[MobileCode] = (*AsyncSender[MobileCode])(nil)
+
+// NewAsyncSender creates an AsyncSender publishing to subject.
+func NewAsyncSender[T VerificationCode](publisher MessagePublisher, subject string) *AsyncSender[T] {
+	return &AsyncSender[T]{publisher: publisher, subject: subject}
+}
+
+// Send publishes the code, the message ID deduplicates retries of the same code.
+func (s *AsyncSender[T]) Send(ctx context.Context, code *T) error {
+	c := any(code).(interface {
+		GetValue() string
+		GetSequence() string
+		GetDigest() string
+	})
+	data, err := json.Marshal(deliveryMessage[T]{Code: code, Value: c.GetValue(), EnqueuedAt: timeNow().UnixMilli()})
+	if err != nil {
+		return fmt.Errorf("verification: encode delivery failed: %w", err)
+	}
+	if err = s.publisher.Publish(ctx, s.subject, c.GetSequence()+":"+c.GetDigest(), data); err != nil {
+		return fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+	return nil
+}
+
+// DeliveryWorker delivers the codes queued by an AsyncSender with the provider sender.
+// It implements the Handler of nats/subscriber.
+type DeliveryWorker[T VerificationCode] struct {
+	sender CodeSender[T]
+	maxAge time.Duration
+	logger *slog.Logger
+}
+
+// NewDeliveryWorker creates a DeliveryWorker. Codes queued longer than maxAge, usually
+// the TTL of the codes, are dropped as they can no longer be verified; zero keeps all.
+// A nil logger uses slog.Default.
+func NewDeliveryWorker[T VerificationCode](sender CodeSender[T], maxAge time.Duration,
+	logger *slog.Logger,
+) *DeliveryWorker[T] {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &DeliveryWorker[T]{sender: sender, maxAge: maxAge, logger: logger}
+}
+
+// Handle delivers a queued code. Transient provider failures are returned so the
+// message is redelivered, malformed and expired messages and rejected codes are logged
+// and dropped.
+func (w *DeliveryWorker[T]) Handle(ctx context.Context, subject, id string, data []byte,
+	_ func(ctx context.Context) error,
+) error {
+	var msg deliveryMessage[T]
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Code == nil {
+		w.logger.ErrorContext(ctx, "dropped malformed code delivery", "subject", subject, "id", id, "err", err)
+		return nil
+	}
+	if w.maxAge > 0 && timeNow().Sub(time.UnixMilli(msg.EnqueuedAt)) > w.maxAge {
+		w.logger.WarnContext(ctx, "dropped expired code delivery", "subject", subject, "id", id)
+		return nil
+	}
+	any(msg.Code).(interface{ setValue(string) }).setValue(msg.Value)
+	if err := w.sender.Send(ctx, msg.Code); err != nil {
+		if isTransient(err) || ctx.Err() != nil {
+			return fmt.Errorf("verification: deliver code failed: %w", err)
+		}
+		w.logger.ErrorContext(ctx, "dropped rejected code delivery", "subject", subject, "id", id, "err", err)
+	}
+	return nil
+}
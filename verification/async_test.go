@@ -0,0 +1,58 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePublisher captures published messages.
+type fakePublisher struct {
+	subjects, ids []string
+	data          [][]byte
+}
+
+func (p *fakePublisher) Publish(_ context.Context, subject, msgID string, data []byte) error {
+	p.subjects, p.ids, p.data = append(p.subjects, subject), append(p.ids, msgID), append(p.data, data)
+	return nil
+}
+
+func TestVerification_AsyncSender(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	pub := &fakePublisher{}
+	svc := NewOTPService[MobileCode](mobileTestConfig(5, 5), client, NewAsyncSender[MobileCode](pub, "otp.sms"))
+	mc, err := NewTestCodeGenerator("123456").NewMobileCode("login", 1, "13800000000", "86")
+	require.NoError(t, err)
+	seq, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+	require.Len(t, pub.data, 1)
+	assert.Equal(t, "otp.sms", pub.subjects[0])
+	assert.Equal(t, seq+":"+mc.Digest, pub.ids[0])
+
+	sms := &fakeSMSSender{}
+	worker := NewDeliveryWorker[MobileCode](sms, time.Minute, nil)
+	require.NoError(t, worker.Handle(ctx, "otp.sms", pub.ids[0], pub.data[0], nil))
+	require.NotNil(t, sms.last)
+	assert.Equal(t, "123456", sms.last.GetValue())
+	assert.Equal(t, "13800000000", sms.last.Mobile)
+	assert.Equal(t, seq, sms.last.Sequence)
+
+	// Transient failures are redelivered, rejected, expired and malformed messages dropped.
+	transient := errors.New("provider timeout")
+	failing := &scriptedSMSSender{errs: []error{transient, ErrUnsupportedCountryCode}}
+	worker = NewDeliveryWorker[MobileCode](failing, time.Minute, nil)
+	assert.ErrorIs(t, worker.Handle(ctx, "otp.sms", pub.ids[0], pub.data[0], nil), transient)
+	assert.NoError(t, worker.Handle(ctx, "otp.sms", pub.ids[0], pub.data[0], nil))
+	assert.NoError(t, worker.Handle(ctx, "otp.sms", "x", []byte("{"), nil))
+	timeNow = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	defer func() { timeNow = time.Now }()
+	assert.NoError(t, worker.Handle(ctx, "otp.sms", pub.ids[0], pub.data[0], nil))
+	assert.Equal(t, 2, failing.calls)
+}
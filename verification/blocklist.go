@@ -0,0 +1,214 @@
+package verification
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrTargetBlocked indicates that the target of a send is on the block list.
+	ErrTargetBlocked = bizerrors.New(403, "VERIFICATION_TARGET_BLOCKED", "target is blocked")
+	// ErrInvalidBlockKind indicates a block list entry of an unknown kind.
+	ErrInvalidBlockKind = bizerrors.New(400, "VERIFICATION_INVALID_BLOCK_KIND", "invalid block kind")
+)
+
+// BlockKind is the kind of the entries of a block list.
+type BlockKind string
+
+const (
+	// BlockMobile blocks a number with its country code, e.g. "8613800138000".
+	BlockMobile BlockKind = "MOBILE"
+	// BlockMobilePrefix blocks the numbers starting with a prefix including the country
+	// code, e.g. "86170" for a virtual operator range.
+	BlockMobilePrefix BlockKind = "MOBILE_PREFIX"
+	// BlockEmail blocks an email address.
+	BlockEmail BlockKind = "EMAIL"
+	// BlockEmailDomain blocks the addresses of a domain and its subdomains, e.g.
+	// "mailinator.com" for disposable mailboxes.
+	BlockEmailDomain BlockKind = "EMAIL_DOMAIN"
+)
+
+// BlockKinds lists the kinds of a RedisBlockList.
+var BlockKinds = []BlockKind{BlockMobile, BlockMobilePrefix, BlockEmail, BlockEmailDomain}
+
+// BlockEntry is an entry of a block list.
+type BlockEntry struct {
+	Kind      BlockKind `json:"kind"`
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at"` // Zero for a permanent block
+}
+
+// BlockList is consulted by OTPService before sending, see WithBlockList.
+type BlockList interface {
+	// Blocked reports whether target is blocked.
+	Blocked(ctx context.Context, target Target) (bool, error)
+}
+
+// WithBlockList rejects sends to the targets blocked by list with ErrTargetBlocked,
+// before any limit or quota is consumed.
+func WithBlockList[T CodeConstraint](list BlockList) OTPServiceOption[T] {
+	return func(s *OTPService[T]) { s.blockList = list }
+}
+
+// RedisBlockList is a BlockList keeping a Redis sorted set per BlockKind, scored by the
+// expiry of the entries in milliseconds, so entries may be blocked temporarily. Expired
+// entries are ignored and removed on the next change of their kind.
+type RedisBlockList struct {
+	client redis.UniversalClient
+	keys   *CacheKeyBuilder
+}
+
+// Compile-time assertion: RedisBlockList implements BlockList.
+var _ BlockList = (*RedisBlockList)(nil)
+
+// NewRedisBlockList creates a RedisBlockList.
+func NewRedisBlockList(client redis.UniversalClient, prefix CodeCacheKeyPrefix) *RedisBlockList {
+	return &RedisBlockList{client: client, keys: NewCacheKeyBuilder(prefix)}
+}
+
+// Block adds value of kind to the list for ttl, permanently when ttl is zero. Blocking
+// a value again replaces its expiry.
+func (l *RedisBlockList) Block(ctx context.Context, kind BlockKind, value string, ttl time.Duration) error {
+	value, err := normalizeBlockValue(kind, value)
+	if err != nil {
+		return err
+	}
+	now := timeNow()
+	score := math.Inf(1)
+	if ttl > 0 {
+		score = float64(now.Add(ttl).UnixMilli())
+	}
+	key := l.keys.BlockKey(string(kind))
+	_, err = l.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+		pipe.ZAdd(ctx, key, redis.Z{Score: score, Member: value})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("verification: redis zadd failed: %w", err)
+	}
+	return nil
+}
+
+// Unblock removes value of kind from the list.
+func (l *RedisBlockList) Unblock(ctx context.Context, kind BlockKind, value string) error {
+	value, err := normalizeBlockValue(kind, value)
+	if err != nil {
+		return err
+	}
+	if err = l.client.ZRem(ctx, l.keys.BlockKey(string(kind)), value).Err(); err != nil {
+		return fmt.Errorf("verification: redis zrem failed: %w", err)
+	}
+	return nil
+}
+
+// List returns the unexpired entries of kind.
+func (l *RedisBlockList) List(ctx context.Context, kind BlockKind) ([]BlockEntry, error) {
+	if _, err := normalizeBlockValue(kind, ""); err != nil {
+		return nil, err
+	}
+	zs, err := l.client.ZRangeByScoreWithScores(ctx, l.keys.BlockKey(string(kind)), &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(timeNow().UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("verification: redis zrangebyscore failed: %w", err)
+	}
+	entries := make([]BlockEntry, 0, len(zs))
+	for _, z := range zs {
+		e := BlockEntry{Kind: kind, Value: z.Member.(string)}
+		if !math.IsInf(z.Score, 1) {
+			e.ExpiresAt = time.UnixMilli(int64(z.Score))
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Blocked implements BlockList. A number is matched against the numbers and every
+// prefix of it, an address against the addresses and its domain and parent domains.
+// Wallet targets are never blocked.
+func (l *RedisBlockList) Blocked(ctx context.Context, target Target) (bool, error) {
+	candidates := map[BlockKind][]string{}
+	if target.Mobile != "" {
+		number, _ := normalizeBlockValue(BlockMobile, target.CountryCode+target.Mobile)
+		candidates[BlockMobile] = []string{number}
+		prefixes := make([]string, 0, len(number))
+		for i := 1; i <= len(number); i++ {
+			prefixes = append(prefixes, number[:i])
+		}
+		candidates[BlockMobilePrefix] = prefixes
+	}
+	if target.Email != "" {
+		email, _ := normalizeBlockValue(BlockEmail, target.Email)
+		candidates[BlockEmail] = []string{email}
+		if _, domain, ok := strings.Cut(email, "@"); ok && domain != "" {
+			var domains []string
+			for ; strings.Contains(domain, "."); _, domain, _ = strings.Cut(domain, ".") {
+				domains = append(domains, domain)
+			}
+			candidates[BlockEmailDomain] = domains
+		}
+	}
+	if len(candidates) == 0 {
+		return false, nil
+	}
+
+	pipe := l.client.Pipeline()
+	cmds := make([]*redis.FloatSliceCmd, 0, len(candidates))
+	for kind, members := range candidates {
+		if len(members) > 0 {
+			cmds = append(cmds, pipe.ZMScore(ctx, l.keys.BlockKey(string(kind)), members...))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("verification: redis zmscore failed: %w", err)
+	}
+	// ZMSCORE scores missing members 0, so they are expired as well.
+	now := float64(timeNow().UnixMilli())
+	for _, cmd := range cmds {
+		for _, score := range cmd.Val() {
+			if score > now {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// normalizeBlockValue returns value as stored in the list of kind: numbers without "+",
+// spaces or dashes, lowercase addresses and domains without "@".
+func normalizeBlockValue(kind BlockKind, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch kind {
+	case BlockMobile, BlockMobilePrefix:
+		return strings.NewReplacer("+", "", " ", "", "-", "").Replace(value), nil
+	case BlockEmail:
+		return strings.ToLower(value), nil
+	case BlockEmailDomain:
+		return strings.TrimPrefix(strings.ToLower(value), "@"), nil
+	}
+	return "", ErrInvalidBlockKind
+}
+
+// blockTarget returns the Target of code checked against a BlockList.
+func blockTarget(code any) Target {
+	switch v := code.(type) {
+	case *MobileCode:
+		return Target{Mobile: v.Mobile, CountryCode: v.CountryCode}
+	case *EmailCode:
+		return Target{Email: v.Email}
+	case *EcdsaCode:
+		return Target{Chain: v.Chain, Address: v.Address}
+	case *Ed25519Code:
+		return Target{Chain: v.Chain, Address: v.Address}
+	}
+	return Target{}
+}
@@ -0,0 +1,75 @@
+package verification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_Service_BlockList(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	list := NewRedisBlockList(client, "TEST")
+	require.NoError(t, list.Block(ctx, BlockMobile, "+86 138-0013-8001", 0))
+	require.NoError(t, list.Block(ctx, BlockMobilePrefix, "86170", 0))
+	require.NoError(t, list.Block(ctx, BlockEmailDomain, "@Mailinator.com", time.Hour))
+	assert.ErrorIs(t, list.Block(ctx, "PHONE", "1", 0), ErrInvalidBlockKind)
+
+	gen := NewTestCodeGenerator("666666")
+	mobile := NewOTPService[MobileCode](mobileTestConfig(10, 10), client, &fakeSMSSender{},
+		WithBlockList[MobileCode](list))
+	email := NewOTPService[EmailCode](emailTestConfig(10, 10), client, &fakeEmailSender{},
+		WithBlockList[EmailCode](list))
+	sendMobile := func(number string) error {
+		mc, err := gen.NewMobileCode("login", 1, number, "86")
+		require.NoError(t, err)
+		_, err = mobile.Send(ctx, mc)
+		return err
+	}
+	sendEmail := func(address string) error {
+		ec, err := gen.NewEmailCode("login", 1, address)
+		require.NoError(t, err)
+		_, err = email.Send(ctx, ec)
+		return err
+	}
+
+	assert.ErrorIs(t, sendMobile("13800138001"), ErrTargetBlocked)
+	assert.ErrorIs(t, sendMobile("17012345678"), ErrTargetBlocked)
+	require.NoError(t, sendMobile("13800138002"))
+	assert.ErrorIs(t, sendEmail("user@mailinator.com"), ErrTargetBlocked)
+	assert.ErrorIs(t, sendEmail("user@eu.MAILINATOR.com"), ErrTargetBlocked)
+	require.NoError(t, sendEmail("user@example.com"))
+
+	// A blocked send consumes no limit.
+	n, err := client.Exists(ctx, NewCacheKeyBuilder("TEST").LimitKey("MOBILE", "login", "13800138001", "86")).Result()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	entries, err := list.List(ctx, BlockEmailDomain)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "mailinator.com", entries[0].Value)
+	assert.Equal(t, now.Add(time.Hour).UnixMilli(), entries[0].ExpiresAt.UnixMilli())
+
+	// Temporary blocks expire, and entries can be removed.
+	now = now.Add(time.Hour + time.Second)
+	require.NoError(t, sendEmail("user@mailinator.com"))
+	entries, err = list.List(ctx, BlockEmailDomain)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	require.NoError(t, list.Unblock(ctx, BlockMobilePrefix, "86170"))
+	require.NoError(t, sendMobile("17012345678"))
+	entries, err = list.List(ctx, BlockMobile)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, BlockEntry{Kind: BlockMobile, Value: "8613800138001"}, entries[0])
+}
@@ -0,0 +1,145 @@
+package verification
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/mr-tron/base58"
+)
+
+// ChainVerifier implements the address format and the signature scheme of a chain,
+// the wallet channels use it to check that a challenge was signed by its address.
+type ChainVerifier interface {
+	// NormalizeAddress validates address and returns its canonical form, codes are
+	// stored under it.
+	NormalizeAddress(address string) (string, error)
+	// Message returns the text the wallet signs for a challenge.
+	Message(challenge string) string
+	// VerifySignature checks that signature is a signature of message by address.
+	VerifySignature(address, message, signature string) error
+}
+
+// Chains of the DefaultChainRegistry.
+const (
+	ChainEthereum = "ETHEREUM"
+	ChainBSC      = "BSC"
+)
+
+// ChainRegistry maps the Chain of wallet codes to their ChainVerifier, chain names are
+// case-insensitive. It is safe for concurrent use.
+type ChainRegistry struct {
+	mu        sync.RWMutex
+	verifiers map[string]ChainVerifier
+}
+
+// NewChainRegistry creates an empty ChainRegistry.
+func NewChainRegistry() *ChainRegistry {
+	return &ChainRegistry{verifiers: map[string]ChainVerifier{}}
+}
+
+// DefaultChainRegistry creates a ChainRegistry with the EthereumVerifier registered for
+// ChainEthereum and ChainBSC.
+func DefaultChainRegistry() *ChainRegistry {
+	r := NewChainRegistry()
+	r.Register(ChainEthereum, EthereumVerifier{})
+	r.Register(ChainBSC, EthereumVerifier{})
+	return r
+}
+
+// Register sets the verifier of chain, replacing a registered one.
+func (r *ChainRegistry) Register(chain string, verifier ChainVerifier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.verifiers[strings.ToUpper(chain)] = verifier
+}
+
+// Verifier returns the verifier of chain or ErrUnsupportedChain.
+func (r *ChainRegistry) Verifier(chain string) (ChainVerifier, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	v, ok := r.verifiers[strings.ToUpper(chain)]
+	if !ok {
+		return nil, ErrUnsupportedChain
+	}
+	return v, nil
+}
+
+// challengeMessage returns the message of challenge prefixed by statement.
+func challengeMessage(statement, challenge string) string {
+	if statement == "" {
+		return challenge
+	}
+	return statement + "\n\nNonce: " + challenge
+}
+
+// EthereumVerifier is the ChainVerifier of EVM chains such as Ethereum and BSC.
+// Addresses are hex and normalized to EIP-55, messages are signed with personal_sign.
+type EthereumVerifier struct {
+	// Statement, when set, precedes the challenge in the signed message.
+	Statement string
+}
+
+var _ ChainVerifier = EthereumVerifier{}
+
+// NormalizeAddress implements ChainVerifier.
+func (EthereumVerifier) NormalizeAddress(address string) (string, error) {
+	return checksumAddress(address)
+}
+
+// Message implements ChainVerifier.
+func (v EthereumVerifier) Message(challenge string) string {
+	return challengeMessage(v.Statement, challenge)
+}
+
+// VerifySignature implements ChainVerifier.
+func (EthereumVerifier) VerifySignature(address, message, signature string) error {
+	return verifyPersonalSignature(address, message, signature)
+}
+
+// Ed25519Verifier is the ChainVerifier of ed25519 chains such as Solana and NEAR.
+// Addresses are base58 public keys, optionally prefixed "ed25519:" as NEAR keys are.
+// Signatures of the raw message are base58, or hex when prefixed "0x".
+type Ed25519Verifier struct {
+	// Statement, when set, precedes the challenge in the signed message.
+	Statement string
+}
+
+var _ ChainVerifier = Ed25519Verifier{}
+
+// NormalizeAddress implements ChainVerifier.
+func (Ed25519Verifier) NormalizeAddress(address string) (string, error) {
+	key, err := base58.Decode(strings.TrimPrefix(address, "ed25519:"))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return "", ErrEd25519AddressInvalid
+	}
+	return base58.Encode(key), nil
+}
+
+// Message implements ChainVerifier.
+func (v Ed25519Verifier) Message(challenge string) string {
+	return challengeMessage(v.Statement, challenge)
+}
+
+// VerifySignature implements ChainVerifier.
+func (v Ed25519Verifier) VerifySignature(address, message, signature string) error {
+	address, err := v.NormalizeAddress(address)
+	if err != nil {
+		return err
+	}
+	key, _ := base58.Decode(address)
+	var sig []byte
+	if strings.HasPrefix(signature, "0x") {
+		sig, err = hex.DecodeString(signature[2:])
+	} else {
+		sig, err = base58.Decode(signature)
+	}
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return ErrSignatureInvalid
+	}
+	if !ed25519.Verify(key, []byte(message), sig) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
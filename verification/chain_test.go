@@ -0,0 +1,55 @@
+package verification
+
+import (
+	"context"
+	"crypto/ed25519"
+	"strings"
+	"testing"
+
+	"github.com/mr-tron/base58"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_ChainRegistry(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	registry := DefaultChainRegistry()
+	_, err := registry.Verifier("bsc")
+	assert.NoError(t, err)
+	_, err = registry.Verifier("TRON")
+	assert.ErrorIs(t, err, ErrUnsupportedChain)
+	registry.Register("SOLANA", Ed25519Verifier{})
+	registry.Register(ChainBSC, EthereumVerifier{Statement: "Sign in to Example."})
+
+	svc := NewChannelOTPService(NewTestCodeGenerator("123456"), nil, nil,
+		NewOTPService[EcdsaCode](DefaultOTPConfig("TEST"), client, nil),
+		WithEd25519(NewOTPService[Ed25519Code](DefaultOTPConfig("TEST"), client, nil), nil),
+		WithChainRegistry(registry))
+
+	_, err = svc.Send(ctx, ChannelEcdsa, "login", 1, Target{Chain: "TRON", Address: testWalletAddress})
+	assert.ErrorIs(t, err, ErrUnsupportedChain)
+	_, err = svc.Send(ctx, ChannelEcdsa, "login", 1, Target{Chain: ChainBSC, Address: "0xabc"})
+	assert.ErrorIs(t, err, ErrEcdsaAddressInvalid)
+
+	// Addresses are normalized, the statement is part of the signed message only.
+	wallet := Target{Chain: ChainBSC, Address: strings.ToLower(testWalletAddress)}
+	res, err := svc.Send(ctx, ChannelEcdsa, "login", 1, wallet)
+	require.NoError(t, err)
+	assert.Equal(t, "Sign in to Example.\n\nNonce: "+res.Challenge, res.Message)
+	assert.ErrorIs(t, svc.VerifySignature(ctx, ChannelEcdsa, "login", res.Sequence, wallet, res.Challenge,
+		signHash(t, personalMessageHash(res.Challenge))), ErrSignatureInvalid)
+	assert.NoError(t, svc.VerifySignature(ctx, ChannelEcdsa, "login", res.Sequence,
+		Target{Chain: ChainBSC, Address: testWalletAddress}, res.Challenge,
+		signHash(t, personalMessageHash(res.Message))))
+
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	sol := Target{Chain: "solana", Address: base58.Encode(key.Public().(ed25519.PublicKey))}
+	res, err = svc.Send(ctx, ChannelEd25519, "login", 1, sol)
+	require.NoError(t, err)
+	assert.Equal(t, res.Challenge, res.Message)
+	assert.NoError(t, svc.VerifySignature(ctx, ChannelEd25519, "login", res.Sequence, sol, res.Challenge,
+		base58.Encode(ed25519.Sign(key, []byte(res.Message)))))
+}
@@ -0,0 +1,287 @@
+package verification
+
+import (
+	"context"
+	"fmt"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+)
+
+// Channel is a verification channel.
+type Channel string
+
+const (
+	ChannelMobile  Channel = "MOBILE"
+	ChannelEmail   Channel = "EMAIL"
+	ChannelEcdsa   Channel = "ECDSA"
+	ChannelEd25519 Channel = "ED25519"
+)
+
+var (
+	// ErrUnsupportedChannel is returned for an unknown Channel.
+	ErrUnsupportedChannel = bizerrors.New(400, "VERIFICATION_UNSUPPORTED_CHANNEL", "unsupported verification channel")
+	// ErrChannelNotConfigured is returned for a Channel without OTPService.
+	ErrChannelNotConfigured = bizerrors.New(500, "VERIFICATION_CHANNEL_NOT_CONFIGURED",
+		"verification channel is not configured")
+)
+
+// Target identifies the recipient of a code, only the fields of the channel are used.
+type Target struct {
+	Mobile      string // ChannelMobile
+	CountryCode string // ChannelMobile
+	Email       string // ChannelEmail
+	Chain       string // ChannelEcdsa, ChannelEd25519
+	Address     string // ChannelEcdsa, ChannelEd25519
+}
+
+// SendResult is the result of ChannelOTPService.Send.
+type SendResult struct {
+	// Sequence identifies the code in Verify.
+	Sequence string
+	// Challenge is the code of the wallet channels, it is empty for delivered codes.
+	Challenge string
+	// Message is the text the wallet signs for Challenge, formatted by the ChainVerifier
+	// of the chain, or Challenge itself without one.
+	Message string
+}
+
+// ChannelOTPService dispatches Send and Verify by Channel to the per-channel
+// OTPService, each with its own cache keys, limiters and sender.
+type ChannelOTPService struct {
+	generator CodeGenerator
+	mobile    *OTPService[MobileCode]
+	email     *OTPService[EmailCode]
+	ecdsa     *OTPService[EcdsaCode]
+	ed25519   *OTPService[Ed25519Code]
+	edChain   ChainVerifier
+	chains    *ChainRegistry
+}
+
+// ChannelOption configures a ChannelOTPService.
+type ChannelOption func(*ChannelOTPService)
+
+// WithEd25519 enables ChannelEd25519, verifier checks the addresses and signatures of
+// its chains.
+func WithEd25519(svc *OTPService[Ed25519Code], verifier ChainVerifier) ChannelOption {
+	return func(s *ChannelOTPService) { s.ed25519, s.edChain = svc, verifier }
+}
+
+// WithChainRegistry sets the ChainVerifier of the wallet channels by the Chain of the
+// target, e.g. DefaultChainRegistry. Without it ChannelEcdsa keeps addresses as given
+// and leaves the signature check to the caller.
+func WithChainRegistry(r *ChainRegistry) ChannelOption {
+	return func(s *ChannelOTPService) { s.chains = r }
+}
+
+// NewChannelOTPService creates a ChannelOTPService, a nil service disables its channel.
+func NewChannelOTPService(generator CodeGenerator, mobile *OTPService[MobileCode],
+	email *OTPService[EmailCode], ecdsa *OTPService[EcdsaCode], opts ...ChannelOption,
+) *ChannelOTPService {
+	s := &ChannelOTPService{generator: generator, mobile: mobile, email: email, ecdsa: ecdsa}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Send generates a code of typ for the target and sends it through the channel.
+func (s *ChannelOTPService) Send(ctx context.Context, channel Channel, typ CodeType, userID int64,
+	target Target, opts ...SendOption,
+) (*SendResult, error) {
+	switch channel {
+	case ChannelMobile:
+		if s.mobile == nil {
+			return nil, ErrChannelNotConfigured
+		}
+		code, err := s.generator.NewMobileCode(typ, userID, target.Mobile, target.CountryCode)
+		if err != nil {
+			return nil, err
+		}
+		seq, err := s.mobile.Send(ctx, code, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &SendResult{Sequence: seq}, nil
+	case ChannelEmail:
+		if s.email == nil {
+			return nil, ErrChannelNotConfigured
+		}
+		code, err := s.generator.NewEmailCode(typ, userID, target.Email)
+		if err != nil {
+			return nil, err
+		}
+		seq, err := s.email.Send(ctx, code, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &SendResult{Sequence: seq}, nil
+	case ChannelEcdsa:
+		if s.ecdsa == nil {
+			return nil, ErrChannelNotConfigured
+		}
+		v, address, err := s.walletAddress(channel, target)
+		if err != nil {
+			return nil, err
+		}
+		code, err := s.generator.NewEcdsaCode(typ, userID, target.Chain, address)
+		if err != nil {
+			return nil, err
+		}
+		seq, err := s.ecdsa.Send(ctx, code, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return walletResult(seq, code.GetValue(), v), nil
+	case ChannelEd25519:
+		if s.ed25519 == nil {
+			return nil, ErrChannelNotConfigured
+		}
+		v, address, err := s.walletAddress(channel, target)
+		if err != nil {
+			return nil, err
+		}
+		code, err := s.generator.NewEd25519Code(typ, userID, target.Chain, address)
+		if err != nil {
+			return nil, err
+		}
+		seq, err := s.ed25519.Send(ctx, code, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return walletResult(seq, code.GetValue(), v), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedChannel, channel)
+	}
+}
+
+// Verify checks the input against the code identified by typ, sequence and target.
+func (s *ChannelOTPService) Verify(ctx context.Context, channel Channel, typ CodeType, sequence string,
+	target Target, input string,
+) error {
+	base := Code{Type: typ, Sequence: sequence}
+	switch channel {
+	case ChannelMobile:
+		if s.mobile == nil {
+			return ErrChannelNotConfigured
+		}
+		return s.mobile.Verify(ctx, input, &MobileCode{Code: base, Mobile: target.Mobile,
+			CountryCode: target.CountryCode})
+	case ChannelEmail:
+		if s.email == nil {
+			return ErrChannelNotConfigured
+		}
+		return s.email.Verify(ctx, input, &EmailCode{Code: base, Email: target.Email})
+	case ChannelEcdsa:
+		if s.ecdsa == nil {
+			return ErrChannelNotConfigured
+		}
+		_, address, err := s.walletAddress(channel, target)
+		if err != nil {
+			return err
+		}
+		return s.ecdsa.Verify(ctx, input, &EcdsaCode{Code: base, Chain: target.Chain, Address: address})
+	case ChannelEd25519:
+		if s.ed25519 == nil {
+			return ErrChannelNotConfigured
+		}
+		_, address, err := s.walletAddress(channel, target)
+		if err != nil {
+			return err
+		}
+		return s.ed25519.Verify(ctx, input, &Ed25519Code{Code: base, Chain: target.Chain, Address: address})
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedChannel, channel)
+	}
+}
+
+// VerifySignature checks that signature is a signature of the message of challenge by
+// the target address and then verifies challenge like Verify, for the wallet channels
+// with a ChainVerifier of the chain.
+func (s *ChannelOTPService) VerifySignature(ctx context.Context, channel Channel, typ CodeType,
+	sequence string, target Target, challenge, signature string,
+) error {
+	switch channel {
+	case ChannelEcdsa, ChannelEd25519:
+		if (channel == ChannelEcdsa && s.ecdsa == nil) || (channel == ChannelEd25519 && s.ed25519 == nil) {
+			return ErrChannelNotConfigured
+		}
+		v, _, err := s.walletAddress(channel, target)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return fmt.Errorf("%w: %s", ErrUnsupportedChain, target.Chain)
+		}
+		if err := v.VerifySignature(target.Address, v.Message(challenge), signature); err != nil {
+			return err
+		}
+		return s.Verify(ctx, channel, typ, sequence, target, challenge)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedChannel, channel)
+	}
+}
+
+// walletAddress returns the ChainVerifier of the target chain and the address
+// normalized by it. The registry takes precedence over the verifier of WithEd25519, a
+// ChannelEcdsa chain has no verifier without registry.
+func (s *ChannelOTPService) walletAddress(channel Channel, target Target) (ChainVerifier, string, error) {
+	var v ChainVerifier
+	if s.chains != nil {
+		v, _ = s.chains.Verifier(target.Chain)
+	}
+	if v == nil && channel == ChannelEd25519 {
+		v = s.edChain
+	}
+	if v == nil {
+		if s.chains != nil {
+			return nil, "", fmt.Errorf("%w: %s", ErrUnsupportedChain, target.Chain)
+		}
+		return nil, target.Address, nil
+	}
+	address, err := v.NormalizeAddress(target.Address)
+	if err != nil {
+		return nil, "", err
+	}
+	return v, address, nil
+}
+
+// walletResult returns the SendResult of a wallet challenge formatted by v.
+func walletResult(seq, challenge string, v ChainVerifier) *SendResult {
+	message := challenge
+	if v != nil {
+		message = v.Message(challenge)
+	}
+	return &SendResult{Sequence: seq, Challenge: challenge, Message: message}
+}
+
+// Resend generates a fresh code of typ for the target under an outstanding sequence and
+// delivers it, see OTPService.Resend. The wallet channels have nothing to deliver, a
+// new challenge is requested with Send.
+func (s *ChannelOTPService) Resend(ctx context.Context, channel Channel, typ CodeType, userID int64,
+	sequence string, target Target, opts ...SendOption,
+) error {
+	switch channel {
+	case ChannelMobile:
+		if s.mobile == nil {
+			return ErrChannelNotConfigured
+		}
+		code, err := s.generator.NewMobileCode(typ, userID, target.Mobile, target.CountryCode)
+		if err != nil {
+			return err
+		}
+		code.Sequence = sequence
+		return s.mobile.Resend(ctx, code, opts...)
+	case ChannelEmail:
+		if s.email == nil {
+			return ErrChannelNotConfigured
+		}
+		code, err := s.generator.NewEmailCode(typ, userID, target.Email)
+		if err != nil {
+			return err
+		}
+		code.Sequence = sequence
+		return s.email.Resend(ctx, code, opts...)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedChannel, channel)
+	}
+}
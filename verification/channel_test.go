@@ -0,0 +1,86 @@
+package verification
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/mr-tron/base58"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_ChannelOTPService(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	sms, mail := &fakeSMSSender{}, &fakeEmailSender{}
+	svc := NewChannelOTPService(NewTestCodeGenerator("123456"),
+		NewOTPService[MobileCode](mobileTestConfig(5, 5), client, sms),
+		NewOTPService[EmailCode](emailTestConfig(5, 5), client, mail),
+		NewOTPService[EcdsaCode](DefaultOTPConfig("TEST"), client, nil))
+
+	mobile := Target{Mobile: "13800000000", CountryCode: "86"}
+	res, err := svc.Send(ctx, ChannelMobile, "login", 1, mobile)
+	require.NoError(t, err)
+	assert.Empty(t, res.Challenge)
+	assert.Equal(t, "123456", sms.last.GetValue())
+	assert.ErrorIs(t, svc.Verify(ctx, ChannelMobile, "login", res.Sequence, mobile, "000000"), ErrCodeIncorrect)
+	assert.NoError(t, svc.Verify(ctx, ChannelMobile, "login", res.Sequence, mobile, "123456"))
+
+	email := Target{Email: "user@example.com"}
+	res, err = svc.Send(ctx, ChannelEmail, "login", 1, email)
+	require.NoError(t, err)
+	assert.NoError(t, svc.Verify(ctx, ChannelEmail, "login", res.Sequence, email, "123456"))
+
+	wallet := Target{Chain: "ETH", Address: "0xabc"}
+	res, err = svc.Send(ctx, ChannelEcdsa, "login", 1, wallet)
+	require.NoError(t, err)
+	require.NotEmpty(t, res.Challenge)
+	assert.NoError(t, svc.Verify(ctx, ChannelEcdsa, "login", res.Sequence, wallet, res.Challenge))
+
+	_, err = svc.Send(ctx, "FAX", "login", 1, mobile)
+	assert.ErrorIs(t, err, ErrUnsupportedChannel)
+	_, err = NewChannelOTPService(NewTestCodeGenerator("1"), nil, nil, nil).Send(ctx, ChannelEmail, "login", 1, email)
+	assert.ErrorIs(t, err, ErrChannelNotConfigured)
+}
+
+func TestVerification_Ed25519Channel(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, fastForward := getRedisClient(t)
+	defer cleanup()
+
+	key := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	address := base58.Encode(key.Public().(ed25519.PublicKey))
+	svc := NewChannelOTPService(NewTestCodeGenerator("123456"), nil, nil, nil,
+		WithEd25519(NewOTPService[Ed25519Code](DefaultOTPConfig("TEST"), client, nil), Ed25519Verifier{}))
+
+	_, err := svc.Send(ctx, ChannelEd25519, "login", 1, Target{Chain: "SOLANA", Address: "0xabc"})
+	assert.ErrorIs(t, err, ErrEd25519AddressInvalid)
+
+	wallet := Target{Chain: "SOLANA", Address: address}
+	res, err := svc.Send(ctx, ChannelEd25519, "login", 1, wallet)
+	require.NoError(t, err)
+	require.NotEmpty(t, res.Challenge)
+	sig := ed25519.Sign(key, []byte(res.Challenge))
+	assert.ErrorIs(t, svc.VerifySignature(ctx, ChannelEd25519, "login", res.Sequence, wallet, res.Challenge,
+		base58.Encode(ed25519.Sign(key, []byte("other")))), ErrSignatureInvalid)
+	assert.NoError(t, svc.VerifySignature(ctx, ChannelEd25519, "login", res.Sequence, wallet, res.Challenge,
+		base58.Encode(sig)))
+
+	// NEAR style keys and hex signatures address the same code.
+	fastForward(time.Minute)
+	res, err = svc.Send(ctx, ChannelEd25519, "login", 1, wallet)
+	require.NoError(t, err)
+	near := Target{Chain: "SOLANA", Address: "ed25519:" + address}
+	assert.NoError(t, svc.VerifySignature(ctx, ChannelEd25519, "login", res.Sequence, near, res.Challenge,
+		"0x"+hex.EncodeToString(ed25519.Sign(key, []byte(res.Challenge)))))
+
+	assert.ErrorIs(t, svc.VerifySignature(ctx, ChannelMobile, "login", res.Sequence, wallet, "", ""),
+		ErrUnsupportedChannel)
+	assert.ErrorIs(t, NewChannelOTPService(NewTestCodeGenerator("1"), nil, nil, nil).
+		VerifySignature(ctx, ChannelEd25519, "login", res.Sequence, wallet, "", ""), ErrChannelNotConfigured)
+}
@@ -0,0 +1,78 @@
+package verification
+
+import "github.com/crypto-zero/go-biz/cache"
+
+// Codec encodes the stored verification codes, it is the Codec of the go-biz cache.
+type Codec = cache.Codec
+
+var (
+	// JSONCodec encodes codes with encoding/json. It is the default, readable by other
+	// languages sharing the Redis, and the only codec verified by a single Lua script.
+	JSONCodec = cache.JSONCodec
+	// GobCodec encodes codes with encoding/gob.
+	GobCodec = cache.GobCodec
+	// MsgpackCodec encodes codes with msgpack, keyed by the json field names.
+	MsgpackCodec = cache.MsgpackCodec
+)
+
+// envelopeMarker starts a VersionedCodec payload. No codec starts a code with it: gob
+// streams start with a non-zero message length, JSON with '{' and msgpack with a map.
+const envelopeMarker = 0x00
+
+// CodecUpgrade decodes body, written with codec by an older layout of the code types,
+// into v, e.g. by decoding into the former struct and converting it.
+type CodecUpgrade func(codec Codec, body []byte, v any) error
+
+// VersionedCodec wraps the payloads of a Codec in an envelope of a marker byte, a
+// version byte and the body, so a binary can tell which layout of the code types wrote
+// a payload when their fields change.
+//
+// Bodies of other versions without an upgrade, e.g. of a newer binary, and payloads
+// without envelope are decoded with the wrapped codec, which skips unknown fields and
+// leaves missing ones zero. Register an upgrade with WithUpgrade for a version that
+// doesn't decode that way, e.g. after a field was renamed. Payloads without envelope
+// are version 0.
+//
+// For a rolling deploy, first ship the decoding with version 0, which still writes
+// payloads without envelope, then raise the version once every binary decodes it.
+type VersionedCodec struct {
+	codec    Codec
+	version  byte
+	upgrades map[byte]CodecUpgrade
+}
+
+// Compile-time assertion: VersionedCodec implements Codec.
+var _ Codec = (*VersionedCodec)(nil)
+
+// NewVersionedCodec creates a VersionedCodec writing the payloads of codec with version,
+// without envelope when version is 0.
+func NewVersionedCodec(codec Codec, version byte) *VersionedCodec {
+	return &VersionedCodec{codec: codec, version: version, upgrades: map[byte]CodecUpgrade{}}
+}
+
+// WithUpgrade decodes the payloads of version with upgrade, it returns c for chaining.
+func (c *VersionedCodec) WithUpgrade(version byte, upgrade CodecUpgrade) *VersionedCodec {
+	c.upgrades[version] = upgrade
+	return c
+}
+
+// Marshal implements Codec.
+func (c *VersionedCodec) Marshal(v any) ([]byte, error) {
+	body, err := c.codec.Marshal(v)
+	if err != nil || c.version == 0 {
+		return body, err
+	}
+	return append([]byte{envelopeMarker, c.version}, body...), nil
+}
+
+// Unmarshal implements Codec.
+func (c *VersionedCodec) Unmarshal(data []byte, v any) error {
+	version, body := byte(0), data
+	if len(data) >= 2 && data[0] == envelopeMarker {
+		version, body = data[1], data[2:]
+	}
+	if upgrade, ok := c.upgrades[version]; ok && version != c.version {
+		return upgrade(c.codec, body, v)
+	}
+	return c.codec.Unmarshal(body, v)
+}
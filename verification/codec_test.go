@@ -0,0 +1,123 @@
+package verification
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_Service_Codecs(t *testing.T) {
+	ctx := context.Background()
+	for name, codec := range map[string]Codec{"json": JSONCodec, "gob": GobCodec, "msgpack": MsgpackCodec,
+		"versioned": NewVersionedCodec(GobCodec, 1)} {
+		t.Run(name, func(t *testing.T) {
+			client, cleanup, _ := getRedisClient(t)
+			defer cleanup()
+
+			cfg := mobileTestConfig(10, 1)
+			cfg.Codec = codec
+			gen := NewTestCodeGenerator("666666")
+			svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+			send := func() string {
+				mc, err := gen.NewMobileCode("login", 7, "13800138000", "86")
+				require.NoError(t, err)
+				seq, err := svc.Send(ctx, mc)
+				require.NoError(t, err)
+				return seq
+			}
+
+			// The stored code round-trips without its plaintext.
+			seq := send()
+			store := NewCodeStoreWithCodec[MobileCode](client, codec)
+			stored, err := store.Peek(ctx, NewCacheKeyBuilder("TEST").CodeKey("MOBILE", "LOGIN", seq, "13800138000", "86"))
+			require.NoError(t, err)
+			assert.Equal(t, int64(7), stored.UserID)
+			assert.Equal(t, "13800138000", stored.Mobile)
+			assert.Equal(t, hashCode("666666"), stored.Digest)
+			assert.Empty(t, stored.Value)
+
+			probe := mobileProbe(seq, "13800138000", "86")
+			require.NoError(t, svc.Verify(ctx, "666666", probe))
+			assert.ErrorIs(t, svc.Verify(ctx, "666666", probe), ErrCodeNotFound)
+
+			// Failures are counted and exhaust the code.
+			probe = mobileProbe(send(), "13800138000", "86")
+			assert.ErrorIs(t, svc.Verify(ctx, "000000", probe), ErrCodeIncorrect)
+			var rlErr *RateLimitError
+			require.ErrorAs(t, svc.Verify(ctx, "000000", probe), &rlErr)
+			assert.ErrorIs(t, svc.Verify(ctx, "666666", probe), ErrMobileVerifyLimitExceeded)
+		})
+	}
+}
+
+func TestVerification_CodecRoundTrip(t *testing.T) {
+	base := Code{UserID: 1, Type: "LOGIN", Sequence: "seq", CodeLength: 6, Digest: hashCode("123456")}
+	codes := []any{
+		&MobileCode{Code: base, Mobile: "13800138000", CountryCode: "86"},
+		&EmailCode{Code: base, Email: "a@b.c"},
+		&EcdsaCode{Code: base, Chain: "ETH", Address: "0xabc"},
+	}
+	for _, codec := range []Codec{JSONCodec, GobCodec, MsgpackCodec, NewVersionedCodec(GobCodec, 1)} {
+		for _, code := range codes {
+			data, err := codec.Marshal(code)
+			require.NoError(t, err)
+			// Decode into a fresh value of the same type, no field may be dropped.
+			out := reflect.New(reflect.TypeOf(code).Elem()).Interface()
+			require.NoError(t, codec.Unmarshal(data, out))
+			assert.Equal(t, code, out)
+		}
+	}
+}
+
+// mobileCodeV1 is a former layout of MobileCode, the number included the country code.
+type mobileCodeV1 struct {
+	Code
+	Phone string
+}
+
+func TestVerification_VersionedCodec(t *testing.T) {
+	base := Code{UserID: 1, Type: "LOGIN", Sequence: "seq", CodeLength: 6, Digest: hashCode("123456")}
+	code := &MobileCode{Code: base, Mobile: "13800138000", CountryCode: "86"}
+
+	// Version 0 decodes enveloped payloads and still writes plain ones.
+	v0 := NewVersionedCodec(GobCodec, 0)
+	v2 := NewVersionedCodec(GobCodec, 2)
+	data, err := v0.Marshal(code)
+	require.NoError(t, err)
+	plain, err := GobCodec.Marshal(code)
+	require.NoError(t, err)
+	assert.Equal(t, plain, data)
+	data, err = v2.Marshal(code)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 2}, data[:2])
+	var out MobileCode
+	require.NoError(t, v0.Unmarshal(data, &out))
+	assert.Equal(t, *code, out)
+
+	// Payloads of the former layout are upgraded.
+	v2.WithUpgrade(1, func(codec Codec, body []byte, v any) error {
+		var old mobileCodeV1
+		if err := codec.Unmarshal(body, &old); err != nil {
+			return err
+		}
+		cc, mobile, _ := strings.Cut(old.Phone, "-")
+		*v.(*MobileCode) = MobileCode{Code: old.Code, Mobile: mobile, CountryCode: cc}
+		return nil
+	})
+	old, err := NewVersionedCodec(GobCodec, 1).Marshal(&mobileCodeV1{Code: base, Phone: "86-13800138000"})
+	require.NoError(t, err)
+	out = MobileCode{}
+	require.NoError(t, v2.Unmarshal(old, &out))
+	assert.Equal(t, *code, out)
+
+	// JSON payloads without envelope stay readable.
+	data, err = JSONCodec.Marshal(code)
+	require.NoError(t, err)
+	out = MobileCode{}
+	require.NoError(t, NewVersionedCodec(JSONCodec, 1).Unmarshal(data, &out))
+	assert.Equal(t, *code, out)
+}
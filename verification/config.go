@@ -0,0 +1,490 @@
+package verification
+
+import (
+	"encoding"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidConfig is returned by the Validate methods of the config types.
+var ErrInvalidConfig = bizerrors.New(500, "VERIFICATION_INVALID_CONFIG", "invalid verification config")
+
+// Duration is a time.Duration decoded from strings like "5m" by YAML, JSON and env
+// config sources, which keeps the config types compatible with kratos config Scan.
+type Duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", text, err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// RateLimitConfig is the config of a RateLimiterConfig.
+type RateLimitConfig struct {
+	Limit     int64            `json:"limit" yaml:"limit"`
+	Window    Duration         `json:"window" yaml:"window"`
+	Algorithm LimiterAlgorithm `json:"algorithm" yaml:"algorithm"`
+	Burst     int64            `json:"burst" yaml:"burst"`
+	Tiers     []RateLimitTier  `json:"tiers" yaml:"tiers"`
+}
+
+// RateLimitTier is the config of an extra LimitTier.
+type RateLimitTier struct {
+	Limit  int64    `json:"limit" yaml:"limit"`
+	Window Duration `json:"window" yaml:"window"`
+}
+
+// Validate checks the limit and window are positive.
+func (c RateLimitConfig) Validate() error {
+	if c.Limit <= 0 {
+		return fmt.Errorf("%w: limit must be positive", ErrInvalidConfig)
+	}
+	if c.Window <= 0 {
+		return fmt.Errorf("%w: window must be positive", ErrInvalidConfig)
+	}
+	switch c.Algorithm {
+	case AlgorithmFixedWindow, AlgorithmSlidingWindow, AlgorithmTokenBucket:
+	default:
+		return fmt.Errorf("%w: unsupported limiter algorithm %s", ErrInvalidConfig, c.Algorithm)
+	}
+	if c.Burst < 0 {
+		return fmt.Errorf("%w: burst must not be negative", ErrInvalidConfig)
+	}
+	if len(c.Tiers) > 0 && c.Algorithm != AlgorithmFixedWindow {
+		return fmt.Errorf("%w: tiers require the fixed window algorithm", ErrInvalidConfig)
+	}
+	for i, tier := range c.Tiers {
+		if tier.Limit <= 0 || tier.Window <= 0 {
+			return fmt.Errorf("%w: tier %d limit and window must be positive", ErrInvalidConfig, i)
+		}
+	}
+	return nil
+}
+
+// RateLimiterConfig converts the config, limitErr is wrapped when the limit is exceeded.
+func (c RateLimitConfig) RateLimiterConfig(limitErr error) RateLimiterConfig {
+	cfg := RateLimiterConfig{Limit: c.Limit, Window: time.Duration(c.Window), LimitErr: limitErr,
+		Algorithm: c.Algorithm, Burst: c.Burst}
+	for _, tier := range c.Tiers {
+		cfg.Tiers = append(cfg.Tiers, LimitTier{Limit: tier.Limit, Window: time.Duration(tier.Window)})
+	}
+	return cfg
+}
+
+// ShapeConfig is the config of a LeakyBucketConfig, a zero rate disables shaping.
+type ShapeConfig struct {
+	Rate     int64    `json:"rate" yaml:"rate"`
+	Interval Duration `json:"interval" yaml:"interval"`
+	Capacity int64    `json:"capacity" yaml:"capacity"`
+}
+
+// Validate checks the interval of an enabled policy is positive and the values are
+// not negative.
+func (c ShapeConfig) Validate() error {
+	if c.Rate < 0 || c.Capacity < 0 {
+		return fmt.Errorf("%w: rate and capacity must not be negative", ErrInvalidConfig)
+	}
+	if c.Rate > 0 && c.Interval <= 0 {
+		return fmt.Errorf("%w: interval must be positive", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// LeakyBucketConfig converts the config to a LeakyBucketConfig.
+func (c ShapeConfig) LeakyBucketConfig() LeakyBucketConfig {
+	return LeakyBucketConfig{Rate: c.Rate, Interval: time.Duration(c.Interval), Capacity: c.Capacity}
+}
+
+// GeneratorConfig is the config of a CodeGenerator, loadable from YAML or env.
+type GeneratorConfig struct {
+	// Length is the digits of the codes of types without format, 6 when unset.
+	Length int `json:"length" yaml:"length"`
+	// Formats are the formats per CodeType, e.g. "PAYMENT".
+	Formats map[string]CodeFormatConfig `json:"formats" yaml:"formats"`
+}
+
+// CodeFormatConfig is the config of a CodeFormat.
+type CodeFormatConfig struct {
+	// Charset is digits (default) or alphanumeric.
+	Charset string `json:"charset" yaml:"charset"`
+	// Length defaults to the length of the generator when unset.
+	Length int `json:"length" yaml:"length"`
+}
+
+// charsets are the charsets selectable by name.
+var charsets = map[string]string{"": CharsetDigits, "digits": CharsetDigits, "alphanumeric": CharsetAlphanumeric}
+
+// Code lengths accepted by GeneratorConfig.Validate.
+const (
+	minCodeLength = 4
+	maxCodeLength = 12
+)
+
+// Validate checks the lengths are between 4 and 12 and the charsets are known.
+func (c GeneratorConfig) Validate() error {
+	if c.Length != 0 && (c.Length < minCodeLength || c.Length > maxCodeLength) {
+		return fmt.Errorf("%w: code length must be between %d and %d", ErrInvalidConfig, minCodeLength, maxCodeLength)
+	}
+	for typ, f := range c.Formats {
+		if typ == "" {
+			return fmt.Errorf("%w: format code type is empty", ErrInvalidConfig)
+		}
+		if _, ok := charsets[f.Charset]; !ok {
+			return fmt.Errorf("%w: unsupported charset %s of %s", ErrInvalidConfig, f.Charset, typ)
+		}
+		if f.Length != 0 && (f.Length < minCodeLength || f.Length > maxCodeLength) {
+			return fmt.Errorf("%w: code length of %s must be between %d and %d", ErrInvalidConfig, typ,
+				minCodeLength, maxCodeLength)
+		}
+	}
+	return nil
+}
+
+// Generator creates the CodeGenerator of the config, opts are applied after the formats.
+func (c GeneratorConfig) Generator(opts ...GeneratorOption) CodeGenerator {
+	formats := make([]GeneratorOption, 0, len(c.Formats)+len(opts))
+	for typ, f := range c.Formats {
+		formats = append(formats, WithCodeFormat(CodeType(typ), CodeFormat{Charset: charsets[f.Charset], Length: f.Length}))
+	}
+	return NewCodeGenerator(c.Length, append(formats, opts...)...)
+}
+
+// OTPServiceConfig is the config of an OTPService, loadable from YAML or env.
+type OTPServiceConfig struct {
+	Prefix string `json:"prefix" yaml:"prefix"`
+	// KeyVersion appends a version segment to the prefix when positive, see
+	// CodeCacheKeyPrefix.Versioned.
+	KeyVersion int `json:"key_version" yaml:"key_version"`
+	// PreviousPrefix is optional, the full prefix before a key schema change whose codes
+	// still verify, e.g. "APP" after key_version became 2.
+	PreviousPrefix string          `json:"previous_prefix" yaml:"previous_prefix"`
+	TTL            Duration        `json:"ttl" yaml:"ttl"`
+	Send           RateLimitConfig `json:"send" yaml:"send"`
+	Verify         RateLimitConfig `json:"verify" yaml:"verify"`
+	// SendByIP is optional, a zero limit disables it.
+	SendByIP RateLimitConfig `json:"send_by_ip" yaml:"send_by_ip"`
+	// SendByDevice is optional, a zero limit disables it.
+	SendByDevice RateLimitConfig `json:"send_by_device" yaml:"send_by_device"`
+	// SendByUser is optional, a zero limit disables it.
+	SendByUser RateLimitConfig `json:"send_by_user" yaml:"send_by_user"`
+	DailyQuota int64           `json:"daily_quota" yaml:"daily_quota"`
+	Shape      ShapeConfig     `json:"shape" yaml:"shape"`
+	// AllowedCountryCodes is optional, when set only these countries receive mobile codes.
+	AllowedCountryCodes []string `json:"allowed_country_codes" yaml:"allowed_country_codes"`
+	DeniedCountryCodes  []string `json:"denied_country_codes" yaml:"denied_country_codes"`
+	// HMACKey is optional, when set codes are stored as HMAC-SHA256 digests.
+	HMACKey string `json:"hmac_key" yaml:"hmac_key"`
+	// Codec is json (default), gob or msgpack.
+	Codec string `json:"codec" yaml:"codec"`
+	// ResendCooldown defaults to one minute when unset.
+	ResendCooldown     Duration `json:"resend_cooldown" yaml:"resend_cooldown"`
+	InvalidatePrevious bool     `json:"invalidate_previous" yaml:"invalidate_previous"`
+	MaxValidCodes      int      `json:"max_valid_codes" yaml:"max_valid_codes"`
+	// LockoutDuration defaults to the remaining verify window when unset.
+	LockoutDuration Duration `json:"lockout_duration" yaml:"lockout_duration"`
+	VerifyByTarget  bool     `json:"verify_by_target" yaml:"verify_by_target"`
+	// Normalize lists the code types whose codes are compared with NormalizeAlphanumeric,
+	// e.g. the types of alphanumeric formats.
+	Normalize []string `json:"normalize" yaml:"normalize"`
+	// Consume is verify (default) or read, see ConsumePolicy.
+	Consume string `json:"consume" yaml:"consume"`
+	// IdempotencyWindow defaults to the TTL when unset.
+	IdempotencyWindow Duration `json:"idempotency_window" yaml:"idempotency_window"`
+	// Provider names the sender of the channel in the Senders of NewOTPServiceFromConfig,
+	// e.g. "aliyun" or "smtp". Empty for channels without delivery, e.g. ecdsa.
+	Provider string `json:"provider" yaml:"provider"`
+}
+
+// codecs are the codecs selectable by name.
+var codecs = map[string]Codec{"": JSONCodec, "json": JSONCodec, "gob": GobCodec, "msgpack": MsgpackCodec}
+
+// consumePolicies are the consume policies selectable by name.
+var consumePolicies = map[string]ConsumePolicy{"": ConsumeOnVerify, "verify": ConsumeOnVerify, "read": ConsumeOnRead}
+
+// Validate checks the prefix is set and the TTL and limits are positive.
+func (c OTPServiceConfig) Validate() error {
+	if c.Prefix == "" {
+		return fmt.Errorf("%w: prefix is empty", ErrInvalidConfig)
+	}
+	if c.TTL <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", ErrInvalidConfig)
+	}
+	if c.KeyVersion < 0 {
+		return fmt.Errorf("%w: key version must not be negative", ErrInvalidConfig)
+	}
+	if err := c.Send.Validate(); err != nil {
+		return fmt.Errorf("send: %w", err)
+	}
+	if err := c.Verify.Validate(); err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	if c.SendByIP.Limit != 0 {
+		if err := c.SendByIP.Validate(); err != nil {
+			return fmt.Errorf("send_by_ip: %w", err)
+		}
+	}
+	if c.SendByDevice.Limit != 0 {
+		if err := c.SendByDevice.Validate(); err != nil {
+			return fmt.Errorf("send_by_device: %w", err)
+		}
+	}
+	if c.SendByUser.Limit != 0 {
+		if err := c.SendByUser.Validate(); err != nil {
+			return fmt.Errorf("send_by_user: %w", err)
+		}
+	}
+	if _, ok := codecs[c.Codec]; !ok {
+		return fmt.Errorf("%w: unsupported codec %s", ErrInvalidConfig, c.Codec)
+	}
+	if _, ok := consumePolicies[c.Consume]; !ok {
+		return fmt.Errorf("%w: unsupported consume policy %s", ErrInvalidConfig, c.Consume)
+	}
+	if c.ResendCooldown < 0 || c.IdempotencyWindow < 0 || c.LockoutDuration < 0 {
+		return fmt.Errorf("%w: resend cooldown, idempotency window and lockout duration must not be negative",
+			ErrInvalidConfig)
+	}
+	if c.DailyQuota < 0 {
+		return fmt.Errorf("%w: daily quota must not be negative", ErrInvalidConfig)
+	}
+	if c.MaxValidCodes < 0 {
+		return fmt.Errorf("%w: max valid codes must not be negative", ErrInvalidConfig)
+	}
+	if err := c.Shape.Validate(); err != nil {
+		return fmt.Errorf("shape: %w", err)
+	}
+	for _, cc := range append(append([]string{}, c.AllowedCountryCodes...), c.DeniedCountryCodes...) {
+		if n := normalizeCountryCode(cc); n == "" || strings.Trim(n, "0123456789") != "" {
+			return fmt.Errorf("%w: invalid country code %q", ErrInvalidConfig, cc)
+		}
+	}
+	return nil
+}
+
+// OTPConfig converts the config to the OTPConfig of NewOTPService, with the limit
+// errors of DefaultOTPConfig.
+func (c OTPServiceConfig) OTPConfig() OTPConfig {
+	cfg := DefaultOTPConfig(CodeCacheKeyPrefix(c.Prefix).Versioned(c.KeyVersion))
+	cfg.PreviousPrefix = CodeCacheKeyPrefix(c.PreviousPrefix)
+	cfg.TTL = time.Duration(c.TTL)
+	cfg.Send = c.Send.RateLimiterConfig(cfg.Send.LimitErr)
+	cfg.Verify = c.Verify.RateLimiterConfig(cfg.Verify.LimitErr)
+	if c.SendByIP.Limit != 0 {
+		cfg.SendByIP = c.SendByIP.RateLimiterConfig(ErrIPSendLimitExceeded)
+	}
+	if c.SendByDevice.Limit != 0 {
+		cfg.SendByDevice = c.SendByDevice.RateLimiterConfig(ErrDeviceSendLimitExceeded)
+	}
+	if c.SendByUser.Limit != 0 {
+		cfg.SendByUser = c.SendByUser.RateLimiterConfig(ErrUserSendLimitExceeded)
+	}
+	cfg.DailyQuota = c.DailyQuota
+	cfg.Shape = c.Shape.LeakyBucketConfig()
+	cfg.AllowedCountryCodes, cfg.DeniedCountryCodes = c.AllowedCountryCodes, c.DeniedCountryCodes
+	if c.HMACKey != "" {
+		cfg.HMACKey = []byte(c.HMACKey)
+	}
+	cfg.Codec = codecs[c.Codec]
+	if c.ResendCooldown > 0 {
+		cfg.ResendCooldown = time.Duration(c.ResendCooldown)
+	}
+	cfg.InvalidatePrevious = c.InvalidatePrevious
+	cfg.MaxValidCodes = c.MaxValidCodes
+	cfg.IdempotencyWindow = time.Duration(c.IdempotencyWindow)
+	cfg.LockoutDuration = time.Duration(c.LockoutDuration)
+	cfg.VerifyByTarget = c.VerifyByTarget
+	cfg.Consume = consumePolicies[c.Consume]
+	for _, typ := range c.Normalize {
+		if cfg.Normalize == nil {
+			cfg.Normalize = map[CodeType]CodeNormalizer{}
+		}
+		cfg.Normalize[CodeType(typ)] = NormalizeAlphanumeric
+	}
+	return cfg
+}
+
+// Config is the config of the verification services of an application, loadable from
+// YAML or env. Channels left nil are not configured.
+type Config struct {
+	Generator GeneratorConfig   `json:"generator" yaml:"generator"`
+	Mobile    *OTPServiceConfig `json:"mobile" yaml:"mobile"`
+	Email     *OTPServiceConfig `json:"email" yaml:"email"`
+	Ecdsa     *OTPServiceConfig `json:"ecdsa" yaml:"ecdsa"`
+	Ed25519   *OTPServiceConfig `json:"ed25519" yaml:"ed25519"`
+}
+
+// Validate checks the generator and the configured channels.
+func (c *Config) Validate() error {
+	if err := c.Generator.Validate(); err != nil {
+		return fmt.Errorf("generator: %w", err)
+	}
+	for _, ch := range []struct {
+		name string
+		cfg  *OTPServiceConfig
+	}{{"mobile", c.Mobile}, {"email", c.Email}, {"ecdsa", c.Ecdsa}, {"ed25519", c.Ed25519}} {
+		if ch.cfg == nil {
+			continue
+		}
+		if err := ch.cfg.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", ch.name, err)
+		}
+	}
+	return nil
+}
+
+// channel returns the OTPConfig of a configured channel, ErrInvalidConfig when it is nil.
+func (c *Config) channel(name string, cfg *OTPServiceConfig) (OTPConfig, error) {
+	if cfg == nil {
+		return OTPConfig{}, fmt.Errorf("%w: %s channel is not configured", ErrInvalidConfig, name)
+	}
+	return cfg.OTPConfig(), nil
+}
+
+// Senders are the senders of a channel by provider name, see OTPServiceConfig.Provider.
+type Senders[T VerificationCode] map[string]CodeSender[T]
+
+// NewOTPServiceFromConfig validates cfg and creates an OTPService sending with the
+// sender of cfg.Provider in senders, or without sender when the provider is empty.
+// An unknown provider returns ErrInvalidConfig.
+func NewOTPServiceFromConfig[T CodeConstraint](cfg OTPServiceConfig, client redis.UniversalClient,
+	senders Senders[T], opts ...OTPServiceOption[T],
+) (*OTPService[T], error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	var sender CodeSender[T]
+	if cfg.Provider != "" {
+		var ok bool
+		if sender, ok = senders[cfg.Provider]; !ok || sender == nil {
+			return nil, fmt.Errorf("%w: unknown provider %s", ErrInvalidConfig, cfg.Provider)
+		}
+	}
+	return NewOTPService(cfg.OTPConfig(), client, sender, opts...), nil
+}
+
+// LoadConfig loads the Config from the YAML file at path, when not empty, overrides it
+// with the env vars named envPrefix and the upper case json names of the fields joined
+// by "_", and validates it. E.g. with "VERIFICATION", VERIFICATION_MOBILE_TTL=5m and
+// VERIFICATION_MOBILE_SEND_LIMIT=1 set the mobile channel, comma separated values set
+// lists like VERIFICATION_MOBILE_ALLOWED_COUNTRY_CODES=86,852. Limit tiers and code
+// formats are only loaded from YAML.
+func LoadConfig(path, envPrefix string) (*Config, error) {
+	cfg := &Config{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("verification: read config failed: %w", err)
+		}
+		if err = yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+	}
+	if _, err := bindEnv(reflect.ValueOf(cfg).Elem(), envPrefix, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// bindEnv sets the fields of the struct v from the env vars named after them under
+// prefix, it reports whether any was set.
+func bindEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) (bool, error) {
+	set := false
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		ok, err := bindEnvValue(v.Field(i), prefix+"_"+strings.ToUpper(name), lookup)
+		if err != nil {
+			return false, err
+		}
+		set = set || ok
+	}
+	return set, nil
+}
+
+// bindEnvValue sets v from the env var key, or its fields from the env vars under key.
+// A nil struct pointer is allocated when one of its fields is set.
+func bindEnvValue(v reflect.Value, key string, lookup func(string) (string, bool)) (bool, error) {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		s, found := lookup(key)
+		if !found {
+			return false, nil
+		}
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			return false, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, key, err)
+		}
+		return true, nil
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		return bindEnv(v, key, lookup)
+	case reflect.Pointer:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return false, nil
+		}
+		p := v
+		if v.IsNil() {
+			p = reflect.New(v.Type().Elem())
+		}
+		ok, err := bindEnv(p.Elem(), key, lookup)
+		if ok && v.IsNil() {
+			v.Set(p)
+		}
+		return ok, err
+	}
+	s, found := lookup(key)
+	if !found {
+		return false, nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, key, err)
+		}
+		v.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return false, fmt.Errorf("%w: %s: %w", ErrInvalidConfig, key, err)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return false, nil
+		}
+		items := strings.Split(s, ",")
+		list := reflect.MakeSlice(v.Type(), 0, len(items))
+		for _, item := range items {
+			if item = strings.TrimSpace(item); item != "" {
+				list = reflect.Append(list, reflect.ValueOf(item).Convert(v.Type().Elem()))
+			}
+		}
+		v.Set(list)
+	default:
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,158 @@
+package verification
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/fx"
+)
+
+func TestVerification_OTPServiceConfig(t *testing.T) {
+	var cfg OTPServiceConfig
+	err := json.Unmarshal([]byte(`{"prefix":"APP","ttl":"5m",
+		"send":{"limit":1,"window":"1m","tiers":[{"limit":5,"window":"1h"}]},
+		"verify":{"limit":5,"window":"5m"},"codec":"msgpack"}`), &cfg)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+
+	otp := cfg.OTPConfig()
+	assert.Equal(t, CodeCacheKeyPrefix("APP"), otp.Prefix)
+	assert.Equal(t, 5*time.Minute, otp.TTL)
+	assert.Equal(t, MsgpackCodec, otp.Codec)
+	assert.Equal(t, RateLimiterConfig{Limit: 1, Window: time.Minute, LimitErr: ErrSendFailed,
+		Tiers: []LimitTier{{Limit: 5, Window: time.Hour}}}, otp.Send)
+	assert.Equal(t, RateLimiterConfig{Limit: 5, Window: 5 * time.Minute, LimitErr: ErrCodeIncorrect}, otp.Verify)
+
+	cfg.Codec = "xml"
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+	cfg.Codec = ""
+	cfg.Consume = "peek"
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+	cfg.Consume = "read"
+	assert.Equal(t, ConsumeOnRead, cfg.OTPConfig().Consume)
+	cfg.MaxValidCodes = -1
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+	cfg.MaxValidCodes = 2
+	assert.Equal(t, 2, cfg.OTPConfig().MaxValidCodes)
+	cfg.Normalize = []string{"PAYMENT"}
+	assert.Contains(t, cfg.OTPConfig().Normalize, CodeType("PAYMENT"))
+	cfg.AllowedCountryCodes = []string{"+86", "CN"}
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+	cfg.AllowedCountryCodes = nil
+	cfg.KeyVersion, cfg.PreviousPrefix = 2, "APP"
+	require.NoError(t, cfg.Validate())
+	otp = cfg.OTPConfig()
+	assert.Equal(t, CodeCacheKeyPrefix("APP:v2"), otp.Prefix)
+	assert.Equal(t, CodeCacheKeyPrefix("APP"), otp.PreviousPrefix)
+	cfg.KeyVersion = -1
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+	cfg.KeyVersion = 0
+	cfg.LockoutDuration = Duration(-time.Minute)
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+	cfg.LockoutDuration = 0
+	cfg.Send.Algorithm = AlgorithmSlidingWindow
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+	cfg.Send.Algorithm = AlgorithmFixedWindow
+	cfg.Verify.Limit = 0
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+	cfg.TTL = 0
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+}
+
+func TestVerification_ConfigModule(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	var cfg Config
+	err := json.Unmarshal([]byte(`{"generator":{"length":8},
+		"mobile":{"prefix":"TEST","ttl":"5m","send":{"limit":1,"window":"1m"},"verify":{"limit":5,"window":"5m"}}}`), &cfg)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+
+	sms := &fakeSMSSender{}
+	var (
+		svc *OTPService[MobileCode]
+		gen CodeGenerator
+	)
+	app := fx.New(fx.NopLogger, ConfigModule,
+		fx.Supply(&cfg, fx.Annotate(client, fx.As(new(redis.UniversalClient))),
+			fx.Annotate(sms, fx.As(new(CodeSender[MobileCode])))),
+		fx.Populate(&svc, &gen))
+	require.NoError(t, app.Err())
+
+	code, err := gen.NewMobileCode("LOGIN", 1, "13800000000", "86")
+	require.NoError(t, err)
+	assert.True(t, isNDigits(code.GetValue(), 8))
+	seq, err := svc.Send(ctx, code)
+	require.NoError(t, err)
+	assert.NoError(t, svc.Verify(ctx, sms.last.GetValue(), mobileProbe(seq, "13800000000", "86")))
+
+	// The email channel is not configured.
+	app = fx.New(fx.NopLogger, ConfigModule, fx.Supply(&cfg), fx.Populate(new(EmailOTPConfig)))
+	assert.ErrorIs(t, app.Err(), ErrInvalidConfig)
+
+	cfg.Mobile.TTL = 0
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+}
+
+func TestVerification_LoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "verification.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+generator:
+  length: 8
+mobile:
+  prefix: APP
+  ttl: 5m
+  provider: aliyun
+  send: {limit: 1, window: 1m, tiers: [{limit: 5, window: 1h}]}
+  verify: {limit: 5, window: 5m}
+`), 0o600))
+	t.Setenv("TESTCFG_MOBILE_TTL", "10m")
+	t.Setenv("TESTCFG_MOBILE_ALLOWED_COUNTRY_CODES", "86, 852")
+	t.Setenv("TESTCFG_EMAIL_PREFIX", "APP")
+	t.Setenv("TESTCFG_EMAIL_TTL", "15m")
+	t.Setenv("TESTCFG_EMAIL_SEND_LIMIT", "2")
+	t.Setenv("TESTCFG_EMAIL_SEND_WINDOW", "1m")
+	t.Setenv("TESTCFG_EMAIL_VERIFY_LIMIT", "3")
+	t.Setenv("TESTCFG_EMAIL_VERIFY_WINDOW", "10m")
+	t.Setenv("TESTCFG_EMAIL_VERIFY_BY_TARGET", "true")
+
+	cfg, err := LoadConfig(path, "TESTCFG")
+	require.NoError(t, err)
+	assert.Equal(t, 8, cfg.Generator.Length)
+	assert.Equal(t, Duration(10*time.Minute), cfg.Mobile.TTL)
+	assert.Equal(t, []string{"86", "852"}, cfg.Mobile.AllowedCountryCodes)
+	assert.Equal(t, []RateLimitTier{{Limit: 5, Window: Duration(time.Hour)}}, cfg.Mobile.Send.Tiers)
+	require.NotNil(t, cfg.Email)
+	assert.Equal(t, int64(2), cfg.Email.Send.Limit)
+	assert.True(t, cfg.Email.VerifyByTarget)
+	assert.Nil(t, cfg.Ecdsa)
+
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+	sms := &fakeSMSSender{}
+	svc, err := NewOTPServiceFromConfig(*cfg.Mobile, client, Senders[MobileCode]{"aliyun": sms})
+	require.NoError(t, err)
+	code, err := NewTestCodeGenerator("123456").NewMobileCode("LOGIN", 1, "13800000000", "86")
+	require.NoError(t, err)
+	_, err = svc.Send(context.Background(), code)
+	require.NoError(t, err)
+	assert.Equal(t, "123456", sms.last.GetValue())
+	_, err = NewOTPServiceFromConfig(*cfg.Mobile, client, Senders[MobileCode]{"wechat": sms})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+
+	t.Setenv("TESTCFG_MOBILE_TTL", "soon")
+	_, err = LoadConfig(path, "TESTCFG")
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	t.Setenv("TESTCFG_MOBILE_TTL", "0s")
+	_, err = LoadConfig(path, "TESTCFG")
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
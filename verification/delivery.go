@@ -0,0 +1,176 @@
+package verification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrDeliveryNotFound indicates that no delivery is recorded for a sequence.
+var ErrDeliveryNotFound = bizerrors.New(404, "VERIFICATION_DELIVERY_NOT_FOUND", "delivery not found")
+
+// DeliveryState is the state of a code delivery as reported by the provider.
+type DeliveryState string
+
+const (
+	// DeliveryPending is a delivery accepted by the provider without carrier receipt yet.
+	DeliveryPending DeliveryState = "PENDING"
+	// DeliveryDelivered is a delivery the carrier confirmed.
+	DeliveryDelivered DeliveryState = "DELIVERED"
+	// DeliveryFailed is a delivery the provider or the carrier rejected.
+	DeliveryFailed DeliveryState = "FAILED"
+)
+
+// DeliveryStatus is the delivery record of a sent code.
+type DeliveryStatus struct {
+	Sequence  string        `json:"sequence"`
+	Provider  string        `json:"provider"` // e.g. "aliyun", selects the DeliveryStatusQuerier
+	Target    string        `json:"target"`   // Recipient as known to the provider, e.g. the mobile number
+	BizID     string        `json:"biz_id"`   // Message ID assigned by the provider
+	OutID     string        `json:"out_id"`   // ID passed to the provider, usually the sequence
+	State     DeliveryState `json:"state"`
+	ErrCode   string        `json:"err_code,omitempty"` // Provider error code of a failed delivery
+	SentAt    time.Time     `json:"sent_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// DeliveryRecorder records deliveries, senders of providers returning a message ID
+// report to it, e.g. aliyun.WithDeliveryRecorder.
+type DeliveryRecorder interface {
+	Record(ctx context.Context, status *DeliveryStatus) error
+}
+
+// DeliveryStatusQuerier polls a provider for the state of a pending delivery and
+// updates State and ErrCode of status.
+type DeliveryStatusQuerier interface {
+	QueryStatus(ctx context.Context, status *DeliveryStatus) error
+}
+
+// DeliveryOption configures a DeliveryStatusService.
+type DeliveryOption func(*DeliveryStatusService)
+
+// WithStatusQuerier polls pending deliveries of provider with querier.
+func WithStatusQuerier(provider string, querier DeliveryStatusQuerier) DeliveryOption {
+	return func(s *DeliveryStatusService) { s.queriers[provider] = querier }
+}
+
+// DeliveryStatusService keeps the delivery records of sent codes in Redis, so support
+// can see whether a code reached the carrier. Records are updated by polling the
+// provider in QuerySendStatus or by provider callbacks through Report.
+type DeliveryStatusService struct {
+	client   redis.UniversalClient
+	keys     *CacheKeyBuilder
+	ttl      time.Duration
+	queriers map[string]DeliveryStatusQuerier
+}
+
+// Compile-time assertion: DeliveryStatusService implements DeliveryRecorder.
+var _ DeliveryRecorder = (*DeliveryStatusService)(nil)
+
+// NewDeliveryStatusService creates a DeliveryStatusService keeping records for ttl,
+// 24 hours when zero.
+func NewDeliveryStatusService(client redis.UniversalClient, prefix CodeCacheKeyPrefix, ttl time.Duration,
+	opts ...DeliveryOption,
+) *DeliveryStatusService {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	s := &DeliveryStatusService{
+		client:   client,
+		keys:     NewCacheKeyBuilder(prefix),
+		ttl:      ttl,
+		queriers: map[string]DeliveryStatusQuerier{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Record implements DeliveryRecorder.
+func (s *DeliveryStatusService) Record(ctx context.Context, status *DeliveryStatus) error {
+	if status.State == "" {
+		status.State = DeliveryPending
+	}
+	if status.SentAt.IsZero() {
+		status.SentAt = timeNow()
+	}
+	status.UpdatedAt = status.SentAt
+	return s.save(ctx, status, false)
+}
+
+// QuerySendStatus returns the delivery record of sequence. A pending delivery is
+// polled from its provider first when a DeliveryStatusQuerier is registered for it.
+func (s *DeliveryStatusService) QuerySendStatus(ctx context.Context, sequence string) (*DeliveryStatus, error) {
+	status, err := s.load(ctx, sequence)
+	if err != nil {
+		return nil, err
+	}
+	q, ok := s.queriers[status.Provider]
+	if !ok || status.State != DeliveryPending {
+		return status, nil
+	}
+	if err = q.QueryStatus(ctx, status); err != nil {
+		return nil, fmt.Errorf("verification: query delivery status failed: %w", err)
+	}
+	if status.State != DeliveryPending {
+		status.UpdatedAt = timeNow()
+		if err = s.save(ctx, status, true); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// Report updates the delivery of sequence from a provider callback.
+func (s *DeliveryStatusService) Report(ctx context.Context, sequence string, state DeliveryState,
+	errCode string,
+) error {
+	status, err := s.load(ctx, sequence)
+	if err != nil {
+		return err
+	}
+	status.State, status.ErrCode, status.UpdatedAt = state, errCode, timeNow()
+	return s.save(ctx, status, true)
+}
+
+// load returns the record of sequence.
+func (s *DeliveryStatusService) load(ctx context.Context, sequence string) (*DeliveryStatus, error) {
+	data, err := s.client.Get(ctx, s.keys.DeliveryKey(sequence)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("verification: get delivery failed: %w", err)
+	}
+	var status DeliveryStatus
+	if err = json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("verification: decode delivery failed: %w", err)
+	}
+	return &status, nil
+}
+
+// save stores status, an update keeps the TTL of the record.
+func (s *DeliveryStatusService) save(ctx context.Context, status *DeliveryStatus, update bool) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("verification: encode delivery failed: %w", err)
+	}
+	args := redis.SetArgs{TTL: s.ttl}
+	if update {
+		args = redis.SetArgs{KeepTTL: true, Mode: "XX"}
+	}
+	err = s.client.SetArgs(ctx, s.keys.DeliveryKey(status.Sequence), data, args).Err()
+	if errors.Is(err, redis.Nil) {
+		return ErrDeliveryNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("verification: set delivery failed: %w", err)
+	}
+	return nil
+}
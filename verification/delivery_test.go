@@ -0,0 +1,61 @@
+package verification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStatusQuerier reports the scripted state.
+type fakeStatusQuerier struct {
+	state DeliveryState
+	calls int
+}
+
+func (q *fakeStatusQuerier) QueryStatus(_ context.Context, status *DeliveryStatus) error {
+	q.calls++
+	status.State = q.state
+	return nil
+}
+
+func TestVerification_DeliveryStatus(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, fastForward := getRedisClient(t)
+	defer cleanup()
+
+	querier := &fakeStatusQuerier{state: DeliveryPending}
+	svc := NewDeliveryStatusService(client, "TEST", time.Hour, WithStatusQuerier("aliyun", querier))
+	_, err := svc.QuerySendStatus(ctx, "missing")
+	assert.ErrorIs(t, err, ErrDeliveryNotFound)
+	assert.ErrorIs(t, svc.Report(ctx, "missing", DeliveryDelivered, ""), ErrDeliveryNotFound)
+
+	require.NoError(t, svc.Record(ctx, &DeliveryStatus{Sequence: "s1", Provider: "aliyun", BizID: "biz", Target: "138"}))
+	status, err := svc.QuerySendStatus(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, DeliveryPending, status.State)
+	assert.Equal(t, "biz", status.BizID)
+
+	// A polled final state is stored and not polled again.
+	querier.state = DeliveryDelivered
+	status, err = svc.QuerySendStatus(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, DeliveryDelivered, status.State)
+	_, err = svc.QuerySendStatus(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, querier.calls)
+
+	// Callbacks update records of providers without querier, the TTL is kept.
+	require.NoError(t, svc.Record(ctx, &DeliveryStatus{Sequence: "s2", Provider: "other"}))
+	fastForward(30 * time.Minute)
+	require.NoError(t, svc.Report(ctx, "s2", DeliveryFailed, "MOBILE_NOT_ON_SERVICE"))
+	status, err = svc.QuerySendStatus(ctx, "s2")
+	require.NoError(t, err)
+	assert.Equal(t, DeliveryFailed, status.State)
+	assert.Equal(t, "MOBILE_NOT_ON_SERVICE", status.ErrCode)
+	fastForward(31 * time.Minute)
+	_, err = svc.QuerySendStatus(ctx, "s2")
+	assert.ErrorIs(t, err, ErrDeliveryNotFound)
+}
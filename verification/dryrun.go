@@ -0,0 +1,226 @@
+package verification
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CapturedCode is a code captured by a DryRunSender instead of being delivered.
+type CapturedCode struct {
+	Sequence string    `json:"sequence"`
+	Type     CodeType  `json:"type"`
+	Target   string    `json:"target"`
+	Value    string    `json:"value"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+// CodeCapture stores the codes captured by a DryRunSender per medium and target.
+type CodeCapture interface {
+	// Capture stores code.
+	Capture(ctx context.Context, medium string, code *CapturedCode) error
+	// Captured returns the codes captured for target, the most recent first.
+	Captured(ctx context.Context, medium, target string) ([]CapturedCode, error)
+}
+
+// defaultCaptureLimit is the number of codes kept per target when the limit is zero.
+const defaultCaptureLimit = 10
+
+// MemoryCapture is a CodeCapture keeping the codes in memory, for tests and single
+// instance staging environments.
+type MemoryCapture struct {
+	mu    sync.Mutex
+	limit int
+	codes map[string][]CapturedCode
+}
+
+// Compile-time assertion: MemoryCapture implements CodeCapture.
+var _ CodeCapture = (*MemoryCapture)(nil)
+
+// NewMemoryCapture creates a MemoryCapture keeping the last limit codes of each target,
+// 10 when zero.
+func NewMemoryCapture(limit int) *MemoryCapture {
+	if limit <= 0 {
+		limit = defaultCaptureLimit
+	}
+	return &MemoryCapture{limit: limit, codes: map[string][]CapturedCode{}}
+}
+
+// Capture implements CodeCapture.
+func (m *MemoryCapture) Capture(_ context.Context, medium string, code *CapturedCode) error {
+	key := medium + ":" + code.Target
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	codes := append([]CapturedCode{*code}, m.codes[key]...)
+	if len(codes) > m.limit {
+		codes = codes[:m.limit]
+	}
+	m.codes[key] = codes
+	return nil
+}
+
+// Captured implements CodeCapture.
+func (m *MemoryCapture) Captured(_ context.Context, medium, target string) ([]CapturedCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]CapturedCode(nil), m.codes[medium+":"+target]...), nil
+}
+
+// RedisCapture is a CodeCapture keeping the codes in Redis lists, so E2E tests can read
+// the codes sent by any instance.
+type RedisCapture struct {
+	client redis.UniversalClient
+	keys   *CacheKeyBuilder
+	limit  int64
+	ttl    time.Duration
+}
+
+// Compile-time assertion: RedisCapture implements CodeCapture.
+var _ CodeCapture = (*RedisCapture)(nil)
+
+// NewRedisCapture creates a RedisCapture keeping the last limit codes of each target,
+// 10 when zero, for ttl after the last capture, 24 hours when zero.
+func NewRedisCapture(client redis.UniversalClient, prefix CodeCacheKeyPrefix, limit int,
+	ttl time.Duration,
+) *RedisCapture {
+	if limit <= 0 {
+		limit = defaultCaptureLimit
+	}
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &RedisCapture{client: client, keys: NewCacheKeyBuilder(prefix), limit: int64(limit), ttl: ttl}
+}
+
+// Capture implements CodeCapture.
+func (r *RedisCapture) Capture(ctx context.Context, medium string, code *CapturedCode) error {
+	data, err := json.Marshal(code)
+	if err != nil {
+		return fmt.Errorf("verification: encode captured code failed: %w", err)
+	}
+	key := r.keys.CaptureKey(medium, code.Target)
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, data)
+		pipe.LTrim(ctx, key, 0, r.limit-1)
+		pipe.PExpire(ctx, key, r.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("verification: capture code failed: %w", err)
+	}
+	return nil
+}
+
+// Captured implements CodeCapture.
+func (r *RedisCapture) Captured(ctx context.Context, medium, target string) ([]CapturedCode, error) {
+	items, err := r.client.LRange(ctx, r.keys.CaptureKey(medium, target), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("verification: get captured codes failed: %w", err)
+	}
+	codes := make([]CapturedCode, len(items))
+	for i, item := range items {
+		if err = json.Unmarshal([]byte(item), &codes[i]); err != nil {
+			return nil, fmt.Errorf("verification: decode captured code failed: %w", err)
+		}
+	}
+	return codes, nil
+}
+
+// codeTarget returns the medium and the target of code. The target is the
+// LimitKeyParts joined with ":", e.g. "13800138000:86" or "ETHEREUM:0xabc...".
+func codeTarget(code any) (string, string) {
+	c := code.(interface {
+		Medium() string
+		LimitKeyParts() []string
+	})
+	return c.Medium(), strings.Join(c.LimitKeyParts(), ":")
+}
+
+// DryRunSender is a CodeSender capturing the codes instead of calling a provider, for
+// staging environments and E2E tests reading the sent codes back. The plaintext codes
+// are captured, never use it for real users.
+type DryRunSender[T VerificationCode] struct {
+	capture CodeCapture
+}
+
+// Compile-time assertion: DryRunSender implements CodeSender[MobileCode].
+var _ CodeSender[MobileCode] = (*DryRunSender[MobileCode])(nil)
+
+// NewDryRunSender creates a DryRunSender storing the codes in capture.
+func NewDryRunSender[T VerificationCode](capture CodeCapture) *DryRunSender[T] {
+	return &DryRunSender[T]{capture: capture}
+}
+
+// Send captures the code.
+func (s *DryRunSender[T]) Send(ctx context.Context, code *T) error {
+	c := any(code).(interface {
+		GetValue() string
+		GetSequence() string
+		GetType() CodeType
+	})
+	medium, target := codeTarget(code)
+	return s.capture.Capture(ctx, medium, &CapturedCode{
+		Sequence: c.GetSequence(),
+		Type:     c.GetType(),
+		Target:   target,
+		Value:    c.GetValue(),
+		SentAt:   timeNow(),
+	})
+}
+
+// Captured returns the codes captured for target, the most recent first. The target
+// is the LimitKeyParts of the code joined with ":", e.g. "13800138000:86".
+func (s *DryRunSender[T]) Captured(ctx context.Context, target string) ([]CapturedCode, error) {
+	var zero T
+	medium, _ := codeTarget(&zero)
+	return s.capture.Captured(ctx, medium, target)
+}
+
+// Last returns the most recent code captured for target, ErrCodeNotFound without one.
+func (s *DryRunSender[T]) Last(ctx context.Context, target string) (*CapturedCode, error) {
+	codes, err := s.Captured(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if len(codes) == 0 {
+		return nil, ErrCodeNotFound
+	}
+	return &codes[0], nil
+}
+
+// DryRunRouter is a CodeSender routing allow listed test targets, e.g. the phone
+// numbers of app store reviewers and E2E tests, to a DryRunSender and all others to
+// the provider.
+type DryRunRouter[T VerificationCode] struct {
+	next    CodeSender[T]
+	dryRun  CodeSender[T]
+	targets map[string]struct{}
+}
+
+// Compile-time assertion: DryRunRouter implements CodeSender[MobileCode].
+var _ CodeSender[MobileCode] = (*DryRunRouter[MobileCode])(nil)
+
+// NewDryRunRouter creates a DryRunRouter sending the codes of targets to dryRun and
+// the others to next. Targets use the format of DryRunSender.Captured.
+func NewDryRunRouter[T VerificationCode](next, dryRun CodeSender[T], targets ...string) *DryRunRouter[T] {
+	r := &DryRunRouter[T]{next: next, dryRun: dryRun, targets: make(map[string]struct{}, len(targets))}
+	for _, target := range targets {
+		r.targets[target] = struct{}{}
+	}
+	return r
+}
+
+// Send sends the code with the dry-run sender when its target is allow listed.
+func (r *DryRunRouter[T]) Send(ctx context.Context, code *T) error {
+	if _, target := codeTarget(code); target != "" {
+		if _, ok := r.targets[target]; ok {
+			return r.dryRun.Send(ctx, code)
+		}
+	}
+	return r.next.Send(ctx, code)
+}
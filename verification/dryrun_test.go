@@ -0,0 +1,58 @@
+package verification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_DryRunSender(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	gen := NewCodeGenerator(6)
+	for name, capture := range map[string]CodeCapture{
+		"memory": NewMemoryCapture(2),
+		"redis":  NewRedisCapture(client, "TEST", 2, time.Hour),
+	} {
+		t.Run(name, func(t *testing.T) {
+			provider := &scriptedSMSSender{}
+			dryRun := NewDryRunSender[MobileCode](capture)
+			sender := NewDryRunRouter[MobileCode](provider, dryRun, "13800000000:86")
+
+			_, err := dryRun.Last(ctx, "13800000000:86")
+			assert.ErrorIs(t, err, ErrCodeNotFound)
+
+			var sent []*MobileCode
+			for range 3 {
+				mc, err := gen.NewMobileCode("LOGIN", 1, "13800000000", "86")
+				require.NoError(t, err)
+				require.NoError(t, sender.Send(ctx, mc))
+				sent = append(sent, mc)
+			}
+			other, err := gen.NewMobileCode("LOGIN", 1, "13900000000", "86")
+			require.NoError(t, err)
+			require.NoError(t, sender.Send(ctx, other))
+			assert.Equal(t, 1, provider.calls)
+
+			// The most recent codes come first, older ones are trimmed.
+			codes, err := dryRun.Captured(ctx, "13800000000:86")
+			require.NoError(t, err)
+			require.Len(t, codes, 2)
+			assert.Equal(t, sent[2].Sequence, codes[0].Sequence)
+			assert.Equal(t, sent[2].Value, codes[0].Value)
+			assert.Equal(t, sent[1].Sequence, codes[1].Sequence)
+			last, err := dryRun.Last(ctx, "13800000000:86")
+			require.NoError(t, err)
+			assert.Equal(t, CodeType("LOGIN"), last.Type)
+
+			codes, err = dryRun.Captured(ctx, "13900000000:86")
+			require.NoError(t, err)
+			assert.Empty(t, codes)
+		})
+	}
+}
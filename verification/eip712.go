@@ -0,0 +1,258 @@
+package verification
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TypedDataField is a member of an EIP-712 struct type.
+type TypedDataField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// TypedData is EIP-712 typed data in the JSON layout of eth_signTypedData_v4, the
+// types include EIP712Domain.
+type TypedData struct {
+	Types       map[string][]TypedDataField `json:"types"`
+	PrimaryType string                      `json:"primaryType"`
+	Domain      map[string]any              `json:"domain"`
+	Message     map[string]any              `json:"message"`
+}
+
+// Hash returns the EIP-712 signing hash keccak256("\x19\x01" ‖ domainSeparator ‖ hashStruct(message)).
+func (td *TypedData) Hash() ([]byte, error) {
+	domain, err := td.HashStruct("EIP712Domain", td.Domain)
+	if err != nil {
+		return nil, err
+	}
+	message, err := td.HashStruct(td.PrimaryType, td.Message)
+	if err != nil {
+		return nil, err
+	}
+	return keccak256([]byte{0x19, 0x01}, domain, message), nil
+}
+
+// HashStruct returns hashStruct of data of the struct type typ.
+func (td *TypedData) HashStruct(typ string, data map[string]any) ([]byte, error) {
+	fields, ok := td.Types[typ]
+	if !ok {
+		return nil, fmt.Errorf("verification: eip712 type %q is not defined", typ)
+	}
+	enc := keccak256([]byte(td.encodeType(typ)))
+	for _, f := range fields {
+		v, err := td.encodeValue(f.Type, data[f.Name])
+		if err != nil {
+			return nil, fmt.Errorf("verification: eip712 field %s.%s: %w", typ, f.Name, err)
+		}
+		enc = append(enc, v...)
+	}
+	return keccak256(enc), nil
+}
+
+// encodeType returns encodeType of typ: its signature followed by the signatures of the
+// struct types it references, sorted by name.
+func (td *TypedData) encodeType(typ string) string {
+	deps := map[string]bool{}
+	td.dependencies(typ, deps)
+	delete(deps, typ)
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range append([]string{typ}, names...) {
+		b.WriteString(name + "(")
+		for i, f := range td.Types[name] {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(f.Type + " " + f.Name)
+		}
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+// dependencies adds typ and the struct types it references to deps.
+func (td *TypedData) dependencies(typ string, deps map[string]bool) {
+	typ = baseType(typ)
+	if _, ok := td.Types[typ]; !ok || deps[typ] {
+		return
+	}
+	deps[typ] = true
+	for _, f := range td.Types[typ] {
+		td.dependencies(f.Type, deps)
+	}
+}
+
+// arrayType matches array types such as "uint256[]" or "Person[2]".
+var arrayType = regexp.MustCompile(`^(.+)\[(\d*)\]$`)
+
+// baseType strips the array suffixes of typ.
+func baseType(typ string) string {
+	for {
+		m := arrayType.FindStringSubmatch(typ)
+		if m == nil {
+			return typ
+		}
+		typ = m[1]
+	}
+}
+
+// encodeValue returns the 32 byte encodeData of v of type typ.
+func (td *TypedData) encodeValue(typ string, v any) ([]byte, error) {
+	if m := arrayType.FindStringSubmatch(typ); m != nil {
+		items, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an array", typ)
+		}
+		if m[2] != "" && strconv.Itoa(len(items)) != m[2] {
+			return nil, fmt.Errorf("%s has %d items", typ, len(items))
+		}
+		var enc []byte
+		for _, item := range items {
+			e, err := td.encodeValue(m[1], item)
+			if err != nil {
+				return nil, err
+			}
+			enc = append(enc, e...)
+		}
+		return keccak256(enc), nil
+	}
+	if _, ok := td.Types[typ]; ok {
+		data, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an object", typ)
+		}
+		return td.HashStruct(typ, data)
+	}
+	switch {
+	case typ == "string":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a string", typ)
+		}
+		return keccak256([]byte(s)), nil
+	case typ == "bytes":
+		b, err := hexBytes(v)
+		if err != nil {
+			return nil, err
+		}
+		return keccak256(b), nil
+	case typ == "bool":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a bool", typ)
+		}
+		enc := make([]byte, 32)
+		if b {
+			enc[31] = 1
+		}
+		return enc, nil
+	case typ == "address":
+		b, err := hexBytes(v)
+		if err != nil || len(b) != 20 {
+			return nil, ErrEcdsaAddressInvalid
+		}
+		return leftPad(b), nil
+	case strings.HasPrefix(typ, "bytes"):
+		n, err := strconv.Atoi(strings.TrimPrefix(typ, "bytes"))
+		if err != nil || n < 1 || n > 32 {
+			return nil, fmt.Errorf("unsupported type %s", typ)
+		}
+		b, err := hexBytes(v)
+		if err != nil || len(b) != n {
+			return nil, fmt.Errorf("%s has %d bytes", typ, len(b))
+		}
+		return append(b, make([]byte, 32-n)...), nil
+	case strings.HasPrefix(typ, "uint"), strings.HasPrefix(typ, "int"):
+		n, err := bigInt(v)
+		if err != nil {
+			return nil, err
+		}
+		if n.Sign() < 0 {
+			if strings.HasPrefix(typ, "uint") {
+				return nil, fmt.Errorf("%s is negative", typ)
+			}
+			// Two's complement in 256 bits.
+			n = new(big.Int).Add(n, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		if n.BitLen() > 256 {
+			return nil, fmt.Errorf("%s overflows", typ)
+		}
+		return n.FillBytes(make([]byte, 32)), nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", typ)
+	}
+}
+
+// leftPad returns b left padded with zeros to 32 bytes.
+func leftPad(b []byte) []byte {
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+// hexBytes decodes a 0x prefixed hex string.
+func hexBytes(v any) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a hex string", v)
+	}
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
+
+// bigInt converts the JSON and Go representations of an integer to a big.Int.
+func bigInt(v any) (*big.Int, error) {
+	switch n := v.(type) {
+	case int:
+		return big.NewInt(int64(n)), nil
+	case int64:
+		return big.NewInt(n), nil
+	case uint64:
+		return new(big.Int).SetUint64(n), nil
+	case float64:
+		if n != float64(int64(n)) {
+			return nil, fmt.Errorf("%v is not an integer", n)
+		}
+		return big.NewInt(int64(n)), nil
+	case json.Number:
+		return bigInt(n.String())
+	case *big.Int:
+		return n, nil
+	case string:
+		i, ok := new(big.Int).SetString(n, 0)
+		if !ok {
+			return nil, fmt.Errorf("%q is not an integer", n)
+		}
+		return i, nil
+	default:
+		return nil, fmt.Errorf("%v is not an integer", v)
+	}
+}
+
+// verifyTypedDataSignature checks that signature is the eth_signTypedData_v4 of td by address.
+func verifyTypedDataSignature(address string, td *TypedData, signature string) error {
+	want, err := checksumAddress(address)
+	if err != nil {
+		return err
+	}
+	hash, err := td.Hash()
+	if err != nil {
+		return err
+	}
+	got, err := recoverAddress(hash, signature)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
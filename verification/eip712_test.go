@@ -0,0 +1,93 @@
+package verification
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_EIP712(t *testing.T) {
+	// The example of the EIP-712 specification.
+	var td TypedData
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"types": {
+			"EIP712Domain": [
+				{"name": "name", "type": "string"},
+				{"name": "version", "type": "string"},
+				{"name": "chainId", "type": "uint256"},
+				{"name": "verifyingContract", "type": "address"}
+			],
+			"Person": [{"name": "name", "type": "string"}, {"name": "wallet", "type": "address"}],
+			"Mail": [
+				{"name": "from", "type": "Person"},
+				{"name": "to", "type": "Person"},
+				{"name": "contents", "type": "string"}
+			]
+		},
+		"primaryType": "Mail",
+		"domain": {
+			"name": "Ether Mail", "version": "1", "chainId": 1,
+			"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+		},
+		"message": {
+			"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+			"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+			"contents": "Hello, Bob!"
+		}
+	}`), &td))
+	assert.Equal(t, "Mail(Person from,Person to,string contents)Person(string name,address wallet)",
+		td.encodeType("Mail"))
+	domain, err := td.HashStruct("EIP712Domain", td.Domain)
+	require.NoError(t, err)
+	assert.Equal(t, "f2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f", hex.EncodeToString(domain))
+	hash, err := td.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, "be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2", hex.EncodeToString(hash))
+
+	sig := "0x4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d" +
+		"07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b915621c"
+	assert.NoError(t, verifyTypedDataSignature("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826", &td, sig))
+	td.Message["contents"] = "Hello, Alice!"
+	assert.ErrorIs(t, verifyTypedDataSignature("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826", &td, sig),
+		ErrSignatureInvalid)
+
+	t.Run("siwe typed data", func(t *testing.T) {
+		client, cleanup, _ := getRedisClient(t)
+		defer cleanup()
+		ctx := context.Background()
+		svc := NewSIWEService(SIWEConfig{Domain: "example.com", URI: "https://example.com/login"},
+			NewTestCodeGenerator("123456"), NewOTPService[EcdsaCode](DefaultOTPConfig("TEST"), client, nil))
+		ch, err := svc.Challenge(ctx, "login", 1, testWalletAddress)
+		require.NoError(t, err)
+
+		// The typed data travels to the wallet and back as JSON.
+		raw, err := json.Marshal(ch.Message.TypedData())
+		require.NoError(t, err)
+		var td TypedData
+		require.NoError(t, json.Unmarshal(raw, &td))
+		hash, err := td.Hash()
+		require.NoError(t, err)
+		sig := signHash(t, hash)
+
+		tampered := td
+		tampered.Message = map[string]any{}
+		for k, v := range td.Message {
+			tampered.Message[k] = v
+		}
+		tampered.Message["statement"] = "Transfer all funds."
+		_, err = svc.VerifyTypedData(ctx, "login", ch.Sequence, &tampered, sig)
+		assert.ErrorIs(t, err, ErrSignatureInvalid)
+
+		forged := td
+		forged.Types = map[string][]TypedDataField{"EIP712Domain": siweTypes["EIP712Domain"],
+			"SignIn": siweTypes["SignIn"][:4]}
+		_, err = svc.VerifyTypedData(ctx, "login", ch.Sequence, &forged, sig)
+		assert.NoError(t, err, "types sent by the client are ignored")
+		_, err = svc.VerifyTypedData(ctx, "login", ch.Sequence, &td, sig)
+		assert.ErrorIs(t, err, ErrCodeNotFound)
+	})
+}
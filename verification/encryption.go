@@ -0,0 +1,157 @@
+package verification
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+)
+
+// ErrEncryptionKeyNotFound indicates a payload encrypted with a key the KeyProvider
+// doesn't have, e.g. after it was removed too early in a rotation.
+var ErrEncryptionKeyNotFound = bizerrors.New(500, "VERIFICATION_ENCRYPTION_KEY_NOT_FOUND", "encryption key not found")
+
+// KeyProvider provides the AES keys of an EncryptedCodec. Keys are 16, 24 or 32 bytes
+// for AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// Current returns the id and the key encrypting new payloads, ids are at most 255
+	// bytes.
+	Current() (id string, key []byte, err error)
+	// Key returns the key of id, ErrEncryptionKeyNotFound when it is unknown.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider of fixed keys by id. To rotate, add the new key, make it
+// current once every instance has it, and remove the old one after the TTL of the codes.
+type StaticKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+// Compile-time assertion: StaticKeys implements KeyProvider.
+var _ KeyProvider = (*StaticKeys)(nil)
+
+// NewStaticKeys creates a StaticKeys encrypting with the key of current, it returns
+// ErrInvalidConfig when current is missing or a key or id has an invalid length.
+func NewStaticKeys(current string, keys map[string][]byte) (*StaticKeys, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("%w: current encryption key %q is missing", ErrInvalidConfig, current)
+	}
+	for id, key := range keys {
+		if len(id) > 255 {
+			return nil, fmt.Errorf("%w: encryption key id %q is longer than 255 bytes", ErrInvalidConfig, id)
+		}
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, fmt.Errorf("%w: encryption key %q: %w", ErrInvalidConfig, id, err)
+		}
+	}
+	return &StaticKeys{current: current, keys: keys}, nil
+}
+
+// Current implements KeyProvider.
+func (k *StaticKeys) Current() (string, []byte, error) {
+	return k.current, k.keys[k.current], nil
+}
+
+// Key implements KeyProvider.
+func (k *StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrEncryptionKeyNotFound, id)
+	}
+	return key, nil
+}
+
+// errTruncatedPayload is returned for an encrypted payload shorter than its header.
+var errTruncatedPayload = fmt.Errorf("verification: decrypt failed: truncated payload")
+
+// encryptedMarker starts an EncryptedCodec payload. No codec starts a code with it,
+// see envelopeMarker.
+const encryptedMarker = 0x01
+
+// EncryptedCodec encrypts the payloads of a Codec with AES-GCM, so the codes in Redis
+// snapshots and replicas are not readable. A payload is the marker byte, the length and
+// bytes of the key id, the nonce and the sealed body, the key id is authenticated as
+// additional data.
+//
+// Payloads without the marker are decoded with the wrapped codec, so codes stored before
+// the encryption was enabled still verify. Encrypted payloads are decoded in Go, not by
+// the Lua scripts of the JSON codec.
+type EncryptedCodec struct {
+	codec Codec
+	keys  KeyProvider
+}
+
+// Compile-time assertion: EncryptedCodec implements Codec.
+var _ Codec = (*EncryptedCodec)(nil)
+
+// NewEncryptedCodec creates an EncryptedCodec encrypting the payloads of codec with the
+// keys of keys.
+func NewEncryptedCodec(codec Codec, keys KeyProvider) *EncryptedCodec {
+	return &EncryptedCodec{codec: codec, keys: keys}
+}
+
+// Marshal implements Codec.
+func (c *EncryptedCodec) Marshal(v any) ([]byte, error) {
+	body, err := c.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	id, key, err := c.keys.Current()
+	if err != nil {
+		return nil, err
+	}
+	if len(id) > 255 {
+		return nil, fmt.Errorf("verification: encryption key id %q is longer than 255 bytes", id)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte{encryptedMarker, byte(len(id))}, id...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("verification: encrypt failed: %w", err)
+	}
+	out := append(header, nonce...)
+	return aead.Seal(out, nonce, body, []byte(id)), nil
+}
+
+// Unmarshal implements Codec.
+func (c *EncryptedCodec) Unmarshal(data []byte, v any) error {
+	if len(data) < 2 || data[0] != encryptedMarker {
+		return c.codec.Unmarshal(data, v)
+	}
+	n := int(data[1])
+	if len(data) < 2+n {
+		return errTruncatedPayload
+	}
+	id, sealed := string(data[2:2+n]), data[2+n:]
+	key, err := c.keys.Key(id)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return errTruncatedPayload
+	}
+	body, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return fmt.Errorf("verification: decrypt failed: %w", err)
+	}
+	return c.codec.Unmarshal(body, v)
+}
+
+// newAEAD returns the AES-GCM AEAD of key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("verification: encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
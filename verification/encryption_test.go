@@ -0,0 +1,61 @@
+package verification
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_EncryptedCodec(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	k1, k2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 16)
+	keys, err := NewStaticKeys("k1", map[string][]byte{"k1": k1})
+	require.NoError(t, err)
+	cfg := mobileTestConfig(5, 5)
+	cfg.Codec = NewEncryptedCodec(JSONCodec, keys)
+	sms := &fakeSMSSender{}
+	svc := NewOTPService[MobileCode](cfg, client, sms)
+	gen := NewTestCodeGenerator("666666")
+
+	code, _ := gen.NewMobileCode("LOGIN", 1, "13800000000", "86")
+	seq, err := svc.Send(ctx, code)
+	require.NoError(t, err)
+	key := NewCacheKeyBuilder("TEST").CodeKey("MOBILE", "LOGIN", code.CacheKeyParts()...)
+	raw, err := client.Get(ctx, key).Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 'k', '1'}, raw[:4])
+	assert.NotContains(t, string(raw), code.Digest)
+	assert.NotContains(t, string(raw), "13800000000")
+
+	// After the rotation to k2 the codes encrypted with k1 still verify.
+	rotated, err := NewStaticKeys("k2", map[string][]byte{"k1": k1, "k2": k2})
+	require.NoError(t, err)
+	cfg.Codec = NewEncryptedCodec(JSONCodec, rotated)
+	svc = NewOTPService[MobileCode](cfg, client, sms)
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", mobileProbe(seq, "13800000000", "86")), ErrCodeIncorrect)
+	require.NoError(t, svc.Verify(ctx, "666666", mobileProbe(seq, "13800000000", "86")))
+
+	// Codes stored before the encryption stay readable, unknown keys fail.
+	plain := &MobileCode{Code: Code{Type: "LOGIN", Sequence: "seq", Digest: hashCode("666666")}, Mobile: "13800000000"}
+	data, err := JSONCodec.Marshal(plain)
+	require.NoError(t, err)
+	var out MobileCode
+	require.NoError(t, cfg.Codec.Unmarshal(data, &out))
+	assert.Equal(t, *plain, out)
+	data, err = cfg.Codec.Marshal(plain)
+	require.NoError(t, err)
+	assert.ErrorIs(t, NewEncryptedCodec(JSONCodec, keys).Unmarshal(data, &out), ErrEncryptionKeyNotFound)
+	data[len(data)-1] ^= 1
+	assert.Error(t, cfg.Codec.Unmarshal(data, &out))
+
+	_, err = NewStaticKeys("k3", map[string][]byte{"k1": k1})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = NewStaticKeys("k1", map[string][]byte{"k1": []byte("short")})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
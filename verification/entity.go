@@ -2,7 +2,9 @@ package verification
 
 import (
 	"context"
+	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
 	"time"
@@ -14,6 +16,19 @@ func hashCode(code string) string {
 	return hex.EncodeToString(h[:])
 }
 
+// hmacCode returns the hex-encoded HMAC-SHA256 of a verification code string.
+func hmacCode(key []byte, code string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(code))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// equalCode reports whether a and b are equal in time independent of their content,
+// verify paths comparing codes or digests in Go must use it instead of ==.
+func equalCode(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
 // timeNow is a package-level function variable for time.Now.
 // Override in tests to make EcdsaCode generation deterministic.
 var timeNow = time.Now
@@ -23,13 +38,16 @@ type CodeType string
 // ChinaCountryCode is the country code for mainland China.
 const ChinaCountryCode = "86"
 
+// Code is the base of all code types. It holds plain data only, no func or channel
+// fields, so every Codec encodes it losslessly; formatting lives in the templates.
 type Code struct {
 	UserID     int64    `json:"user_id"`
 	Type       CodeType `json:"type"`
 	Sequence   string   `json:"sequence"`
 	CodeLength int32    `json:"code_length"`
-	Value      string   `json:"-"`      // Plaintext code, in-memory only, never persisted
-	Digest     string   `json:"digest"` // SHA-256 digest for storage and comparison
+	Value      string   `json:"-"`                // Plaintext code, in-memory only, never persisted
+	Digest     string   `json:"digest"`           // SHA-256 digest for storage and comparison
+	Locale     string   `json:"locale,omitempty"` // BCP 47 tag selecting the template, e.g. "zh-CN"
 }
 
 // GetValue returns the plaintext verification code (transient, in-memory only).
@@ -41,9 +59,27 @@ func (c Code) GetDigest() string { return c.Digest }
 // GetSequence returns the sequence identifier.
 func (c Code) GetSequence() string { return c.Sequence }
 
+// GetUserID returns the ID of the user the code was sent to.
+func (c Code) GetUserID() int64 { return c.UserID }
+
 // GetType returns the code type.
 func (c Code) GetType() CodeType { return c.Type }
 
+// GetLocale returns the locale of the templates, empty for the default templates.
+func (c Code) GetLocale() string { return c.Locale }
+
+// setLocale sets the locale of a code being sent.
+func (c *Code) setLocale(locale string) { c.Locale = locale }
+
+// setDigest replaces the digest, it is promoted to the pointers of all code types.
+func (c *Code) setDigest(digest string) { c.Digest = digest }
+
+// setValue restores the plaintext code of a queued delivery.
+func (c *Code) setValue(value string) { c.Value = value }
+
+// clearValue drops the plaintext code before it is stored.
+func (c *Code) clearValue() { c.Value = "" }
+
 // validate checks that common base fields are populated.
 func (c Code) validate() error {
 	if c.Digest == "" {
@@ -150,9 +186,44 @@ func (c EcdsaCode) Validate() error {
 	return c.Code.validate()
 }
 
+// Ed25519Code represents an ed25519 wallet verification code, e.g. of Solana.
+type Ed25519Code struct {
+	Code
+	Chain   string `json:"chain"`
+	Address string `json:"address"`
+}
+
+func (c Ed25519Code) Medium() string          { return "ED25519" }
+func (c Ed25519Code) CacheKeyParts() []string { return []string{c.Sequence, c.Chain, c.Address} }
+func (c Ed25519Code) LimitKeyParts() []string { return []string{c.Chain, c.Address} }
+
+// NewEd25519Code creates an Ed25519Code from a base Code.
+// Appends a timestamp to the code for challenge uniqueness like NewEcdsaCode.
+// Returns an error if required fields are missing.
+func NewEd25519Code(base Code, chain, address string) (*Ed25519Code, error) {
+	base.Value = fmt.Sprintf("%s-%d", base.Value, timeNow().UnixNano())
+	base.Digest = hashCode(base.Value)
+	ec := &Ed25519Code{Code: base, Chain: chain, Address: address}
+	if err := ec.Validate(); err != nil {
+		return nil, err
+	}
+	return ec, nil
+}
+
+// Validate checks that all required fields are populated.
+func (c Ed25519Code) Validate() error {
+	if c.Chain == "" {
+		return ErrEd25519CodeChainIsEmpty
+	}
+	if c.Address == "" {
+		return ErrEd25519CodeAddressIsEmpty
+	}
+	return c.Code.validate()
+}
+
 // VerificationCode is a type-set constraint for all verification code types.
 type VerificationCode interface {
-	MobileCode | EmailCode | EcdsaCode
+	MobileCode | EmailCode | EcdsaCode | Ed25519Code
 }
 
 // CodeConstraint is the unified generic constraint for OTPService.
@@ -161,7 +232,7 @@ type CodeConstraint interface {
 	VerificationCode
 	GetValue() string        // returns the plaintext code for sending
 	GetDigest() string       // returns the SHA-256 digest for comparison
-	Medium() string          // e.g. "MOBILE", "EMAIL", "ECDSA"
+	Medium() string          // e.g. "MOBILE", "EMAIL", "ECDSA", "ED25519"
 	CacheKeyParts() []string // e.g. [sequence, mobile, countryCode]
 	LimitKeyParts() []string // e.g. [mobile, countryCode]  (no sequence)
 	GetSequence() string
@@ -178,12 +249,16 @@ type CodeSender[T VerificationCode] interface {
 type EmailTemplate struct {
 	// Subject is the email subject line.
 	Subject string `json:"subject"`
-	// BodyFormat is the email body format string.
-	// Use {{code}} as the placeholder for the verification code.
+	// BodyFormat is the text/template of the email body, rendered with TemplateData,
+	// e.g. "Your {{.AppName}} code is {{.Code}}". Subject is rendered the same way.
 	BodyFormat string `json:"body_format"`
 	// ContentType specifies the MIME type: "text/plain" or "text/html".
 	// Defaults to "text/plain" if empty.
 	ContentType string `json:"content_type"`
+	// TextFormat is the optional text/template of the plain text alternative of a
+	// text/html body, the senders send both as multipart/alternative for clients that
+	// don't render HTML. It is ignored for text/plain bodies.
+	TextFormat string `json:"text_format,omitempty"`
 }
 
 // SMSTemplate represents an SMS template with code and sign.
@@ -191,7 +266,32 @@ type SMSTemplate struct {
 	TaskID       string `json:"task_id"`       // Optional: used for global SMS
 	Code         string `json:"code"`          // Template code
 	SignName     string `json:"sign_name"`     // Sign name
-	ParamsFormat string `json:"params_format"` // JSON format string, e.g., `{"code":"%s"}`
+	ParamsFormat string `json:"params_format"` // text/template of the JSON params, e.g., `{"code":"{{.Code}}"}`
+}
+
+// Validate checks that the subject is set and parses and that the body renders the
+// code, it returns ErrTemplateInvalid otherwise.
+func (t EmailTemplate) Validate() error {
+	if t.Subject == "" {
+		return fmt.Errorf("%w: email subject is empty", ErrTemplateInvalid)
+	}
+	if _, err := ParseContentTemplate("subject", t.Subject); err != nil {
+		return err
+	}
+	if err := validateContent("email", t.BodyFormat); err != nil {
+		return err
+	}
+	if t.TextFormat != "" && t.ContentType == "text/html" {
+		return validateContent("email text", t.TextFormat)
+	}
+	return nil
+}
+
+// Validate checks that ParamsFormat renders the code, it returns ErrTemplateInvalid
+// otherwise. The provider specific fields are checked by the senders, e.g.
+// aliyun.SMS.ValidateTemplates.
+func (t SMSTemplate) Validate() error {
+	return validateContent("sms", t.ParamsFormat)
 }
 
 // Template is a type constraint for all template types.
@@ -0,0 +1,63 @@
+package verification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_Service_HMACDigest(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	cfg := mobileTestConfig(10, 10)
+	cfg.HMACKey = []byte("secret")
+	gen := NewTestCodeGenerator("666666")
+	svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+	mc, err := gen.NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	seq, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+
+	// Redis holds the keyed digest, never the code or its plain SHA-256.
+	stored, err := NewCodeStore[MobileCode](client).Peek(ctx,
+		NewCacheKeyBuilder("TEST").CodeKey("MOBILE", "LOGIN", seq, "13800138000", "86"))
+	require.NoError(t, err)
+	assert.Equal(t, hmacCode([]byte("secret"), "666666"), stored.Digest)
+	assert.NotEqual(t, hashCode("666666"), stored.Digest)
+	assert.Empty(t, stored.Value)
+
+	// A service with another key can't verify it.
+	other := NewOTPService[MobileCode](mobileTestConfig(10, 10), client, &fakeSMSSender{})
+	probe := mobileProbe(seq, "13800138000", "86")
+	assert.ErrorIs(t, other.Verify(ctx, "666666", probe), ErrCodeIncorrect)
+	require.NoError(t, svc.Verify(ctx, "666666", probe))
+}
+
+func TestVerification_EqualCode(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	store := NewCodeStore[MobileCode](client)
+	stored := hashCode("123456")
+	cases := []string{stored, hashCode("123457"), stored[:len(stored)-1], stored + "0", "", "123456"}
+	for _, input := range cases {
+		// The Go helper and the Lua comparison behave like ==.
+		assert.Equal(t, stored == input, equalCode(stored, input), input)
+
+		code := &MobileCode{Code: Code{Type: "LOGIN", Digest: stored}, Mobile: "13800138000", CountryCode: "86"}
+		require.NoError(t, store.Set(ctx, "EQUAL", code, time.Minute))
+		decision, err := store.Consume(ctx, "EQUAL", input)
+		require.NoError(t, err)
+		want := ConsumeMismatched
+		if stored == input {
+			want = ConsumeMatched
+		}
+		assert.Equal(t, want, decision, input)
+	}
+}
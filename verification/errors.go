@@ -1,9 +1,10 @@
 package verification
 
 import (
-	"errors"
 	"fmt"
 	"time"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
 )
 
 // RateLimitError wraps a rate limit error with a retry duration.
@@ -28,43 +29,82 @@ func (e *RateLimitError) Unwrap() error {
 
 var (
 	// ErrSendFailed represents a generic send failure.
-	ErrSendFailed = errors.New("send failed")
+	ErrSendFailed = bizerrors.New(503, "VERIFICATION_SEND_FAILED", "send failed")
+	// ErrSendThrottled indicates that the send throughput of the channel is saturated.
+	ErrSendThrottled = bizerrors.New(429, "VERIFICATION_SEND_THROTTLED", "send throughput exceeded")
 
 	// ErrCodeNotFound represents a verification code not found error.
-	ErrCodeNotFound = errors.New("verification code not found")
+	ErrCodeNotFound = bizerrors.New(404, "VERIFICATION_CODE_NOT_FOUND", "verification code not found")
 	// ErrCodeTypeIsEmpty represents a verification code type is empty error.
-	ErrCodeTypeIsEmpty = errors.New("verification code type is empty")
+	ErrCodeTypeIsEmpty = bizerrors.New(400, "VERIFICATION_CODE_TYPE_EMPTY", "verification code type is empty")
 	// ErrCodeIncorrect represents a verification code incorrect error.
-	ErrCodeIncorrect = errors.New("verification code is incorrect")
+	ErrCodeIncorrect = bizerrors.New(400, "VERIFICATION_CODE_INCORRECT", "verification code is incorrect")
 	// ErrCodeIsEmpty represents an empty verification code error.
-	ErrCodeIsEmpty = errors.New("verification code is empty")
+	ErrCodeIsEmpty = bizerrors.New(400, "VERIFICATION_CODE_EMPTY", "verification code is empty")
 	// ErrMobileSendLimitExceeded indicates that the mobile number has exceeded the limit for sending OTPs.
-	ErrMobileSendLimitExceeded = errors.New("mobile send OTP limit exceeded")
+	ErrMobileSendLimitExceeded = bizerrors.New(429, "VERIFICATION_MOBILE_SEND_LIMIT_EXCEEDED", "mobile send OTP limit exceeded")
 	// ErrMobileVerifyLimitExceeded indicates that the mobile number has exceeded the limit for verifying OTPs.
-	ErrMobileVerifyLimitExceeded = errors.New("mobile verify OTP limit exceeded")
+	ErrMobileVerifyLimitExceeded = bizerrors.New(429, "VERIFICATION_MOBILE_VERIFY_LIMIT_EXCEEDED", "mobile verify OTP limit exceeded")
 	// ErrEmailSendLimitExceeded indicates that the email address has exceeded the limit for sending OTPs.
-	ErrEmailSendLimitExceeded = errors.New("email send OTP limit exceeded")
+	ErrEmailSendLimitExceeded = bizerrors.New(429, "VERIFICATION_EMAIL_SEND_LIMIT_EXCEEDED", "email send OTP limit exceeded")
 	// ErrEmailVerifyLimitExceeded indicates that the email address has exceeded the limit for verifying OTPs.
-	ErrEmailVerifyLimitExceeded = errors.New("email verify OTP limit exceeded")
+	ErrEmailVerifyLimitExceeded = bizerrors.New(429, "VERIFICATION_EMAIL_VERIFY_LIMIT_EXCEEDED", "email verify OTP limit exceeded")
 	// ErrEcdsaSendLimitExceeded indicates that the ecdsa address has exceeded the limit for sending OTPs.
-	ErrEcdsaSendLimitExceeded = errors.New("ecdsa send OTP limit exceeded")
+	ErrEcdsaSendLimitExceeded = bizerrors.New(429, "VERIFICATION_ECDSA_SEND_LIMIT_EXCEEDED", "ecdsa send OTP limit exceeded")
 	// ErrEcdsaVerifyLimitExceeded indicates that the ecdsa address has exceeded the limit for verifying OTPs.
-	ErrEcdsaVerifyLimitExceeded = errors.New("ecdsa verify OTP limit exceeded")
+	ErrEcdsaVerifyLimitExceeded = bizerrors.New(429, "VERIFICATION_ECDSA_VERIFY_LIMIT_EXCEEDED", "ecdsa verify OTP limit exceeded")
+
+	// ErrEd25519SendLimitExceeded indicates that the ed25519 address has exceeded the limit for sending OTPs.
+	ErrEd25519SendLimitExceeded = bizerrors.New(429, "VERIFICATION_ED25519_SEND_LIMIT_EXCEEDED", "ed25519 send OTP limit exceeded")
+	// ErrEd25519VerifyLimitExceeded indicates that the ed25519 address has exceeded the limit for verifying OTPs.
+	ErrEd25519VerifyLimitExceeded = bizerrors.New(429, "VERIFICATION_ED25519_VERIFY_LIMIT_EXCEEDED", "ed25519 verify OTP limit exceeded")
+
+	// ErrIPSendLimitExceeded indicates that the client IP has exceeded the limit for sending OTPs.
+	ErrIPSendLimitExceeded = bizerrors.New(429, "VERIFICATION_IP_SEND_LIMIT_EXCEEDED", "ip send OTP limit exceeded")
+	// ErrDeviceSendLimitExceeded indicates that the client device has exceeded the limit for sending OTPs.
+	ErrDeviceSendLimitExceeded = bizerrors.New(429, "VERIFICATION_DEVICE_SEND_LIMIT_EXCEEDED", "device send OTP limit exceeded")
+	// ErrUserSendLimitExceeded indicates that the user has exceeded the limit for sending OTPs.
+	ErrUserSendLimitExceeded = bizerrors.New(429, "VERIFICATION_USER_SEND_LIMIT_EXCEEDED", "user send OTP limit exceeded")
+
+	// ErrResendCooldown indicates that a code was resent before the cooldown of its sequence ended.
+	ErrResendCooldown = bizerrors.New(429, "VERIFICATION_RESEND_COOLDOWN", "resend cooldown not elapsed")
+	// ErrSendInProgress indicates that a send with the same idempotency key is in progress.
+	ErrSendInProgress = bizerrors.New(409, "VERIFICATION_SEND_IN_PROGRESS", "send with the same idempotency key in progress")
+	// ErrGlobalQuotaExceeded indicates that the daily quota of a code type across all targets is used up.
+	ErrGlobalQuotaExceeded = bizerrors.New(429, "VERIFICATION_GLOBAL_QUOTA_EXCEEDED", "global daily OTP quota exceeded")
 
 	// ErrMobileCodeMobileIsEmpty represents an empty mobile error.
-	ErrMobileCodeMobileIsEmpty = errors.New("mobile code mobile is empty")
+	ErrMobileCodeMobileIsEmpty = bizerrors.New(400, "VERIFICATION_MOBILE_EMPTY", "mobile code mobile is empty")
 	// ErrMobileCodeCountryCodeIsEmpty represents an empty country code error.
-	ErrMobileCodeCountryCodeIsEmpty = errors.New("mobile code country code is empty")
+	ErrMobileCodeCountryCodeIsEmpty = bizerrors.New(400, "VERIFICATION_COUNTRY_CODE_EMPTY", "mobile code country code is empty")
 	// ErrUnsupportedCountryCode represents an unsupported country code error.
-	ErrUnsupportedCountryCode = errors.New("unsupported country code")
+	ErrUnsupportedCountryCode = bizerrors.New(400, "VERIFICATION_UNSUPPORTED_COUNTRY_CODE", "unsupported country code")
+	// ErrCountryNotAllowed indicates a destination country code the country policy of the service rejects.
+	ErrCountryNotAllowed = bizerrors.New(403, "VERIFICATION_COUNTRY_NOT_ALLOWED", "country code is not allowed")
 
 	// ErrEmailCodeEmailIsEmpty represents an empty email error.
-	ErrEmailCodeEmailIsEmpty = errors.New("email code email is empty")
+	ErrEmailCodeEmailIsEmpty = bizerrors.New(400, "VERIFICATION_EMAIL_EMPTY", "email code email is empty")
 	// ErrEmailTemplateNotFound represents an email template not found error.
-	ErrEmailTemplateNotFound = errors.New("email template not found")
+	ErrEmailTemplateNotFound = bizerrors.New(500, "VERIFICATION_EMAIL_TEMPLATE_NOT_FOUND", "email template not found")
 
 	// ErrEcdsaCodeChainIsEmpty represents an empty chain error.
-	ErrEcdsaCodeChainIsEmpty = errors.New("ecdsa code chain is empty")
+	ErrEcdsaCodeChainIsEmpty = bizerrors.New(400, "VERIFICATION_ECDSA_CHAIN_EMPTY", "ecdsa code chain is empty")
 	// ErrEcdsaCodeAddressIsEmpty represents an empty address error.
-	ErrEcdsaCodeAddressIsEmpty = errors.New("ecdsa code address is empty")
+	ErrEcdsaCodeAddressIsEmpty = bizerrors.New(400, "VERIFICATION_ECDSA_ADDRESS_EMPTY", "ecdsa code address is empty")
+	// ErrEcdsaAddressInvalid represents a malformed address error.
+	ErrEcdsaAddressInvalid = bizerrors.New(400, "VERIFICATION_ECDSA_ADDRESS_INVALID", "ecdsa address is invalid")
+	// ErrEd25519CodeChainIsEmpty represents an empty chain error.
+	ErrEd25519CodeChainIsEmpty = bizerrors.New(400, "VERIFICATION_ED25519_CHAIN_EMPTY", "ed25519 code chain is empty")
+	// ErrEd25519CodeAddressIsEmpty represents an empty address error.
+	ErrEd25519CodeAddressIsEmpty = bizerrors.New(400, "VERIFICATION_ED25519_ADDRESS_EMPTY", "ed25519 code address is empty")
+	// ErrEd25519AddressInvalid represents an address that is not a base58 ed25519 public key.
+	ErrEd25519AddressInvalid = bizerrors.New(400, "VERIFICATION_ED25519_ADDRESS_INVALID", "ed25519 address is invalid")
+	// ErrUnsupportedChain represents a chain without ChainVerifier.
+	ErrUnsupportedChain = bizerrors.New(400, "VERIFICATION_UNSUPPORTED_CHAIN", "unsupported chain")
+	// ErrSignatureInvalid indicates that a signature is malformed or not made by the address.
+	ErrSignatureInvalid = bizerrors.New(401, "VERIFICATION_SIGNATURE_INVALID", "signature is invalid")
+	// ErrSIWEMessageInvalid indicates a malformed SIWE message or one issued for another domain.
+	ErrSIWEMessageInvalid = bizerrors.New(400, "VERIFICATION_SIWE_MESSAGE_INVALID", "siwe message is invalid")
+	// ErrSIWEMessageExpired indicates a SIWE message outside its validity period.
+	ErrSIWEMessageExpired = bizerrors.New(401, "VERIFICATION_SIWE_MESSAGE_EXPIRED", "siwe message is expired")
 )
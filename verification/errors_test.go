@@ -0,0 +1,22 @@
+package verification
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_ErrorCodes(t *testing.T) {
+	err := &RateLimitError{Err: ErrMobileSendLimitExceeded, RetryIn: time.Minute}
+	var coded interface {
+		Code() int
+		Reason() string
+	}
+	require.True(t, errors.As(err, &coded))
+	assert.Equal(t, 429, coded.Code())
+	assert.Equal(t, "VERIFICATION_MOBILE_SEND_LIMIT_EXCEEDED", coded.Reason())
+	assert.ErrorIs(t, err, ErrMobileSendLimitExceeded)
+}
@@ -0,0 +1,86 @@
+package verification
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+// keccak256 returns the Keccak-256 hash of the concatenated data.
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// checksumAddress validates a hex Ethereum address and returns its EIP-55 checksum form.
+func checksumAddress(address string) (string, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(address, "0x"), "0X")
+	if len(s) != 40 {
+		return "", ErrEcdsaAddressInvalid
+	}
+	if _, err := hex.DecodeString(s); err != nil {
+		return "", ErrEcdsaAddressInvalid
+	}
+	s = strings.ToLower(s)
+	hash := hex.EncodeToString(keccak256([]byte(s)))
+	out := []byte(s)
+	for i, c := range out {
+		if c >= 'a' && hash[i] >= '8' {
+			out[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(out), nil
+}
+
+// personalMessageHash returns the EIP-191 personal_sign hash of message.
+func personalMessageHash(message string) []byte {
+	prefix := "\x19Ethereum Signed Message:\n" + strconv.Itoa(len(message))
+	return keccak256([]byte(prefix), []byte(message))
+}
+
+// recoverAddress returns the checksum address that signed hash, signature is the
+// hex-encoded 65 byte R || S || V produced by wallets, V being 0, 1, 27 or 28.
+func recoverAddress(hash []byte, signature string) (string, error) {
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, "0x"))
+	if err != nil || len(sig) != 65 {
+		return "", ErrSignatureInvalid
+	}
+	v := sig[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 {
+		return "", ErrSignatureInvalid
+	}
+	// RecoverCompact expects V || R || S with V offset by 27.
+	compact := make([]byte, 65)
+	compact[0] = 27 + v
+	copy(compact[1:], sig[:64])
+	pub, _, err := ecdsa.RecoverCompact(compact, hash)
+	if err != nil {
+		return "", ErrSignatureInvalid
+	}
+	return checksumAddress(hex.EncodeToString(keccak256(pub.SerializeUncompressed()[1:])[12:]))
+}
+
+// verifyPersonalSignature checks that signature is the personal_sign of message by address.
+func verifyPersonalSignature(address, message, signature string) error {
+	want, err := checksumAddress(address)
+	if err != nil {
+		return err
+	}
+	got, err := recoverAddress(personalMessageHash(message), signature)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// CodeEvent describes a code in a CodeEventListener callback, it never holds the code.
+type CodeEvent struct {
+	Medium   string
+	Type     CodeType
+	Sequence string
+	UserID   int64  // Set for sends, verifications only know the identity of the probe
+	Target   string // Mobile number, email address or wallet address
+	Time     time.Time
+	Err      error         // Error of OnVerifyFailed and OnLimited
+	Limiter  string        // Limiter of OnLimited: "send", "ip", "device", "quota" or "verify"
+	RetryIn  time.Duration // Time until the limiter of OnLimited admits again
+}
+
+// CodeEventListener receives the events of an OTPService, e.g. for audit logs,
+// analytics or fraud pipelines. The callbacks run synchronously in the flow, hand slow
+// work off to a queue; embed NopCodeEventListener to implement a subset.
+type CodeEventListener interface {
+	// OnSent is called after a code was stored and delivered.
+	OnSent(ctx context.Context, e CodeEvent)
+	// OnVerifySucceeded is called after a code matched and was consumed.
+	OnVerifySucceeded(ctx context.Context, e CodeEvent)
+	// OnVerifyFailed is called for an incorrect, expired or unknown code and for
+	// verifications failing in Redis.
+	OnVerifyFailed(ctx context.Context, e CodeEvent)
+	// OnLimited is called when a limiter or the quota rejects a send or a verification,
+	// a rejected verification locks the code.
+	OnLimited(ctx context.Context, e CodeEvent)
+}
+
+// NopCodeEventListener implements CodeEventListener with no-ops.
+type NopCodeEventListener struct{}
+
+// Compile-time assertion: NopCodeEventListener implements CodeEventListener.
+var _ CodeEventListener = NopCodeEventListener{}
+
+func (NopCodeEventListener) OnSent(context.Context, CodeEvent)            {}
+func (NopCodeEventListener) OnVerifySucceeded(context.Context, CodeEvent) {}
+func (NopCodeEventListener) OnVerifyFailed(context.Context, CodeEvent)    {}
+func (NopCodeEventListener) OnLimited(context.Context, CodeEvent)         {}
+
+// WithEventListener adds listener to the listeners of the service, they are called in
+// the order added.
+func WithEventListener[T CodeConstraint](listener CodeEventListener) OTPServiceOption[T] {
+	return func(s *OTPService[T]) { s.listeners = append(s.listeners, listener) }
+}
+
+// newCodeEvent returns the CodeEvent of code.
+func newCodeEvent(code any, err error) CodeEvent {
+	c := code.(interface {
+		Medium() string
+		GetType() CodeType
+		GetSequence() string
+		GetUserID() int64
+	})
+	e := CodeEvent{
+		Medium:   c.Medium(),
+		Type:     c.GetType(),
+		Sequence: c.GetSequence(),
+		UserID:   c.GetUserID(),
+		Target:   recipient(code),
+		Time:     timeNow(),
+		Err:      err,
+	}
+	var rle *RateLimitError
+	if errors.As(err, &rle) {
+		e.RetryIn = rle.RetryIn
+	}
+	return e
+}
@@ -0,0 +1,79 @@
+package verification
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingListener records the events as "callback sequence limiter" strings.
+type recordingListener struct {
+	NopCodeEventListener
+	events []string
+	last   CodeEvent
+}
+
+func (l *recordingListener) OnSent(_ context.Context, e CodeEvent) {
+	l.events, l.last = append(l.events, "sent "+e.Sequence), e
+}
+
+func (l *recordingListener) OnVerifySucceeded(_ context.Context, e CodeEvent) {
+	l.events, l.last = append(l.events, "verified "+e.Sequence), e
+}
+
+func (l *recordingListener) OnVerifyFailed(_ context.Context, e CodeEvent) {
+	l.events, l.last = append(l.events, "failed "+e.Sequence), e
+}
+
+func (l *recordingListener) OnLimited(_ context.Context, e CodeEvent) {
+	l.events, l.last = append(l.events, "limited "+e.Sequence+" "+e.Limiter), e
+}
+
+func TestVerification_EventListener(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	l := &recordingListener{}
+	svc := NewOTPService[MobileCode](mobileTestConfig(1, 1), client, &fakeSMSSender{},
+		WithEventListener[MobileCode](l))
+	gen := NewTestCodeGenerator("666666")
+
+	mc, err := gen.NewMobileCode("login", 7, "13800138000", "86")
+	require.NoError(t, err)
+	seq, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), l.last.UserID)
+	assert.Equal(t, "13800138000", l.last.Target)
+	assert.Equal(t, CodeType("LOGIN"), l.last.Type)
+
+	blocked, err := gen.NewMobileCode("login", 7, "13800138000", "86")
+	require.NoError(t, err)
+	_, err = svc.Send(ctx, blocked)
+	require.Error(t, err)
+	assert.Positive(t, l.last.RetryIn)
+
+	require.NoError(t, svc.Verify(ctx, "666666", mobileProbe(seq, "13800138000", "86")))
+	assert.ErrorIs(t, svc.Verify(ctx, "666666", mobileProbe(seq, "13800138000", "86")), ErrCodeNotFound)
+	assert.ErrorIs(t, l.last.Err, ErrCodeNotFound)
+
+	// The second failure of a code exceeds the verify limit of 1 and locks it.
+	mc, err = gen.NewMobileCode("login", 7, "13900000000", "86")
+	require.NoError(t, err)
+	seq2, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", mobileProbe(seq2, "13900000000", "86")), ErrCodeIncorrect)
+	require.Error(t, svc.Verify(ctx, "000000", mobileProbe(seq2, "13900000000", "86")))
+
+	assert.Equal(t, []string{
+		"sent " + seq,
+		"limited " + blocked.Sequence + " send",
+		"verified " + seq,
+		"failed " + seq,
+		"sent " + seq2,
+		"failed " + seq2,
+		"limited " + seq2 + " verify",
+	}, l.events)
+}
@@ -0,0 +1,376 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+)
+
+// ErrFallbackFull indicates the in-memory store of a Fallback reached its MaxEntries.
+var ErrFallbackFull = bizerrors.New(503, "VERIFICATION_FALLBACK_FULL", "fallback store is full")
+
+// FallbackConfig configures a Fallback.
+type FallbackConfig struct {
+	MaxEntries       int           // Codes and counters kept in memory, default 10000
+	FailureThreshold int           // Consecutive Redis failures opening the circuit, default 3
+	OpenTimeout      time.Duration // Time until Redis is tried again, default 10s
+	// OnStateChange, when set, is called on every transition, e.g. to alert on the
+	// degraded mode. It runs with the fallback locked.
+	OnStateChange func(from, to CircuitState)
+}
+
+// applyDefaultValue fills zero fields with defaults.
+func (c *FallbackConfig) applyDefaultValue() {
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = 10000
+	}
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = 3
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 10 * time.Second
+	}
+}
+
+// fallbackEntry is a code, a counter or a flag of the in-memory store.
+type fallbackEntry struct {
+	data      []byte
+	count     int64
+	expiresAt time.Time
+}
+
+// Fallback is a circuit breaker over Redis with a bounded in-memory store. After
+// FailureThreshold consecutive Redis failures the codes, rate limit counters and
+// lockouts of the services using it are kept in memory until a probe after OpenTimeout
+// succeeds, so login OTP keeps working through short Redis outages. The memory is
+// local to the instance, use it on single node deployments only. Codes stored in
+// memory still verify once Redis is back.
+//
+// In memory every limiter policy is evaluated as fixed windows.
+type Fallback struct {
+	cfg FallbackConfig
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int       // Consecutive failures
+	openedAt time.Time // When the circuit opened
+	probing  bool      // A half-open probe is in flight
+	entries  map[string]*fallbackEntry
+}
+
+// NewFallback creates a Fallback.
+func NewFallback(cfg FallbackConfig) *Fallback {
+	cfg.applyDefaultValue()
+	return &Fallback{cfg: cfg, entries: map[string]*fallbackEntry{}}
+}
+
+// State returns the circuit state, the memory store serves while it is not closed.
+func (f *Fallback) State() CircuitState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.state == CircuitOpen && !timeNow().Before(f.openedAt.Add(f.cfg.OpenTimeout)) {
+		return CircuitHalfOpen
+	}
+	return f.state
+}
+
+// do runs redisFn while the circuit admits it, and memFn when it is open or redisFn
+// fails with the failure opening it.
+func (f *Fallback) do(redisFn, memFn func() error) error {
+	if !f.acquire() {
+		return memFn()
+	}
+	err := redisFn()
+	if f.record(err) {
+		return memFn()
+	}
+	return err
+}
+
+// acquire admits a Redis call: always when closed, one probe at a time when half-open.
+func (f *Fallback) acquire() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.state == CircuitOpen {
+		if timeNow().Before(f.openedAt.Add(f.cfg.OpenTimeout)) {
+			return false
+		}
+		f.transition(CircuitHalfOpen)
+	}
+	if f.state == CircuitHalfOpen {
+		if f.probing {
+			return false
+		}
+		f.probing = true
+	}
+	return true
+}
+
+// record updates the circuit with the outcome of a Redis call and reports whether the
+// circuit is open after a failure. Errors like ErrCodeNotFound are answers of Redis.
+func (f *Fallback) record(err error) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.probing = false
+	if err == nil || !isTransient(err) {
+		f.failures = 0
+		f.transition(CircuitClosed)
+		return false
+	}
+	f.failures++
+	if f.state == CircuitHalfOpen || f.failures >= f.cfg.FailureThreshold {
+		f.openedAt = timeNow()
+		f.failures = 0
+		f.transition(CircuitOpen)
+	}
+	return f.state == CircuitOpen
+}
+
+// transition sets the state and reports a change.
+func (f *Fallback) transition(to CircuitState) {
+	from := f.state
+	f.state = to
+	if from != to && f.cfg.OnStateChange != nil {
+		f.cfg.OnStateChange(from, to)
+	}
+}
+
+// entry returns the unexpired entry under key, deleting an expired one. f.mu is held.
+func (f *Fallback) entry(key string, now time.Time) *fallbackEntry {
+	e, ok := f.entries[key]
+	if !ok {
+		return nil
+	}
+	if !now.Before(e.expiresAt) {
+		delete(f.entries, key)
+		return nil
+	}
+	return e
+}
+
+// put stores e under key, it returns ErrFallbackFull when the store is full of
+// unexpired entries. f.mu is held.
+func (f *Fallback) put(key string, e *fallbackEntry, now time.Time) error {
+	if _, ok := f.entries[key]; !ok && len(f.entries) >= f.cfg.MaxEntries {
+		for k, v := range f.entries {
+			if !now.Before(v.expiresAt) {
+				delete(f.entries, k)
+			}
+		}
+		if len(f.entries) >= f.cfg.MaxEntries {
+			return ErrFallbackFull
+		}
+	}
+	f.entries[key] = e
+	return nil
+}
+
+// set stores data under key for ttl.
+func (f *Fallback) set(key string, data []byte, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := timeNow()
+	return f.put(key, &fallbackEntry{data: data, expiresAt: now.Add(ttl)}, now)
+}
+
+// get returns the data under key and its remaining TTL.
+func (f *Fallback) get(key string) ([]byte, time.Duration, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := timeNow()
+	e := f.entry(key, now)
+	if e == nil {
+		return nil, 0, false
+	}
+	return e.data, e.expiresAt.Sub(now), true
+}
+
+// ttl returns the remaining TTL of key, zero when it is missing.
+func (f *Fallback) ttl(key string) time.Duration {
+	_, ttl, _ := f.get(key)
+	return ttl
+}
+
+// del deletes the keys and reports whether one existed.
+func (f *Fallback) del(keys ...string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now, found := timeNow(), false
+	for _, key := range keys {
+		found = f.entry(key, now) != nil || found
+		delete(f.entries, key)
+	}
+	return found
+}
+
+// decide evaluates the policy of cfg for key as fixed windows like
+// RateLimiter.AllowTiers: the action is counted in every tier only when none is
+// exhausted.
+func (f *Fallback) decide(key string, cfg RateLimiterConfig) (*LimitDecision, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := timeNow()
+	tiers := cfg.tiers()
+	var best *LimitDecision
+	for i, tier := range tiers {
+		var current int64
+		retryIn := tier.Window
+		if e := f.entry(tierKey(key, i, tier), now); e != nil {
+			current, retryIn = e.count, e.expiresAt.Sub(now)
+		}
+		if current >= tier.Limit && (best == nil || retryIn > best.RetryIn) {
+			best = &LimitDecision{Tier: i, Limit: tier.Limit, Current: current, RetryIn: retryIn}
+		}
+	}
+	if best != nil {
+		return best, nil
+	}
+	for i, tier := range tiers {
+		k := tierKey(key, i, tier)
+		e := f.entry(k, now)
+		if e == nil {
+			e = &fallbackEntry{expiresAt: now.Add(tier.Window)}
+			if err := f.put(k, e, now); err != nil {
+				return nil, err
+			}
+		}
+		e.count++
+		if best == nil || tier.Limit-e.count < best.Limit-best.Current {
+			best = &LimitDecision{Allowed: true, Tier: i, Limit: tier.Limit, Current: e.count,
+				RetryIn: e.expiresAt.Sub(now)}
+		}
+	}
+	return best, nil
+}
+
+// undo reverses the last action counted by decide for key.
+func (f *Fallback) undo(key string, cfg RateLimiterConfig) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := timeNow()
+	for i, tier := range cfg.tiers() {
+		if e := f.entry(tierKey(key, i, tier), now); e != nil && e.count > 0 {
+			e.count--
+		}
+	}
+}
+
+// reset deletes the counters of key.
+func (f *Fallback) reset(key string, cfg RateLimiterConfig) {
+	keys := make([]string, 0, len(cfg.Tiers)+1)
+	for i, tier := range cfg.tiers() {
+		keys = append(keys, tierKey(key, i, tier))
+	}
+	f.del(keys...)
+}
+
+// FallbackCache[T] is a CodeCache storing the codes in the memory of a Fallback while
+// the circuit of the Redis cache it decorates is open.
+type FallbackCache[T CodeConstraint] struct {
+	next     CodeCache[T]
+	fallback *Fallback
+}
+
+// Compile-time assertion: FallbackCache implements CodeCache.
+var _ CodeCache[MobileCode] = (*FallbackCache[MobileCode])(nil)
+
+// NewFallbackCache decorates next with fallback.
+func NewFallbackCache[T CodeConstraint](next CodeCache[T], fallback *Fallback) *FallbackCache[T] {
+	return &FallbackCache[T]{next: next, fallback: fallback}
+}
+
+// Check checks the decorated cache, so health checks report the outage.
+func (c *FallbackCache[T]) Check(ctx context.Context) error {
+	return c.next.Check(ctx)
+}
+
+// Set implements CodeCache.
+func (c *FallbackCache[T]) Set(ctx context.Context, key string, code *T, expire time.Duration) error {
+	return c.fallback.do(func() error {
+		return c.next.Set(ctx, key, code, expire)
+	}, func() error {
+		v := *code
+		any(&v).(interface{ clearValue() }).clearValue()
+		data, err := JSONCodec.Marshal(&v)
+		if err != nil {
+			return err
+		}
+		return c.fallback.set(key, data, expire)
+	})
+}
+
+// Peek implements CodeCache.
+func (c *FallbackCache[T]) Peek(ctx context.Context, key string) (*T, error) {
+	code, _, err := c.PeekWithTTL(ctx, key)
+	return code, err
+}
+
+// PeekWithTTL implements CodeCache, it returns a code stored in memory during an
+// outage after Redis is back.
+func (c *FallbackCache[T]) PeekWithTTL(ctx context.Context, key string) (*T, time.Duration, error) {
+	var (
+		code *T
+		ttl  time.Duration
+	)
+	err := c.fallback.do(func() error {
+		var err error
+		code, ttl, err = c.next.PeekWithTTL(ctx, key)
+		return err
+	}, func() error { return ErrCodeNotFound })
+	if !errors.Is(err, ErrCodeNotFound) {
+		return code, ttl, err
+	}
+	data, ttl, ok := c.fallback.get(key)
+	if !ok {
+		return nil, 0, ErrCodeNotFound
+	}
+	code = new(T)
+	if err = JSONCodec.Unmarshal(data, code); err != nil {
+		return nil, 0, err
+	}
+	return code, ttl, nil
+}
+
+// Delete implements CodeCache.
+func (c *FallbackCache[T]) Delete(ctx context.Context, key string) (bool, error) {
+	var ok bool
+	err := c.fallback.do(func() error {
+		var err error
+		ok, err = c.next.Delete(ctx, key)
+		return err
+	}, func() error { return nil })
+	return c.fallback.del(key) || ok, err
+}
+
+// Consume implements CodeCache, it consumes a code stored in memory during an outage
+// after Redis is back.
+func (c *FallbackCache[T]) Consume(ctx context.Context, key, digest string) (ConsumeDecision, error) {
+	decision := ConsumeNotFound
+	err := c.fallback.do(func() error {
+		var err error
+		decision, err = c.next.Consume(ctx, key, digest)
+		return err
+	}, func() error { return nil })
+	if err != nil || decision != ConsumeNotFound {
+		return decision, err
+	}
+	data, _, ok := c.fallback.get(key)
+	if !ok {
+		return ConsumeNotFound, nil
+	}
+	var code T
+	if err = JSONCodec.Unmarshal(data, &code); err != nil {
+		return ConsumeNotFound, err
+	}
+	if !equalCode(code.GetDigest(), digest) {
+		return ConsumeMismatched, nil
+	}
+	if !c.fallback.del(key) {
+		// A concurrent verification consumed it.
+		return ConsumeNotFound, nil
+	}
+	return ConsumeMatched, nil
+}
@@ -0,0 +1,78 @@
+package verification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_RedisFallback(t *testing.T) {
+	ctx := context.Background()
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	client := redis.NewClient(&redis.Options{Addr: m.Addr(), MaxRetries: -1})
+	defer func() { _ = client.Close() }()
+
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	var states []CircuitState
+	fallback := NewFallback(FallbackConfig{FailureThreshold: 1, OpenTimeout: time.Minute,
+		OnStateChange: func(_, to CircuitState) { states = append(states, to) }})
+	sms := &fakeSMSSender{}
+	svc := NewOTPService[MobileCode](mobileTestConfig(1, 1), client, sms, WithRedisFallback[MobileCode](fallback))
+	gen := NewTestCodeGenerator("666666")
+
+	// Redis is down: the first failure opens the circuit and the send is kept in memory.
+	m.SetError("ERR unavailable")
+	code, _ := gen.NewMobileCode("LOGIN", 1, "13800000000", "86")
+	seq, err := svc.Send(ctx, code)
+	require.NoError(t, err)
+	assert.Equal(t, CircuitOpen, fallback.State())
+	code, _ = gen.NewMobileCode("LOGIN", 1, "13800000000", "86")
+	_, err = svc.Send(ctx, code)
+	assert.ErrorIs(t, err, ErrMobileSendLimitExceeded)
+	require.NoError(t, svc.Verify(ctx, "666666", mobileProbe(seq, "13800000000", "86")))
+
+	// The verify limit and the lockout hold in memory.
+	code, _ = gen.NewMobileCode("LOGIN", 1, "13900000000", "86")
+	locked, err := svc.Send(ctx, code)
+	require.NoError(t, err)
+	probe := mobileProbe(locked, "13900000000", "86")
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", probe), ErrCodeIncorrect)
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", probe), ErrMobileVerifyLimitExceeded)
+	assert.ErrorIs(t, svc.Verify(ctx, "666666", probe), ErrMobileVerifyLimitExceeded)
+
+	code, _ = gen.NewMobileCode("LOGIN", 1, "13700000000", "86")
+	pending, err := svc.Send(ctx, code)
+	require.NoError(t, err)
+
+	// Redis is back: the probe closes the circuit and the code kept in memory verifies.
+	m.SetError("")
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, CircuitHalfOpen, fallback.State())
+	require.NoError(t, svc.Verify(ctx, "666666", mobileProbe(pending, "13700000000", "86")))
+	assert.Equal(t, CircuitClosed, fallback.State())
+	assert.Equal(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitClosed}, states)
+	status, err := svc.GetLockoutStatus(ctx, probe)
+	require.NoError(t, err)
+	assert.True(t, status.Locked)
+	code, _ = gen.NewMobileCode("LOGIN", 1, "13600000000", "86")
+	_, err = svc.Send(ctx, code)
+	require.NoError(t, err)
+	assert.NotEmpty(t, m.Keys())
+
+	// The memory is bounded.
+	small := NewFallbackCache[MobileCode](NewCodeStore[MobileCode](client), NewFallback(FallbackConfig{
+		MaxEntries: 1, FailureThreshold: 1}))
+	m.SetError("ERR unavailable")
+	require.NoError(t, small.Set(ctx, "A", code, time.Minute))
+	assert.ErrorIs(t, small.Set(ctx, "B", code, time.Minute), ErrFallbackFull)
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"strings"
+	"unicode"
 
 	"github.com/crypto-zero/go-kit/text"
 )
@@ -13,6 +14,7 @@ type CodeGenerator interface {
 	NewMobileCode(typ CodeType, userID int64, mobile, countryCode string) (*MobileCode, error)
 	NewEmailCode(typ CodeType, userID int64, email string) (*EmailCode, error)
 	NewEcdsaCode(typ CodeType, userID int64, chain, address string) (*EcdsaCode, error)
+	NewEd25519Code(typ CodeType, userID int64, chain, address string) (*Ed25519Code, error)
 }
 
 // codeGenerator is the standard CodeGenerator implementation.
@@ -20,46 +22,120 @@ type CodeGenerator interface {
 type codeGenerator struct {
 	codeLength int
 	staticCode string // if non-empty, always return this code (for testing)
+	sequence   SequenceFunc
+	formats    map[CodeType]CodeFormat // formats per upper case CodeType
+}
+
+// Charsets of a CodeFormat.
+const (
+	CharsetDigits = "0123456789"
+	// CharsetAlphanumeric is the upper case letters and digits without the look-alikes
+	// 0, 1, I and O, so codes can be read out and typed without confusion.
+	CharsetAlphanumeric = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+)
+
+// CodeFormat is the charset and length of the codes of a CodeType.
+type CodeFormat struct {
+	Charset string // CharsetDigits when empty
+	Length  int    // The length of the generator when zero
+}
+
+// CodeNormalizer maps a typed code to the form it was generated in before it is
+// compared, see OTPConfig.Normalize.
+type CodeNormalizer func(input string) string
+
+// NormalizeAlphanumeric is the CodeNormalizer of CharsetAlphanumeric codes, it drops
+// spaces and dashes and upper cases the rest, so "ab-12 cd" matches "AB12CD".
+func NormalizeAlphanumeric(input string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, input)
+}
+
+// GeneratorOption configures a CodeGenerator.
+type GeneratorOption func(*codeGenerator)
+
+// WithSequence sets the sequence strategy, SequenceRandom by default.
+func WithSequence(f SequenceFunc) GeneratorOption {
+	return func(g *codeGenerator) { g.sequence = f }
+}
+
+// WithCodeFormat generates the codes of typ in format, e.g. 8 alphanumeric characters
+// for PAYMENT while LOGIN keeps 6 digits. Types without format use the digits and
+// length of the generator.
+func WithCodeFormat(typ CodeType, format CodeFormat) GeneratorOption {
+	return func(g *codeGenerator) {
+		if g.formats == nil {
+			g.formats = map[CodeType]CodeFormat{}
+		}
+		g.formats[CodeType(strings.ToUpper(string(typ)))] = format
+	}
+}
+
+// newGenerator applies opts to g.
+func newGenerator(g *codeGenerator, opts []GeneratorOption) CodeGenerator {
+	g.sequence = SequenceRandom
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
 }
 
 var _ CodeGenerator = (*codeGenerator)(nil)
 
 // NewCodeGenerator creates a generator that produces random numeric codes of the given length.
-func NewCodeGenerator(codeLength int) CodeGenerator {
+func NewCodeGenerator(codeLength int, opts ...GeneratorOption) CodeGenerator {
 	if codeLength <= 0 {
 		codeLength = 6
 	}
-	return &codeGenerator{codeLength: codeLength}
+	return newGenerator(&codeGenerator{codeLength: codeLength}, opts)
 }
 
 // NewTestCodeGenerator creates a generator that always produces the given fixed code.
 // Intended for testing only — do not use in production.
-func NewTestCodeGenerator(code string) CodeGenerator {
-	return &codeGenerator{codeLength: len(code), staticCode: code}
+func NewTestCodeGenerator(code string, opts ...GeneratorOption) CodeGenerator {
+	return newGenerator(&codeGenerator{codeLength: len(code), staticCode: code}, opts)
 }
 
-func (g *codeGenerator) newSequence() string {
-	b := make([]byte, 16)
+// randomHex returns n random bytes hex-encoded.
+func randomHex(n int) string {
+	b := make([]byte, n)
 	_, _ = rand.Read(b)
 	return hex.EncodeToString(b)
 }
 
-func (g *codeGenerator) newCode() (string, int32) {
+func (g *codeGenerator) newSequence() string {
+	return g.sequence()
+}
+
+// newCode returns a code of typ in its format.
+func (g *codeGenerator) newCode(typ CodeType) (string, int32) {
 	if g.staticCode != "" {
 		return g.staticCode, int32(g.codeLength)
 	}
-	return text.RandStringWithCharset(g.codeLength, "0123456789"), int32(g.codeLength)
+	format := g.formats[typ]
+	if format.Charset == "" {
+		format.Charset = CharsetDigits
+	}
+	if format.Length <= 0 {
+		format.Length = g.codeLength
+	}
+	return text.RandStringWithCharset(format.Length, format.Charset), int32(format.Length)
 }
 
 func (g *codeGenerator) newBaseCode(typ CodeType, userID int64) (Code, error) {
 	if typ == "" {
 		return Code{}, ErrCodeTypeIsEmpty
 	}
+	typ = CodeType(strings.ToUpper(string(typ)))
 	seq := g.newSequence()
-	code, clen := g.newCode()
+	code, clen := g.newCode(typ)
 	return Code{
 		UserID:     userID,
-		Type:       CodeType(strings.ToUpper(string(typ))),
+		Type:       typ,
 		Sequence:   seq,
 		CodeLength: clen,
 		Value:      code,
@@ -96,3 +172,13 @@ func (g *codeGenerator) NewEcdsaCode(
 	}
 	return NewEcdsaCode(base, chain, address)
 }
+
+func (g *codeGenerator) NewEd25519Code(
+	typ CodeType, userID int64, chain, address string,
+) (*Ed25519Code, error) {
+	base, err := g.newBaseCode(typ, userID)
+	if err != nil {
+		return nil, err
+	}
+	return NewEd25519Code(base, chain, address)
+}
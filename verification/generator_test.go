@@ -0,0 +1,37 @@
+package verification
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_CodeFormat(t *testing.T) {
+	var cfg GeneratorConfig
+	err := json.Unmarshal([]byte(`{"length":6,"formats":{
+		"payment":{"charset":"alphanumeric","length":8},"reset":{"length":4}}}`), &cfg)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	gen := cfg.Generator()
+
+	mc, err := gen.NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9]{6}$`, mc.Value)
+	mc, err = gen.NewMobileCode("PAYMENT", 1, "13800138000", "86")
+	require.NoError(t, err)
+	assert.Regexp(t, `^[2-9A-HJ-NP-Z]{8}$`, mc.Value)
+	assert.Equal(t, int32(8), mc.CodeLength)
+	ec, err := gen.NewEmailCode("reset", 1, "user@example.com")
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9]{4}$`, ec.Value)
+
+	cfg.Formats["payment"] = CodeFormatConfig{Charset: "hex"}
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+	cfg.Formats["payment"] = CodeFormatConfig{Length: 20}
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+	cfg.Formats["payment"] = CodeFormatConfig{}
+	cfg.Length = 3
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+}
@@ -0,0 +1,58 @@
+package verification
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Rate limit response headers.
+const (
+	HeaderRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderRateLimitReset     = "X-RateLimit-Reset" // Seconds until the window resets
+	HeaderRetryAfter         = "Retry-After"
+)
+
+// RateLimitHeaders returns the X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset headers of d, and Retry-After when d denied the action, so HTTP APIs
+// surface the limiter state consistently.
+func RateLimitHeaders(d *LimitDecision) http.Header {
+	h := http.Header{}
+	h.Set(HeaderRateLimitLimit, strconv.FormatInt(d.Limit, 10))
+	h.Set(HeaderRateLimitRemaining, strconv.FormatInt(max(d.Limit-d.Current, 0), 10))
+	h.Set(HeaderRateLimitReset, headerSeconds(d.RetryIn))
+	if !d.Allowed {
+		h.Set(HeaderRetryAfter, headerSeconds(d.RetryIn))
+	}
+	return h
+}
+
+// RateLimitErrorHeaders returns the Retry-After header of the *RateLimitError in the
+// chain of err, and nil when there is none.
+func RateLimitErrorHeaders(err error) http.Header {
+	var rle *RateLimitError
+	if !errors.As(err, &rle) {
+		return nil
+	}
+	h := http.Header{}
+	h.Set(HeaderRetryAfter, headerSeconds(rle.RetryIn))
+	return h
+}
+
+// SetRateLimitHeaders sets the RateLimitHeaders of d on h.
+func SetRateLimitHeaders(h http.Header, d *LimitDecision) {
+	for k, v := range RateLimitHeaders(d) {
+		h[k] = v
+	}
+}
+
+// headerSeconds formats d in whole seconds rounded up, as HTTP delays are integers and
+// rounding down would invite retries before the limit resets.
+func headerSeconds(d time.Duration) string {
+	if d <= 0 {
+		return "0"
+	}
+	return strconv.FormatInt(int64((d+time.Second-1)/time.Second), 10)
+}
@@ -0,0 +1,25 @@
+package verification
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerification_RateLimitHeaders(t *testing.T) {
+	h := RateLimitHeaders(&LimitDecision{Allowed: true, Limit: 5, Current: 2, RetryIn: 1500 * time.Millisecond})
+	assert.Equal(t, http.Header{"X-Ratelimit-Limit": {"5"}, "X-Ratelimit-Remaining": {"3"},
+		"X-Ratelimit-Reset": {"2"}}, h)
+
+	h = http.Header{}
+	SetRateLimitHeaders(h, &LimitDecision{Limit: 5, Current: 6, RetryIn: time.Minute})
+	assert.Equal(t, "0", h.Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "60", h.Get(HeaderRetryAfter))
+
+	err := fmt.Errorf("send: %w", &RateLimitError{Err: ErrMobileSendLimitExceeded, RetryIn: 30 * time.Second})
+	assert.Equal(t, "30", RateLimitErrorHeaders(err).Get(HeaderRetryAfter))
+	assert.Nil(t, RateLimitErrorHeaders(ErrCodeIncorrect))
+}
@@ -1,10 +1,24 @@
 package verification
 
-import "strings"
+import (
+	"strconv"
+	"strings"
+)
 
 // CodeCacheKeyPrefix represents a verification code cache key prefix.
 type CodeCacheKeyPrefix string
 
+// Versioned returns the prefix with a version segment, e.g. "APP:v2" for version 2, so
+// a changed key schema starts in a key space of its own. Versions below 1 return the
+// prefix unchanged. See OTPConfig.PreviousPrefix to keep the codes in flight verifying
+// during the rollout.
+func (p CodeCacheKeyPrefix) Versioned(version int) CodeCacheKeyPrefix {
+	if version < 1 {
+		return p
+	}
+	return CodeCacheKeyPrefix(string(p) + ":v" + strconv.Itoa(version))
+}
+
 // CacheKeyBuilder constructs Redis keys with a consistent prefix and format.
 type CacheKeyBuilder struct {
 	prefix CodeCacheKeyPrefix
@@ -30,7 +44,81 @@ func (b *CacheKeyBuilder) LimitKey(medium string, typ CodeType, parts ...string)
 	return b.buildKey("VERIFICATION_SEND_LIMIT", medium, typ, parts...)
 }
 
+// DeviceLimitKey builds a per-device send-rate-limit key, the fingerprint is hashed to
+// bound the key length.
+func (b *CacheKeyBuilder) DeviceLimitKey(typ CodeType, device string) string {
+	return strings.Join([]string{string(b.prefix), "VERIFICATION_DEVICE_SEND_LIMIT", strings.ToUpper(string(typ)),
+		hashCode(device)}, ":")
+}
+
+// UserLimitKey builds a per-user send-rate-limit key.
+func (b *CacheKeyBuilder) UserLimitKey(typ CodeType, userID int64) string {
+	return strings.Join([]string{string(b.prefix), "VERIFICATION_USER_SEND_LIMIT", strings.ToUpper(string(typ)),
+		strconv.FormatInt(userID, 10)}, ":")
+}
+
+// IPLimitKey builds a per-IP send-rate-limit key.
+func (b *CacheKeyBuilder) IPLimitKey(typ CodeType, ip string) string {
+	return strings.Join([]string{string(b.prefix), "VERIFICATION_IP_SEND_LIMIT", strings.ToUpper(string(typ)), ip}, ":")
+}
+
+// QuotaKey builds a per code type send quota key, the quota appends the day.
+func (b *CacheKeyBuilder) QuotaKey(medium string, typ CodeType) string {
+	return b.buildKey("VERIFICATION_SEND_QUOTA", medium, typ)
+}
+
+// ResendKey builds a per-sequence resend cooldown key.
+func (b *CacheKeyBuilder) ResendKey(medium string, typ CodeType, parts ...string) string {
+	return b.buildKey("VERIFICATION_RESEND", medium, typ, parts...)
+}
+
+// LatestKey builds the key pointing to the latest code of a target.
+func (b *CacheKeyBuilder) LatestKey(medium string, typ CodeType, parts ...string) string {
+	return b.buildKey("VERIFICATION_LATEST", medium, typ, parts...)
+}
+
+// RecentKey builds the key listing the most recent codes of a target, see
+// OTPConfig.MaxValidCodes.
+func (b *CacheKeyBuilder) RecentKey(medium string, typ CodeType, parts ...string) string {
+	return b.buildKey("VERIFICATION_RECENT", medium, typ, parts...)
+}
+
+// IdempotencyKey builds a send idempotency record key.
+func (b *CacheKeyBuilder) IdempotencyKey(medium string, typ CodeType, parts ...string) string {
+	return b.buildKey("VERIFICATION_IDEMPOTENCY", medium, typ, parts...)
+}
+
 // IncorrectKey builds a verification-incorrect-count key.
 func (b *CacheKeyBuilder) IncorrectKey(medium string, typ CodeType, parts ...string) string {
 	return b.buildKey("VERIFICATION_FAILURE", medium, typ, parts...)
 }
+
+// LockoutKey builds the lockout record key of a sequence.
+func (b *CacheKeyBuilder) LockoutKey(medium string, typ CodeType, parts ...string) string {
+	return b.buildKey("VERIFICATION_LOCKOUT", medium, typ, parts...)
+}
+
+// QRKey builds the key of a QR challenge.
+func (b *CacheKeyBuilder) QRKey(typ CodeType, sequence string) string {
+	return strings.Join([]string{string(b.prefix), "VERIFICATION_QR", string(typ), sequence}, ":")
+}
+
+// ShapeKey builds a channel-wide send shaping key.
+func (b *CacheKeyBuilder) ShapeKey(medium string) string {
+	return strings.Join([]string{string(b.prefix), "VERIFICATION_SEND_SHAPE", medium}, ":")
+}
+
+// BlockKey builds the key of the block list entries of a kind.
+func (b *CacheKeyBuilder) BlockKey(kind string) string {
+	return strings.Join([]string{string(b.prefix), "VERIFICATION_BLOCK", kind}, ":")
+}
+
+// DeliveryKey builds the delivery record key of a sequence.
+func (b *CacheKeyBuilder) DeliveryKey(sequence string) string {
+	return strings.Join([]string{string(b.prefix), "VERIFICATION_DELIVERY", sequence}, ":")
+}
+
+// CaptureKey returns the key of the codes captured by a DryRunSender for target.
+func (b *CacheKeyBuilder) CaptureKey(medium, target string) string {
+	return strings.Join([]string{string(b.prefix), "VERIFICATION_CAPTURE", medium, target}, ":")
+}
@@ -0,0 +1,48 @@
+// Package kratos surfaces the limiter state of the verification services in the reply
+// headers of Kratos HTTP and gRPC servers.
+package kratos
+
+import (
+	"context"
+
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+
+	"github.com/crypto-zero/go-biz/verification"
+)
+
+// decisionKey is the context key of the decision reported by a handler.
+type decisionKey struct{}
+
+// ReportDecision attaches d to the reply of the request of ctx, the RateLimitHeaders
+// middleware sets its X-RateLimit headers. It does nothing outside the middleware.
+func ReportDecision(ctx context.Context, d *verification.LimitDecision) {
+	if p, ok := ctx.Value(decisionKey{}).(**verification.LimitDecision); ok {
+		*p = d
+	}
+}
+
+// RateLimitHeaders returns a middleware setting the reply headers of the decision a
+// handler reported with ReportDecision, and Retry-After on replies failing with a
+// *verification.RateLimitError, e.g. ErrMobileSendLimitExceeded from OTPService.Send.
+func RateLimitHeaders() middleware.Middleware {
+	return func(next middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			var d *verification.LimitDecision
+			reply, err := next(context.WithValue(ctx, decisionKey{}, &d), req)
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return reply, err
+			}
+			if d != nil {
+				for k, v := range verification.RateLimitHeaders(d) {
+					tr.ReplyHeader().Set(k, v[0])
+				}
+			}
+			for k, v := range verification.RateLimitErrorHeaders(err) {
+				tr.ReplyHeader().Set(k, v[0])
+			}
+			return reply, err
+		}
+	}
+}
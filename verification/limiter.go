@@ -2,7 +2,9 @@ package verification
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -40,18 +42,186 @@ end
 return val
 `)
 
-// RateLimiterConfig holds the fixed-window rate limiter policy.
+// slidingAllowScript atomically trims a sliding log to the window and records the
+// action when fewer than limit actions remain in it.
+var slidingAllowScript = redis.NewScript(`
+local key       = KEYS[1]
+local limit     = tonumber(ARGV[1])
+local window_ms = tonumber(ARGV[2])
+local now_ms    = tonumber(ARGV[3])
+local member    = ARGV[4]
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now_ms - window_ms)
+local current = redis.call('ZCARD', key)
+
+local allowed = 0
+if current < limit then
+  redis.call('ZADD', key, now_ms, member)
+  current = current + 1
+  allowed = 1
+end
+redis.call('PEXPIRE', key, window_ms)
+
+local retry_ms = 0
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+if oldest[2] then
+  retry_ms = tonumber(oldest[2]) + window_ms - now_ms
+end
+
+return {allowed, current, limit, retry_ms}
+`)
+
+// tokenBucketAllowScript atomically refills a token bucket by the elapsed time and
+// takes one token when available.
+var tokenBucketAllowScript = redis.NewScript(`
+local key    = KEYS[1]
+local burst  = tonumber(ARGV[1])
+local rate   = tonumber(ARGV[2])
+local now_ms = tonumber(ARGV[3])
+
+local state  = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts     = tonumber(state[2]) or now_ms
+tokens = math.min(burst, tokens + math.max(0, now_ms - ts) * rate)
+
+local allowed  = 0
+local retry_ms = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry_ms = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HSET', key, 'tokens', tostring(tokens), 'ts', now_ms)
+redis.call('PEXPIRE', key, math.max(1, math.ceil((burst - tokens) / rate)))
+
+return {allowed, math.floor(burst - tokens), burst, retry_ms}
+`)
+
+// tokenBucketUndoScript atomically returns a token to the bucket, capped at burst.
+var tokenBucketUndoScript = redis.NewScript(`
+local tokens = tonumber(redis.call('HGET', KEYS[1], 'tokens'))
+if tokens then
+  redis.call('HSET', KEYS[1], 'tokens', tostring(math.min(tonumber(ARGV[1]), tokens + 1)))
+end
+return 0
+`)
+
+// tiersAllowScript atomically evaluates fixed-window counters of several tiers. It
+// records the action in every tier only when none is exhausted, and returns the tier
+// that tripped, or the tier with the fewest remaining actions when allowed.
+var tiersAllowScript = redis.NewScript(`
+local tripped, retry_ms = 0, -1
+local counts = {}
+for i = 1, #KEYS do
+  local limit  = tonumber(ARGV[2 * i - 1])
+  local window = tonumber(ARGV[2 * i])
+  counts[i] = tonumber(redis.call('GET', KEYS[i]) or '0')
+  local ttl = redis.call('PTTL', KEYS[i])
+  if ttl < 0 then
+    ttl = window
+  end
+  if counts[i] >= limit and ttl > retry_ms then
+    tripped, retry_ms = i, ttl
+  end
+end
+if tripped > 0 then
+  return {0, tripped, tonumber(ARGV[2 * tripped - 1]), counts[tripped], retry_ms}
+end
+
+local best, best_remaining, best_current, best_ttl = 1, nil, 0, 0
+for i = 1, #KEYS do
+  local limit  = tonumber(ARGV[2 * i - 1])
+  local window = tonumber(ARGV[2 * i])
+  redis.call('SET', KEYS[i], 0, 'PX', window, 'NX')
+  local current = redis.call('INCR', KEYS[i])
+  local ttl = redis.call('PTTL', KEYS[i])
+  if ttl == -1 then
+    redis.call('PEXPIRE', KEYS[i], window)
+    ttl = window
+  end
+  if best_remaining == nil or limit - current < best_remaining then
+    best, best_remaining, best_current, best_ttl = i, limit - current, current, ttl
+  end
+end
+return {1, best, tonumber(ARGV[2 * best - 1]), best_current, best_ttl}
+`)
+
+// LimiterAlgorithm is the rate limiting algorithm of a RateLimiter.
+type LimiterAlgorithm string
+
+const (
+	// AlgorithmFixedWindow counts actions per fixed window, it allows up to twice the
+	// limit across a window boundary. It is the default.
+	AlgorithmFixedWindow LimiterAlgorithm = ""
+	// AlgorithmSlidingWindow keeps a sliding log of the actions in a sorted set, the
+	// limit holds for every window-long interval.
+	AlgorithmSlidingWindow LimiterAlgorithm = "sliding_window"
+	// AlgorithmTokenBucket refills Limit tokens per Window up to Burst, each action
+	// takes one token.
+	AlgorithmTokenBucket LimiterAlgorithm = "token_bucket"
+)
+
+// RateLimiterConfig holds the rate limiter policy.
 type RateLimiterConfig struct {
-	Limit    int64         // max actions per window
-	Window   time.Duration // window duration
-	LimitErr error         // sentinel wrapped in *RateLimitError when exceeded
+	Limit     int64            // max actions per window
+	Window    time.Duration    // window duration
+	LimitErr  error            // sentinel wrapped in *RateLimitError when exceeded
+	Algorithm LimiterAlgorithm // limiting algorithm, fixed window by default
+	Burst     int64            // token bucket capacity, defaults to Limit
+	Tiers     []LimitTier      // extra fixed-window tiers, e.g. 5/hour and 10/day on top of 1/min
+}
+
+// LimitTier is a single fixed-window limit of a multi-tier policy.
+type LimitTier struct {
+	Limit  int64         // max actions per window
+	Window time.Duration // window duration
+}
+
+// LimitDecision is the outcome of evaluating a multi-tier policy.
+type LimitDecision struct {
+	Allowed bool          // whether the action was recorded
+	Tier    int           // index of the tier that tripped, or with the fewest remaining actions
+	Limit   int64         // limit of Tier
+	Current int64         // actions recorded in the window of Tier
+	RetryIn time.Duration // time until the window of Tier resets
+
+	member string // sliding log member of the recorded action, see RateLimiter.UndoDecision
+}
+
+// tiers returns the primary limit followed by the extra tiers.
+func (c RateLimiterConfig) tiers() []LimitTier {
+	return append([]LimitTier{{Limit: c.Limit, Window: c.Window}}, c.Tiers...)
+}
+
+// tierKey returns the counter key of a tier, the primary tier keeps the plain key.
+func tierKey(key string, i int, tier LimitTier) string {
+	if i == 0 {
+		return key
+	}
+	return fmt.Sprintf("%s:%d", key, tier.Window.Milliseconds())
+}
+
+// burst returns the token bucket capacity.
+func (c RateLimiterConfig) burst() int64 {
+	if c.Burst > 0 {
+		return c.Burst
+	}
+	return c.Limit
 }
 
-// RateLimiter provides fixed-window rate limiting backed by Redis.
+// refillRate returns the token bucket refill rate in tokens per millisecond.
+func (c RateLimiterConfig) refillRate() float64 {
+	return float64(c.Limit) / float64(c.Window.Milliseconds())
+}
+
+// RateLimiter provides rate limiting backed by Redis.
 // Configuration is bound at construction time.
 type RateLimiter struct {
-	client redis.UniversalClient
-	cfg    RateLimiterConfig
+	client   redis.UniversalClient
+	cfg      RateLimiterConfig
+	fallback *Fallback // Counts in memory while Redis is down, optional
 }
 
 // NewRateLimiter creates a RateLimiter with the given policy.
@@ -59,25 +229,275 @@ func NewRateLimiter(client redis.UniversalClient, cfg RateLimiterConfig) *RateLi
 	return &RateLimiter{client: client, cfg: cfg}
 }
 
-// Allow increments the counter for key.
+// Allow records an action for key.
 // Returns nil if allowed, *RateLimitError if exceeded, or an error on failure.
 func (l *RateLimiter) Allow(ctx context.Context, key string) error {
-	res, err := allowScript.Run(ctx, l.client, []string{key}, l.cfg.Limit, l.cfg.Window.Milliseconds()).Int64Slice()
+	_, err := l.allow(ctx, key)
+	return err
+}
+
+// Decide records an action for key like Allow, and returns the decision with the
+// actions counted in the window, e.g. to report the remaining attempts. For the token
+// bucket Current is the number of tokens taken.
+func (l *RateLimiter) Decide(ctx context.Context, key string) (*LimitDecision, error) {
+	if l.fallback == nil {
+		return l.decide(ctx, key)
+	}
+	var d *LimitDecision
+	err := l.fallback.do(func() error {
+		var err error
+		d, err = l.decide(ctx, key)
+		return err
+	}, func() error {
+		var err error
+		d, err = l.fallback.decide(key, l.cfg)
+		return err
+	})
+	return d, err
+}
+
+// decide is Decide on Redis.
+func (l *RateLimiter) decide(ctx context.Context, key string) (*LimitDecision, error) {
+	if len(l.cfg.Tiers) > 0 {
+		return l.AllowTiers(ctx, key, l.cfg.tiers())
+	}
+	var (
+		res    []int64
+		err    error
+		member string
+	)
+	switch l.cfg.Algorithm {
+	case AlgorithmSlidingWindow:
+		now := timeNow()
+		member = fmt.Sprintf("%d-%s", now.UnixNano(), randomHex(8))
+		res, err = slidingAllowScript.Run(ctx, l.client, []string{key},
+			l.cfg.Limit, l.cfg.Window.Milliseconds(), now.UnixMilli(), member).Int64Slice()
+	case AlgorithmTokenBucket:
+		res, err = tokenBucketAllowScript.Run(ctx, l.client, []string{key},
+			l.cfg.burst(), l.cfg.refillRate(), timeNow().UnixMilli()).Int64Slice()
+	default:
+		res, err = allowScript.Run(ctx, l.client, []string{key},
+			l.cfg.Limit, l.cfg.Window.Milliseconds()).Int64Slice()
+	}
 	if err != nil {
-		return fmt.Errorf("limiter: %w", err)
+		return nil, fmt.Errorf("limiter: %w", err)
 	}
-	if res[0] != 1 {
-		return &RateLimitError{Err: l.cfg.LimitErr, RetryIn: time.Duration(res[3]) * time.Millisecond}
+	return &LimitDecision{
+		Allowed: res[0] == 1,
+		Limit:   res[2],
+		Current: res[1],
+		RetryIn: time.Duration(res[3]) * time.Millisecond,
+		member:  member,
+	}, nil
+}
+
+// AllowTiers evaluates the fixed-window tiers for key in one round trip. The action is
+// recorded in every tier only when none of them is exhausted, and the decision reports
+// the most restrictive tier. The tier counters are separate keys, on a Redis Cluster
+// key must carry a hash tag.
+func (l *RateLimiter) AllowTiers(ctx context.Context, key string, tiers []LimitTier) (*LimitDecision, error) {
+	keys := make([]string, len(tiers))
+	args := make([]any, 0, 2*len(tiers))
+	for i, tier := range tiers {
+		keys[i] = tierKey(key, i, tier)
+		args = append(args, tier.Limit, tier.Window.Milliseconds())
 	}
-	return nil
+	res, err := tiersAllowScript.Run(ctx, l.client, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("limiter: %w", err)
+	}
+	return &LimitDecision{
+		Allowed: res[0] == 1,
+		Tier:    int(res[1]) - 1,
+		Limit:   res[2],
+		Current: res[3],
+		RetryIn: time.Duration(res[4]) * time.Millisecond,
+	}, nil
+}
+
+// allow is Allow returning the function undoing the recorded action with UndoDecision.
+func (l *RateLimiter) allow(ctx context.Context, key string) (func(), error) {
+	d, err := l.Decide(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !d.Allowed {
+		return nil, &RateLimitError{Err: l.cfg.LimitErr, RetryIn: d.RetryIn}
+	}
+	return func() { _ = l.UndoDecision(ctx, key, d) }, nil
 }
 
-// Undo decrements the counter (e.g. to reverse a failed send attempt).
+// UndoDecision reverses the action recorded by the decision d of Decide. The sliding
+// window removes the entry of d, concurrent actions for key stay recorded.
+func (l *RateLimiter) UndoDecision(ctx context.Context, key string, d *LimitDecision) error {
+	if d.member == "" {
+		return l.Undo(ctx, key)
+	}
+	undo := func() error { return l.client.ZRem(ctx, key, d.member).Err() }
+	if l.fallback == nil {
+		return undo()
+	}
+	return l.fallback.do(undo, func() error {
+		l.fallback.undo(key, l.cfg)
+		return nil
+	})
+}
+
+// Undo reverses the last recorded action (e.g. a failed send attempt). The sliding
+// window removes its most recent entry, which may be of a concurrent action, prefer
+// UndoDecision.
 func (l *RateLimiter) Undo(ctx context.Context, key string) error {
+	if l.fallback == nil {
+		return l.undo(ctx, key)
+	}
+	return l.fallback.do(func() error { return l.undo(ctx, key) }, func() error {
+		l.fallback.undo(key, l.cfg)
+		return nil
+	})
+}
+
+// undo is Undo on Redis.
+func (l *RateLimiter) undo(ctx context.Context, key string) error {
+	if len(l.cfg.Tiers) > 0 {
+		for i, tier := range l.cfg.tiers() {
+			if err := undoScript.Run(ctx, l.client, []string{tierKey(key, i, tier)}).Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	switch l.cfg.Algorithm {
+	case AlgorithmSlidingWindow:
+		return l.client.ZPopMax(ctx, key).Err()
+	case AlgorithmTokenBucket:
+		return tokenBucketUndoScript.Run(ctx, l.client, []string{key}, l.cfg.burst()).Err()
+	}
 	return undoScript.Run(ctx, l.client, []string{key}).Err()
 }
 
+// Used returns the actions counted for key in the current window of the primary limit
+// without recording one, e.g. as velocity for a RiskEvaluator. For the token bucket it
+// is the number of tokens taken after the refill.
+func (l *RateLimiter) Used(ctx context.Context, key string) (int64, error) {
+	var (
+		n   int64
+		err error
+	)
+	switch {
+	case len(l.cfg.Tiers) == 0 && l.cfg.Algorithm == AlgorithmSlidingWindow:
+		now := timeNow().UnixMilli()
+		n, err = l.client.ZCount(ctx, key, "("+strconv.FormatInt(now-l.cfg.Window.Milliseconds(), 10), "+inf").Result()
+	case len(l.cfg.Tiers) == 0 && l.cfg.Algorithm == AlgorithmTokenBucket:
+		var state []any
+		state, err = l.client.HMGet(ctx, key, "tokens", "ts").Result()
+		if err == nil && state[0] != nil && state[1] != nil {
+			tokens, _ := strconv.ParseFloat(state[0].(string), 64)
+			ts, _ := strconv.ParseInt(state[1].(string), 10, 64)
+			burst := float64(l.cfg.burst())
+			tokens = min(burst, tokens+float64(max(0, timeNow().UnixMilli()-ts))*l.cfg.refillRate())
+			n = int64(burst - tokens)
+		}
+	default:
+		n, err = l.client.Get(ctx, key).Int64()
+		if errors.Is(err, redis.Nil) {
+			n, err = 0, nil
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("limiter: %w", err)
+	}
+	return n, nil
+}
+
+// LimitState is the state of a tier of a policy for a key, see RateLimiter.State.
+type LimitState struct {
+	Limit     int64         `json:"limit"`
+	Window    time.Duration `json:"window"`
+	Current   int64         `json:"current"`   // Actions counted in the window, tokens taken for the token bucket
+	Remaining int64         `json:"remaining"` // Actions allowed before the tier trips
+	// ResetIn is the time until the window resets, until the oldest action leaves the
+	// sliding window, or until the token bucket is full again. Zero without actions.
+	ResetIn time.Duration `json:"reset_in"`
+}
+
+// State returns the state of the primary limit and the extra tiers for key without
+// recording an action, e.g. for dashboards and support tools showing why a user is
+// throttled.
+func (l *RateLimiter) State(ctx context.Context, key string) ([]LimitState, error) {
+	tiers := l.cfg.tiers()
+	if len(l.cfg.Tiers) == 0 && l.cfg.Algorithm != AlgorithmFixedWindow {
+		tiers = tiers[:1]
+	}
+	states := make([]LimitState, len(tiers))
+	for i, tier := range tiers {
+		states[i] = LimitState{Limit: tier.Limit, Window: tier.Window}
+	}
+	now := timeNow().UnixMilli()
+	pipe := l.client.Pipeline()
+	ttls := make([]*redis.DurationCmd, len(tiers))
+	var (
+		counts []*redis.StringCmd
+		oldest *redis.ZSliceCmd
+		window *redis.IntCmd
+		bucket *redis.SliceCmd
+	)
+	switch {
+	case len(tiers) == 1 && l.cfg.Algorithm == AlgorithmSlidingWindow:
+		from := "(" + strconv.FormatInt(now-l.cfg.Window.Milliseconds(), 10)
+		window = pipe.ZCount(ctx, key, from, "+inf")
+		oldest = pipe.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: from, Max: "+inf", Count: 1})
+	case len(tiers) == 1 && l.cfg.Algorithm == AlgorithmTokenBucket:
+		states[0].Limit = l.cfg.burst()
+		bucket = pipe.HMGet(ctx, key, "tokens", "ts")
+		ttls[0] = pipe.PTTL(ctx, key)
+	default:
+		for i, tier := range tiers {
+			counts = append(counts, pipe.Get(ctx, tierKey(key, i, tier)))
+			ttls[i] = pipe.PTTL(ctx, tierKey(key, i, tier))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("limiter: %w", err)
+	}
+
+	switch {
+	case window != nil:
+		states[0].Current = window.Val()
+		if zs := oldest.Val(); len(zs) > 0 {
+			states[0].ResetIn = time.Duration(int64(zs[0].Score)+l.cfg.Window.Milliseconds()-now) * time.Millisecond
+		}
+	case bucket != nil:
+		if v := bucket.Val(); len(v) == 2 && v[0] != nil && v[1] != nil {
+			tokens, _ := strconv.ParseFloat(v[0].(string), 64)
+			ts, _ := strconv.ParseInt(v[1].(string), 10, 64)
+			burst := float64(l.cfg.burst())
+			tokens = min(burst, tokens+float64(max(0, now-ts))*l.cfg.refillRate())
+			states[0].Current = int64(burst - tokens)
+			states[0].ResetIn = max(ttls[0].Val(), 0)
+		}
+	default:
+		for i, cmd := range counts {
+			states[i].Current, _ = cmd.Int64()
+			if states[i].Current > 0 {
+				states[i].ResetIn = max(ttls[i].Val(), 0)
+			}
+		}
+	}
+	for i := range states {
+		states[i].Remaining = max(states[i].Limit-states[i].Current, 0)
+	}
+	return states, nil
+}
+
 // Reset removes the counter key entirely.
 func (l *RateLimiter) Reset(ctx context.Context, key string) error {
-	return l.client.Del(ctx, key).Err()
+	keys := []string{key}
+	for i, tier := range l.cfg.Tiers {
+		keys = append(keys, tierKey(key, i+1, tier))
+	}
+	if l.fallback == nil {
+		return l.client.Del(ctx, keys...).Err()
+	}
+	l.fallback.reset(key, l.cfg)
+	return l.fallback.do(func() error { return l.client.Del(ctx, keys...).Err() }, func() error { return nil })
 }
@@ -0,0 +1,305 @@
+package verification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_RateLimiter_SlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	limiter := NewRateLimiter(client, RateLimiterConfig{
+		Limit: 2, Window: time.Minute, LimitErr: ErrMobileSendLimitExceeded, Algorithm: AlgorithmSlidingWindow,
+	})
+	require.NoError(t, limiter.Allow(ctx, "SLIDING"))
+	now = now.Add(40 * time.Second)
+	require.NoError(t, limiter.Allow(ctx, "SLIDING"))
+
+	// A fixed window would have reset here, the sliding window still holds both actions.
+	now = now.Add(10 * time.Second)
+	err := limiter.Allow(ctx, "SLIDING")
+	var rlErr *RateLimitError
+	require.ErrorAs(t, err, &rlErr)
+	assert.ErrorIs(t, err, ErrMobileSendLimitExceeded)
+	assert.Equal(t, 10*time.Second, rlErr.RetryIn)
+
+	// The first action leaves the window.
+	now = now.Add(11 * time.Second)
+	require.NoError(t, limiter.Allow(ctx, "SLIDING"))
+
+	// Undo frees the slot of the last action.
+	require.Error(t, limiter.Allow(ctx, "SLIDING"))
+	require.NoError(t, limiter.Undo(ctx, "SLIDING"))
+	require.NoError(t, limiter.Allow(ctx, "SLIDING"))
+
+	// UndoDecision frees the slot of its own action, not of a later one.
+	now = now.Add(2 * time.Minute)
+	first, err := limiter.Decide(ctx, "SLIDING")
+	require.NoError(t, err)
+	now = now.Add(time.Second)
+	_, err = limiter.Decide(ctx, "SLIDING")
+	require.NoError(t, err)
+	require.NoError(t, limiter.UndoDecision(ctx, "SLIDING", first))
+	states, err := limiter.State(ctx, "SLIDING")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), states[0].Current)
+	assert.Equal(t, time.Minute, states[0].ResetIn)
+}
+
+func TestVerification_RateLimiter_TokenBucket(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	// One token per 10 seconds, bursts of up to 3.
+	limiter := NewRateLimiter(client, RateLimiterConfig{
+		Limit: 6, Window: time.Minute, Burst: 3, LimitErr: ErrMobileSendLimitExceeded,
+		Algorithm: AlgorithmTokenBucket,
+	})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.Allow(ctx, "BUCKET"))
+	}
+	err := limiter.Allow(ctx, "BUCKET")
+	var rlErr *RateLimitError
+	require.ErrorAs(t, err, &rlErr)
+	assert.ErrorIs(t, err, ErrMobileSendLimitExceeded)
+	assert.Equal(t, 10*time.Second, rlErr.RetryIn)
+
+	// A single token is refilled.
+	now = now.Add(10 * time.Second)
+	require.NoError(t, limiter.Allow(ctx, "BUCKET"))
+	require.Error(t, limiter.Allow(ctx, "BUCKET"))
+
+	// Undo returns the token.
+	require.NoError(t, limiter.Undo(ctx, "BUCKET"))
+	require.NoError(t, limiter.Allow(ctx, "BUCKET"))
+
+	// The bucket never holds more than burst tokens.
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.Allow(ctx, "BUCKET"))
+	}
+	require.Error(t, limiter.Allow(ctx, "BUCKET"))
+}
+
+func TestVerification_RateLimiter_Tiers(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, ff := getRedisClient(t)
+	defer cleanup()
+
+	// 1/min and 2/hour.
+	limiter := NewRateLimiter(client, RateLimiterConfig{
+		Limit: 1, Window: time.Minute, LimitErr: ErrMobileSendLimitExceeded,
+		Tiers: []LimitTier{{Limit: 2, Window: time.Hour}},
+	})
+	require.NoError(t, limiter.Allow(ctx, "TIERS"))
+
+	err := limiter.Allow(ctx, "TIERS")
+	var rlErr *RateLimitError
+	require.ErrorAs(t, err, &rlErr)
+	assert.ErrorIs(t, err, ErrMobileSendLimitExceeded)
+	assert.Equal(t, time.Minute, rlErr.RetryIn)
+
+	ff(time.Minute + time.Second)
+	require.NoError(t, limiter.Allow(ctx, "TIERS"))
+
+	// The minute tier resets, the hour tier trips.
+	ff(time.Minute + time.Second)
+	require.ErrorAs(t, limiter.Allow(ctx, "TIERS"), &rlErr)
+	assert.Equal(t, time.Hour-2*(time.Minute+time.Second), rlErr.RetryIn)
+
+	// Undo frees the last action in every tier.
+	require.NoError(t, limiter.Undo(ctx, "TIERS"))
+	require.NoError(t, limiter.Allow(ctx, "TIERS"))
+
+	// AllowTiers reports the tier with the fewest remaining actions.
+	require.NoError(t, limiter.Reset(ctx, "TIERS"))
+	d, err := limiter.AllowTiers(ctx, "TIERS", []LimitTier{
+		{Limit: 5, Window: time.Minute}, {Limit: 2, Window: time.Hour}, {Limit: 10, Window: 24 * time.Hour},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &LimitDecision{Allowed: true, Tier: 1, Limit: 2, Current: 1, RetryIn: time.Hour}, d)
+}
+
+func TestVerification_Service_SendByIP(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	cfg := mobileTestConfig(1, 10)
+	cfg.SendByIP = RateLimiterConfig{Limit: 2, Window: time.Hour, LimitErr: ErrIPSendLimitExceeded}
+	gen := NewTestCodeGenerator("666666")
+	svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+
+	send := func(mobile string, opts ...SendOption) error {
+		mc, err := gen.NewMobileCode("login", 1, mobile, "86")
+		require.NoError(t, err)
+		_, err = svc.Send(ctx, mc, opts...)
+		return err
+	}
+	require.NoError(t, send("13800138001", WithIP("1.2.3.4")))
+
+	// A target limit rejection does not consume the IP limit.
+	assert.ErrorIs(t, send("13800138001", WithIP("1.2.3.4")), ErrMobileSendLimitExceeded)
+	require.NoError(t, send("13800138002", WithIP("1.2.3.4")))
+
+	// The IP cannot enumerate more targets, other IPs and sends without an IP can.
+	assert.ErrorIs(t, send("13800138003", WithIP("1.2.3.4")), ErrIPSendLimitExceeded)
+	require.NoError(t, send("13800138003", WithIP("5.6.7.8")))
+	require.NoError(t, send("13800138004"))
+
+	keys := NewCacheKeyBuilder("TEST")
+	assert.Equal(t, "TEST:VERIFICATION_IP_SEND_LIMIT:LOGIN:1.2.3.4", keys.IPLimitKey("login", "1.2.3.4"))
+}
+
+func TestVerification_Service_SendByDevice(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	cfg := mobileTestConfig(1, 10)
+	cfg.SendByIP = RateLimiterConfig{Limit: 10, Window: time.Hour, LimitErr: ErrIPSendLimitExceeded}
+	cfg.SendByDevice = RateLimiterConfig{Limit: 2, Window: time.Hour, LimitErr: ErrDeviceSendLimitExceeded}
+	gen := NewTestCodeGenerator("666666")
+	svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+
+	send := func(mobile string, opts ...SendOption) error {
+		mc, err := gen.NewMobileCode("login", 1, mobile, "86")
+		require.NoError(t, err)
+		_, err = svc.Send(ctx, mc, opts...)
+		return err
+	}
+	require.NoError(t, send("13800138001", WithIP("1.2.3.4"), WithDevice("device-a")))
+	require.NoError(t, send("13800138002", WithIP("5.6.7.8"), WithDevice("device-a")))
+
+	// The device cannot cycle through more numbers from any IP, and the rejection
+	// refunds the IP limit.
+	assert.ErrorIs(t, send("13800138003", WithIP("1.2.3.4"), WithDevice("device-a")), ErrDeviceSendLimitExceeded)
+	require.NoError(t, send("13800138003", WithDevice("device-b")))
+	require.NoError(t, send("13800138004"))
+	n, err := client.Get(ctx, NewCacheKeyBuilder("TEST").IPLimitKey("login", "1.2.3.4")).Int()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	keys := NewCacheKeyBuilder("TEST")
+	assert.Equal(t, "TEST:VERIFICATION_DEVICE_SEND_LIMIT:LOGIN:"+hashCode("device-a"), keys.DeviceLimitKey("login", "device-a"))
+}
+
+func TestVerification_Service_SendByUser(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	cfg := mobileTestConfig(1, 10)
+	cfg.SendByDevice = RateLimiterConfig{Limit: 10, Window: time.Hour, LimitErr: ErrDeviceSendLimitExceeded}
+	cfg.SendByUser = RateLimiterConfig{Limit: 2, Window: time.Hour, LimitErr: ErrUserSendLimitExceeded}
+	gen := NewTestCodeGenerator("666666")
+	svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+
+	send := func(userID int64, mobile string) error {
+		mc, err := gen.NewMobileCode("login", userID, mobile, "86")
+		require.NoError(t, err)
+		_, err = svc.Send(ctx, mc, WithDevice("device-a"))
+		return err
+	}
+	require.NoError(t, send(7, "13800138001"))
+	require.NoError(t, send(7, "13800138002"))
+
+	// The user cannot rotate numbers, and the rejection refunds the device limit.
+	assert.ErrorIs(t, send(7, "13800138003"), ErrUserSendLimitExceeded)
+	require.NoError(t, send(8, "13800138003"))
+	require.NoError(t, send(0, "13800138004"))
+	require.NoError(t, send(0, "13800138005"))
+	keys := NewCacheKeyBuilder("TEST")
+	n, err := client.Get(ctx, keys.DeviceLimitKey("login", "device-a")).Int()
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "TEST:VERIFICATION_USER_SEND_LIMIT:LOGIN:7", keys.UserLimitKey("login", 7))
+}
+
+func TestVerification_RateLimiterUsed(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	for _, algorithm := range []LimiterAlgorithm{AlgorithmFixedWindow, AlgorithmSlidingWindow, AlgorithmTokenBucket} {
+		l := NewRateLimiter(client, RateLimiterConfig{Limit: 5, Window: time.Minute, Algorithm: algorithm})
+		key := "used:" + string(algorithm)
+		n, err := l.Used(ctx, key)
+		require.NoError(t, err)
+		assert.Zero(t, n, algorithm)
+		require.NoError(t, l.Allow(ctx, key))
+		require.NoError(t, l.Allow(ctx, key))
+		n, err = l.Used(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n, algorithm)
+	}
+}
+
+func TestVerification_LimitState(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	for _, algorithm := range []LimiterAlgorithm{AlgorithmSlidingWindow, AlgorithmTokenBucket} {
+		l := NewRateLimiter(client, RateLimiterConfig{Limit: 5, Window: time.Minute, Algorithm: algorithm})
+		key := "state:" + string(algorithm)
+		states, err := l.State(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, []LimitState{{Limit: 5, Window: time.Minute, Remaining: 5}}, states, algorithm)
+		require.NoError(t, l.Allow(ctx, key))
+		require.NoError(t, l.Allow(ctx, key))
+		states, err = l.State(ctx, key)
+		require.NoError(t, err)
+		require.Len(t, states, 1)
+		assert.Equal(t, int64(2), states[0].Current, algorithm)
+		assert.Equal(t, int64(3), states[0].Remaining, algorithm)
+		assert.Positive(t, states[0].ResetIn, algorithm)
+	}
+
+	// The service reports every send tier and the failures without recording any.
+	cfg := mobileTestConfig(1, 3)
+	cfg.Send.Tiers = []LimitTier{{Limit: 5, Window: time.Hour}}
+	svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+	mc, err := NewTestCodeGenerator("666666").NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	seq, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+	probe := mobileProbe(seq, "13800138000", "86")
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", probe), ErrCodeIncorrect)
+
+	for range 2 {
+		states, err := svc.GetSendLimitState(ctx, probe)
+		require.NoError(t, err)
+		assert.Equal(t, []LimitState{
+			{Limit: 1, Window: cfg.Send.Window, Current: 1, ResetIn: cfg.Send.Window},
+			{Limit: 5, Window: time.Hour, Current: 1, Remaining: 4, ResetIn: time.Hour},
+		}, states)
+		states, err = svc.GetVerifyLimitState(ctx, probe)
+		require.NoError(t, err)
+		assert.Equal(t, []LimitState{{Limit: 3, Window: cfg.Verify.Window, Current: 1, Remaining: 2,
+			ResetIn: cfg.Verify.Window}}, states)
+	}
+}
@@ -0,0 +1,202 @@
+package verification
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// failureCounter is a CodeCache counting the verify failures in the same operation as
+// the consume, see CodeStore.CompareAndConsume.
+type failureCounter interface {
+	CompareAndConsume(ctx context.Context, key, digest, failureKey string, limit int64,
+		window time.Duration) (ConsumeResult, error)
+}
+
+// codeIndex is a CodeCache keeping the indexes of OTPConfig.InvalidatePrevious and
+// MaxValidCodes in the same operation as the deletion of the codes, see CodeStore.Replace
+// and CodeStore.KeepRecent.
+type codeIndex interface {
+	Replace(ctx context.Context, index, key string, expire time.Duration) error
+	KeepRecent(ctx context.Context, index, key string, n int, expire time.Duration) error
+}
+
+var (
+	_ failureCounter = (*CodeStore[MobileCode])(nil)
+	_ failureCounter = (*LocalCache[MobileCode])(nil)
+	_ codeIndex      = (*CodeStore[MobileCode])(nil)
+	_ codeIndex      = (*LocalCache[MobileCode])(nil)
+)
+
+// LocalCacheConfig configures a LocalCache.
+type LocalCacheConfig struct {
+	MaxEntries int           // Codes kept in process, least recently used evicted, default 1000
+	TTL        time.Duration // Time a peeked code is served from the process, default 1s
+}
+
+// applyDefaultValue fills zero fields with defaults.
+func (c *LocalCacheConfig) applyDefaultValue() {
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = 1000
+	}
+	if c.TTL <= 0 {
+		c.TTL = time.Second
+	}
+}
+
+// localEntry is a code peeked from Redis.
+type localEntry[T VerificationCode] struct {
+	key       string
+	code      T
+	codeTTL   time.Time // When the code expires in Redis
+	expiresAt time.Time // When the entry expires in the process
+}
+
+// LocalCache[T] is a two-level CodeCache, it keeps the codes peeked from a CodeStore in
+// an in-process LRU for TTL to absorb bursts of polling, e.g. of ExpiresIn. Set, Delete
+// and Consume go to Redis and invalidate the entry. Another instance consuming the code
+// is only seen once the entry expires, keep the TTL short.
+type LocalCache[T CodeConstraint] struct {
+	next *CodeStore[T]
+	cfg  LocalCacheConfig
+
+	mu      sync.Mutex
+	lru     *list.List // Front is the most recently used
+	entries map[string]*list.Element
+}
+
+// Compile-time assertion: LocalCache implements CodeCache.
+var _ CodeCache[MobileCode] = (*LocalCache[MobileCode])(nil)
+
+// NewLocalCache creates a LocalCache in front of next.
+func NewLocalCache[T CodeConstraint](next *CodeStore[T], cfg LocalCacheConfig) *LocalCache[T] {
+	cfg.applyDefaultValue()
+	return &LocalCache[T]{next: next, cfg: cfg, lru: list.New(), entries: map[string]*list.Element{}}
+}
+
+// Len returns the number of codes kept in process, expired entries included.
+func (c *LocalCache[T]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Check implements CodeCache.
+func (c *LocalCache[T]) Check(ctx context.Context) error {
+	return c.next.Check(ctx)
+}
+
+// Set implements CodeCache.
+func (c *LocalCache[T]) Set(ctx context.Context, key string, code *T, expire time.Duration) error {
+	c.invalidate(key)
+	return c.next.Set(ctx, key, code, expire)
+}
+
+// Peek implements CodeCache.
+func (c *LocalCache[T]) Peek(ctx context.Context, key string) (*T, error) {
+	code, _, err := c.PeekWithTTL(ctx, key)
+	return code, err
+}
+
+// PeekWithTTL implements CodeCache, it serves the code from the process while the
+// entry is fresh.
+func (c *LocalCache[T]) PeekWithTTL(ctx context.Context, key string) (*T, time.Duration, error) {
+	if code, ttl, ok := c.get(key); ok {
+		return code, ttl, nil
+	}
+	code, ttl, err := c.next.PeekWithTTL(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	c.put(key, code, ttl)
+	return code, ttl, nil
+}
+
+// Delete implements CodeCache.
+func (c *LocalCache[T]) Delete(ctx context.Context, key string) (bool, error) {
+	c.invalidate(key)
+	return c.next.Delete(ctx, key)
+}
+
+// Consume implements CodeCache.
+func (c *LocalCache[T]) Consume(ctx context.Context, key, digest string) (ConsumeDecision, error) {
+	defer c.invalidate(key)
+	return c.next.Consume(ctx, key, digest)
+}
+
+// CompareAndConsume is CodeStore.CompareAndConsume invalidating the entry of key.
+func (c *LocalCache[T]) CompareAndConsume(ctx context.Context, key, digest, failureKey string,
+	limit int64, window time.Duration,
+) (ConsumeResult, error) {
+	defer c.invalidate(key)
+	return c.next.CompareAndConsume(ctx, key, digest, failureKey, limit, window)
+}
+
+// Take is CodeStore.Take invalidating the entry of key.
+func (c *LocalCache[T]) Take(ctx context.Context, key string) (*T, error) {
+	defer c.invalidate(key)
+	return c.next.Take(ctx, key)
+}
+
+// Replace is CodeStore.Replace. The entry of the deleted code is not known, it expires
+// with the TTL of the cache like the codes consumed by another instance.
+func (c *LocalCache[T]) Replace(ctx context.Context, index, key string, expire time.Duration) error {
+	return c.next.Replace(ctx, index, key, expire)
+}
+
+// KeepRecent is CodeStore.KeepRecent, the entries of the deleted codes expire like for
+// Replace.
+func (c *LocalCache[T]) KeepRecent(ctx context.Context, index, key string, n int, expire time.Duration) error {
+	return c.next.KeepRecent(ctx, index, key, n, expire)
+}
+
+// get returns a copy of the fresh code under key with its remaining validity.
+func (c *LocalCache[T]) get(key string) (*T, time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, 0, false
+	}
+	e := el.Value.(*localEntry[T])
+	now := timeNow()
+	if !now.Before(e.expiresAt) || !now.Before(e.codeTTL) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return nil, 0, false
+	}
+	c.lru.MoveToFront(el)
+	code := e.code
+	return &code, e.codeTTL.Sub(now), true
+}
+
+// put keeps a copy of code valid for ttl under key, evicting the least recently used
+// entry when full.
+func (c *LocalCache[T]) put(key string, code *T, ttl time.Duration) {
+	now := timeNow()
+	e := &localEntry[T]{key: key, code: *code, codeTTL: now.Add(ttl), expiresAt: now.Add(min(c.cfg.TTL, ttl))}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	if c.lru.Len() >= c.cfg.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*localEntry[T]).key)
+	}
+	c.entries[key] = c.lru.PushFront(e)
+}
+
+// invalidate drops the entry of key.
+func (c *LocalCache[T]) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+	}
+}
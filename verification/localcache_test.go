@@ -0,0 +1,75 @@
+package verification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_LocalCache(t *testing.T) {
+	ctx := context.Background()
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	defer func() { _ = client.Close() }()
+
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	sms := &fakeSMSSender{}
+	svc := NewOTPService[MobileCode](mobileTestConfig(5, 2), client, sms,
+		WithLocalCache[MobileCode](LocalCacheConfig{MaxEntries: 1, TTL: time.Second}))
+	cache, ok := svc.store.(*LocalCache[MobileCode])
+	require.True(t, ok)
+	gen := NewTestCodeGenerator("666666")
+
+	code, _ := gen.NewMobileCode("LOGIN", 1, "13800000000", "86")
+	seq, err := svc.Send(ctx, code)
+	require.NoError(t, err)
+	probe := mobileProbe(seq, "13800000000", "86")
+	ttl, err := svc.ExpiresIn(ctx, probe)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cache.Len())
+
+	// Peeks are served from the process until the entry expires.
+	m.FlushAll()
+	now = now.Add(500 * time.Millisecond)
+	cached, err := svc.ExpiresIn(ctx, probe)
+	require.NoError(t, err)
+	assert.Equal(t, ttl-500*time.Millisecond, cached)
+	now = now.Add(time.Second)
+	_, err = svc.ExpiresIn(ctx, probe)
+	assert.ErrorIs(t, err, ErrCodeNotFound)
+
+	// Consuming invalidates the entry, the verify failures are still counted atomically.
+	code, _ = gen.NewMobileCode("LOGIN", 1, "13800000000", "86")
+	seq, err = svc.Send(ctx, code)
+	require.NoError(t, err)
+	probe = mobileProbe(seq, "13800000000", "86")
+	_, err = svc.ExpiresIn(ctx, probe)
+	require.NoError(t, err)
+	res, err := svc.VerifyWithResult(ctx, "000000", probe)
+	assert.ErrorIs(t, err, ErrCodeIncorrect)
+	assert.Equal(t, int64(1), res.RemainingAttempts)
+	require.NoError(t, svc.Verify(ctx, "666666", probe))
+	assert.Equal(t, 0, cache.Len())
+	_, err = svc.ExpiresIn(ctx, probe)
+	assert.ErrorIs(t, err, ErrCodeNotFound)
+
+	// The least recently used entry is evicted.
+	for _, mobile := range []string{"13900000000", "13700000000"} {
+		code, _ = gen.NewMobileCode("LOGIN", 1, mobile, "86")
+		seq, err = svc.Send(ctx, code)
+		require.NoError(t, err)
+		_, err = svc.ExpiresIn(ctx, mobileProbe(seq, mobile, "86"))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, cache.Len())
+}
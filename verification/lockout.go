@@ -0,0 +1,127 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LockoutStatus is the lockout state of a sequence, see OTPService.GetLockoutStatus.
+type LockoutStatus struct {
+	Locked  bool          `json:"locked"`
+	RetryIn time.Duration `json:"retry_in"` // Time until the lockout ends
+}
+
+// GetLockoutStatus reports whether the sequence of probe, or its target with
+// VerifyByTarget, is locked after exceeding its verify limit, and for how long, e.g. to
+// tell users "locked for 14 more minutes".
+func (s *OTPService[T]) GetLockoutStatus(ctx context.Context, probe *T) (*LockoutStatus, error) {
+	ttl, err := s.lockoutTTL(ctx, probe)
+	if err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		return &LockoutStatus{}, nil
+	}
+	return &LockoutStatus{Locked: true, RetryIn: ttl}, nil
+}
+
+// lockoutKey returns the lockout record key of the sequence of probe, or of its target
+// with VerifyByTarget.
+func (s *OTPService[T]) lockoutKey(probe *T) string {
+	c := *probe
+	return s.keys.LockoutKey(c.Medium(), c.GetType(), s.failureParts(probe)...)
+}
+
+// lockoutTTL returns the remaining lockout of probe, zero when it is not locked. With a
+// Fallback a lockout recorded in memory during an outage holds after Redis is back.
+func (s *OTPService[T]) lockoutTTL(ctx context.Context, probe *T) (time.Duration, error) {
+	key := s.lockoutKey(probe)
+	var ttl time.Duration
+	pttl := func() error {
+		var err error
+		ttl, err = s.client.PTTL(ctx, key).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return fmt.Errorf("verification: redis pttl failed: %w", err)
+		}
+		return nil
+	}
+	if s.fallback == nil {
+		err := pttl()
+		return ttl, err
+	}
+	if err := s.fallback.do(pttl, func() error { ttl = 0; return nil }); err != nil {
+		return 0, err
+	}
+	return max(ttl, s.fallback.ttl(key)), nil
+}
+
+// setLockout records the lockout of probe for d.
+func (s *OTPService[T]) setLockout(ctx context.Context, probe *T, d time.Duration) error {
+	key := s.lockoutKey(probe)
+	set := func() error {
+		if err := s.client.Set(ctx, key, 1, d).Err(); err != nil {
+			return fmt.Errorf("verification: redis set failed: %w", err)
+		}
+		return nil
+	}
+	if s.fallback == nil {
+		return set()
+	}
+	return s.fallback.do(set, func() error { return s.fallback.set(key, nil, d) })
+}
+
+// failureParts returns the key parts of the verify failure counter and the lockout of
+// probe: its sequence and target, or only its target with VerifyByTarget.
+func (s *OTPService[T]) failureParts(probe *T) []string {
+	c := *probe
+	if s.cfg.VerifyByTarget {
+		return c.LimitKeyParts()
+	}
+	return c.CacheKeyParts()
+}
+
+// lockedOut returns the *RateLimitError of the limit while probe is locked, and nil
+// results otherwise.
+func (s *OTPService[T]) lockedOut(ctx context.Context, probe *T) (*VerifyResult, error) {
+	ttl, err := s.lockoutTTL(ctx, probe)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		return &VerifyResult{LockoutTTL: ttl}, &RateLimitError{Err: s.cfg.Verify.LimitErr, RetryIn: ttl}
+	}
+	return nil, nil
+}
+
+// lockout records the lockout of a verification exceeding the verify limit, and turns
+// the ErrCodeNotFound of a locked sequence, whose code was deleted, into the
+// *RateLimitError of the lockout.
+func (s *OTPService[T]) lockout(ctx context.Context, probe *T, res *VerifyResult, err error,
+) (*VerifyResult, error) {
+	var rle *RateLimitError
+	switch {
+	case errors.As(err, &rle):
+		// verifyCode returns a *RateLimitError only when the limit is exceeded.
+		d := s.cfg.LockoutDuration
+		if d <= 0 {
+			d = rle.RetryIn
+		}
+		if d <= 0 {
+			d = s.cfg.Verify.Window
+		}
+		if serr := s.setLockout(ctx, probe, d); serr != nil {
+			return res, serr
+		}
+		rle.RetryIn = d
+		return &VerifyResult{LockoutTTL: d}, err
+	case errors.Is(err, ErrCodeNotFound):
+		if lres, lerr := s.lockedOut(ctx, probe); lres != nil || lerr != nil {
+			return lres, lerr
+		}
+	}
+	return res, err
+}
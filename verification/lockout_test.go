@@ -0,0 +1,60 @@
+package verification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_Service_Lockout(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, ff := getRedisClient(t)
+	defer cleanup()
+
+	cfg := mobileTestConfig(10, 2)
+	cfg.LockoutDuration = 15 * time.Minute
+	gen := NewTestCodeGenerator("666666")
+	svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+	mc, err := gen.NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	seq, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+	probe := mobileProbe(seq, "13800138000", "86")
+
+	status, err := svc.GetLockoutStatus(ctx, probe)
+	require.NoError(t, err)
+	assert.Equal(t, &LockoutStatus{}, status)
+
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", probe), ErrCodeIncorrect)
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", probe), ErrCodeIncorrect)
+	res, err := svc.VerifyWithResult(ctx, "000000", probe)
+	var rlErr *RateLimitError
+	require.ErrorAs(t, err, &rlErr)
+	assert.Equal(t, 15*time.Minute, rlErr.RetryIn)
+	assert.Equal(t, 15*time.Minute, res.LockoutTTL)
+
+	// The locked sequence reports the lockout instead of a missing code.
+	ff(time.Minute)
+	res, err = svc.VerifyWithResult(ctx, "666666", probe)
+	require.ErrorAs(t, err, &rlErr)
+	assert.ErrorIs(t, err, ErrMobileVerifyLimitExceeded)
+	assert.Equal(t, 14*time.Minute, rlErr.RetryIn)
+	assert.Equal(t, 14*time.Minute, res.LockoutTTL)
+	status, err = svc.GetLockoutStatus(ctx, probe)
+	require.NoError(t, err)
+	assert.Equal(t, &LockoutStatus{Locked: true, RetryIn: 14 * time.Minute}, status)
+
+	state, err := NewAdminService(client, cfg).Inspect(ctx, "MOBILE", "13800138000", "86")
+	require.NoError(t, err)
+	require.Len(t, state.Lockouts, 1)
+	assert.Equal(t, seq, state.Lockouts[0].Sequence)
+
+	ff(14 * time.Minute)
+	assert.ErrorIs(t, svc.Verify(ctx, "666666", probe), ErrCodeNotFound)
+	status, err = svc.GetLockoutStatus(ctx, probe)
+	require.NoError(t, err)
+	assert.False(t, status.Locked)
+}
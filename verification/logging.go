@@ -0,0 +1,145 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// LogLevels sets the level of each class of events logged by WithLogger. A class is
+// dropped when the handler of the logger does not enable its level, e.g. Send at
+// slog.LevelDebug with the default Info handler.
+type LogLevels struct {
+	Send          slog.Level // Successful sends
+	SendFailure   slog.Level // Sends failing in Redis or at the provider
+	VerifyFailure slog.Level // Incorrect, expired or unknown codes
+	Rejection     slog.Level // Sends and verifications rejected by a limiter, quota, block list or risk control
+}
+
+// DefaultLogLevels returns Info for sends, Error for send failures and Warn for
+// verify failures and rejections.
+func DefaultLogLevels() LogLevels {
+	return LogLevels{
+		Send:          slog.LevelInfo,
+		SendFailure:   slog.LevelError,
+		VerifyFailure: slog.LevelWarn,
+		Rejection:     slog.LevelWarn,
+	}
+}
+
+// WithLogger logs the sends, verify failures and limiter rejections of the service with
+// the code type, the sequence and the masked target; the code is never logged.
+func WithLogger[T CodeConstraint](logger *slog.Logger, levels LogLevels) OTPServiceOption[T] {
+	return func(s *OTPService[T]) { s.logger, s.logLevels = logger, levels }
+}
+
+// MaskTarget returns target with its middle hidden for logs, e.g. "138****8000",
+// "a***@example.com" or "0x1234…abcd".
+func MaskTarget(target string) string {
+	if local, domain, ok := strings.Cut(target, "@"); ok {
+		if local == "" {
+			return "***@" + domain
+		}
+		return local[:1] + "***@" + domain
+	}
+	switch n := len(target); {
+	case n > 12:
+		return target[:6] + "…" + target[n-4:]
+	case n > 6:
+		return target[:3] + strings.Repeat("*", n-7) + target[n-4:]
+	}
+	return strings.Repeat("*", len(target))
+}
+
+// logAttrs returns the attributes identifying code in logs.
+func logAttrs(code any) []slog.Attr {
+	c := code.(interface {
+		Medium() string
+		GetType() CodeType
+		GetSequence() string
+	})
+	return []slog.Attr{
+		slog.String("medium", c.Medium()),
+		slog.String("type", string(c.GetType())),
+		slog.String("sequence", c.GetSequence()),
+		slog.String("target", MaskTarget(recipient(code))),
+	}
+}
+
+// observeSend records a send of code in the metrics, the listeners and the log.
+func (s *OTPService[T]) observeSend(ctx context.Context, code *T, err error, d time.Duration) {
+	result := resultOf(err)
+	s.metrics.ObserveSend((*code).Medium(), (*code).GetType(), result, d)
+	if err == nil {
+		for _, l := range s.listeners {
+			l.OnSent(ctx, newCodeEvent(code, nil))
+		}
+	}
+	if s.logger == nil || result == ResultRateLimited {
+		return // rejections are logged by rejected
+	}
+	level, msg := s.logLevels.Send, "verification code sent"
+	switch {
+	case result == ResultBlocked || result == ResultChallenged:
+		level, msg = s.logLevels.Rejection, "verification send denied"
+	case err != nil:
+		level, msg = s.logLevels.SendFailure, "verification code send failed"
+	}
+	attrs := append(logAttrs(code), slog.String("result", result), slog.Duration("duration", d))
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	s.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// observeVerify records a verification of probe in the metrics, the listeners and the log.
+func (s *OTPService[T]) observeVerify(ctx context.Context, probe *T, err error) {
+	result := resultOf(err)
+	s.metrics.ObserveVerify((*probe).Medium(), (*probe).GetType(), result)
+	if result == ResultRateLimited {
+		s.rejected(ctx, probe, "verify", err)
+		return
+	}
+	for _, l := range s.listeners {
+		if err == nil {
+			l.OnVerifySucceeded(ctx, newCodeEvent(probe, nil))
+		} else {
+			l.OnVerifyFailed(ctx, newCodeEvent(probe, err))
+		}
+	}
+	if s.logger != nil && err != nil {
+		s.logger.LogAttrs(ctx, s.logLevels.VerifyFailure, "verification code verify failed",
+			append(logAttrs(probe), slog.String("result", result), slog.String("error", err.Error()))...)
+	}
+}
+
+// invalidateFailed logs err of invalidating the codes sent before code, at the
+// SendFailure level.
+func (s *OTPService[T]) invalidateFailed(ctx context.Context, code *T, err error) {
+	if s.logger != nil {
+		s.logger.LogAttrs(ctx, s.logLevels.SendFailure, "verification previous codes invalidation failed",
+			append(logAttrs(code), slog.String("error", err.Error()))...)
+	}
+}
+
+// rejected records err of limiter in the metrics, the listeners and the log when it is
+// a rate limit rejection.
+func (s *OTPService[T]) rejected(ctx context.Context, code *T, limiter string, err error) {
+	var rle *RateLimitError
+	if !errors.As(err, &rle) {
+		return
+	}
+	s.metrics.ObserveRejection((*code).Medium(), (*code).GetType(), limiter)
+	for _, l := range s.listeners {
+		e := newCodeEvent(code, err)
+		e.Limiter = limiter
+		l.OnLimited(ctx, e)
+	}
+	if s.logger != nil {
+		s.logger.LogAttrs(ctx, s.logLevels.Rejection, "verification rate limited",
+			append(logAttrs(code), slog.String("limiter", limiter), slog.Duration("retry_in", rle.RetryIn),
+				slog.String("error", err.Error()))...)
+	}
+}
@@ -0,0 +1,58 @@
+package verification
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_Logger(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	assert.Equal(t, "138****8000", MaskTarget("13800138000"))
+	assert.Equal(t, "a***@example.com", MaskTarget("alice@example.com"))
+	assert.Equal(t, "0x71C7…976F", MaskTarget("0x71C7656EC7ab88b098defB751B7401B5f6d8976F"))
+	assert.Equal(t, "****", MaskTarget("1234"))
+
+	var buf strings.Builder
+	levels := DefaultLogLevels()
+	levels.Send = slog.LevelDebug // dropped by the Info handler
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	svc := NewOTPService[MobileCode](mobileTestConfig(1, 1), client, &fakeSMSSender{},
+		WithLogger[MobileCode](logger, levels))
+	gen := NewTestCodeGenerator("666666")
+
+	mc, err := gen.NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	seq, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+	mc, err = gen.NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	_, err = svc.Send(ctx, mc)
+	require.Error(t, err)
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", mobileProbe(seq, "13800138000", "86")), ErrCodeIncorrect)
+
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 2)
+	assert.Equal(t, "verification rate limited", entries[0]["msg"])
+	assert.Equal(t, "WARN", entries[0]["level"])
+	assert.Equal(t, "send", entries[0]["limiter"])
+	assert.Equal(t, "138****8000", entries[0]["target"])
+	assert.Equal(t, "verification code verify failed", entries[1]["msg"])
+	assert.Equal(t, seq, entries[1]["sequence"])
+	assert.Equal(t, ResultIncorrect, entries[1]["result"])
+	assert.NotContains(t, buf.String(), "666666")
+	assert.NotContains(t, buf.String(), "13800138000")
+}
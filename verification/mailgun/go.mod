@@ -0,0 +1,23 @@
+module github.com/crypto-zero/go-biz/verification/mailgun
+
+go 1.23.2
+
+toolchain go1.24.4
+
+require (
+	github.com/crypto-zero/go-biz/verification v0.0.0-20251006105426-276c489b11b7
+	github.com/google/wire v0.6.0
+	go.uber.org/fx v1.23.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/crypto-zero/go-kit v0.0.0-20250610071112-97b2f51ec745 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/redis/go-redis/v9 v9.10.0 // indirect
+	go.uber.org/dig v1.18.0 // indirect
+	go.uber.org/multierr v1.10.0 // indirect
+	go.uber.org/zap v1.27.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.26.0 // indirect
+)
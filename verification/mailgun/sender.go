@@ -0,0 +1,186 @@
+package mailgun
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/crypto-zero/go-biz/verification"
+)
+
+// Region is the Mailgun region hosting the sending domain.
+type Region string
+
+const (
+	RegionUS Region = "us"
+	RegionEU Region = "eu"
+)
+
+// baseURLs are the API endpoints of the regions.
+var baseURLs = map[Region]string{
+	RegionUS: "https://api.mailgun.net",
+	RegionEU: "https://api.eu.mailgun.net",
+}
+
+// Config holds the Mailgun API configuration, loadable from YAML or env.
+type Config struct {
+	Domain  string `json:"domain" yaml:"domain"`     // Sending domain, e.g., "mg.example.com"
+	APIKey  string `json:"api_key" yaml:"api_key"`   // Mailgun private API key
+	From    string `json:"from" yaml:"from"`         // Sender email address
+	Region  Region `json:"region" yaml:"region"`     // RegionUS (default) or RegionEU
+	BaseURL string `json:"base_url" yaml:"base_url"` // Optional API endpoint overriding Region
+	// Templates maps code types to Mailgun stored templates, rendered by Mailgun with
+	// the variables code, type, email, locale, app_name and ttl_minutes. Other types use
+	// the TemplateProvider.
+	Templates map[verification.CodeType]string `json:"templates" yaml:"templates"`
+	// Render sets {{.AppName}} and {{.TTLMinutes}} of the templates.
+	Render verification.RenderConfig `json:"render" yaml:"render"`
+}
+
+// Validate checks the domain, the API key, the sender address and the region are set.
+func (c *Config) Validate() error {
+	if c.Domain == "" || c.APIKey == "" {
+		return fmt.Errorf("%w: mailgun domain or api key is empty", verification.ErrInvalidConfig)
+	}
+	if c.From == "" {
+		return fmt.Errorf("%w: mailgun from is empty", verification.ErrInvalidConfig)
+	}
+	if _, ok := baseURLs[c.Region]; !ok && c.Region != "" {
+		return fmt.Errorf("%w: unknown mailgun region %q", verification.ErrInvalidConfig, c.Region)
+	}
+	return nil
+}
+
+// Endpoint returns the API endpoint of the config.
+func (c *Config) Endpoint() string {
+	if c.BaseURL != "" {
+		return strings.TrimSuffix(c.BaseURL, "/")
+	}
+	if c.Region == "" {
+		return baseURLs[RegionUS]
+	}
+	return baseURLs[c.Region]
+}
+
+// Sender implements CodeSender[EmailCode] using the Mailgun messages API.
+type Sender struct {
+	config    *Config
+	provider  verification.TemplateProvider[verification.EmailTemplate]
+	client    *http.Client
+	tmplCache sync.Map // map[templateKey]*verification.EmailContentTemplate
+}
+
+// templateKey identifies a cached template by code type and locale.
+type templateKey struct {
+	typ    verification.CodeType
+	locale string
+}
+
+// Compile-time assertion: Sender implements CodeSender[EmailCode].
+var _ verification.CodeSender[verification.EmailCode] = (*Sender)(nil)
+
+// NewSender creates a new Sender.
+func NewSender(config *Config, provider verification.TemplateProvider[verification.EmailTemplate]) *Sender {
+	return &Sender{
+		config:   config,
+		provider: provider,
+		client:   &http.Client{},
+	}
+}
+
+// Send sends the email verification code via Mailgun.
+func (s *Sender) Send(ctx context.Context, emailCode *verification.EmailCode) error {
+	form := url.Values{}
+	form.Set("from", s.config.From)
+	form.Set("to", emailCode.Email)
+	data := verification.NewTemplateData(emailCode, s.config.Render)
+	if name, ok := s.config.Templates[emailCode.Type]; ok {
+		vars, err := json.Marshal(map[string]any{
+			"code":        data.Code,
+			"type":        string(data.Type),
+			"email":       emailCode.Email,
+			"locale":      data.Locale,
+			"app_name":    data.AppName,
+			"ttl_minutes": data.TTLMinutes,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode mailgun template variables: %w", err)
+		}
+		form.Set("template", name)
+		form.Set("t:variables", string(vars))
+	} else {
+		ct, err := s.getTemplate(emailCode.Type, emailCode.Locale)
+		if err != nil {
+			return err
+		}
+		content, err := ct.Render(data)
+		if err != nil {
+			return err
+		}
+		// Mailgun sends both bodies as multipart/alternative.
+		form.Set("subject", content.Subject)
+		if content.HTMLBody != "" {
+			form.Set("html", content.HTMLBody)
+		}
+		if content.TextBody != "" {
+			form.Set("text", content.TextBody)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		s.config.Endpoint()+"/v3/"+url.PathEscape(s.config.Domain)+"/messages", strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("mailgun new request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return s.do(req)
+}
+
+// Check fetches the sending domain, it implements the health checker of the sender.
+func (s *Sender) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		s.config.Endpoint()+"/v3/domains/"+url.PathEscape(s.config.Domain), nil)
+	if err != nil {
+		return fmt.Errorf("mailgun new request failed: %w", err)
+	}
+	return s.do(req)
+}
+
+// do sends the authenticated request and checks the response status.
+func (s *Sender) do(req *http.Request) error {
+	req.SetBasicAuth("api", s.config.APIKey)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("mailgun request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("mailgun request failed: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// getTemplate returns a cached, pre-parsed template for the given code type and locale.
+func (s *Sender) getTemplate(typ verification.CodeType, locale string) (*verification.EmailContentTemplate, error) {
+	key := templateKey{typ: typ, locale: locale}
+	if cached, ok := s.tmplCache.Load(key); ok {
+		return cached.(*verification.EmailContentTemplate), nil
+	}
+	tmpl, err := verification.LookupTemplate(s.provider, typ, locale)
+	if err != nil {
+		return nil, err
+	}
+	ct, err := verification.ParseEmailTemplate(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email template: %w", err)
+	}
+	s.tmplCache.Store(key, ct)
+	return ct, nil
+}
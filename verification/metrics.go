@@ -0,0 +1,155 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Results reported to Metrics.
+const (
+	ResultOK          = "ok"
+	ResultRateLimited = "rate_limited" // A limiter, the quota or a cooldown rejected the request
+	ResultThrottled   = "throttled"    // The send shaper is saturated
+	ResultIncorrect   = "incorrect"    // The code did not match
+	ResultNotFound    = "not_found"    // The code expired, was consumed or never sent
+	ResultBlocked     = "blocked"      // The BlockList, the country policy or the RiskEvaluator denied it
+	ResultChallenged  = "challenged"   // The RiskEvaluator asked for a challenge
+	ResultError       = "error"
+)
+
+// Metrics receives the measurements of the verification flows. Implementations must be
+// safe for concurrent use, verification/prometheus exports them to Prometheus. The
+// package does not depend on a metrics library, a service without WithMetrics records
+// nothing.
+type Metrics interface {
+	// ObserveSend records OTPService.Send with its result and duration.
+	ObserveSend(medium string, typ CodeType, result string, d time.Duration)
+	// ObserveVerify records the result of OTPService.Verify.
+	ObserveVerify(medium string, typ CodeType, result string)
+	// ObserveRejection records a request rejected by limiter: "send", "ip", "device", "quota" or "verify".
+	ObserveRejection(medium string, typ CodeType, limiter string)
+	// ObserveProvider records a provider call made by an InstrumentedSender.
+	ObserveProvider(provider, medium, result string, d time.Duration)
+	// ObserveRedis records a Redis command, or "pipeline", of a client with NewRedisMetricsHook.
+	ObserveRedis(command, result string, d time.Duration)
+}
+
+// nopMetrics is the Metrics of services without WithMetrics.
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveSend(string, CodeType, string, time.Duration)   {}
+func (nopMetrics) ObserveVerify(string, CodeType, string)                {}
+func (nopMetrics) ObserveRejection(string, CodeType, string)             {}
+func (nopMetrics) ObserveProvider(string, string, string, time.Duration) {}
+func (nopMetrics) ObserveRedis(string, string, time.Duration)            {}
+
+// WithMetrics records the sends, verifications and limiter rejections of the service.
+func WithMetrics[T CodeConstraint](m Metrics) OTPServiceOption[T] {
+	return func(s *OTPService[T]) { s.metrics = m }
+}
+
+// resultOf returns the Metrics result of the error of a send or verification.
+func resultOf(err error) string {
+	var rle *RateLimitError
+	switch {
+	case err == nil:
+		return ResultOK
+	case errors.As(err, &rle):
+		return ResultRateLimited
+	case errors.Is(err, ErrSendThrottled):
+		return ResultThrottled
+	case errors.Is(err, ErrCodeIncorrect):
+		return ResultIncorrect
+	case errors.Is(err, ErrCodeNotFound):
+		return ResultNotFound
+	case errors.Is(err, ErrTargetBlocked), errors.Is(err, ErrCountryNotAllowed), errors.Is(err, ErrRiskDenied):
+		return ResultBlocked
+	case errors.Is(err, ErrChallengeRequired):
+		return ResultChallenged
+	}
+	return ResultError
+}
+
+// InstrumentedSender is a CodeSender recording the result and the latency of every
+// provider call, e.g. to compare the providers of a WeightedRouter.
+type InstrumentedSender[T VerificationCode] struct {
+	next     CodeSender[T]
+	provider string
+	metrics  Metrics
+}
+
+// Compile-time assertion: InstrumentedSender implements CodeSender[MobileCode].
+var _ CodeSender[MobileCode] = (*InstrumentedSender[MobileCode])(nil)
+
+// NewInstrumentedSender creates an InstrumentedSender reporting next as provider.
+func NewInstrumentedSender[T VerificationCode](next CodeSender[T], provider string, m Metrics) *InstrumentedSender[T] {
+	return &InstrumentedSender[T]{next: next, provider: provider, metrics: m}
+}
+
+// Send sends the code with the provider and records the call.
+func (s *InstrumentedSender[T]) Send(ctx context.Context, code *T) error {
+	start := time.Now()
+	err := s.next.Send(ctx, code)
+	medium, _ := codeTarget(code)
+	s.metrics.ObserveProvider(s.provider, medium, resultOf(err), time.Since(start))
+	return err
+}
+
+// Check forwards to the sender when it implements Check.
+func (s *InstrumentedSender[T]) Check(ctx context.Context) error {
+	if c, ok := s.next.(interface{ Check(context.Context) error }); ok {
+		return c.Check(ctx)
+	}
+	return nil
+}
+
+// redisMetricsHook is the redis.Hook of NewRedisMetricsHook.
+type redisMetricsHook struct {
+	metrics Metrics
+}
+
+// NewRedisMetricsHook returns a hook recording the latency of the commands of a client,
+// including the Lua scripts of the stores and limiters, add it with client.AddHook.
+func NewRedisMetricsHook(m Metrics) redis.Hook {
+	return redisMetricsHook{metrics: m}
+}
+
+// DialHook implements redis.Hook.
+func (h redisMetricsHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+// ProcessHook implements redis.Hook.
+func (h redisMetricsHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.metrics.ObserveRedis(cmd.Name(), redisResult(err), time.Since(start))
+		return err
+	}
+}
+
+// ProcessPipelineHook implements redis.Hook.
+func (h redisMetricsHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		h.metrics.ObserveRedis("pipeline", redisResult(err), time.Since(start))
+		return err
+	}
+}
+
+// redisResult returns the Metrics result of a Redis error. A missing key is no error,
+// neither is NOSCRIPT as the scripts fall back to EVAL with it.
+func redisResult(err error) string {
+	if err == nil || errors.Is(err, redis.Nil) || redis.HasErrorPrefix(err, "NOSCRIPT") {
+		return ResultOK
+	}
+	return ResultError
+}
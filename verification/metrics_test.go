@@ -0,0 +1,95 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingMetrics records the observations as "kind medium type result" strings.
+type recordingMetrics struct {
+	mu     sync.Mutex
+	events []string
+	redis  map[string]int
+}
+
+func (m *recordingMetrics) add(e string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, e)
+}
+
+func (m *recordingMetrics) ObserveSend(medium string, typ CodeType, result string, _ time.Duration) {
+	m.add("send " + medium + " " + string(typ) + " " + result)
+}
+
+func (m *recordingMetrics) ObserveVerify(medium string, typ CodeType, result string) {
+	m.add("verify " + medium + " " + string(typ) + " " + result)
+}
+
+func (m *recordingMetrics) ObserveRejection(medium string, typ CodeType, limiter string) {
+	m.add("reject " + medium + " " + string(typ) + " " + limiter)
+}
+
+func (m *recordingMetrics) ObserveProvider(provider, medium, result string, _ time.Duration) {
+	m.add("provider " + provider + " " + medium + " " + result)
+}
+
+func (m *recordingMetrics) ObserveRedis(command, result string, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.redis == nil {
+		m.redis = map[string]int{}
+	}
+	m.redis[command+" "+result]++
+}
+
+func TestVerification_Metrics(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	m := &recordingMetrics{}
+	client.AddHook(NewRedisMetricsHook(m))
+	sender := NewInstrumentedSender[MobileCode](&scriptedSMSSender{errs: []error{nil, errors.New("down")}}, "aliyun", m)
+	svc := NewOTPService[MobileCode](mobileTestConfig(1, 1), client, sender, WithMetrics[MobileCode](m))
+	gen := NewTestCodeGenerator("666666")
+
+	mc, err := gen.NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	seq, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+	mc, err = gen.NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	_, err = svc.Send(ctx, mc)
+	require.Error(t, err)
+	mc, err = gen.NewMobileCode("login", 1, "13900000000", "86")
+	require.NoError(t, err)
+	_, err = svc.Send(ctx, mc)
+	require.Error(t, err)
+
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", mobileProbe(seq, "13800138000", "86")), ErrCodeIncorrect)
+	require.Error(t, svc.Verify(ctx, "000000", mobileProbe(seq, "13800138000", "86")))
+	assert.ErrorIs(t, svc.Verify(ctx, "666666", mobileProbe(seq, "13800138000", "86")), ErrMobileVerifyLimitExceeded)
+
+	assert.Equal(t, []string{
+		"provider aliyun MOBILE ok",
+		"send MOBILE LOGIN ok",
+		"reject MOBILE LOGIN send",
+		"send MOBILE LOGIN rate_limited",
+		"provider aliyun MOBILE error",
+		"send MOBILE LOGIN error",
+		"verify MOBILE LOGIN incorrect",
+		"verify MOBILE LOGIN rate_limited",
+		"reject MOBILE LOGIN verify",
+		"verify MOBILE LOGIN rate_limited",
+		"reject MOBILE LOGIN verify",
+	}, m.events)
+	assert.NotEmpty(t, m.redis)
+	assert.Zero(t, m.redis["evalsha error"])
+}
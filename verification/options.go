@@ -0,0 +1,92 @@
+package verification
+
+// OTPServiceOption configures an OTPService.
+type OTPServiceOption[T CodeConstraint] func(*OTPService[T])
+
+// WithCodeCache replaces the Redis CodeStore of the service, e.g. with a SQLCodeStore.
+// The rate limiters stay on Redis.
+func WithCodeCache[T CodeConstraint](cache CodeCache[T]) OTPServiceOption[T] {
+	return func(s *OTPService[T]) { s.store = cache }
+}
+
+// WithLocalCache puts a LocalCache in front of the Redis CodeStore of the service, so
+// peeks like ExpiresIn are served from the process for cfg.TTL. Apply it before
+// WithRedisFallback, it has no effect on other CodeCaches.
+func WithLocalCache[T CodeConstraint](cfg LocalCacheConfig) OTPServiceOption[T] {
+	return func(s *OTPService[T]) {
+		if store, ok := s.store.(*CodeStore[T]); ok {
+			s.store = NewLocalCache(store, cfg)
+		}
+	}
+}
+
+// WithRedisFallback keeps the codes, the send and verify limits and the lockouts of the
+// service in the memory of fallback while Redis is down. Apply it after WithCodeCache.
+// The daily quota, send shaping, resend cooldowns, idempotency keys and Redis block
+// lists are not covered and fail during an outage, leave them off to rely on it.
+// InvalidatePrevious and MaxValidCodes are not covered either, their indexes stay in
+// Redis: during an outage the sends succeed but the previous codes stay valid until
+// they expire.
+func WithRedisFallback[T CodeConstraint](fallback *Fallback) OTPServiceOption[T] {
+	return func(s *OTPService[T]) {
+		s.fallback = fallback
+		s.store = NewFallbackCache(s.store, fallback)
+		for _, l := range []*RateLimiter{s.sendLimiter, s.verifyLimiter, s.ipLimiter, s.deviceLimiter, s.userLimiter} {
+			if l != nil {
+				l.fallback = fallback
+			}
+		}
+	}
+}
+
+// SendOption configures a single OTPService.Send call. WithIP, WithDevice and
+// WithChallengePassed configure OTPService.Verify calls as well.
+type SendOption func(*sendOptions)
+
+// sendOptions holds the request context of a send or a verification.
+type sendOptions struct {
+	ip              string
+	device          string
+	idempotencyKey  string
+	locale          string
+	challengePassed bool
+}
+
+// WithIP sets the client IP of the send, limited by the SendByIP policy of the service.
+func WithIP(ip string) SendOption {
+	return func(o *sendOptions) { o.ip = ip }
+}
+
+// WithDevice sets the fingerprint of the client device of the send, e.g. from a device
+// SDK, limited by the SendByDevice policy of the service.
+func WithDevice(fingerprint string) SendOption {
+	return func(o *sendOptions) { o.device = fingerprint }
+}
+
+// WithIdempotencyKey sets a caller supplied idempotency key of the send, e.g. from a
+// gateway retry. A send repeating the key of a successful send to the same target within
+// the IdempotencyWindow returns the original sequence without sending again.
+func WithIdempotencyKey(key string) SendOption {
+	return func(o *sendOptions) { o.idempotencyKey = key }
+}
+
+// WithLocale sets the locale of the code, the senders render the template of the
+// locale from a LocalizedTemplateProvider such as TemplateCatalog.
+func WithLocale(locale string) SendOption {
+	return func(o *sendOptions) { o.locale = locale }
+}
+
+// WithChallengePassed tells the RiskEvaluator of the service that the client passed the
+// challenge it asked for, e.g. a CAPTCHA checked by the caller.
+func WithChallengePassed() SendOption {
+	return func(o *sendOptions) { o.challengePassed = true }
+}
+
+// newSendOptions applies opts to empty send options.
+func newSendOptions(opts []SendOption) sendOptions {
+	var o sendOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -2,8 +2,10 @@ package verification
 
 import (
 	"context"
-	"crypto/subtle"
 	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -12,9 +14,73 @@ import (
 // OTPConfig groups the policy/configuration for a single-channel OTPService.
 type OTPConfig struct {
 	Prefix CodeCacheKeyPrefix
-	TTL    time.Duration     // code expiration time
-	Send   RateLimiterConfig // send rate-limit policy
-	Verify RateLimiterConfig // verify rate-limit policy
+	// PreviousPrefix is the prefix before a key schema change, e.g. the unversioned
+	// prefix when Prefix becomes Prefix.Versioned(2). Codes are written with Prefix
+	// only, codes not found under it are looked up under PreviousPrefix, so the codes
+	// sent before the rollout still verify. Remove it once TTL has passed.
+	PreviousPrefix CodeCacheKeyPrefix
+	TTL            time.Duration     // code expiration time
+	Send           RateLimiterConfig // send rate-limit policy
+	Verify         RateLimiterConfig // verify rate-limit policy
+	// SendByIP is the per client IP send rate-limit policy across all targets, applied
+	// to sends with WithIP. A zero Limit disables it.
+	SendByIP RateLimiterConfig
+	// SendByDevice is the per device send rate-limit policy across all targets, applied
+	// to sends with WithDevice, so one device cannot cycle through many numbers. A zero
+	// Limit disables it.
+	SendByDevice RateLimiterConfig
+	// SendByUser is the per UserID send rate-limit policy across all targets, so a user
+	// cannot rotate numbers or addresses to spam sends. Codes of UserID 0 are not
+	// limited by it. A zero Limit disables it.
+	SendByUser RateLimiterConfig
+	// AllowedCountryCodes, when set, restricts mobile sends to these destination country
+	// codes, e.g. []string{"86", "852"}. Other countries return ErrCountryNotAllowed
+	// whichever sender delivers the code.
+	AllowedCountryCodes []string
+	// DeniedCountryCodes rejects mobile sends to these country codes with
+	// ErrCountryNotAllowed, even when they are allowed.
+	DeniedCountryCodes []string
+	// DailyQuota caps the codes sent per CodeType and UTC day across all targets,
+	// exceeding it returns ErrGlobalQuotaExceeded. Zero disables it.
+	DailyQuota int64
+	Shape      LeakyBucketConfig // channel-wide send shaping policy, disabled by default
+	// HMACKey, when set, stores codes as HMAC-SHA256 digests keyed by it instead of
+	// plain SHA-256, so the short codes can't be brute-forced from a Redis dump.
+	// Changing the key invalidates the codes in flight.
+	HMACKey []byte
+	// Codec encodes the stored codes, JSONCodec when nil.
+	Codec Codec
+	// ResendCooldown is the minimum time between sends of a sequence, see Resend.
+	// Zero disables it.
+	ResendCooldown time.Duration
+	// InvalidatePrevious deletes the outstanding codes of the target and type on every
+	// successful send, so only the most recent code verifies. A failed deletion is logged
+	// and leaves the previous codes valid until they expire. On a Redis Cluster the
+	// code keys must share a hash tag, e.g. through the key prefix.
+	InvalidatePrevious bool
+	// MaxValidCodes keeps the codes of the N most recent sends of the target and type
+	// valid and deletes older ones, e.g. 2 so the code of an SMS arriving late after a
+	// resend still verifies. Zero keeps every code until it expires, InvalidatePrevious
+	// takes precedence. Failed deletions are handled like for InvalidatePrevious.
+	MaxValidCodes int
+	// LockoutDuration is how long a sequence stays locked once its verify limit is
+	// exceeded, verifications of it return the *RateLimitError of the limit meanwhile
+	// instead of ErrCodeNotFound. The remaining failure window when zero.
+	LockoutDuration time.Duration
+	// Normalize maps code types to the CodeNormalizer applied to the codes of the type
+	// before they are hashed on send and on verify, e.g. NormalizeAlphanumeric for
+	// alphanumeric PAYMENT codes. Types without normalizer are compared as typed.
+	Normalize map[CodeType]CodeNormalizer
+	// Consume is when a verification consumes the code, ConsumeOnVerify by default.
+	Consume ConsumePolicy
+	// VerifyByTarget counts the failed verifications per type and target across
+	// sequences, and locks the target instead of the sequence, so requesting a new code
+	// doesn't reset the attempt budget. A locked target fails the verifications of all
+	// its codes.
+	VerifyByTarget bool
+	// IdempotencyWindow is how long the sequence of a send with WithIdempotencyKey is
+	// returned for the same key, TTL when zero.
+	IdempotencyWindow time.Duration
 }
 
 // DefaultOTPConfig returns an OTPConfig with sensible, secure defaults.
@@ -32,16 +98,47 @@ func DefaultOTPConfig(prefix CodeCacheKeyPrefix) OTPConfig {
 			Window:   5 * time.Minute,
 			LimitErr: ErrCodeIncorrect,
 		},
+		ResendCooldown: time.Minute,
 	}
 }
 
+// ConsumePolicy is when a verification consumes the code, see OTPConfig.Consume.
+type ConsumePolicy string
+
+const (
+	// ConsumeOnVerify deletes the code once it matches, mismatches are counted until the
+	// verify limit deletes it. It is the default.
+	ConsumeOnVerify ConsumePolicy = ""
+	// ConsumeOnRead deletes the code on its first verification whatever the input, so
+	// each code allows one guess and a mistyped code needs a new one. Mismatches still
+	// count towards the verify limit and the lockout.
+	ConsumeOnRead ConsumePolicy = "read"
+)
+
 // OTPService[T] manages OTP send/verify for a single verification code type.
 type OTPService[T CodeConstraint] struct {
-	store         *CodeStore[T]
+	client        redis.UniversalClient
+	store         CodeCache[T]
 	keys          *CacheKeyBuilder
+	previousKeys  *CacheKeyBuilder
 	sender        CodeSender[T]
 	sendLimiter   *RateLimiter
 	verifyLimiter *RateLimiter
+	ipLimiter     *RateLimiter
+	deviceLimiter *RateLimiter
+	userLimiter   *RateLimiter
+	quota         *DailyQuota
+	shaper        *LeakyBucket
+	blockList     BlockList
+	risk          RiskEvaluator
+	allowed       map[string]bool
+	denied        map[string]bool
+	metrics       Metrics
+	logger        *slog.Logger
+	logLevels     LogLevels
+	listeners     []CodeEventListener
+	fallback      *Fallback
+	normalizers   map[CodeType]CodeNormalizer // Normalize by upper case CodeType
 	cfg           OTPConfig
 }
 
@@ -51,27 +148,184 @@ type OTPService[T CodeConstraint] struct {
 // Pass nil for channels that don't require external delivery (e.g., ECDSA).
 func NewOTPService[T CodeConstraint](
 	cfg OTPConfig, client redis.UniversalClient,
-	sender CodeSender[T],
+	sender CodeSender[T], opts ...OTPServiceOption[T],
 ) *OTPService[T] {
-	return &OTPService[T]{
-		store:         NewCodeStore[T](client),
+	s := &OTPService[T]{
+		client:        client,
+		store:         NewCodeStoreWithCodec[T](client, cfg.Codec),
 		keys:          NewCacheKeyBuilder(cfg.Prefix),
 		sender:        sender,
 		sendLimiter:   NewRateLimiter(client, cfg.Send),
 		verifyLimiter: NewRateLimiter(client, cfg.Verify),
+		metrics:       nopMetrics{},
 		cfg:           cfg,
 	}
+	if cfg.SendByIP.Limit > 0 {
+		s.ipLimiter = NewRateLimiter(client, cfg.SendByIP)
+	}
+	if cfg.SendByDevice.Limit > 0 {
+		s.deviceLimiter = NewRateLimiter(client, cfg.SendByDevice)
+	}
+	if cfg.SendByUser.Limit > 0 {
+		s.userLimiter = NewRateLimiter(client, cfg.SendByUser)
+	}
+	if cfg.PreviousPrefix != "" && cfg.PreviousPrefix != cfg.Prefix {
+		s.previousKeys = NewCacheKeyBuilder(cfg.PreviousPrefix)
+	}
+	s.allowed, s.denied = countrySet(cfg.AllowedCountryCodes), countrySet(cfg.DeniedCountryCodes)
+	if cfg.DailyQuota > 0 {
+		s.quota = NewDailyQuota(client, cfg.DailyQuota, ErrGlobalQuotaExceeded)
+	}
+	if cfg.Shape.Enabled() {
+		s.shaper = NewLeakyBucket(client, cfg.Shape)
+	}
+	for typ, fn := range cfg.Normalize {
+		if s.normalizers == nil {
+			s.normalizers = map[CodeType]CodeNormalizer{}
+		}
+		s.normalizers[CodeType(strings.ToUpper(string(typ)))] = fn
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Check checks the Redis backing the service is reachable.
+func (s *OTPService[T]) Check(ctx context.Context) error {
+	return s.store.Check(ctx)
 }
 
 // Send stores the code, applies rate limiting, and optionally delivers it externally.
 // The caller is responsible for creating the code via CodeGenerator.
 // Returns the sequence identifier for later verification.
-func (s *OTPService[T]) Send(ctx context.Context, code *T) (string, error) {
+//
+// With a Shape policy the delivery waits for the channel-wide leaky bucket, a full
+// bucket fails the send with ErrSendThrottled. With WithIdempotencyKey a repeated send
+// returns the original sequence, or ErrSendInProgress while the original is running.
+func (s *OTPService[T]) Send(ctx context.Context, code *T, opts ...SendOption) (string, error) {
+	start := time.Now()
+	ctx, span := startSpan(ctx, "verification.Send", (*code).Medium(), (*code).GetType())
+	seq, err := s.sendIdempotent(ctx, code, newSendOptions(opts))
+	endSpan(span, err)
+	s.observeSend(ctx, code, err, time.Since(start))
+	return seq, err
+}
+
+// sendIdempotent runs send once per idempotency key of o.
+func (s *OTPService[T]) sendIdempotent(ctx context.Context, code *T, o sendOptions) (string, error) {
+	if o.idempotencyKey == "" {
+		return s.send(ctx, code, o)
+	}
+
+	// The first send of a key claims it, repeats return the sequence it recorded.
+	c := *code
+	key := s.keys.IdempotencyKey(c.Medium(), c.GetType(), append(c.LimitKeyParts(), o.idempotencyKey)...)
+	window := s.cfg.IdempotencyWindow
+	if window <= 0 {
+		window = s.cfg.TTL
+	}
+	ok, err := s.client.SetNX(ctx, key, idempotencyPending, min(window, idempotencyPendingTTL)).Result()
+	if err != nil {
+		return "", fmt.Errorf("verification: redis setnx failed: %w", err)
+	}
+	if !ok {
+		seq, err := s.client.Get(ctx, key).Result()
+		if errors.Is(err, redis.Nil) {
+			return "", ErrSendInProgress
+		}
+		if err != nil {
+			return "", fmt.Errorf("verification: redis get failed: %w", err)
+		}
+		if seq == idempotencyPending {
+			return "", ErrSendInProgress
+		}
+		return seq, nil
+	}
+	seq, err := s.send(ctx, code, o)
+	// The key is released and recorded even when the caller gave up on the send.
+	ctx = context.WithoutCancel(ctx)
+	if err != nil {
+		_ = s.client.Del(ctx, key).Err()
+		return "", err
+	}
+	_ = s.client.Set(ctx, key, seq, window).Err()
+	return seq, nil
+}
+
+const (
+	// idempotencyPending marks an idempotency key claimed by a send in progress.
+	idempotencyPending = "-"
+	// idempotencyPendingTTL bounds the claim of a send in progress, so a claim left by a
+	// crashed instance blocks the retries of its key for a minute, not for the window.
+	idempotencyPendingTTL = time.Minute
+)
+
+// send runs the send flow of Send.
+func (s *OTPService[T]) send(ctx context.Context, code *T, o sendOptions) (string, error) {
 	var sf func() error
 	if s.sender != nil {
-		sf = func() error { return s.sender.Send(ctx, code) }
+		sf = func() error {
+			if s.shaper != nil {
+				if err := s.shaper.Wait(ctx, s.keys.ShapeKey((*code).Medium())); err != nil {
+					return err
+				}
+			}
+			ctx, span := startSpan(ctx, "verification.Deliver", (*code).Medium(), (*code).GetType())
+			err := s.sender.Send(ctx, code)
+			endSpan(span, err)
+			return err
+		}
+	}
+	seq, err := s.sendCode(ctx, code, o, sf)
+	if err != nil {
+		return "", err
+	}
+	if s.cfg.ResendCooldown > 0 {
+		_ = s.client.Set(ctx, s.resendKey(code), 1, s.cfg.ResendCooldown).Err()
 	}
-	return s.sendCode(ctx, code, sf)
+	return seq, nil
+}
+
+// resendKey returns the resend cooldown key of the sequence of code.
+func (s *OTPService[T]) resendKey(code *T) string {
+	c := *code
+	return s.keys.ResendKey(c.Medium(), c.GetType(), c.CacheKeyParts()...)
+}
+
+// Resend delivers code in place of the outstanding code of the same sequence, so the
+// client keeps its sequence. Only digests are stored, so the code is a fresh one with
+// the sequence of the previous (e.g. code.Sequence = seq) and a full TTL.
+//
+// Returns ErrCodeNotFound if the sequence has no outstanding code, and *RateLimitError
+// wrapping ErrResendCooldown with the remaining cooldown if the sequence was sent less
+// than ResendCooldown ago. Resends are subject to the send limits as well, a failed
+// delivery drops the code of the sequence.
+func (s *OTPService[T]) Resend(ctx context.Context, code *T, opts ...SendOption) error {
+	if _, _, err := s.peek(ctx, code); err != nil {
+		return err
+	}
+	if s.cfg.ResendCooldown > 0 {
+		key := s.resendKey(code)
+		ok, err := s.client.SetNX(ctx, key, 1, s.cfg.ResendCooldown).Result()
+		if err != nil {
+			return fmt.Errorf("verification: redis setnx failed: %w", err)
+		}
+		if !ok {
+			ttl, err := s.client.PTTL(ctx, key).Result()
+			if err != nil {
+				return fmt.Errorf("verification: redis pttl failed: %w", err)
+			}
+			return &RateLimitError{Err: ErrResendCooldown, RetryIn: ttl}
+		}
+		if _, err = s.Send(ctx, code, opts...); err != nil {
+			_ = s.client.Del(ctx, key).Err()
+			return err
+		}
+		return nil
+	}
+	_, err := s.Send(ctx, code, opts...)
+	return err
 }
 
 // Verify checks the input code against the stored code.
@@ -79,81 +333,394 @@ func (s *OTPService[T]) Send(ctx context.Context, code *T) (string, error) {
 // (e.g., Sequence, Mobile, CountryCode for MobileCode) — the Code field is ignored.
 // This design ensures the same CacheKeyParts()/Medium()/GetType() logic used in Send
 // is also used here, eliminating key-construction mismatches.
-func (s *OTPService[T]) Verify(ctx context.Context, input string, probe *T) error {
+//
+// opts pass the client IP and device to the RiskEvaluator of the service.
+func (s *OTPService[T]) Verify(ctx context.Context, input string, probe *T, opts ...SendOption) error {
+	_, err := s.VerifyWithResult(ctx, input, probe, opts...)
+	return err
+}
+
+// VerifyResult describes the outcome of a verification, e.g. to tell users
+// "2 attempts remaining".
+type VerifyResult struct {
+	// Consumed reports whether the code matched and was consumed.
+	Consumed bool
+	// RemainingAttempts is the number of failed attempts left before the code is deleted.
+	RemainingAttempts int64
+	// LockoutTTL is the time until the failure window resets, set once a failure is counted.
+	LockoutTTL time.Duration
+}
+
+// VerifyWithResult is Verify returning a VerifyResult along with the same errors. The
+// result is nil if no code is stored for probe or the verification failed.
+func (s *OTPService[T]) VerifyWithResult(ctx context.Context, input string, probe *T,
+	opts ...SendOption,
+) (*VerifyResult, error) {
 	c := *probe
 	medium := c.Medium()
 	codeKey := s.keys.CodeKey(medium, c.GetType(), c.CacheKeyParts()...)
-	incorrectKey := s.keys.IncorrectKey(medium, c.GetType(), c.CacheKeyParts()...)
-	return s.verifyCode(ctx, codeKey, incorrectKey, input)
+	incorrectKey := s.keys.IncorrectKey(medium, c.GetType(), s.failureParts(probe)...)
+	ctx, span := startSpan(ctx, "verification.Verify", medium, c.GetType())
+	if err := s.evaluateRisk(ctx, RiskOperationVerify, probe, newSendOptions(opts)); err != nil {
+		endSpan(span, err)
+		s.observeVerify(ctx, probe, err)
+		return nil, err
+	}
+	if s.cfg.VerifyByTarget {
+		// A new code of a locked target must not verify either.
+		if res, err := s.lockedOut(ctx, probe); res != nil || err != nil {
+			endSpan(span, err)
+			s.observeVerify(ctx, probe, err)
+			return res, err
+		}
+	}
+	input = s.normalize(c.GetType(), input)
+	res, err := s.verifyCode(ctx, codeKey, incorrectKey, input)
+	if errors.Is(err, ErrCodeNotFound) && s.previousKeys != nil {
+		// The code may have been sent before the key prefix changed.
+		res, err = s.verifyCode(ctx, s.previousKeys.CodeKey(medium, c.GetType(), c.CacheKeyParts()...),
+			s.previousKeys.IncorrectKey(medium, c.GetType(), s.failureParts(probe)...), input)
+	}
+	res, err = s.lockout(ctx, probe, res, err)
+	endSpan(span, err)
+	s.observeVerify(ctx, probe, err)
+	return res, err
+}
+
+// digest returns the stored digest of a plaintext code.
+func (s *OTPService[T]) digest(value string) string {
+	if s.cfg.HMACKey != nil {
+		return hmacCode(s.cfg.HMACKey, value)
+	}
+	return hashCode(value)
+}
+
+// normalize applies the CodeNormalizer of typ to value.
+func (s *OTPService[T]) normalize(typ CodeType, value string) string {
+	if fn := s.normalizers[CodeType(strings.ToUpper(string(typ)))]; fn != nil {
+		return fn(value)
+	}
+	return value
+}
+
+// ExpiresIn returns the remaining validity of the code identified by probe, e.g. to show
+// "code expires in 02:43". Returns ErrCodeNotFound if it expired or was consumed.
+func (s *OTPService[T]) ExpiresIn(ctx context.Context, probe *T) (time.Duration, error) {
+	_, ttl, err := s.peek(ctx, probe)
+	return ttl, err
+}
+
+// GetSendLimitState returns the state of the send limit tiers of the target of code,
+// identified by its LimitKeyParts, without recording a send.
+func (s *OTPService[T]) GetSendLimitState(ctx context.Context, code *T) ([]LimitState, error) {
+	c := *code
+	return s.sendLimiter.State(ctx, s.keys.LimitKey(c.Medium(), c.GetType(), c.LimitKeyParts()...))
+}
+
+// GetVerifyLimitState returns the state of the verify failure counter of the sequence of
+// probe, or of its target with VerifyByTarget, without counting a failure.
+func (s *OTPService[T]) GetVerifyLimitState(ctx context.Context, probe *T) ([]LimitState, error) {
+	c := *probe
+	return s.verifyLimiter.State(ctx, s.keys.IncorrectKey(c.Medium(), c.GetType(), s.failureParts(probe)...))
+}
+
+// peek returns the stored code of probe and its TTL, under the previous prefix when it
+// is not found under the prefix.
+func (s *OTPService[T]) peek(ctx context.Context, probe *T) (*T, time.Duration, error) {
+	c := *probe
+	code, ttl, err := s.store.PeekWithTTL(ctx, s.keys.CodeKey(c.Medium(), c.GetType(), c.CacheKeyParts()...))
+	if errors.Is(err, ErrCodeNotFound) && s.previousKeys != nil {
+		return s.store.PeekWithTTL(ctx, s.previousKeys.CodeKey(c.Medium(), c.GetType(), c.CacheKeyParts()...))
+	}
+	return code, ttl, err
 }
 
 // verifyCode performs the standard OTP verification flow for any code type.
 //
-// The flow is designed to be race-safe:
-//  1. Peek the stored code (non-destructive read).
-//  2. If correct → atomically delete code (prevents concurrent double-consumption),
-//     clear incorrect counter, return nil.
-//  3. If wrong  → atomically increment incorrect counter via limiter.
-//     The limiter returns *RateLimitError when exceeded → clean up and propagate.
-//  4. Otherwise → return ErrCodeIncorrect.
-func (s *OTPService[T]) verifyCode(ctx context.Context, codeKey, incorrectKey, input string) error {
-	// 1. Peek the stored code.
-	stored, err := s.store.Peek(ctx, codeKey)
+// The flow is designed to be race-safe: the store atomically fetches the stored code,
+// compares its digest with the digest of the input, and deletes it on match, so an
+// OTP is never consumed twice. With the Redis store and the default fixed-window verify
+// policy the same Lua script counts the failure on mismatch and deletes the code once
+// the limit is exceeded. Otherwise the failure is counted with the limiter afterwards.
+//
+// Only digests are compared, so the comparison time reveals nothing about the code.
+func (s *OTPService[T]) verifyCode(ctx context.Context, codeKey, incorrectKey, input string) (*VerifyResult, error) {
+	if s.cfg.Consume == ConsumeOnRead {
+		return s.verifyOnRead(ctx, codeKey, incorrectKey, input)
+	}
+	policy := s.cfg.Verify
+	// The Redis store counts fixed-window failures in the same script.
+	store, atomic := s.store.(failureCounter)
+	atomic = atomic && policy.Algorithm == AlgorithmFixedWindow && len(policy.Tiers) == 0
+	var (
+		res ConsumeResult
+		err error
+	)
+	if atomic {
+		res, err = store.CompareAndConsume(ctx, codeKey, s.digest(input), incorrectKey,
+			policy.Limit, policy.Window)
+	} else {
+		res.Decision, err = s.store.Consume(ctx, codeKey, s.digest(input))
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	// 2. Correct code → success path (constant-time compare to prevent timing attacks).
-	//    The stored code is a SHA-256 hash; hash the user input before comparing.
-	if subtle.ConstantTimeCompare([]byte((*stored).GetDigest()), []byte(hashCode(input))) == 1 {
-		deleted, err := s.store.Delete(ctx, codeKey)
-		// If another concurrent request successfully deleted the code before us,
-		// we must not return success, otherwise an OTP is consumed twice.
-		if err == nil && !deleted {
-			return ErrCodeNotFound
+	switch res.Decision {
+	case ConsumeNotFound:
+		return nil, ErrCodeNotFound
+	case ConsumeMatched:
+		if !atomic {
+			_ = s.verifyLimiter.Reset(ctx, incorrectKey)
 		}
+		return &VerifyResult{Consumed: true, RemainingAttempts: policy.Limit}, nil
+	case ConsumeLimitExceeded:
+		return &VerifyResult{LockoutTTL: res.RetryIn}, &RateLimitError{Err: policy.LimitErr, RetryIn: res.RetryIn}
+	}
+	if atomic {
+		return remainingAttempts(policy.Limit, res.Failures, res.RetryIn), ErrCodeIncorrect
+	}
+
+	// The limiter handles increment + limit check internally.
+	// *RateLimitError → limit exceeded; infrastructure error → propagate directly.
+	d, err := s.verifyLimiter.Decide(ctx, incorrectKey)
+	if err != nil {
+		return nil, err
+	}
+	if !d.Allowed {
+		_, _ = s.store.Delete(ctx, codeKey)
 		_ = s.verifyLimiter.Reset(ctx, incorrectKey)
-		return nil
+		return &VerifyResult{LockoutTTL: d.RetryIn}, &RateLimitError{Err: policy.LimitErr, RetryIn: d.RetryIn}
 	}
+	return remainingAttempts(d.Limit, d.Current, d.RetryIn), ErrCodeIncorrect
+}
 
-	// 3. Wrong code → the limiter handles increment + limit check internally.
-	//    *RateLimitError → limit exceeded; infrastructure error → propagate directly.
-	if err := s.verifyLimiter.Allow(ctx, incorrectKey); err != nil {
-		var rlErr *RateLimitError
-		if errors.As(err, &rlErr) {
-			_, _ = s.store.Delete(ctx, codeKey)
-			_ = s.verifyLimiter.Reset(ctx, incorrectKey)
-		}
-		return err
+// verifyOnRead is verifyCode of ConsumeOnRead: the code is taken from the store before
+// the comparison, so concurrent verifications of a code get one guess in total.
+func (s *OTPService[T]) verifyOnRead(ctx context.Context, codeKey, incorrectKey, input string) (*VerifyResult, error) {
+	code, err := s.take(ctx, codeKey)
+	if err != nil {
+		return nil, err
+	}
+	if equalCode((*code).GetDigest(), s.digest(input)) {
+		_ = s.verifyLimiter.Reset(ctx, incorrectKey)
+		return &VerifyResult{Consumed: true, RemainingAttempts: s.cfg.Verify.Limit}, nil
+	}
+	// The code is gone, no attempt remains but the failure still counts.
+	d, err := s.verifyLimiter.Decide(ctx, incorrectKey)
+	if err != nil {
+		return nil, err
+	}
+	if !d.Allowed {
+		_ = s.verifyLimiter.Reset(ctx, incorrectKey)
+		return &VerifyResult{LockoutTTL: d.RetryIn}, &RateLimitError{Err: s.cfg.Verify.LimitErr, RetryIn: d.RetryIn}
+	}
+	return &VerifyResult{LockoutTTL: d.RetryIn}, ErrCodeIncorrect
+}
+
+// take returns and deletes the code under key, with GETDEL on the Redis store. Other
+// stores peek the code, only the verification whose delete removes it gets it.
+func (s *OTPService[T]) take(ctx context.Context, key string) (*T, error) {
+	if store, ok := s.store.(interface {
+		Take(ctx context.Context, key string) (*T, error)
+	}); ok {
+		return store.Take(ctx, key)
+	}
+	code, err := s.store.Peek(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := s.store.Delete(ctx, key)
+	if err != nil {
+		return nil, err
 	}
+	if !deleted {
+		return nil, ErrCodeNotFound
+	}
+	return code, nil
+}
 
-	return ErrCodeIncorrect
+// remainingAttempts returns the VerifyResult of a counted failure.
+func remainingAttempts(limit, failures int64, retryIn time.Duration) *VerifyResult {
+	return &VerifyResult{RemainingAttempts: max(limit-failures, 0), LockoutTTL: retryIn}
 }
 
-// sendCode performs the common OTP send flow: rate-limit check → store code → optional send.
-// sendFn is called after storing (e.g. to send SMS/email); on failure the code is rolled back.
+// sendCode performs the common OTP send flow: rate-limit checks → store code → optional send.
+// sendFn is called after storing (e.g. to send SMS/email); on failure the code is rolled back
+// and the recorded send limits and quota are refunded, so users aren't penalized for
+// provider errors.
 // Pass nil for sendFn if no external delivery is needed (e.g. ECDSA challenge).
 //
 // Design note: each code's CacheKeyParts includes the unique Sequence, so consecutive
 // sends for the same user/identifier produce independent Redis keys. This means a
 // rollback (store.Delete + sendLimiter.Undo) on send failure only affects the
 // current attempt and never removes a previously sent, still-valid code.
-func (s *OTPService[T]) sendCode(ctx context.Context, code *T, sendFn func() error) (string, error) {
+func (s *OTPService[T]) sendCode(ctx context.Context, code *T, o sendOptions, sendFn func() error) (string, error) {
 	c := *code // dereference to call interface methods on value
+	if cc := blockTarget(code).CountryCode; cc != "" {
+		cc = normalizeCountryCode(cc)
+		if s.denied[cc] || (s.allowed != nil && !s.allowed[cc]) {
+			return "", ErrCountryNotAllowed
+		}
+	}
+	if s.blockList != nil {
+		blocked, err := s.blockList.Blocked(ctx, blockTarget(code))
+		if err != nil {
+			return "", err
+		}
+		if blocked {
+			return "", ErrTargetBlocked
+		}
+	}
+	if err := s.evaluateRisk(ctx, RiskOperationSend, code, o); err != nil {
+		return "", err
+	}
+	// The IP limit is checked first so that a single IP enumerating targets is
+	// rejected before consuming the quota and their per-target limits. Every recorded
+	// action is undone when a later step fails.
+	var undos []func()
+	undo := func() {
+		for i := len(undos) - 1; i >= 0; i-- {
+			undos[i]()
+		}
+	}
+	if s.ipLimiter != nil && o.ip != "" {
+		ipKey := s.keys.IPLimitKey(c.GetType(), o.ip)
+		undoLimit, err := s.ipLimiter.allow(ctx, ipKey)
+		if err != nil {
+			s.rejected(ctx, code, "ip", err)
+			return "", err
+		}
+		undos = append(undos, undoLimit)
+	}
+	if s.deviceLimiter != nil && o.device != "" {
+		deviceKey := s.keys.DeviceLimitKey(c.GetType(), o.device)
+		undoLimit, err := s.deviceLimiter.allow(ctx, deviceKey)
+		if err != nil {
+			s.rejected(ctx, code, "device", err)
+			undo()
+			return "", err
+		}
+		undos = append(undos, undoLimit)
+	}
+	if userID := any(code).(interface{ GetUserID() int64 }).GetUserID(); s.userLimiter != nil && userID != 0 {
+		userKey := s.keys.UserLimitKey(c.GetType(), userID)
+		undoLimit, err := s.userLimiter.allow(ctx, userKey)
+		if err != nil {
+			s.rejected(ctx, code, "user", err)
+			undo()
+			return "", err
+		}
+		undos = append(undos, undoLimit)
+	}
+	if s.quota != nil {
+		quotaKey := s.keys.QuotaKey(c.Medium(), c.GetType())
+		if err := s.quota.Allow(ctx, quotaKey); err != nil {
+			s.rejected(ctx, code, "quota", err)
+			undo()
+			return "", err
+		}
+		undos = append(undos, func() { _ = s.quota.Undo(ctx, quotaKey) })
+	}
 	limitKey := s.keys.LimitKey(c.Medium(), c.GetType(), c.LimitKeyParts()...)
-	if err := s.sendLimiter.Allow(ctx, limitKey); err != nil {
+	undoLimit, err := s.sendLimiter.allow(ctx, limitKey)
+	if err != nil {
+		s.rejected(ctx, code, "send", err)
+		undo()
 		return "", err
 	}
 	codeKey := s.keys.CodeKey(c.Medium(), c.GetType(), c.CacheKeyParts()...)
+	undos = append(undos, undoLimit)
+	if s.cfg.HMACKey != nil || s.normalizers != nil {
+		any(code).(interface{ setDigest(string) }).setDigest(s.digest(s.normalize(c.GetType(), c.GetValue())))
+	}
+	if o.locale != "" {
+		any(code).(interface{ setLocale(string) }).setLocale(o.locale)
+	}
 	if err := s.store.Set(ctx, codeKey, code, s.cfg.TTL); err != nil {
+		undo()
 		return "", err
 	}
 	if sendFn != nil {
 		if err := sendFn(); err != nil {
 			_, _ = s.store.Delete(ctx, codeKey)
-			_ = s.sendLimiter.Undo(ctx, limitKey)
+			undo()
 			return "", err
 		}
 	}
+	// The code is sent, failing to invalidate the previous ones leaves them valid until
+	// they expire rather than failing the send.
+	if s.cfg.InvalidatePrevious {
+		latestKey := s.keys.LatestKey(c.Medium(), c.GetType(), c.LimitKeyParts()...)
+		if err := s.replaceLatest(ctx, latestKey, codeKey); err != nil {
+			s.invalidateFailed(ctx, code, err)
+		}
+	} else if s.cfg.MaxValidCodes > 0 {
+		recentKey := s.keys.RecentKey(c.Medium(), c.GetType(), c.LimitKeyParts()...)
+		if err := s.keepRecent(ctx, recentKey, codeKey); err != nil {
+			s.invalidateFailed(ctx, code, err)
+		}
+	}
 	return c.GetSequence(), nil
 }
+
+// keepRecent pushes codeKey to the list of recentKey and deletes the codes beyond the
+// MaxValidCodes most recent, atomically with a codeIndex store.
+func (s *OTPService[T]) keepRecent(ctx context.Context, recentKey, codeKey string) error {
+	n := s.cfg.MaxValidCodes
+	if store, ok := s.store.(codeIndex); ok {
+		return store.KeepRecent(ctx, recentKey, codeKey, n, s.cfg.TTL)
+	}
+	var old *redis.StringSliceCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, recentKey, 0, codeKey)
+		pipe.LPush(ctx, recentKey, codeKey)
+		old = pipe.LRange(ctx, recentKey, int64(n), -1)
+		pipe.LTrim(ctx, recentKey, 0, int64(n-1))
+		pipe.PExpire(ctx, recentKey, s.cfg.TTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("verification: redis keep recent failed: %w", err)
+	}
+	for _, key := range old.Val() {
+		if _, err = s.store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countrySet returns the set of the normalized codes, nil when codes is empty.
+func countrySet(codes []string) map[string]bool {
+	if len(codes) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(codes))
+	for _, cc := range codes {
+		set[normalizeCountryCode(cc)] = true
+	}
+	return set
+}
+
+// normalizeCountryCode returns cc without spaces and a leading "+".
+func normalizeCountryCode(cc string) string {
+	return strings.TrimPrefix(strings.TrimSpace(cc), "+")
+}
+
+// replaceLatest points latestKey to codeKey and deletes the code it pointed to before,
+// atomically with a codeIndex store.
+func (s *OTPService[T]) replaceLatest(ctx context.Context, latestKey, codeKey string) error {
+	if store, ok := s.store.(codeIndex); ok {
+		return store.Replace(ctx, latestKey, codeKey, s.cfg.TTL)
+	}
+	prev, err := s.client.SetArgs(ctx, latestKey, codeKey, redis.SetArgs{TTL: s.cfg.TTL, Get: true}).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("verification: redis set failed: %w", err)
+	}
+	if prev != "" && prev != codeKey {
+		if _, err = s.store.Delete(ctx, prev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,592 @@
+package verification
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_Service_ConsumeOnRead(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	cfg := mobileTestConfig(10, 2)
+	cfg.Consume = ConsumeOnRead
+	gen := NewTestCodeGenerator("666666")
+	svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+
+	send := func() string {
+		mc, err := gen.NewMobileCode("login", 1, "13800138000", "86")
+		require.NoError(t, err)
+		seq, err := svc.Send(ctx, mc)
+		require.NoError(t, err)
+		return seq
+	}
+
+	// A wrong guess burns the code.
+	seq := send()
+	res, err := svc.VerifyWithResult(ctx, "000000", mobileProbe(seq, "13800138000", "86"))
+	assert.ErrorIs(t, err, ErrCodeIncorrect)
+	assert.Zero(t, res.RemainingAttempts)
+	assert.ErrorIs(t, svc.Verify(ctx, "666666", mobileProbe(seq, "13800138000", "86")), ErrCodeNotFound)
+
+	seq = send()
+	res, err = svc.VerifyWithResult(ctx, "666666", mobileProbe(seq, "13800138000", "86"))
+	require.NoError(t, err)
+	assert.True(t, res.Consumed)
+	assert.ErrorIs(t, svc.Verify(ctx, "666666", mobileProbe(seq, "13800138000", "86")), ErrCodeNotFound)
+
+	// Mismatches still count towards the verify limit.
+	cfg.VerifyByTarget = true
+	svc = NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+	for range 2 {
+		assert.ErrorIs(t, svc.Verify(ctx, "000000", mobileProbe(send(), "13800138000", "86")), ErrCodeIncorrect)
+	}
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", mobileProbe(send(), "13800138000", "86")), ErrMobileVerifyLimitExceeded)
+}
+
+func TestVerification_Service_CountryPolicy(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	cfg := mobileTestConfig(10, 10)
+	cfg.AllowedCountryCodes = []string{"86", "+852", "1"}
+	cfg.DeniedCountryCodes = []string{"1"}
+	gen := NewTestCodeGenerator("666666")
+	sender := &countingSMSSender{}
+	svc := NewOTPService[MobileCode](cfg, client, sender)
+
+	send := func(cc string) error {
+		mc, err := gen.NewMobileCode("login", 1, "13800138000", cc)
+		require.NoError(t, err)
+		_, err = svc.Send(ctx, mc)
+		return err
+	}
+	require.NoError(t, send("86"))
+	require.NoError(t, send("+852"))
+	assert.ErrorIs(t, send("44"), ErrCountryNotAllowed)
+	assert.ErrorIs(t, send("1"), ErrCountryNotAllowed)
+	assert.Equal(t, 2, sender.calls)
+
+	// Without an allowlist only the denied countries are rejected.
+	cfg.AllowedCountryCodes = nil
+	svc = NewOTPService[MobileCode](cfg, client, sender)
+	require.NoError(t, send("44"))
+	assert.ErrorIs(t, send("1"), ErrCountryNotAllowed)
+}
+
+func TestVerification_Service_VerifyByTarget(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	cfg := mobileTestConfig(10, 2)
+	cfg.VerifyByTarget = true
+	cfg.LockoutDuration = 15 * time.Minute
+	gen := NewTestCodeGenerator("666666")
+	svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+	send := func() *MobileCode {
+		mc, err := gen.NewMobileCode("login", 1, "13800138000", "86")
+		require.NoError(t, err)
+		seq, err := svc.Send(ctx, mc)
+		require.NoError(t, err)
+		return mobileProbe(seq, "13800138000", "86")
+	}
+
+	// A new code continues the attempt budget of the target.
+	first := send()
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", first), ErrCodeIncorrect)
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", first), ErrCodeIncorrect)
+	second := send()
+	res, err := svc.VerifyWithResult(ctx, "000000", second)
+	assert.ErrorIs(t, err, ErrMobileVerifyLimitExceeded)
+	assert.Equal(t, 15*time.Minute, res.LockoutTTL)
+
+	// No code of the locked target verifies, including codes sent after the lockout.
+	var rlErr *RateLimitError
+	require.ErrorAs(t, svc.Verify(ctx, "666666", first), &rlErr)
+	assert.Equal(t, 15*time.Minute, rlErr.RetryIn)
+	third := send()
+	assert.ErrorIs(t, svc.Verify(ctx, "666666", third), ErrMobileVerifyLimitExceeded)
+	status, err := svc.GetLockoutStatus(ctx, third)
+	require.NoError(t, err)
+	assert.True(t, status.Locked)
+
+	state, err := NewAdminService(client, cfg).Inspect(ctx, "MOBILE", "13800138000", "86")
+	require.NoError(t, err)
+	require.Len(t, state.Lockouts, 1)
+	assert.Empty(t, state.Lockouts[0].Sequence)
+
+	// A match clears the failures of the target.
+	_, err = NewAdminService(client, cfg).ClearLimits(ctx, "MOBILE", "13800138000", "86")
+	require.NoError(t, err)
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", third), ErrCodeIncorrect)
+	require.NoError(t, svc.Verify(ctx, "666666", third))
+	fourth := send()
+	res, err = svc.VerifyWithResult(ctx, "000000", fourth)
+	assert.ErrorIs(t, err, ErrCodeIncorrect)
+	assert.Equal(t, int64(1), res.RemainingAttempts)
+}
+
+func TestVerification_Service_PreviousPrefix(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	assert.Equal(t, CodeCacheKeyPrefix("TEST:v2"), CodeCacheKeyPrefix("TEST").Versioned(2))
+	assert.Equal(t, CodeCacheKeyPrefix("TEST"), CodeCacheKeyPrefix("TEST").Versioned(0))
+
+	gen := NewTestCodeGenerator("666666")
+	old := NewOTPService[MobileCode](mobileTestConfig(5, 5), client, &fakeSMSSender{})
+	mc, err := gen.NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	oldSeq, err := old.Send(ctx, mc)
+	require.NoError(t, err)
+
+	// After the rollout codes are written under the versioned prefix, and the codes sent
+	// before it still verify.
+	cfg := mobileTestConfig(5, 5)
+	cfg.Prefix, cfg.PreviousPrefix = cfg.Prefix.Versioned(2), cfg.Prefix
+	svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+	mc, err = gen.NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	seq, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+	n, err := client.Exists(ctx, NewCacheKeyBuilder("TEST:v2").CodeKey("MOBILE", "login", seq, "13800138000", "86")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	ttl, err := svc.ExpiresIn(ctx, mobileProbe(oldSeq, "13800138000", "86"))
+	require.NoError(t, err)
+	assert.Positive(t, ttl)
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", mobileProbe(oldSeq, "13800138000", "86")), ErrCodeIncorrect)
+	require.NoError(t, svc.Verify(ctx, "666666", mobileProbe(oldSeq, "13800138000", "86")))
+	require.NoError(t, svc.Verify(ctx, "666666", mobileProbe(seq, "13800138000", "86")))
+	assert.ErrorIs(t, svc.Verify(ctx, "666666", mobileProbe(oldSeq, "13800138000", "86")), ErrCodeNotFound)
+}
+
+func TestVerification_Service_SendFailureRefund(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	cfg := mobileTestConfig(1, 10)
+	cfg.SendByIP = RateLimiterConfig{Limit: 1, Window: time.Hour, LimitErr: ErrIPSendLimitExceeded}
+	cfg.DailyQuota = 1
+	gen := NewTestCodeGenerator("666666")
+	failing := &failingSMSSender{}
+	svc := NewOTPService[MobileCode](cfg, client, failing)
+
+	// Every failed send refunds the target limit, the IP limit and the quota.
+	for i := 0; i < 3; i++ {
+		mc, err := gen.NewMobileCode("login", 1, "13800138000", "86")
+		require.NoError(t, err)
+		_, err = svc.Send(ctx, mc, WithIP("1.2.3.4"))
+		assert.ErrorIs(t, err, ErrSendFailed)
+		err = svc.Verify(ctx, "666666", mobileProbe(mc.Sequence, "13800138000", "86"))
+		assert.ErrorIs(t, err, ErrCodeNotFound)
+	}
+	assert.Equal(t, 3, failing.calls)
+
+	svc = NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+	mc, err := gen.NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	_, err = svc.Send(ctx, mc, WithIP("1.2.3.4"))
+	require.NoError(t, err)
+}
+
+func TestVerification_Service_ConcurrentVerify(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	gen := NewTestCodeGenerator("666666")
+	svc := NewOTPService[MobileCode](mobileTestConfig(10, 10), client, &fakeSMSSender{})
+	mc, err := gen.NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	seq, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+
+	// Exactly one of the concurrent verifications consumes the code.
+	var (
+		wg        sync.WaitGroup
+		succeeded atomic.Int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if svc.Verify(ctx, "666666", mobileProbe(seq, "13800138000", "86")) == nil {
+				succeeded.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), succeeded.Load())
+}
+
+func TestVerification_Service_VerifyWithLimiterPolicy(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	// A sliding window verify policy counts failures with the limiter.
+	cfg := mobileTestConfig(10, 2)
+	cfg.Verify.Algorithm = AlgorithmSlidingWindow
+	gen := NewTestCodeGenerator("666666")
+	svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+	mc, err := gen.NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	seq, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+
+	probe := mobileProbe(seq, "13800138000", "86")
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", probe), ErrCodeIncorrect)
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", probe), ErrCodeIncorrect)
+	var rlErr *RateLimitError
+	require.ErrorAs(t, svc.Verify(ctx, "000000", probe), &rlErr)
+	assert.ErrorIs(t, rlErr, ErrMobileVerifyLimitExceeded)
+	assert.ErrorIs(t, svc.Verify(ctx, "666666", probe), ErrMobileVerifyLimitExceeded)
+}
+
+func TestVerification_Service_ExpiresIn(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, ff := getRedisClient(t)
+	defer cleanup()
+	sqlStore, _ := newSQLCodeStore(t)
+
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	gen := NewTestCodeGenerator("666666")
+	for name, opts := range map[string][]OTPServiceOption[MobileCode]{
+		"redis": nil,
+		"sql":   {WithCodeCache[MobileCode](sqlStore)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			svc := NewOTPService[MobileCode](mobileTestConfig(10, 10), client, &fakeSMSSender{}, opts...)
+			mc, err := gen.NewMobileCode("login", 1, "13800138000", "86")
+			require.NoError(t, err)
+			seq, err := svc.Send(ctx, mc)
+			require.NoError(t, err)
+			probe := mobileProbe(seq, "13800138000", "86")
+
+			ff(2 * time.Minute)
+			now = now.Add(2 * time.Minute)
+			ttl, err := svc.ExpiresIn(ctx, probe)
+			require.NoError(t, err)
+			assert.Equal(t, 3*time.Minute, ttl)
+
+			require.NoError(t, svc.Verify(ctx, "666666", probe))
+			_, err = svc.ExpiresIn(ctx, probe)
+			assert.ErrorIs(t, err, ErrCodeNotFound)
+		})
+	}
+}
+
+func TestVerification_Service_Resend(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, ff := getRedisClient(t)
+	defer cleanup()
+
+	cfg := mobileTestConfig(10, 10)
+	cfg.ResendCooldown = time.Minute
+	sms := &fakeSMSSender{}
+	svc := NewChannelOTPService(NewTestCodeGenerator("111111"),
+		NewOTPService[MobileCode](cfg, client, sms), nil, nil)
+	target := Target{Mobile: "13800138000", CountryCode: "86"}
+	res, err := svc.Send(ctx, ChannelMobile, "login", 1, target)
+	require.NoError(t, err)
+
+	// The cooldown starts with the first send.
+	err = svc.Resend(ctx, ChannelMobile, "login", 1, res.Sequence, target)
+	var rlErr *RateLimitError
+	require.ErrorAs(t, err, &rlErr)
+	assert.ErrorIs(t, err, ErrResendCooldown)
+	assert.Equal(t, time.Minute, rlErr.RetryIn)
+
+	// A fresh code replaces the previous one under the same sequence.
+	ff(time.Minute)
+	svc.generator = NewTestCodeGenerator("222222")
+	require.NoError(t, svc.Resend(ctx, ChannelMobile, "login", 1, res.Sequence, target))
+	assert.Equal(t, res.Sequence, sms.last.Sequence)
+	assert.Equal(t, "222222", sms.last.Value)
+	assert.ErrorIs(t, svc.Verify(ctx, ChannelMobile, "login", res.Sequence, target, "111111"), ErrCodeIncorrect)
+	require.NoError(t, svc.Verify(ctx, ChannelMobile, "login", res.Sequence, target, "222222"))
+
+	// Consumed or unknown sequences can't be resent.
+	ff(time.Minute)
+	assert.ErrorIs(t, svc.Resend(ctx, ChannelMobile, "login", 1, res.Sequence, target), ErrCodeNotFound)
+	assert.ErrorIs(t, svc.Resend(ctx, ChannelEcdsa, "login", 1, res.Sequence, target), ErrUnsupportedChannel)
+}
+
+func TestVerification_Service_InvalidatePrevious(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+	sqlStore, _ := newSQLCodeStore(t)
+
+	for name, opts := range map[string][]OTPServiceOption[MobileCode]{
+		"redis": nil,
+		"local": {WithLocalCache[MobileCode](LocalCacheConfig{})},
+		"sql":   {WithCodeCache[MobileCode](sqlStore)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := mobileTestConfig(10, 10)
+			cfg.InvalidatePrevious = true
+			svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{}, opts...)
+			send := func(value, mobile string) string {
+				mc, err := NewTestCodeGenerator(value).NewMobileCode("login", 1, mobile, "86")
+				require.NoError(t, err)
+				seq, err := svc.Send(ctx, mc)
+				require.NoError(t, err)
+				return seq
+			}
+			first := send("111111", "13800138000")
+			other := send("333333", "13900139000")
+			second := send("222222", "13800138000")
+
+			// Only the latest code of the target verifies, other targets are untouched.
+			err := svc.Verify(ctx, "111111", mobileProbe(first, "13800138000", "86"))
+			assert.ErrorIs(t, err, ErrCodeNotFound)
+			require.NoError(t, svc.Verify(ctx, "222222", mobileProbe(second, "13800138000", "86")))
+			require.NoError(t, svc.Verify(ctx, "333333", mobileProbe(other, "13900139000", "86")))
+		})
+	}
+}
+
+func TestVerification_Service_InvalidatePreviousFailure(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	cfg := mobileTestConfig(10, 10)
+	cfg.InvalidatePrevious = true
+	svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+	mc, err := NewTestCodeGenerator("111111").NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	// A latest key of the wrong type fails the invalidation after the code is sent.
+	latestKey := svc.keys.LatestKey(mc.Medium(), mc.GetType(), mc.LimitKeyParts()...)
+	require.NoError(t, client.RPush(ctx, latestKey, "corrupt").Err())
+
+	seq, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+	require.NoError(t, svc.Verify(ctx, "111111", mobileProbe(seq, "13800138000", "86")))
+}
+
+func TestVerification_Service_MaxValidCodes(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+	sqlStore, _ := newSQLCodeStore(t)
+
+	for name, opts := range map[string][]OTPServiceOption[MobileCode]{
+		"redis": nil,
+		"local": {WithLocalCache[MobileCode](LocalCacheConfig{})},
+		"sql":   {WithCodeCache[MobileCode](sqlStore)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := mobileTestConfig(10, 10)
+			cfg.MaxValidCodes = 2
+			svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{}, opts...)
+			send := func(value, mobile string) string {
+				mc, err := NewTestCodeGenerator(value).NewMobileCode("login", 1, mobile, "86")
+				require.NoError(t, err)
+				seq, err := svc.Send(ctx, mc)
+				require.NoError(t, err)
+				return seq
+			}
+			first := send("111111", "13800138000")
+			second := send("222222", "13800138000")
+			other := send("444444", "13900139000")
+			third := send("333333", "13800138000")
+
+			// The two most recent codes of the target verify, other targets are untouched.
+			err := svc.Verify(ctx, "111111", mobileProbe(first, "13800138000", "86"))
+			assert.ErrorIs(t, err, ErrCodeNotFound)
+			require.NoError(t, svc.Verify(ctx, "222222", mobileProbe(second, "13800138000", "86")))
+			require.NoError(t, svc.Verify(ctx, "333333", mobileProbe(third, "13800138000", "86")))
+			require.NoError(t, svc.Verify(ctx, "444444", mobileProbe(other, "13900139000", "86")))
+		})
+	}
+}
+
+func TestVerification_Service_MaxValidCodesFailure(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	cfg := mobileTestConfig(10, 10)
+	cfg.MaxValidCodes = 2
+	svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+	mc, err := NewTestCodeGenerator("111111").NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	// A recent key of the wrong type fails the trim after the code is sent.
+	recentKey := svc.keys.RecentKey(mc.Medium(), mc.GetType(), mc.LimitKeyParts()...)
+	require.NoError(t, client.Set(ctx, recentKey, "corrupt", 0).Err())
+
+	seq, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+	require.NoError(t, svc.Verify(ctx, "111111", mobileProbe(seq, "13800138000", "86")))
+}
+
+func TestVerification_Service_IdempotentSend(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	sms := &countingSMSSender{}
+	gen := NewTestCodeGenerator("666666")
+	svc := NewOTPService[MobileCode](mobileTestConfig(10, 10), client, sms)
+	send := func(mobile string, opts ...SendOption) (string, error) {
+		mc, err := gen.NewMobileCode("login", 1, mobile, "86")
+		require.NoError(t, err)
+		return svc.Send(ctx, mc, opts...)
+	}
+
+	// Retries with the same key return the original sequence without sending again.
+	seq, err := send("13800138000", WithIdempotencyKey("req-1"))
+	require.NoError(t, err)
+	retried, err := send("13800138000", WithIdempotencyKey("req-1"))
+	require.NoError(t, err)
+	assert.Equal(t, seq, retried)
+	assert.Equal(t, 1, sms.calls)
+
+	// Other keys and other targets send.
+	other, err := send("13800138000", WithIdempotencyKey("req-2"))
+	require.NoError(t, err)
+	assert.NotEqual(t, seq, other)
+	_, err = send("13900139000", WithIdempotencyKey("req-1"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, sms.calls)
+
+	// A key claimed by a running send is reported in progress.
+	key := NewCacheKeyBuilder("TEST").IdempotencyKey("MOBILE", "LOGIN", "13700137000", "86", "req-3")
+	require.NoError(t, client.Set(ctx, key, idempotencyPending, time.Minute).Err())
+	_, err = send("13700137000", WithIdempotencyKey("req-3"))
+	assert.ErrorIs(t, err, ErrSendInProgress)
+
+	// A failed send releases the key.
+	svc.sender = &failingSMSSender{}
+	_, err = send("13600136000", WithIdempotencyKey("req-4"))
+	assert.ErrorIs(t, err, ErrSendFailed)
+	svc.sender = sms
+	_, err = send("13600136000", WithIdempotencyKey("req-4"))
+	require.NoError(t, err)
+
+	// The claim expires on its own while the send runs, and a send failing after its
+	// caller gave up releases it.
+	key = NewCacheKeyBuilder("TEST").IdempotencyKey("MOBILE", "LOGIN", "13500135000", "86", "req-5")
+	cctx, cancel := context.WithCancel(ctx)
+	svc.sender = sendFunc(func() error {
+		ttl, err := client.PTTL(ctx, key).Result()
+		require.NoError(t, err)
+		assert.LessOrEqual(t, ttl, idempotencyPendingTTL)
+		cancel()
+		return ErrSendFailed
+	})
+	mc, err := gen.NewMobileCode("login", 1, "13500135000", "86")
+	require.NoError(t, err)
+	_, err = svc.Send(cctx, mc, WithIdempotencyKey("req-5"))
+	assert.ErrorIs(t, err, ErrSendFailed)
+	assert.Zero(t, client.Exists(ctx, key).Val())
+}
+
+// sendFunc is a MobileCode sender running a function.
+type sendFunc func() error
+
+func (f sendFunc) Send(context.Context, *MobileCode) error { return f() }
+
+func TestVerification_Service_VerifyWithResult(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	for name, algorithm := range map[string]LimiterAlgorithm{
+		"script":  AlgorithmFixedWindow,
+		"limiter": AlgorithmSlidingWindow,
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := mobileTestConfig(10, 3)
+			cfg.Verify.Algorithm = algorithm
+			svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+			send := func() *MobileCode {
+				mc, err := NewTestCodeGenerator("666666").NewMobileCode("login", 1, "13800138000", "86")
+				require.NoError(t, err)
+				seq, err := svc.Send(ctx, mc)
+				require.NoError(t, err)
+				return mobileProbe(seq, "13800138000", "86")
+			}
+
+			probe := send()
+			res, err := svc.VerifyWithResult(ctx, "000000", probe)
+			assert.ErrorIs(t, err, ErrCodeIncorrect)
+			assert.Equal(t, int64(2), res.RemainingAttempts)
+			assert.False(t, res.Consumed)
+			assert.Positive(t, res.LockoutTTL)
+
+			res, err = svc.VerifyWithResult(ctx, "666666", probe)
+			require.NoError(t, err)
+			assert.Equal(t, &VerifyResult{Consumed: true, RemainingAttempts: 3}, res)
+
+			res, err = svc.VerifyWithResult(ctx, "666666", probe)
+			assert.ErrorIs(t, err, ErrCodeNotFound)
+			assert.Nil(t, res)
+
+			// The last attempt reports none remaining, the next one locks the code out.
+			probe = send()
+			for i := 0; i < 3; i++ {
+				res, err = svc.VerifyWithResult(ctx, "000000", probe)
+				assert.ErrorIs(t, err, ErrCodeIncorrect)
+			}
+			assert.Equal(t, int64(0), res.RemainingAttempts)
+			res, err = svc.VerifyWithResult(ctx, "000000", probe)
+			var rlErr *RateLimitError
+			require.ErrorAs(t, err, &rlErr)
+			assert.Equal(t, rlErr.RetryIn, res.LockoutTTL)
+		})
+	}
+}
+
+func TestVerification_Service_Normalize(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	assert.Equal(t, "AB12CD", NormalizeAlphanumeric(" ab-12 cd\t"))
+	for name, key := range map[string][]byte{"sha256": nil, "hmac": []byte("secret")} {
+		t.Run(name, func(t *testing.T) {
+			cfg := mobileTestConfig(10, 10)
+			cfg.HMACKey = key
+			cfg.Normalize = map[CodeType]CodeNormalizer{"payment": NormalizeAlphanumeric}
+			svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+			send := func(typ CodeType) string {
+				mc, err := NewTestCodeGenerator("AB12CD").NewMobileCode(typ, 1, "13800138000", "86")
+				require.NoError(t, err)
+				seq, err := svc.Send(ctx, mc)
+				require.NoError(t, err)
+				return seq
+			}
+			probe := func(typ CodeType, seq string) *MobileCode {
+				p := mobileProbe(seq, "13800138000", "86")
+				p.Type = typ
+				return p
+			}
+
+			seq := send("PAYMENT")
+			require.NoError(t, svc.Verify(ctx, "ab-12 cd", probe("PAYMENT", seq)))
+			// Types without normalizer are compared as typed.
+			seq = send("LOGIN")
+			assert.ErrorIs(t, svc.Verify(ctx, "ab12cd", probe("LOGIN", seq)), ErrCodeIncorrect)
+			require.NoError(t, svc.Verify(ctx, "AB12CD", probe("LOGIN", seq)))
+		})
+	}
+}
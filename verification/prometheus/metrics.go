@@ -0,0 +1,88 @@
+// Package prometheus exports the verification Metrics to Prometheus.
+package prometheus
+
+import (
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/crypto-zero/go-biz/verification"
+)
+
+// Metrics implements verification.Metrics with Prometheus collectors, prefixed by the
+// namespace:
+//
+//	verification_send_duration_seconds{medium,type,result}        histogram
+//	verification_verifications_total{medium,type,result}          counter
+//	verification_limit_rejections_total{medium,type,limiter}      counter
+//	verification_provider_duration_seconds{provider,medium,result} histogram
+//	verification_redis_duration_seconds{command,result}           histogram
+type Metrics struct {
+	sends      *prom.HistogramVec
+	verifies   *prom.CounterVec
+	rejections *prom.CounterVec
+	providers  *prom.HistogramVec
+	redis      *prom.HistogramVec
+}
+
+// Compile-time assertion: Metrics implements verification.Metrics.
+var _ verification.Metrics = (*Metrics)(nil)
+
+// NewMetrics creates the collectors under namespace, which may be empty, and registers
+// them with reg, e.g. prometheus.DefaultRegisterer.
+func NewMetrics(reg prom.Registerer, namespace string) (*Metrics, error) {
+	m := &Metrics{
+		sends: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace, Subsystem: "verification", Name: "send_duration_seconds",
+			Help: "Duration of the sends of verification codes, including the provider call.",
+		}, []string{"medium", "type", "result"}),
+		verifies: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace, Subsystem: "verification", Name: "verifications_total",
+			Help: "Verifications of codes by result.",
+		}, []string{"medium", "type", "result"}),
+		rejections: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace, Subsystem: "verification", Name: "limit_rejections_total",
+			Help: "Sends and verifications rejected by the rate limiters and quotas.",
+		}, []string{"medium", "type", "limiter"}),
+		providers: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace, Subsystem: "verification", Name: "provider_duration_seconds",
+			Help: "Duration of the calls of the delivery providers.",
+		}, []string{"provider", "medium", "result"}),
+		redis: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace, Subsystem: "verification", Name: "redis_duration_seconds",
+			Help:    "Duration of the Redis commands.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"command", "result"}),
+	}
+	for _, c := range []prom.Collector{m.sends, m.verifies, m.rejections, m.providers, m.redis} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ObserveSend implements verification.Metrics.
+func (m *Metrics) ObserveSend(medium string, typ verification.CodeType, result string, d time.Duration) {
+	m.sends.WithLabelValues(medium, string(typ), result).Observe(d.Seconds())
+}
+
+// ObserveVerify implements verification.Metrics.
+func (m *Metrics) ObserveVerify(medium string, typ verification.CodeType, result string) {
+	m.verifies.WithLabelValues(medium, string(typ), result).Inc()
+}
+
+// ObserveRejection implements verification.Metrics.
+func (m *Metrics) ObserveRejection(medium string, typ verification.CodeType, limiter string) {
+	m.rejections.WithLabelValues(medium, string(typ), limiter).Inc()
+}
+
+// ObserveProvider implements verification.Metrics.
+func (m *Metrics) ObserveProvider(provider, medium, result string, d time.Duration) {
+	m.providers.WithLabelValues(provider, medium, result).Observe(d.Seconds())
+}
+
+// ObserveRedis implements verification.Metrics.
+func (m *Metrics) ObserveRedis(command, result string, d time.Duration) {
+	m.redis.WithLabelValues(command, result).Observe(d.Seconds())
+}
@@ -0,0 +1,119 @@
+package verification
+
+import (
+	"github.com/google/wire"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/fx"
+)
+
+// MobileOTPConfig is the OTPConfig of the mobile channel.
+type MobileOTPConfig OTPConfig
+
+// EmailOTPConfig is the OTPConfig of the email channel.
+type EmailOTPConfig OTPConfig
+
+// EcdsaOTPConfig is the OTPConfig of the ECDSA channel.
+type EcdsaOTPConfig OTPConfig
+
+// Ed25519OTPConfig is the OTPConfig of the ed25519 channel.
+type Ed25519OTPConfig OTPConfig
+
+// NewMobileOTPService creates the OTPService of the mobile channel.
+func NewMobileOTPService(cfg MobileOTPConfig, client redis.UniversalClient,
+	sender CodeSender[MobileCode],
+) *OTPService[MobileCode] {
+	return NewOTPService[MobileCode](OTPConfig(cfg), client, sender)
+}
+
+// NewEmailOTPService creates the OTPService of the email channel.
+func NewEmailOTPService(cfg EmailOTPConfig, client redis.UniversalClient,
+	sender CodeSender[EmailCode],
+) *OTPService[EmailCode] {
+	return NewOTPService[EmailCode](OTPConfig(cfg), client, sender)
+}
+
+// NewEcdsaOTPService creates the OTPService of the ECDSA channel, which has no external delivery.
+func NewEcdsaOTPService(cfg EcdsaOTPConfig, client redis.UniversalClient) *OTPService[EcdsaCode] {
+	return NewOTPService[EcdsaCode](OTPConfig(cfg), client, nil)
+}
+
+// NewEd25519OTPService creates the OTPService of the ed25519 channel, which has no external delivery.
+func NewEd25519OTPService(cfg Ed25519OTPConfig, client redis.UniversalClient) *OTPService[Ed25519Code] {
+	return NewOTPService[Ed25519Code](OTPConfig(cfg), client, nil)
+}
+
+// NewMobileOTPConfig returns the mobile channel of cfg, ErrInvalidConfig when it is
+// not configured.
+func NewMobileOTPConfig(cfg *Config) (MobileOTPConfig, error) {
+	c, err := cfg.channel("mobile", cfg.Mobile)
+	return MobileOTPConfig(c), err
+}
+
+// NewEmailOTPConfig returns the email channel of cfg, ErrInvalidConfig when it is not
+// configured.
+func NewEmailOTPConfig(cfg *Config) (EmailOTPConfig, error) {
+	c, err := cfg.channel("email", cfg.Email)
+	return EmailOTPConfig(c), err
+}
+
+// NewEcdsaOTPConfig returns the ECDSA channel of cfg, ErrInvalidConfig when it is not
+// configured.
+func NewEcdsaOTPConfig(cfg *Config) (EcdsaOTPConfig, error) {
+	c, err := cfg.channel("ecdsa", cfg.Ecdsa)
+	return EcdsaOTPConfig(c), err
+}
+
+// NewEd25519OTPConfig returns the ed25519 channel of cfg, ErrInvalidConfig when it is
+// not configured.
+func NewEd25519OTPConfig(cfg *Config) (Ed25519OTPConfig, error) {
+	c, err := cfg.channel("ed25519", cfg.Ed25519)
+	return Ed25519OTPConfig(c), err
+}
+
+// NewConfigGenerator creates the CodeGenerator of the generator config of cfg.
+func NewConfigGenerator(cfg *Config) CodeGenerator {
+	return cfg.Generator.Generator()
+}
+
+// ProviderSet is the wire provider set of the per-channel OTP services. The application
+// provides the channel configs, the redis client and the senders, e.g. smtp.ProviderSet.
+var ProviderSet = wire.NewSet(
+	NewMobileOTPService,
+	NewEmailOTPService,
+	NewEcdsaOTPService,
+	NewEd25519OTPService,
+)
+
+// Module is the fx equivalent of ProviderSet.
+var Module = fx.Options(
+	fx.Provide(
+		NewMobileOTPService,
+		NewEmailOTPService,
+		NewEcdsaOTPService,
+		NewEd25519OTPService,
+	),
+)
+
+// ConfigProviderSet extends ProviderSet with the channel configs and the CodeGenerator
+// of a *Config, so the application only provides the *Config, the redis client and the
+// senders. The services build their CodeStore and rate limiters on the redis client.
+var ConfigProviderSet = wire.NewSet(
+	ProviderSet,
+	NewMobileOTPConfig,
+	NewEmailOTPConfig,
+	NewEcdsaOTPConfig,
+	NewEd25519OTPConfig,
+	NewConfigGenerator,
+)
+
+// ConfigModule is the fx equivalent of ConfigProviderSet.
+var ConfigModule = fx.Options(
+	Module,
+	fx.Provide(
+		NewMobileOTPConfig,
+		NewEmailOTPConfig,
+		NewEcdsaOTPConfig,
+		NewEd25519OTPConfig,
+		NewConfigGenerator,
+	),
+)
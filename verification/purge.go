@@ -0,0 +1,137 @@
+package verification
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// purgeScript deletes a key only while it still has no expiry, so a key whose TTL is
+// set between the scan and the purge survives.
+var purgeScript = redis.NewScript(`
+if redis.call('PTTL', KEYS[1]) == -1 then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// purgeBatchSize is the number of scanned keys whose TTLs are read in one pipeline.
+const purgeBatchSize = 100
+
+// PurgeReport is the result of a KeyPurger pass.
+type PurgeReport struct {
+	Scanned int64 // Keys of the prefixes seen
+	Orphans int64 // Keys without expiry found
+	Purged  int64 // Keys deleted, zero in a dry run
+	// ByCategory counts the orphans per key category, e.g. "VERIFICATION_CODE".
+	ByCategory map[string]int64
+}
+
+// KeyPurgerConfig configures a KeyPurger.
+type KeyPurgerConfig struct {
+	// Prefixes are the key prefixes of the services to purge, e.g. the Prefix and the
+	// PreviousPrefix of an OTPConfig.
+	Prefixes []CodeCacheKeyPrefix
+	// DryRun only counts the orphans.
+	DryRun bool
+}
+
+// KeyPurger deletes the verification keys without expiry. Every key the services write
+// expires, but a key can lose its TTL, e.g. through a PERSIST during an incident or a
+// bug in an external tool, and would then stay forever. The block lists, which are
+// permanent by design, are skipped.
+type KeyPurger struct {
+	client redis.UniversalClient
+	cfg    KeyPurgerConfig
+}
+
+// NewKeyPurger creates a KeyPurger.
+func NewKeyPurger(client redis.UniversalClient, cfg KeyPurgerConfig) *KeyPurger {
+	return &KeyPurger{client: client, cfg: cfg}
+}
+
+// Purge scans the keys of the prefixes once and deletes those without expiry, e.g. from
+// a cron job.
+func (p *KeyPurger) Purge(ctx context.Context) (*PurgeReport, error) {
+	report := &PurgeReport{ByCategory: map[string]int64{}}
+	for _, prefix := range p.cfg.Prefixes {
+		var (
+			batch []string
+			err   error
+		)
+		scanErr := scanKeys(ctx, p.client, escapeGlob(string(prefix))+":VERIFICATION_*", func(key string) {
+			if err != nil {
+				return
+			}
+			batch = append(batch, key)
+			if len(batch) == purgeBatchSize {
+				err = p.purge(ctx, prefix, batch, report)
+				batch = batch[:0]
+			}
+		})
+		if err == nil && scanErr == nil {
+			err = p.purge(ctx, prefix, batch, report)
+		}
+		if scanErr != nil {
+			return report, scanErr
+		}
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// purge deletes the keys of prefix in batch without expiry.
+func (p *KeyPurger) purge(ctx context.Context, prefix CodeCacheKeyPrefix, batch []string, report *PurgeReport) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	pipe := p.client.Pipeline()
+	ttls := make([]*redis.DurationCmd, len(batch))
+	for i, key := range batch {
+		ttls[i] = pipe.PTTL(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("verification: redis pttl failed: %w", err)
+	}
+	for i, key := range batch {
+		report.Scanned++
+		category, _, _ := strings.Cut(strings.TrimPrefix(key, string(prefix)+":"), ":")
+		if ttls[i].Val() != -1 || category == "VERIFICATION_BLOCK" {
+			continue
+		}
+		report.Orphans++
+		report.ByCategory[category]++
+		if p.cfg.DryRun {
+			continue
+		}
+		n, err := purgeScript.Run(ctx, p.client, []string{key}).Int64()
+		if err != nil {
+			return fmt.Errorf("verification: redis purge failed: %w", err)
+		}
+		report.Purged += n
+	}
+	return nil
+}
+
+// Run purges every interval until ctx is done, e.g. in a goroutine of the service.
+// The report and the error of each pass are passed to onReport when it is not nil.
+func (p *KeyPurger) Run(ctx context.Context, interval time.Duration, onReport func(*PurgeReport, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := p.Purge(ctx)
+			if onReport != nil {
+				onReport(report, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package verification
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_KeyPurger(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	gen := NewTestCodeGenerator("666666")
+	svc := NewOTPService[MobileCode](mobileTestConfig(10, 10), client, &fakeSMSSender{})
+	var keys []string
+	for _, mobile := range []string{"13800138001", "13800138002", "13800138003"} {
+		mc, err := gen.NewMobileCode("login", 1, mobile, "86")
+		require.NoError(t, err)
+		seq, err := svc.Send(ctx, mc)
+		require.NoError(t, err)
+		keys = append(keys, NewCacheKeyBuilder("TEST").CodeKey("MOBILE", "LOGIN", seq, mobile, "86"))
+	}
+	require.NoError(t, client.Persist(ctx, keys[0]).Err())
+	require.NoError(t, client.Persist(ctx, NewCacheKeyBuilder("TEST").LimitKey("MOBILE", "LOGIN", "13800138002", "86")).Err())
+	require.NoError(t, NewRedisBlockList(client, "TEST").Block(ctx, BlockMobile, "8613800138009", 0))
+	require.NoError(t, client.Set(ctx, "OTHER:VERIFICATION_CODE:x", 1, 0).Err())
+
+	report, err := NewKeyPurger(client, KeyPurgerConfig{Prefixes: []CodeCacheKeyPrefix{"TEST"}, DryRun: true}).Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), report.Scanned)
+	assert.Equal(t, int64(2), report.Orphans)
+	assert.Zero(t, report.Purged)
+
+	report, err = NewKeyPurger(client, KeyPurgerConfig{Prefixes: []CodeCacheKeyPrefix{"TEST"}}).Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &PurgeReport{Scanned: 7, Orphans: 2, Purged: 2,
+		ByCategory: map[string]int64{"VERIFICATION_CODE": 1, "VERIFICATION_SEND_LIMIT": 1}}, report)
+	n, err := client.Exists(ctx, keys...).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = client.Exists(ctx, "OTHER:VERIFICATION_CODE:x", NewCacheKeyBuilder("TEST").BlockKey("MOBILE")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+}
@@ -0,0 +1,205 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrQRPayloadInvalid indicates a scanned payload that is not a QR challenge link.
+	ErrQRPayloadInvalid = bizerrors.New(400, "VERIFICATION_QR_PAYLOAD_INVALID", "qr payload is invalid")
+	// ErrQRChallengeConfirmed indicates a QR challenge confirmed before.
+	ErrQRChallengeConfirmed = bizerrors.New(409, "VERIFICATION_QR_CHALLENGE_CONFIRMED", "qr challenge already confirmed")
+)
+
+// qrConfirmScript confirms a pending challenge whose token digest matches, keeping its
+// TTL. It returns 0 when the challenge is missing, 1 on a mismatch, 2 when it was
+// confirmed before and 3 when it is confirmed now.
+var qrConfirmScript = redis.NewScript(`
+local digest = redis.call('HGET', KEYS[1], 'digest')
+if not digest then
+  return 0
+end
+local diff = #digest == #ARGV[1] and 0 or 1
+for i = 1, math.min(#digest, #ARGV[1]) do
+  if digest:byte(i) ~= ARGV[1]:byte(i) then
+    diff = diff + 1
+  end
+end
+if diff ~= 0 then
+  return 1
+end
+if redis.call('HGET', KEYS[1], 'state') == 'CONFIRMED' then
+  return 2
+end
+redis.call('HSET', KEYS[1], 'state', 'CONFIRMED', 'user_id', ARGV[2])
+return 3
+`)
+
+// qrPollScript returns the state and user of a challenge, and deletes it once it is
+// confirmed so the confirmation is handed out once.
+var qrPollScript = redis.NewScript(`
+local v = redis.call('HMGET', KEYS[1], 'state', 'user_id')
+if not v[1] then
+  return {'', '0'}
+end
+if v[1] == 'CONFIRMED' then
+  redis.call('DEL', KEYS[1])
+end
+return {v[1], v[2] or '0'}
+`)
+
+// QRState is the state of a QR challenge.
+type QRState string
+
+const (
+	// QRPending is a challenge waiting to be scanned and confirmed.
+	QRPending QRState = "PENDING"
+	// QRConfirmed is a challenge confirmed by the user of the scanning app.
+	QRConfirmed QRState = "CONFIRMED"
+)
+
+// QRConfig configures a QRService.
+type QRConfig struct {
+	Prefix CodeCacheKeyPrefix
+	TTL    time.Duration // Challenge expiration, 2 minutes when zero
+	// Link is the deep link the payloads extend with the type, sequence and token,
+	// e.g. "myapp://verify/qr" or "https://example.com/qr".
+	Link string
+	// Sequence generates the sequences, SequenceRandom when nil.
+	Sequence SequenceFunc
+}
+
+// applyDefaultValue fills zero fields with defaults.
+func (c *QRConfig) applyDefaultValue() {
+	if c.TTL <= 0 {
+		c.TTL = 2 * time.Minute
+	}
+	if c.Sequence == nil {
+		c.Sequence = SequenceRandom
+	}
+}
+
+// QRChallenge is a challenge issued by QRService.Issue.
+type QRChallenge struct {
+	Type     CodeType
+	Sequence string // Identifies the challenge in Poll
+	// Payload is the deep link to encode in the QR code, it carries a one-time token
+	// and must only be shown to the client that issued it.
+	Payload   string
+	ExpiresAt time.Time
+}
+
+// QRStatus is the status of a QR challenge, see QRService.Poll.
+type QRStatus struct {
+	State  QRState `json:"state"`
+	UserID int64   `json:"user_id,omitempty"` // User that confirmed the challenge
+}
+
+// QRService implements "scan with app to verify": a client without session shows the
+// payload of a challenge as QR code, the signed-in app scans it and confirms it for its
+// user, and the client polls the challenge until it is confirmed. Only the SHA-256 of
+// the token is stored, a challenge expires after TTL and confirms once.
+type QRService struct {
+	client redis.UniversalClient
+	keys   *CacheKeyBuilder
+	cfg    QRConfig
+}
+
+// NewQRService creates a QRService.
+func NewQRService(client redis.UniversalClient, cfg QRConfig) *QRService {
+	cfg.applyDefaultValue()
+	return &QRService{client: client, keys: NewCacheKeyBuilder(cfg.Prefix), cfg: cfg}
+}
+
+// Issue issues a pending challenge of typ.
+func (s *QRService) Issue(ctx context.Context, typ CodeType) (*QRChallenge, error) {
+	if typ == "" {
+		return nil, ErrCodeTypeIsEmpty
+	}
+	typ = CodeType(strings.ToUpper(string(typ)))
+	seq, token := s.cfg.Sequence(), randomHex(16)
+	key := s.keys.QRKey(typ, seq)
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "digest", hashCode(token), "state", string(QRPending))
+		pipe.PExpire(ctx, key, s.cfg.TTL)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("verification: redis hset failed: %w", err)
+	}
+	q := url.Values{"type": {string(typ)}, "seq": {seq}, "token": {token}}
+	sep := "?"
+	if strings.Contains(s.cfg.Link, "?") {
+		sep = "&"
+	}
+	return &QRChallenge{
+		Type:      typ,
+		Sequence:  seq,
+		Payload:   s.cfg.Link + sep + q.Encode(),
+		ExpiresAt: timeNow().Add(s.cfg.TTL),
+	}, nil
+}
+
+// Confirm confirms the challenge of a scanned payload for userID, the user signed in
+// to the app. It returns the type of the challenge, e.g. to ask the user to approve a
+// LOGIN, ErrCodeNotFound if it expired or was polled, ErrCodeIncorrect if the token
+// doesn't match and ErrQRChallengeConfirmed if it was confirmed before.
+func (s *QRService) Confirm(ctx context.Context, payload string, userID int64) (CodeType, error) {
+	typ, seq, token, err := ParseQRPayload(payload)
+	if err != nil {
+		return "", err
+	}
+	res, err := qrConfirmScript.Run(ctx, s.client, []string{s.keys.QRKey(typ, seq)}, hashCode(token), userID).Int64()
+	if err != nil {
+		return "", fmt.Errorf("verification: redis qr confirm failed: %w", err)
+	}
+	switch res {
+	case 0:
+		return "", ErrCodeNotFound
+	case 1:
+		return "", ErrCodeIncorrect
+	case 2:
+		return "", ErrQRChallengeConfirmed
+	}
+	return typ, nil
+}
+
+// Poll returns the status of the challenge of typ and sequence for the issuing client.
+// A confirmed challenge is returned once with the confirming user and deleted, later
+// polls return ErrCodeNotFound like an expired challenge.
+func (s *QRService) Poll(ctx context.Context, typ CodeType, sequence string) (*QRStatus, error) {
+	typ = CodeType(strings.ToUpper(string(typ)))
+	res, err := qrPollScript.Run(ctx, s.client, []string{s.keys.QRKey(typ, sequence)}).StringSlice()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("verification: redis qr poll failed: %w", err)
+	}
+	if len(res) != 2 || res[0] == "" {
+		return nil, ErrCodeNotFound
+	}
+	userID, _ := strconv.ParseInt(res[1], 10, 64)
+	return &QRStatus{State: QRState(res[0]), UserID: userID}, nil
+}
+
+// ParseQRPayload returns the type, sequence and token of a payload issued by
+// QRService.Issue, e.g. for the app to tell the user what they confirm.
+func ParseQRPayload(payload string) (typ CodeType, sequence, token string, err error) {
+	u, err := url.Parse(payload)
+	if err != nil {
+		return "", "", "", fmt.Errorf("%w: %v", ErrQRPayloadInvalid, err)
+	}
+	q := u.Query()
+	typ, sequence, token = CodeType(q.Get("type")), q.Get("seq"), q.Get("token")
+	if typ == "" || sequence == "" || token == "" {
+		return "", "", "", ErrQRPayloadInvalid
+	}
+	return typ, sequence, token, nil
+}
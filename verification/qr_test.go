@@ -0,0 +1,54 @@
+package verification
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_QRService(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, ff := getRedisClient(t)
+	defer cleanup()
+
+	svc := NewQRService(client, QRConfig{Prefix: "TEST", Link: "myapp://verify/qr"})
+	ch, err := svc.Issue(ctx, "login")
+	require.NoError(t, err)
+	assert.Equal(t, CodeType("LOGIN"), ch.Type)
+	typ, seq, token, err := ParseQRPayload(ch.Payload)
+	require.NoError(t, err)
+	assert.Equal(t, CodeType("LOGIN"), typ)
+	assert.Equal(t, ch.Sequence, seq)
+	assert.True(t, strings.HasPrefix(ch.Payload, "myapp://verify/qr?"))
+
+	status, err := svc.Poll(ctx, "LOGIN", ch.Sequence)
+	require.NoError(t, err)
+	assert.Equal(t, &QRStatus{State: QRPending}, status)
+
+	_, err = svc.Confirm(ctx, strings.Replace(ch.Payload, token, randomHex(16), 1), 42)
+	assert.ErrorIs(t, err, ErrCodeIncorrect)
+	_, err = svc.Confirm(ctx, "myapp://verify/qr?type=LOGIN", 42)
+	assert.ErrorIs(t, err, ErrQRPayloadInvalid)
+	typ, err = svc.Confirm(ctx, ch.Payload, 42)
+	require.NoError(t, err)
+	assert.Equal(t, CodeType("LOGIN"), typ)
+	_, err = svc.Confirm(ctx, ch.Payload, 43)
+	assert.ErrorIs(t, err, ErrQRChallengeConfirmed)
+
+	// The confirmation is handed out once.
+	status, err = svc.Poll(ctx, "login", ch.Sequence)
+	require.NoError(t, err)
+	assert.Equal(t, &QRStatus{State: QRConfirmed, UserID: 42}, status)
+	_, err = svc.Poll(ctx, "LOGIN", ch.Sequence)
+	assert.ErrorIs(t, err, ErrCodeNotFound)
+
+	ch, err = svc.Issue(ctx, "login")
+	require.NoError(t, err)
+	ff(2 * time.Minute)
+	_, err = svc.Confirm(ctx, ch.Payload, 42)
+	assert.ErrorIs(t, err, ErrCodeNotFound)
+}
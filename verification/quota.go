@@ -0,0 +1,62 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DailyQuota caps the number of actions per key and UTC calendar day, e.g. the codes
+// sent per CodeType across all targets to protect SMS spend.
+type DailyQuota struct {
+	client   redis.UniversalClient
+	limit    int64
+	limitErr error
+}
+
+// NewDailyQuota creates a DailyQuota of limit actions per day, exceeding it returns
+// *RateLimitError wrapping limitErr.
+func NewDailyQuota(client redis.UniversalClient, limit int64, limitErr error) *DailyQuota {
+	return &DailyQuota{client: client, limit: limit, limitErr: limitErr}
+}
+
+// dayKey returns the counter key of key for the current day and the time until the
+// day ends.
+func dayKey(key string) (string, time.Duration) {
+	now := timeNow().UTC()
+	end := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return fmt.Sprintf("%s:%s", key, now.Format("20060102")), end.Sub(now)
+}
+
+// Allow records an action for key in the current day.
+// Returns nil if allowed, *RateLimitError if exceeded, or an error on failure.
+func (q *DailyQuota) Allow(ctx context.Context, key string) error {
+	dk, rest := dayKey(key)
+	res, err := allowScript.Run(ctx, q.client, []string{dk}, q.limit, rest.Milliseconds()).Int64Slice()
+	if err != nil {
+		return fmt.Errorf("quota: %w", err)
+	}
+	if res[0] != 1 {
+		return &RateLimitError{Err: q.limitErr, RetryIn: time.Duration(res[3]) * time.Millisecond}
+	}
+	return nil
+}
+
+// Undo reverses the last recorded action of the current day.
+func (q *DailyQuota) Undo(ctx context.Context, key string) error {
+	dk, _ := dayKey(key)
+	return undoScript.Run(ctx, q.client, []string{dk}).Err()
+}
+
+// Used returns the number of actions recorded for key in the current day.
+func (q *DailyQuota) Used(ctx context.Context, key string) (int64, error) {
+	dk, _ := dayKey(key)
+	n, err := q.client.Get(ctx, dk).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
+}
@@ -0,0 +1,52 @@
+package verification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_Service_DailyQuota(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	now := time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	cfg := mobileTestConfig(1, 10)
+	cfg.DailyQuota = 2
+	gen := NewTestCodeGenerator("666666")
+	svc := NewOTPService[MobileCode](cfg, client, &fakeSMSSender{})
+
+	send := func(typ CodeType, mobile string) error {
+		mc, err := gen.NewMobileCode(typ, 1, mobile, "86")
+		require.NoError(t, err)
+		_, err = svc.Send(ctx, mc)
+		return err
+	}
+	require.NoError(t, send("login", "13800138001"))
+	require.NoError(t, send("login", "13800138002"))
+
+	// The quota applies across targets and is checked before the target limit.
+	err := send("login", "13800138001")
+	var rlErr *RateLimitError
+	require.ErrorAs(t, err, &rlErr)
+	assert.ErrorIs(t, err, ErrGlobalQuotaExceeded)
+	assert.Equal(t, time.Hour, rlErr.RetryIn)
+
+	// Other code types have their own quota.
+	require.NoError(t, send("register", "13800138001"))
+
+	// The quota resets with the day.
+	now = now.Add(2 * time.Hour)
+	require.NoError(t, send("login", "13800138003"))
+	used, err := NewDailyQuota(client, 2, ErrGlobalQuotaExceeded).Used(ctx,
+		NewCacheKeyBuilder("TEST").QuotaKey("MOBILE", "login"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), used)
+}
@@ -0,0 +1,178 @@
+package verification
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+)
+
+// ErrTemplateInvalid indicates a template that does not parse or references unknown fields.
+var ErrTemplateInvalid = bizerrors.New(500, "VERIFICATION_TEMPLATE_INVALID", "template is invalid")
+
+// RenderConfig holds the values of TemplateData that are not part of the code, loadable
+// from YAML or env.
+type RenderConfig struct {
+	AppName string        `json:"app_name" yaml:"app_name"` // Rendered as {{.AppName}}
+	CodeTTL time.Duration `json:"code_ttl" yaml:"code_ttl"` // Validity of the codes, usually OTPConfig.TTL
+}
+
+// TemplateData is the data the senders render the templates with, e.g.
+// "Your {{.AppName}} code is {{.Code}}, valid for {{.TTLMinutes}} minutes."
+type TemplateData struct {
+	Code       string // Plaintext code
+	Value      string // Same as Code, for templates written against the code types
+	Type       CodeType
+	Sequence   string
+	Locale     string
+	Target     string // Mobile number, email address or wallet address
+	AppName    string
+	TTL        time.Duration
+	TTLMinutes int // TTL rounded up to whole minutes
+}
+
+// NewTemplateData returns the TemplateData of code.
+func NewTemplateData[T VerificationCode](code *T, cfg RenderConfig) TemplateData {
+	c := any(code).(interface {
+		GetValue() string
+		GetSequence() string
+		GetType() CodeType
+		GetLocale() string
+	})
+	data := TemplateData{
+		Code:       c.GetValue(),
+		Value:      c.GetValue(),
+		Type:       c.GetType(),
+		Sequence:   c.GetSequence(),
+		Locale:     c.GetLocale(),
+		AppName:    cfg.AppName,
+		TTL:        cfg.CodeTTL,
+		TTLMinutes: int((cfg.CodeTTL + time.Minute - 1) / time.Minute),
+	}
+	data.Target = recipient(code)
+	return data
+}
+
+// recipient returns the mobile number, the email address or the wallet address of code.
+func recipient(code any) string {
+	switch v := code.(type) {
+	case *MobileCode:
+		return v.Mobile
+	case *EmailCode:
+		return v.Email
+	case *EcdsaCode:
+		return v.Address
+	case *Ed25519Code:
+		return v.Address
+	}
+	return ""
+}
+
+// ContentTemplate is a text/template rendering TemplateData.
+type ContentTemplate struct {
+	tmpl *template.Template
+}
+
+// ParseContentTemplate parses text, it returns ErrTemplateInvalid for a syntax error or
+// a reference to a field TemplateData does not have, so broken templates fail where
+// they are loaded instead of at the first send.
+func ParseContentTemplate(name, text string) (*ContentTemplate, error) {
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTemplateInvalid, err)
+	}
+	if err = t.Execute(io.Discard, TemplateData{}); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTemplateInvalid, err)
+	}
+	return &ContentTemplate{tmpl: t}, nil
+}
+
+// Render executes the template with data.
+func (t *ContentTemplate) Render(data TemplateData) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("verification: render %s failed: %w", t.tmpl.Name(), err)
+	}
+	return b.String(), nil
+}
+
+// EmailContent is an email rendered from an EmailTemplate.
+type EmailContent struct {
+	Subject  string
+	HTMLBody string // Empty for plain text emails
+	TextBody string // The plain text body, or the alternative of HTMLBody when set
+}
+
+// EmailContentTemplate is a parsed EmailTemplate, the email senders cache it per code
+// type and locale.
+type EmailContentTemplate struct {
+	subject *ContentTemplate
+	body    *ContentTemplate
+	text    *ContentTemplate // Plain text alternative of an HTML body, optional
+	html    bool
+}
+
+// ParseEmailTemplate parses the subject and the bodies of t, it returns
+// ErrTemplateInvalid like ParseContentTemplate.
+func ParseEmailTemplate(t *EmailTemplate) (*EmailContentTemplate, error) {
+	subject, err := ParseContentTemplate("subject", t.Subject)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ParseContentTemplate("email", t.BodyFormat)
+	if err != nil {
+		return nil, err
+	}
+	et := &EmailContentTemplate{subject: subject, body: body, html: t.ContentType == "text/html"}
+	if et.html && t.TextFormat != "" {
+		if et.text, err = ParseContentTemplate("email text", t.TextFormat); err != nil {
+			return nil, err
+		}
+	}
+	return et, nil
+}
+
+// Render renders the email for data.
+func (t *EmailContentTemplate) Render(data TemplateData) (*EmailContent, error) {
+	subject, err := t.subject.Render(data)
+	if err != nil {
+		return nil, err
+	}
+	body, err := t.body.Render(data)
+	if err != nil {
+		return nil, err
+	}
+	if !t.html {
+		return &EmailContent{Subject: subject, TextBody: body}, nil
+	}
+	content := &EmailContent{Subject: subject, HTMLBody: body}
+	if t.text != nil {
+		if content.TextBody, err = t.text.Render(data); err != nil {
+			return nil, err
+		}
+	}
+	return content, nil
+}
+
+// sampleCode is the code rendered by the template validations, a template that does not
+// output it does not show the code.
+const sampleCode = "739184"
+
+// validateContent parses text and checks that it renders the code.
+func validateContent(name, text string) error {
+	t, err := ParseContentTemplate(name, text)
+	if err != nil {
+		return err
+	}
+	out, err := t.Render(TemplateData{Code: sampleCode, Value: sampleCode})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrTemplateInvalid, err)
+	}
+	if !strings.Contains(out, sampleCode) {
+		return fmt.Errorf("%w: %s does not render {{.Code}}", ErrTemplateInvalid, name)
+	}
+	return nil
+}
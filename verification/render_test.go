@@ -0,0 +1,59 @@
+package verification
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_ContentTemplate(t *testing.T) {
+	tmpl, err := ParseContentTemplate("sms", `Your {{.AppName}} code is {{.Code}}, valid for {{.TTLMinutes}} minutes.`)
+	require.NoError(t, err)
+	mc, err := NewTestCodeGenerator("123456").NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	data := NewTemplateData(mc, RenderConfig{AppName: "Acme", CodeTTL: 90 * time.Second})
+	assert.Equal(t, "13800138000", data.Target)
+	out, err := tmpl.Render(data)
+	require.NoError(t, err)
+	assert.Equal(t, "Your Acme code is 123456, valid for 2 minutes.", out)
+
+	// Templates written against the code types keep rendering Value.
+	tmpl, err = ParseContentTemplate("sms", `{"code":"{{.Value}}"}`)
+	require.NoError(t, err)
+	out, err = tmpl.Render(data)
+	require.NoError(t, err)
+	assert.Equal(t, `{"code":"123456"}`, out)
+
+	for _, text := range []string{`{{.Code`, `{{.Mobile}}`, `{{template "missing"}}`} {
+		_, err = ParseContentTemplate("sms", text)
+		assert.ErrorIs(t, err, ErrTemplateInvalid, text)
+	}
+}
+
+func TestVerification_EmailContentTemplate(t *testing.T) {
+	ec, err := NewTestCodeGenerator("123456").NewEmailCode("login", 1, "user@example.com")
+	require.NoError(t, err)
+	data := NewTemplateData(ec, RenderConfig{AppName: "Acme"})
+
+	tmpl, err := ParseEmailTemplate(&EmailTemplate{Subject: "{{.AppName}} code", BodyFormat: "<b>{{.Code}}</b>",
+		ContentType: "text/html", TextFormat: "Code: {{.Code}}"})
+	require.NoError(t, err)
+	content, err := tmpl.Render(data)
+	require.NoError(t, err)
+	assert.Equal(t, &EmailContent{Subject: "Acme code", HTMLBody: "<b>123456</b>", TextBody: "Code: 123456"}, content)
+
+	// TextFormat is only the alternative of HTML bodies.
+	tmpl, err = ParseEmailTemplate(&EmailTemplate{Subject: "Code", BodyFormat: "{{.Code}}", TextFormat: "x"})
+	require.NoError(t, err)
+	content, err = tmpl.Render(data)
+	require.NoError(t, err)
+	assert.Equal(t, &EmailContent{Subject: "Code", TextBody: "123456"}, content)
+
+	_, err = ParseEmailTemplate(&EmailTemplate{Subject: "Code", BodyFormat: "{{.Code}}", ContentType: "text/html",
+		TextFormat: "{{.Nope}}"})
+	assert.ErrorIs(t, err, ErrTemplateInvalid)
+	assert.ErrorIs(t, EmailTemplate{Subject: "Code", BodyFormat: "{{.Code}}", ContentType: "text/html",
+		TextFormat: "Your code"}.Validate(), ErrTemplateInvalid)
+}
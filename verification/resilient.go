@@ -0,0 +1,219 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+)
+
+// ErrCircuitOpen indicates that a sender failed repeatedly and is not called until its
+// circuit half-opens.
+var ErrCircuitOpen = bizerrors.New(503, "VERIFICATION_CIRCUIT_OPEN", "sender circuit is open")
+
+// CircuitState is the state of the circuit breaker of a ResilientSender.
+type CircuitState int
+
+const (
+	// CircuitClosed passes sends to the sender.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails sends with ErrCircuitOpen.
+	CircuitOpen
+	// CircuitHalfOpen passes one probe send, closing the circuit on success.
+	CircuitHalfOpen
+)
+
+// String returns the state name for logs and metric labels.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// ResilienceConfig configures the retries and the circuit breaker of a ResilientSender.
+type ResilienceConfig struct {
+	MaxAttempts      int           // Attempts per send including the first, default 3
+	InitialBackoff   time.Duration // Backoff before the first retry, default 100ms
+	MaxBackoff       time.Duration // Backoff cap, default 2s
+	FailureThreshold int           // Consecutive failures opening the circuit, default 5
+	OpenTimeout      time.Duration // Time until an open circuit half-opens, default 30s
+	// Retryable reports whether an error is transient, by default all errors except
+	// context errors and coded errors below 500 such as ErrUnsupportedCountryCode.
+	// Errors that are not retryable do not count as failures of the circuit.
+	Retryable func(error) bool
+	// OnStateChange, when set, is called on every transition, e.g. to update a gauge.
+	// It runs with the breaker locked and must not call the sender.
+	OnStateChange func(from, to CircuitState)
+}
+
+// applyDefaultValue fills zero fields with defaults.
+func (c *ResilienceConfig) applyDefaultValue() {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 3
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = 100 * time.Millisecond
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 2 * time.Second
+	}
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = 5
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 30 * time.Second
+	}
+	if c.Retryable == nil {
+		c.Retryable = isTransient
+	}
+}
+
+// isTransient is the default ResilienceConfig.Retryable.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var coded interface{ Code() int }
+	if errors.As(err, &coded) && coded.Code() < 500 {
+		return false
+	}
+	return true
+}
+
+// ResilientSender is a CodeSender decorator retrying transient failures with
+// exponential backoff and jitter, and opening a circuit after repeated failures so a
+// failing provider is not called until a half-open probe succeeds.
+type ResilientSender[T VerificationCode] struct {
+	next CodeSender[T]
+	cfg  ResilienceConfig
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int       // Consecutive failures
+	openedAt time.Time // When the circuit opened
+	probing  bool      // A half-open probe is in flight
+}
+
+// Compile-time assertion: ResilientSender implements CodeSender[MobileCode].
+var _ CodeSender[MobileCode] = (*ResilientSender[MobileCode])(nil)
+
+// NewResilientSender decorates next with retries and a circuit breaker.
+func NewResilientSender[T VerificationCode](next CodeSender[T], cfg ResilienceConfig) *ResilientSender[T] {
+	cfg.applyDefaultValue()
+	return &ResilientSender[T]{next: next, cfg: cfg}
+}
+
+// Send delivers the code, retrying transient failures while the circuit allows.
+func (s *ResilientSender[T]) Send(ctx context.Context, code *T) error {
+	backoff := s.cfg.InitialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if cerr := s.acquire(); cerr != nil {
+			if err != nil {
+				// A retry refused by the circuit reports the failure of the provider.
+				return err
+			}
+			return cerr
+		}
+		err = s.next.Send(ctx, code)
+		transient := err != nil && s.cfg.Retryable(err)
+		s.record(err == nil, transient)
+		if !transient || attempt >= s.cfg.MaxAttempts {
+			return err
+		}
+		// Jitter within [backoff/2, backoff] spreads the retries of concurrent sends.
+		wait := backoff/2 + rand.N(backoff/2+1)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, s.cfg.MaxBackoff)
+	}
+}
+
+// State returns the current circuit state, e.g. for a metrics gauge.
+func (s *ResilientSender[T]) State() CircuitState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == CircuitOpen && !timeNow().Before(s.openedAt.Add(s.cfg.OpenTimeout)) {
+		return CircuitHalfOpen
+	}
+	return s.state
+}
+
+// Check forwards to the sender when it implements Check.
+func (s *ResilientSender[T]) Check(ctx context.Context) error {
+	if c, ok := s.next.(interface{ Check(context.Context) error }); ok {
+		return c.Check(ctx)
+	}
+	return nil
+}
+
+// acquire admits a send: always when closed, one probe at a time when half-open.
+func (s *ResilientSender[T]) acquire() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == CircuitOpen {
+		if timeNow().Before(s.openedAt.Add(s.cfg.OpenTimeout)) {
+			return ErrCircuitOpen
+		}
+		s.transition(CircuitHalfOpen)
+	}
+	if s.state == CircuitHalfOpen {
+		if s.probing {
+			return ErrCircuitOpen
+		}
+		s.probing = true
+	}
+	return nil
+}
+
+// record updates the circuit with the outcome of a send.
+func (s *ResilientSender[T]) record(ok, transient bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.probing = false
+	switch {
+	case ok:
+		s.failures = 0
+		s.transition(CircuitClosed)
+	case !transient:
+		// A rejected request says nothing about the provider, a probe is retried.
+	case s.state == CircuitHalfOpen:
+		s.open()
+	default:
+		s.failures++
+		if s.failures >= s.cfg.FailureThreshold {
+			s.open()
+		}
+	}
+}
+
+// open opens the circuit.
+func (s *ResilientSender[T]) open() {
+	s.openedAt = timeNow()
+	s.failures = 0
+	s.transition(CircuitOpen)
+}
+
+// transition sets the state and reports a change.
+func (s *ResilientSender[T]) transition(to CircuitState) {
+	from := s.state
+	s.state = to
+	if from != to && s.cfg.OnStateChange != nil {
+		s.cfg.OnStateChange(from, to)
+	}
+}
@@ -0,0 +1,82 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptedSMSSender returns the scripted errors in order, then nil.
+type scriptedSMSSender struct {
+	errs  []error
+	calls int
+}
+
+func (f *scriptedSMSSender) Send(context.Context, *MobileCode) error {
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func TestVerification_ResilientSender(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	transient := errors.New("provider timeout")
+	var transitions []string
+	cfg := ResilienceConfig{
+		MaxAttempts: 3, InitialBackoff: time.Millisecond, FailureThreshold: 3, OpenTimeout: time.Minute,
+		OnStateChange: func(from, to CircuitState) { transitions = append(transitions, from.String()+">"+to.String()) },
+	}
+
+	// Transient failures are retried.
+	next := &scriptedSMSSender{errs: []error{transient, transient}}
+	s := NewResilientSender[MobileCode](next, cfg)
+	assert.NoError(t, s.Send(ctx, &MobileCode{}))
+	assert.Equal(t, 3, next.calls)
+	assert.Equal(t, CircuitClosed, s.State())
+
+	// Rejected requests are neither retried nor counted.
+	next = &scriptedSMSSender{errs: []error{ErrUnsupportedCountryCode}}
+	s = NewResilientSender[MobileCode](next, cfg)
+	assert.ErrorIs(t, s.Send(ctx, &MobileCode{}), ErrUnsupportedCountryCode)
+	assert.Equal(t, 1, next.calls)
+
+	// Three consecutive failures open the circuit.
+	next = &scriptedSMSSender{errs: []error{transient, transient, transient, transient}}
+	s = NewResilientSender[MobileCode](next, cfg)
+	assert.ErrorIs(t, s.Send(ctx, &MobileCode{}), transient)
+	assert.Equal(t, CircuitOpen, s.State())
+	assert.ErrorIs(t, s.Send(ctx, &MobileCode{}), ErrCircuitOpen)
+	assert.Equal(t, 3, next.calls)
+
+	// After the timeout a failed probe opens it again, a successful one closes it.
+	now = now.Add(time.Minute)
+	assert.Equal(t, CircuitHalfOpen, s.State())
+	assert.ErrorIs(t, s.Send(ctx, &MobileCode{}), transient)
+	assert.Equal(t, 4, next.calls)
+	assert.ErrorIs(t, s.Send(ctx, &MobileCode{}), ErrCircuitOpen)
+	now = now.Add(time.Minute)
+	assert.NoError(t, s.Send(ctx, &MobileCode{}))
+	assert.Equal(t, CircuitClosed, s.State())
+	assert.Equal(t, []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"},
+		transitions)
+
+	t.Run("context canceled", func(t *testing.T) {
+		next := &scriptedSMSSender{errs: []error{transient, transient}}
+		s := NewResilientSender[MobileCode](next, ResilienceConfig{InitialBackoff: time.Hour})
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, s.Send(ctx, &MobileCode{}), transient)
+		assert.Equal(t, 1, next.calls)
+	})
+}
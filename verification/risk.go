@@ -0,0 +1,133 @@
+package verification
+
+import (
+	"context"
+	"fmt"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+)
+
+var (
+	// ErrRiskDenied indicates a send or verification the RiskEvaluator denied.
+	ErrRiskDenied = bizerrors.New(403, "VERIFICATION_RISK_DENIED", "request denied by risk control")
+	// ErrChallengeRequired indicates a send or verification the RiskEvaluator allows only
+	// after a challenge, e.g. a CAPTCHA, retry it with WithChallengePassed.
+	ErrChallengeRequired = bizerrors.New(403, "VERIFICATION_CHALLENGE_REQUIRED", "challenge required")
+)
+
+// RiskAction is the decision of a RiskEvaluator.
+type RiskAction string
+
+const (
+	// RiskAllow lets the request proceed.
+	RiskAllow RiskAction = "ALLOW"
+	// RiskChallenge fails the request with ErrChallengeRequired unless the caller passed
+	// a challenge, see WithChallengePassed.
+	RiskChallenge RiskAction = "CHALLENGE"
+	// RiskDeny fails the request with ErrRiskDenied.
+	RiskDeny RiskAction = "DENY"
+)
+
+// Operations of a RiskRequest.
+const (
+	RiskOperationSend   = "send"
+	RiskOperationVerify = "verify"
+)
+
+// RiskVelocity is the recent activity around a request, read from the limiters of the
+// service without recording an action. Counters of limits the service doesn't enforce,
+// or of an IP or device the request doesn't carry, are zero.
+type RiskVelocity struct {
+	TargetSends    int64 // Sends to the target in the current Send window
+	IPSends        int64 // Sends from the IP in the current SendByIP window
+	DeviceSends    int64 // Sends from the device in the current SendByDevice window
+	UserSends      int64 // Sends of the user in the current SendByUser window
+	VerifyFailures int64 // Failed verifications of the sequence in the current Verify window
+}
+
+// RiskRequest is a send or verification submitted to a RiskEvaluator.
+type RiskRequest struct {
+	Operation       string // RiskOperationSend or RiskOperationVerify
+	Medium          string
+	Type            CodeType
+	Sequence        string
+	UserID          int64 // Zero for verifications, the probe carries no user
+	Target          Target
+	IP              string // Set with WithIP
+	Device          string // Set with WithDevice
+	ChallengePassed bool   // Set with WithChallengePassed
+	Velocity        RiskVelocity
+}
+
+// RiskEvaluator decides on the sends and verifications of an OTPService, an
+// integration point for external fraud systems. An error fails the request, evaluators
+// wanting to fail open return RiskAllow instead.
+type RiskEvaluator interface {
+	Evaluate(ctx context.Context, req *RiskRequest) (RiskAction, error)
+}
+
+// RiskEvaluatorFunc adapts a function to a RiskEvaluator.
+type RiskEvaluatorFunc func(ctx context.Context, req *RiskRequest) (RiskAction, error)
+
+// Evaluate implements RiskEvaluator.
+func (f RiskEvaluatorFunc) Evaluate(ctx context.Context, req *RiskRequest) (RiskAction, error) {
+	return f(ctx, req)
+}
+
+// WithRiskEvaluator submits every send and verification to e before any limit is
+// consumed, and enforces its decision.
+func WithRiskEvaluator[T CodeConstraint](e RiskEvaluator) OTPServiceOption[T] {
+	return func(s *OTPService[T]) { s.risk = e }
+}
+
+// evaluateRisk submits the operation on code to the RiskEvaluator of the service and
+// returns the error of its decision.
+func (s *OTPService[T]) evaluateRisk(ctx context.Context, operation string, code *T, o sendOptions) error {
+	if s.risk == nil {
+		return nil
+	}
+	c := *code
+	req := &RiskRequest{
+		Operation:       operation,
+		Medium:          c.Medium(),
+		Type:            c.GetType(),
+		Sequence:        c.GetSequence(),
+		Target:          blockTarget(code),
+		IP:              o.ip,
+		Device:          o.device,
+		ChallengePassed: o.challengePassed,
+	}
+	v, err := &req.Velocity, error(nil)
+	if operation == RiskOperationSend {
+		req.UserID = any(code).(interface{ GetUserID() int64 }).GetUserID()
+		v.TargetSends, err = s.sendLimiter.Used(ctx, s.keys.LimitKey(c.Medium(), c.GetType(), c.LimitKeyParts()...))
+		if err == nil && s.ipLimiter != nil && o.ip != "" {
+			v.IPSends, err = s.ipLimiter.Used(ctx, s.keys.IPLimitKey(c.GetType(), o.ip))
+		}
+		if err == nil && s.deviceLimiter != nil && o.device != "" {
+			v.DeviceSends, err = s.deviceLimiter.Used(ctx, s.keys.DeviceLimitKey(c.GetType(), o.device))
+		}
+		if err == nil && s.userLimiter != nil && req.UserID != 0 {
+			v.UserSends, err = s.userLimiter.Used(ctx, s.keys.UserLimitKey(c.GetType(), req.UserID))
+		}
+	} else {
+		v.VerifyFailures, err = s.verifyLimiter.Used(ctx,
+			s.keys.IncorrectKey(c.Medium(), c.GetType(), s.failureParts(code)...))
+	}
+	if err != nil {
+		return err
+	}
+	action, err := s.risk.Evaluate(ctx, req)
+	if err != nil {
+		return fmt.Errorf("verification: risk evaluation failed: %w", err)
+	}
+	switch action {
+	case RiskDeny:
+		return ErrRiskDenied
+	case RiskChallenge:
+		if !o.challengePassed {
+			return ErrChallengeRequired
+		}
+	}
+	return nil
+}
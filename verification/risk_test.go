@@ -0,0 +1,64 @@
+package verification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_Service_RiskEvaluator(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	cfg := mobileTestConfig(10, 10)
+	cfg.SendByIP = RateLimiterConfig{Limit: 10, Window: time.Hour, LimitErr: ErrIPSendLimitExceeded}
+	var reqs []RiskRequest
+	risk := RiskEvaluatorFunc(func(_ context.Context, req *RiskRequest) (RiskAction, error) {
+		reqs = append(reqs, *req)
+		switch {
+		case req.IP == "6.6.6.6":
+			return RiskDeny, nil
+		case req.Operation == RiskOperationSend && req.Velocity.TargetSends >= 2,
+			req.Operation == RiskOperationVerify && req.Velocity.VerifyFailures >= 1:
+			return RiskChallenge, nil
+		}
+		return RiskAllow, nil
+	})
+	gen := NewTestCodeGenerator("666666")
+	sender := &countingSMSSender{}
+	svc := NewOTPService[MobileCode](cfg, client, sender, WithRiskEvaluator[MobileCode](risk))
+	send := func(opts ...SendOption) (string, error) {
+		mc, err := gen.NewMobileCode("login", 7, "13800138000", "86")
+		require.NoError(t, err)
+		return svc.Send(ctx, mc, opts...)
+	}
+
+	seq, err := send(WithIP("1.2.3.4"), WithDevice("device-a"))
+	require.NoError(t, err)
+	assert.Equal(t, RiskRequest{Operation: RiskOperationSend, Medium: "MOBILE", Type: "LOGIN", Sequence: seq,
+		UserID: 7, Target: Target{Mobile: "13800138000", CountryCode: "86"}, IP: "1.2.3.4", Device: "device-a"}, reqs[0])
+	_, err = send(WithIP("1.2.3.4"))
+	require.NoError(t, err)
+	assert.Equal(t, RiskVelocity{TargetSends: 1, IPSends: 1}, reqs[1].Velocity)
+
+	// Denied and challenged sends consume no limit.
+	_, err = send(WithIP("6.6.6.6"))
+	assert.ErrorIs(t, err, ErrRiskDenied)
+	_, err = send()
+	assert.ErrorIs(t, err, ErrChallengeRequired)
+	_, err = send(WithChallengePassed())
+	require.NoError(t, err)
+	assert.Equal(t, 3, sender.calls)
+	assert.True(t, reqs[len(reqs)-1].ChallengePassed)
+
+	probe := mobileProbe(seq, "13800138000", "86")
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", probe), ErrCodeIncorrect)
+	assert.ErrorIs(t, svc.Verify(ctx, "666666", probe), ErrChallengeRequired)
+	assert.Equal(t, RiskVelocity{VerifyFailures: 1}, reqs[len(reqs)-1].Velocity)
+	assert.ErrorIs(t, svc.Verify(ctx, "666666", probe, WithIP("6.6.6.6"), WithChallengePassed()), ErrRiskDenied)
+	require.NoError(t, svc.Verify(ctx, "666666", probe, WithChallengePassed()))
+}
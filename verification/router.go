@@ -0,0 +1,112 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+)
+
+// Route is a CodeSender of a WeightedRouter and its share of the traffic.
+type Route[T VerificationCode] struct {
+	Name   string // Identifies the route in errors, e.g. "aliyun"
+	Sender CodeSender[T]
+	Weight int // Relative share, e.g. 80 and 20; a zero weight disables the route
+}
+
+// WeightedRouter is a CodeSender splitting sends across providers by weight, e.g. 80%
+// Aliyun and 20% Twilio, to hedge provider reliability and price.
+type WeightedRouter[T VerificationCode] struct {
+	routes   []Route[T]
+	total    int
+	failover bool
+	intN     func(n int) int // rand.IntN, replaced in tests
+}
+
+// RouterOption configures a WeightedRouter.
+type RouterOption func(*routerOptions)
+
+type routerOptions struct {
+	failover bool
+}
+
+// WithFailover retries a failed send on the other routes in weighted random order.
+// A provider failing after accepting the message then delivers a second code, both
+// verify as they share the code.
+func WithFailover() RouterOption {
+	return func(o *routerOptions) { o.failover = true }
+}
+
+// Compile-time assertion: WeightedRouter implements CodeSender[MobileCode].
+var _ CodeSender[MobileCode] = (*WeightedRouter[MobileCode])(nil)
+
+// NewWeightedRouter creates a WeightedRouter, it returns ErrInvalidConfig without a
+// route of positive weight.
+func NewWeightedRouter[T VerificationCode](routes []Route[T], opts ...RouterOption) (*WeightedRouter[T], error) {
+	var o routerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	r := &WeightedRouter[T]{failover: o.failover, intN: rand.IntN}
+	for _, route := range routes {
+		if route.Weight < 0 || route.Sender == nil {
+			return nil, fmt.Errorf("%w: route %q has no sender or a negative weight", ErrInvalidConfig, route.Name)
+		}
+		if route.Weight > 0 {
+			r.routes = append(r.routes, route)
+			r.total += route.Weight
+		}
+	}
+	if r.total == 0 {
+		return nil, fmt.Errorf("%w: router has no route of positive weight", ErrInvalidConfig)
+	}
+	return r, nil
+}
+
+// Send delivers the code through a route picked by weight.
+func (r *WeightedRouter[T]) Send(ctx context.Context, code *T) error {
+	remaining := append([]Route[T](nil), r.routes...)
+	total := r.total
+	var errs []error
+	for len(remaining) > 0 {
+		i := r.pick(remaining, total)
+		route := remaining[i]
+		err := route.Sender.Send(ctx, code)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("route %s: %w", route.Name, err))
+		if !r.failover || ctx.Err() != nil {
+			break
+		}
+		remaining = append(remaining[:i], remaining[i+1:]...)
+		total -= route.Weight
+	}
+	return errors.Join(errs...)
+}
+
+// pick returns the index of a route of routes chosen with probability weight/total.
+func (r *WeightedRouter[T]) pick(routes []Route[T], total int) int {
+	n := r.intN(total)
+	for i, route := range routes {
+		if n < route.Weight {
+			return i
+		}
+		n -= route.Weight
+	}
+	return len(routes) - 1
+}
+
+// Check checks the routes whose sender implements Check, it implements the health
+// checker of the router.
+func (r *WeightedRouter[T]) Check(ctx context.Context) error {
+	var errs []error
+	for _, route := range r.routes {
+		if c, ok := route.Sender.(interface{ Check(context.Context) error }); ok {
+			if err := c.Check(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("route %s: %w", route.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
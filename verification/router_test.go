@@ -0,0 +1,50 @@
+package verification
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_WeightedRouter(t *testing.T) {
+	ctx := context.Background()
+	_, err := NewWeightedRouter([]Route[MobileCode]{{Name: "a", Sender: &countingSMSSender{}}})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = NewWeightedRouter([]Route[MobileCode]{{Name: "a", Weight: -1, Sender: &countingSMSSender{}}})
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+
+	primary, secondary, off := &countingSMSSender{}, &countingSMSSender{}, &countingSMSSender{}
+	router, err := NewWeightedRouter([]Route[MobileCode]{
+		{Name: "primary", Sender: primary, Weight: 80},
+		{Name: "secondary", Sender: secondary, Weight: 20},
+		{Name: "off", Sender: off},
+	})
+	require.NoError(t, err)
+	n := 0
+	router.intN = func(total int) int { n++; return n % total }
+	for range 100 {
+		require.NoError(t, router.Send(ctx, &MobileCode{}))
+	}
+	assert.Equal(t, 80, primary.calls)
+	assert.Equal(t, 20, secondary.calls)
+	assert.Zero(t, off.calls)
+
+	t.Run("failover", func(t *testing.T) {
+		failing, backup := &failingSMSSender{}, &countingSMSSender{}
+		routes := []Route[MobileCode]{{Name: "failing", Sender: failing, Weight: 1}, {Name: "backup", Sender: backup, Weight: 1}}
+		router, err := NewWeightedRouter(routes)
+		require.NoError(t, err)
+		router.intN = func(int) int { return 0 }
+		assert.ErrorIs(t, router.Send(ctx, &MobileCode{}), ErrSendFailed)
+		assert.Zero(t, backup.calls)
+
+		router, err = NewWeightedRouter(routes, WithFailover())
+		require.NoError(t, err)
+		router.intN = func(int) int { return 0 }
+		assert.NoError(t, router.Send(ctx, &MobileCode{}))
+		assert.Equal(t, 2, failing.calls)
+		assert.Equal(t, 1, backup.calls)
+	})
+}
@@ -0,0 +1,65 @@
+package verification
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// SequenceFunc generates the sequence identifying a code.
+type SequenceFunc func() string
+
+var (
+	// SequenceRandom generates 128 random bits, hex-encoded. It is the default.
+	SequenceRandom SequenceFunc = func() string { return randomHex(16) }
+	// SequenceULID generates ULIDs: 48 bits of millisecond time and 80 random bits in
+	// Crockford base32, lexicographically sortable by creation time.
+	SequenceULID SequenceFunc = newULID
+	// SequenceUUIDv7 generates RFC 9562 version 7 UUIDs, sortable by creation time.
+	SequenceUUIDv7 SequenceFunc = newUUIDv7
+)
+
+// crockford is the Crockford base32 alphabet of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a new ULID.
+func newULID() string {
+	var b [16]byte
+	ms := uint64(timeNow().UnixMilli())
+	b[0], b[1], b[2] = byte(ms>>40), byte(ms>>32), byte(ms>>24)
+	b[3], b[4], b[5] = byte(ms>>16), byte(ms>>8), byte(ms)
+	_, _ = rand.Read(b[6:])
+
+	// 128 bits in 26 characters of 5 bits, the first character holds the top 3 bits.
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// newUUIDv7 returns a new version 7 UUID.
+func newUUIDv7() string {
+	var b [16]byte
+	ms := uint64(timeNow().UnixMilli())
+	b[0], b[1], b[2] = byte(ms>>40), byte(ms>>32), byte(ms>>24)
+	b[3], b[4], b[5] = byte(ms>>16), byte(ms>>8), byte(ms)
+	_, _ = rand.Read(b[6:])
+	b[6] = b[6]&0x0f | 0x70 // version 7
+	b[8] = b[8]&0x3f | 0x80 // RFC 9562 variant
+
+	var out [36]byte
+	hex.Encode(out[0:8], b[0:4])
+	out[8] = '-'
+	hex.Encode(out[9:13], b[4:6])
+	out[13] = '-'
+	hex.Encode(out[14:18], b[6:8])
+	out[18] = '-'
+	hex.Encode(out[19:23], b[8:10])
+	out[23] = '-'
+	hex.Encode(out[24:], b[10:])
+	return string(out[:])
+}
@@ -0,0 +1,37 @@
+package verification
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_Sequence(t *testing.T) {
+	now := time.UnixMilli(1469918176385)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	// The ULID spec example timestamp encodes to 01ARYZ6S41.
+	ulid := SequenceULID()
+	assert.Len(t, ulid, 26)
+	assert.Equal(t, "01ARYZ6S41", ulid[:10])
+	assert.NotEqual(t, ulid, SequenceULID())
+
+	uuid := SequenceUUIDv7()
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, uuid)
+	assert.Equal(t, "01563df3-64", uuid[:11])
+
+	// Sequences sort by creation time.
+	now = now.Add(time.Millisecond)
+	assert.Less(t, ulid, SequenceULID())
+	assert.Less(t, uuid, SequenceUUIDv7())
+
+	mc, err := NewCodeGenerator(6, WithSequence(SequenceULID)).NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	assert.Len(t, mc.Sequence, 26)
+	mc, err = NewCodeGenerator(6).NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	assert.Len(t, mc.Sequence, 32)
+}
@@ -0,0 +1,89 @@
+package verification
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// leakyBucketScript atomically schedules an action on a leaky bucket drained at one
+// action per interval. It stores the time the bucket is drained and returns the delay
+// of the action, or rejects it when the delay exceeds max_delay_ms.
+var leakyBucketScript = redis.NewScript(`
+local key          = KEYS[1]
+local interval_ms  = tonumber(ARGV[1])
+local max_delay_ms = tonumber(ARGV[2])
+local now_ms       = tonumber(ARGV[3])
+
+local drained = tonumber(redis.call('GET', key)) or now_ms
+if drained < now_ms then
+  drained = now_ms
+end
+
+local delay = drained - now_ms
+if delay > max_delay_ms then
+  return {0, math.ceil(delay - max_delay_ms)}
+end
+
+drained = drained + interval_ms
+redis.call('SET', key, tostring(drained), 'PX', math.max(1, math.ceil(drained - now_ms)))
+return {1, math.ceil(delay)}
+`)
+
+// LeakyBucketConfig holds the leaky bucket shaping policy.
+type LeakyBucketConfig struct {
+	Rate     int64         // actions drained per Interval, zero disables shaping
+	Interval time.Duration // drain interval
+	Capacity int64         // max actions waiting in the bucket, zero never waits
+}
+
+// Enabled reports whether the policy shapes actions.
+func (c LeakyBucketConfig) Enabled() bool {
+	return c.Rate > 0 && c.Interval > 0
+}
+
+// LeakyBucket smooths actions shared by all callers, e.g. the SMS sent to a provider
+// that throttles bursts, to a constant rate backed by Redis.
+type LeakyBucket struct {
+	client redis.UniversalClient
+	cfg    LeakyBucketConfig
+}
+
+// NewLeakyBucket creates a LeakyBucket with the given policy.
+func NewLeakyBucket(client redis.UniversalClient, cfg LeakyBucketConfig) *LeakyBucket {
+	return &LeakyBucket{client: client, cfg: cfg}
+}
+
+// Reserve schedules an action for key and returns how long the caller must wait
+// before performing it. Returns *RateLimitError wrapping ErrSendThrottled if the
+// bucket is full.
+func (b *LeakyBucket) Reserve(ctx context.Context, key string) (time.Duration, error) {
+	interval := float64(b.cfg.Interval.Milliseconds()) / float64(b.cfg.Rate)
+	res, err := leakyBucketScript.Run(ctx, b.client, []string{key},
+		interval, interval*float64(b.cfg.Capacity), timeNow().UnixMilli()).Int64Slice()
+	if err != nil {
+		return 0, fmt.Errorf("leaky bucket: %w", err)
+	}
+	if res[0] != 1 {
+		return 0, &RateLimitError{Err: ErrSendThrottled, RetryIn: time.Duration(res[1]) * time.Millisecond}
+	}
+	return time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// Wait reserves an action for key and blocks until it may be performed or ctx is done.
+func (b *LeakyBucket) Wait(ctx context.Context, key string) error {
+	delay, err := b.Reserve(ctx, key)
+	if err != nil || delay <= 0 {
+		return err
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
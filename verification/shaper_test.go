@@ -0,0 +1,57 @@
+package verification
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_Service_SendShaping(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	// One SMS per 50ms with a single SMS waiting.
+	cfg := mobileTestConfig(10, 10)
+	cfg.Shape = LeakyBucketConfig{Rate: 1, Interval: 50 * time.Millisecond, Capacity: 1}
+	fake := &fakeSMSSender{}
+	gen := NewTestCodeGenerator("666666")
+	svc := NewOTPService[MobileCode](cfg, client, fake)
+
+	mc, err := gen.NewMobileCode("login", 1, "13800138001", "86")
+	require.NoError(t, err)
+	_, err = svc.Send(ctx, mc)
+	require.NoError(t, err)
+
+	// The second SMS waits for the first to drain.
+	mc, err = gen.NewMobileCode("login", 2, "13800138002", "86")
+	require.NoError(t, err)
+	start := time.Now()
+	_, err = svc.Send(ctx, mc)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// The bucket is full, the send is throttled and rolled back.
+	mc, err = gen.NewMobileCode("login", 3, "13800138003", "86")
+	require.NoError(t, err)
+	_, err = svc.Send(ctx, mc)
+	var rlErr *RateLimitError
+	require.ErrorAs(t, err, &rlErr)
+	assert.ErrorIs(t, err, ErrSendThrottled)
+	assert.Equal(t, 50*time.Millisecond, rlErr.RetryIn)
+	assert.Equal(t, "13800138002", fake.last.Mobile)
+	err = svc.Verify(ctx, "666666", mobileProbe(mc.Sequence, "13800138003", "86"))
+	assert.ErrorIs(t, err, ErrCodeNotFound)
+
+	// The bucket drains over time.
+	now = now.Add(100 * time.Millisecond)
+	_, err = svc.Send(ctx, mc)
+	require.NoError(t, err)
+}
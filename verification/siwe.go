@@ -0,0 +1,346 @@
+package verification
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SIWEMessage is an EIP-4361 Sign-In with Ethereum message.
+type SIWEMessage struct {
+	Domain         string
+	Address        string // EIP-55 checksum address
+	Statement      string // Optional
+	URI            string
+	Version        string
+	ChainID        int64
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime time.Time // Optional
+	NotBefore      time.Time // Optional
+	RequestID      string    // Optional
+	Resources      []string  // Optional
+}
+
+const siweHeader = " wants you to sign in with your Ethereum account:"
+
+// String returns the message text to sign.
+func (m *SIWEMessage) String() string {
+	var b strings.Builder
+	b.WriteString(m.Domain + siweHeader + "\n")
+	b.WriteString(m.Address + "\n\n")
+	if m.Statement != "" {
+		b.WriteString(m.Statement + "\n")
+	}
+	b.WriteString("\n")
+	b.WriteString("URI: " + m.URI + "\n")
+	b.WriteString("Version: " + m.Version + "\n")
+	b.WriteString("Chain ID: " + strconv.FormatInt(m.ChainID, 10) + "\n")
+	b.WriteString("Nonce: " + m.Nonce + "\n")
+	b.WriteString("Issued At: " + m.IssuedAt.UTC().Format(time.RFC3339))
+	if !m.ExpirationTime.IsZero() {
+		b.WriteString("\nExpiration Time: " + m.ExpirationTime.UTC().Format(time.RFC3339))
+	}
+	if !m.NotBefore.IsZero() {
+		b.WriteString("\nNot Before: " + m.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if m.RequestID != "" {
+		b.WriteString("\nRequest ID: " + m.RequestID)
+	}
+	if len(m.Resources) > 0 {
+		b.WriteString("\nResources:")
+		for _, r := range m.Resources {
+			b.WriteString("\n- " + r)
+		}
+	}
+	return b.String()
+}
+
+// ParseSIWEMessage parses an EIP-4361 message, it returns ErrSIWEMessageInvalid when
+// the text does not follow the format.
+func ParseSIWEMessage(s string) (*SIWEMessage, error) {
+	lines := strings.Split(s, "\n")
+	if len(lines) < 9 || !strings.HasSuffix(lines[0], siweHeader) || lines[2] != "" {
+		return nil, ErrSIWEMessageInvalid
+	}
+	m := &SIWEMessage{Domain: strings.TrimSuffix(lines[0], siweHeader), Address: lines[1]}
+	i := 3
+	if lines[i] != "" {
+		m.Statement = lines[i]
+		i++
+	}
+	if lines[i] != "" {
+		return nil, ErrSIWEMessageInvalid
+	}
+	i++
+	// field returns the value of the line i when it has the prefix and advances i.
+	field := func(prefix string, required bool) (string, error) {
+		if i < len(lines) && strings.HasPrefix(lines[i], prefix) {
+			i++
+			return strings.TrimPrefix(lines[i-1], prefix), nil
+		}
+		if required {
+			return "", ErrSIWEMessageInvalid
+		}
+		return "", nil
+	}
+	timeField := func(prefix string, required bool) (time.Time, error) {
+		v, err := field(prefix, required)
+		if err != nil || v == "" {
+			return time.Time{}, err
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, ErrSIWEMessageInvalid
+		}
+		return t, nil
+	}
+	var err error
+	if m.URI, err = field("URI: ", true); err != nil {
+		return nil, err
+	}
+	if m.Version, err = field("Version: ", true); err != nil {
+		return nil, err
+	}
+	chainID, err := field("Chain ID: ", true)
+	if err != nil {
+		return nil, err
+	}
+	if m.ChainID, err = strconv.ParseInt(chainID, 10, 64); err != nil {
+		return nil, ErrSIWEMessageInvalid
+	}
+	if m.Nonce, err = field("Nonce: ", true); err != nil {
+		return nil, err
+	}
+	if m.IssuedAt, err = timeField("Issued At: ", true); err != nil {
+		return nil, err
+	}
+	if m.ExpirationTime, err = timeField("Expiration Time: ", false); err != nil {
+		return nil, err
+	}
+	if m.NotBefore, err = timeField("Not Before: ", false); err != nil {
+		return nil, err
+	}
+	if m.RequestID, err = field("Request ID: ", false); err != nil {
+		return nil, err
+	}
+	if i < len(lines) && lines[i] == "Resources:" {
+		for i++; i < len(lines) && strings.HasPrefix(lines[i], "- "); i++ {
+			m.Resources = append(m.Resources, strings.TrimPrefix(lines[i], "- "))
+		}
+	}
+	if i != len(lines) || m.Version != "1" || len(m.Nonce) < 8 {
+		return nil, ErrSIWEMessageInvalid
+	}
+	if m.Address, err = checksumAddress(m.Address); err != nil {
+		return nil, ErrSIWEMessageInvalid
+	}
+	return m, nil
+}
+
+// SIWEConfig configures the SIWE messages of a SIWEService.
+type SIWEConfig struct {
+	Domain    string // RFC 3986 authority requesting the signing, e.g. "example.com"
+	URI       string // Subject of the signing, e.g. "https://example.com/login"
+	Statement string // Optional human readable assertion shown by wallets
+	ChainID   int64  // EIP-155 chain ID, defaults to 1 (Ethereum mainnet)
+	Chain     string // EcdsaCode.Chain of the codes, defaults to ChainEthereum
+}
+
+// applyDefaultValue fills zero fields with defaults.
+func (c *SIWEConfig) applyDefaultValue() {
+	if c.ChainID == 0 {
+		c.ChainID = 1
+	}
+	if c.Chain == "" {
+		c.Chain = ChainEthereum
+	}
+}
+
+// SIWEChallenge is a SIWE message issued for an EcdsaCode.
+type SIWEChallenge struct {
+	// Sequence identifies the code in Verify.
+	Sequence string
+	// Message is the message to sign, its String is passed to personal_sign or its
+	// TypedData to eth_signTypedData_v4.
+	Message *SIWEMessage
+}
+
+// SIWEService implements Sign-In with Ethereum on an EcdsaCode OTPService: the code
+// is the nonce of the message, so limits, TTL and single use apply as for any code.
+type SIWEService struct {
+	cfg       SIWEConfig
+	generator CodeGenerator
+	otp       *OTPService[EcdsaCode]
+}
+
+// NewSIWEService creates a SIWEService, messages expire with the TTL of otp.
+func NewSIWEService(cfg SIWEConfig, generator CodeGenerator, otp *OTPService[EcdsaCode]) *SIWEService {
+	cfg.applyDefaultValue()
+	return &SIWEService{cfg: cfg, generator: generator, otp: otp}
+}
+
+// Challenge issues a SIWE message of typ for the address to sign.
+func (s *SIWEService) Challenge(ctx context.Context, typ CodeType, userID int64, address string,
+	opts ...SendOption,
+) (*SIWEChallenge, error) {
+	address, err := checksumAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	code, err := s.generator.NewEcdsaCode(typ, userID, s.cfg.Chain, address)
+	if err != nil {
+		return nil, err
+	}
+	// SIWE nonces are alphanumeric, the code is digits and a timestamp joined by "-".
+	code.Value = strings.ReplaceAll(code.Value, "-", "")
+	code.Digest = hashCode(code.Value)
+	now := timeNow().UTC().Truncate(time.Second)
+	msg := &SIWEMessage{
+		Domain:         s.cfg.Domain,
+		Address:        address,
+		Statement:      s.cfg.Statement,
+		URI:            s.cfg.URI,
+		Version:        "1",
+		ChainID:        s.cfg.ChainID,
+		Nonce:          code.Value,
+		IssuedAt:       now,
+		ExpirationTime: now.Add(s.otp.cfg.TTL),
+	}
+	seq, err := s.otp.Send(ctx, code, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &SIWEChallenge{Sequence: seq, Message: msg}, nil
+}
+
+// Verify checks that message was issued by Challenge for typ and sequence and signed
+// by its address, and consumes the code. It returns the parsed message on success.
+func (s *SIWEService) Verify(ctx context.Context, typ CodeType, sequence, message, signature string,
+) (*SIWEMessage, error) {
+	m, err := ParseSIWEMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	return s.verify(ctx, typ, sequence, m, func() error {
+		return verifyPersonalSignature(m.Address, message, signature)
+	})
+}
+
+// VerifyTypedData is Verify for a challenge signed as typed data, see SIWEMessage.TypedData.
+// Only the fields of the SignIn type are read from td, the signed data is rebuilt from
+// them so types sent by the client are not trusted.
+func (s *SIWEService) VerifyTypedData(ctx context.Context, typ CodeType, sequence string, td *TypedData,
+	signature string,
+) (*SIWEMessage, error) {
+	m, err := siweFromTypedData(td)
+	if err != nil {
+		return nil, err
+	}
+	return s.verify(ctx, typ, sequence, m, func() error {
+		return verifyTypedDataSignature(m.Address, m.TypedData(), signature)
+	})
+}
+
+// verify checks m against the config and its validity period, then the signature with
+// verifySig, and consumes the code of the nonce.
+func (s *SIWEService) verify(ctx context.Context, typ CodeType, sequence string, m *SIWEMessage,
+	verifySig func() error,
+) (*SIWEMessage, error) {
+	if m.Domain != s.cfg.Domain || m.URI != s.cfg.URI || m.ChainID != s.cfg.ChainID {
+		return nil, fmt.Errorf("%w: domain, uri or chain id mismatch", ErrSIWEMessageInvalid)
+	}
+	now := timeNow()
+	if (!m.ExpirationTime.IsZero() && !now.Before(m.ExpirationTime)) ||
+		(!m.NotBefore.IsZero() && now.Before(m.NotBefore)) {
+		return nil, ErrSIWEMessageExpired
+	}
+	if err := verifySig(); err != nil {
+		return nil, err
+	}
+	probe := &EcdsaCode{Code: Code{Type: typ, Sequence: sequence}, Chain: s.cfg.Chain, Address: m.Address}
+	if err := s.otp.Verify(ctx, m.Nonce, probe); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// siweTypes are the EIP-712 types of SIWEMessage.TypedData.
+var siweTypes = map[string][]TypedDataField{
+	"EIP712Domain": {
+		{Name: "name", Type: "string"},
+		{Name: "version", Type: "string"},
+		{Name: "chainId", Type: "uint256"},
+	},
+	"SignIn": {
+		{Name: "address", Type: "address"},
+		{Name: "statement", Type: "string"},
+		{Name: "uri", Type: "string"},
+		{Name: "nonce", Type: "string"},
+		{Name: "issuedAt", Type: "string"},
+		{Name: "expirationTime", Type: "string"},
+	},
+}
+
+// TypedData returns m as EIP-712 typed data for wallets that display it better than
+// text, the domain name is the SIWE domain. NotBefore, RequestID and Resources are
+// not part of it.
+func (m *SIWEMessage) TypedData() *TypedData {
+	var expiration string
+	if !m.ExpirationTime.IsZero() {
+		expiration = m.ExpirationTime.UTC().Format(time.RFC3339)
+	}
+	return &TypedData{
+		Types:       siweTypes,
+		PrimaryType: "SignIn",
+		Domain:      map[string]any{"name": m.Domain, "version": m.Version, "chainId": m.ChainID},
+		Message: map[string]any{
+			"address":        m.Address,
+			"statement":      m.Statement,
+			"uri":            m.URI,
+			"nonce":          m.Nonce,
+			"issuedAt":       m.IssuedAt.UTC().Format(time.RFC3339),
+			"expirationTime": expiration,
+		},
+	}
+}
+
+// siweFromTypedData reads the SIWEMessage of SIWEMessage.TypedData.
+func siweFromTypedData(td *TypedData) (*SIWEMessage, error) {
+	if td == nil || td.PrimaryType != "SignIn" {
+		return nil, ErrSIWEMessageInvalid
+	}
+	str := func(data map[string]any, key string) string {
+		v, _ := data[key].(string)
+		return v
+	}
+	chainID, err := bigInt(td.Domain["chainId"])
+	if err != nil || !chainID.IsInt64() {
+		return nil, ErrSIWEMessageInvalid
+	}
+	m := &SIWEMessage{
+		Domain:    str(td.Domain, "name"),
+		Version:   str(td.Domain, "version"),
+		ChainID:   chainID.Int64(),
+		Statement: str(td.Message, "statement"),
+		URI:       str(td.Message, "uri"),
+		Nonce:     str(td.Message, "nonce"),
+	}
+	if m.Address, err = checksumAddress(str(td.Message, "address")); err != nil {
+		return nil, ErrSIWEMessageInvalid
+	}
+	if m.IssuedAt, err = time.Parse(time.RFC3339, str(td.Message, "issuedAt")); err != nil {
+		return nil, ErrSIWEMessageInvalid
+	}
+	if v := str(td.Message, "expirationTime"); v != "" {
+		if m.ExpirationTime, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, ErrSIWEMessageInvalid
+		}
+	}
+	if m.Version != "1" || len(m.Nonce) < 8 {
+		return nil, ErrSIWEMessageInvalid
+	}
+	return m, nil
+}
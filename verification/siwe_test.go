@@ -0,0 +1,82 @@
+package verification
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testWalletKey is the private key of testWalletAddress.
+const (
+	testWalletKey     = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+	testWalletAddress = "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"
+)
+
+// signHash signs hash with testWalletKey and returns the R || S || V hex signature.
+func signHash(t *testing.T, hash []byte) string {
+	t.Helper()
+	raw, err := hex.DecodeString(testWalletKey)
+	require.NoError(t, err)
+	compact := secpecdsa.SignCompact(secp256k1.PrivKeyFromBytes(raw), hash, false)
+	return "0x" + hex.EncodeToString(append(compact[1:], compact[0]))
+}
+
+func TestVerification_SIWE(t *testing.T) {
+	client, cleanup, fastForward := getRedisClient(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	addr, err := checksumAddress("0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed")
+	require.NoError(t, err)
+	assert.Equal(t, "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", addr)
+	_, err = checksumAddress("0x123")
+	assert.ErrorIs(t, err, ErrEcdsaAddressInvalid)
+
+	svc := NewSIWEService(SIWEConfig{Domain: "example.com", URI: "https://example.com/login",
+		Statement: "Sign in to Example."}, NewTestCodeGenerator("123456"),
+		NewOTPService[EcdsaCode](DefaultOTPConfig("TEST"), client, nil))
+
+	ch, err := svc.Challenge(ctx, "login", 1, strings.ToLower(testWalletAddress))
+	require.NoError(t, err)
+	msg := ch.Message.String()
+	assert.True(t, strings.HasPrefix(msg, "example.com wants you to sign in with your Ethereum account:\n"+
+		testWalletAddress+"\n\nSign in to Example.\n\nURI: https://example.com/login\nVersion: 1\nChain ID: 1\n"))
+	parsed, err := ParseSIWEMessage(msg)
+	require.NoError(t, err)
+	assert.Equal(t, ch.Message, parsed)
+
+	t.Run("rejected", func(t *testing.T) {
+		tampered := strings.Replace(msg, "Chain ID: 1", "Chain ID: 56", 1)
+		_, err := svc.Verify(ctx, "login", ch.Sequence, tampered, signHash(t, personalMessageHash(tampered)))
+		assert.ErrorIs(t, err, ErrSIWEMessageInvalid)
+		_, err = svc.Verify(ctx, "login", ch.Sequence, msg, signHash(t, personalMessageHash("other")))
+		assert.ErrorIs(t, err, ErrSignatureInvalid)
+		_, err = svc.Verify(ctx, "login", ch.Sequence, msg, "0x1234")
+		assert.ErrorIs(t, err, ErrSignatureInvalid)
+	})
+
+	m, err := svc.Verify(ctx, "login", ch.Sequence, msg, signHash(t, personalMessageHash(msg)))
+	require.NoError(t, err)
+	assert.Equal(t, testWalletAddress, m.Address)
+	_, err = svc.Verify(ctx, "login", ch.Sequence, msg, signHash(t, personalMessageHash(msg)))
+	assert.ErrorIs(t, err, ErrCodeNotFound)
+
+	t.Run("expired", func(t *testing.T) {
+		fastForward(time.Minute)
+		ch, err := svc.Challenge(ctx, "login", 1, testWalletAddress)
+		require.NoError(t, err)
+		msg := ch.Message.String()
+		now := time.Now()
+		timeNow = func() time.Time { return now.Add(10 * time.Minute) }
+		defer func() { timeNow = time.Now }()
+		_, err = svc.Verify(ctx, "login", ch.Sequence, msg, signHash(t, personalMessageHash(msg)))
+		assert.ErrorIs(t, err, ErrSIWEMessageExpired)
+	})
+}
@@ -0,0 +1,21 @@
+package smtp
+
+import (
+	"github.com/crypto-zero/go-biz/verification"
+	"github.com/google/wire"
+	"go.uber.org/fx"
+)
+
+// ProviderSet is the wire provider set of the email Sender bound to CodeSender[EmailCode].
+// The application provides the *Config and the email TemplateProvider.
+var ProviderSet = wire.NewSet(
+	NewSender,
+	wire.Bind(new(verification.CodeSender[verification.EmailCode]), new(*Sender)),
+)
+
+// Module is the fx equivalent of ProviderSet.
+var Module = fx.Options(
+	fx.Provide(
+		fx.Annotate(NewSender, fx.As(fx.Self()), fx.As(new(verification.CodeSender[verification.EmailCode]))),
+	),
+)
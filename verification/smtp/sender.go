@@ -7,25 +7,39 @@ import (
 	"encoding/hex"
 	"fmt"
 	"mime"
+	"mime/quotedprintable"
 	"net"
 	"net/smtp"
 	"strconv"
 	"strings"
 	"sync"
-	"text/template"
 	"time"
 
 	"github.com/crypto-zero/go-biz/verification"
 )
 
-// Config holds the SMTP connection configuration.
+// Config holds the SMTP connection configuration, loadable from YAML or env.
 type Config struct {
-	Host     string // SMTP server host, e.g., "smtp.gmail.com"
-	Port     int    // SMTP server port, e.g., 587
-	Username string // SMTP auth username
-	Password string // SMTP auth password
-	From     string // Sender email address
-	SSL      bool   // Use implicit TLS (port 465); false uses STARTTLS (port 587)
+	Host     string `json:"host" yaml:"host"`         // SMTP server host, e.g., "smtp.gmail.com"
+	Port     int    `json:"port" yaml:"port"`         // SMTP server port, e.g., 587
+	Username string `json:"username" yaml:"username"` // SMTP auth username
+	Password string `json:"password" yaml:"password"` // SMTP auth password
+	From     string `json:"from" yaml:"from"`         // Sender email address
+	SSL      bool   `json:"ssl" yaml:"ssl"`           // Use implicit TLS (port 465); false uses STARTTLS (port 587)
+
+	// Render sets {{.AppName}} and {{.TTLMinutes}} of the templates.
+	Render verification.RenderConfig `json:"render" yaml:"render"`
+}
+
+// Validate checks the server address and sender address are set.
+func (c *Config) Validate() error {
+	if c.Host == "" || c.Port <= 0 {
+		return fmt.Errorf("%w: smtp host or port is empty", verification.ErrInvalidConfig)
+	}
+	if c.From == "" {
+		return fmt.Errorf("%w: smtp from is empty", verification.ErrInvalidConfig)
+	}
+	return nil
 }
 
 // Addr returns "host:port".
@@ -37,14 +51,13 @@ func (c *Config) Addr() string {
 type Sender struct {
 	config    *Config
 	provider  verification.TemplateProvider[verification.EmailTemplate]
-	tmplCache sync.Map // map[CodeType]*cachedTemplate
+	tmplCache sync.Map // map[templateKey]*verification.EmailContentTemplate
 }
 
-// cachedTemplate holds a pre-parsed template alongside its metadata.
-type cachedTemplate struct {
-	tmpl        *template.Template
-	subject     string
-	contentType string
+// templateKey identifies a cached template by code type and locale.
+type templateKey struct {
+	typ    verification.CodeType
+	locale string
 }
 
 // Compile-time assertion: Sender implements CodeSender[EmailCode].
@@ -60,17 +73,17 @@ func NewSender(config *Config, provider verification.TemplateProvider[verificati
 
 // Send sends the email verification code via SMTP.
 func (s *Sender) Send(ctx context.Context, emailCode *verification.EmailCode) error {
-	ct, err := s.getTemplate(emailCode.Type)
+	ct, err := s.getTemplate(emailCode.Type, emailCode.Locale)
 	if err != nil {
 		return err
 	}
 
-	var buf strings.Builder
-	if err = ct.tmpl.Execute(&buf, emailCode); err != nil {
-		return fmt.Errorf("failed to execute email template: %w", err)
+	content, err := ct.Render(verification.NewTemplateData(emailCode, s.config.Render))
+	if err != nil {
+		return err
 	}
 
-	msg := s.buildMessage(emailCode.Email, ct.subject, ct.contentType, buf.String())
+	msg := s.buildMessage(emailCode.Email, content)
 
 	if s.config.SSL {
 		return s.sendWithSSL(ctx, emailCode.Email, msg)
@@ -78,25 +91,36 @@ func (s *Sender) Send(ctx context.Context, emailCode *verification.EmailCode) er
 	return s.sendWithSTARTTLS(ctx, emailCode.Email, msg)
 }
 
-// getTemplate returns a cached, pre-parsed template for the given code type.
-func (s *Sender) getTemplate(typ verification.CodeType) (*cachedTemplate, error) {
-	if cached, ok := s.tmplCache.Load(typ); ok {
-		return cached.(*cachedTemplate), nil
+// Check dials the SMTP server, it implements the health checker of the sender.
+func (s *Sender) Check(ctx context.Context) error {
+	var dialer interface {
+		DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+	} = &net.Dialer{}
+	if s.config.SSL {
+		dialer = &tls.Dialer{Config: &tls.Config{ServerName: s.config.Host}, NetDialer: &net.Dialer{}}
 	}
-	tmpl, err := s.provider.GetTemplate(typ)
+	conn, err := dialer.DialContext(ctx, "tcp", s.config.Addr())
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("smtp dial failed: %w", err)
+	}
+	return conn.Close()
+}
+
+// getTemplate returns a cached, pre-parsed template for the given code type and locale.
+func (s *Sender) getTemplate(typ verification.CodeType, locale string) (*verification.EmailContentTemplate, error) {
+	key := templateKey{typ: typ, locale: locale}
+	if cached, ok := s.tmplCache.Load(key); ok {
+		return cached.(*verification.EmailContentTemplate), nil
 	}
-	contentType := tmpl.ContentType
-	if contentType == "" {
-		contentType = "text/plain"
+	tmpl, err := verification.LookupTemplate(s.provider, typ, locale)
+	if err != nil {
+		return nil, err
 	}
-	t, err := template.New("email").Parse(tmpl.BodyFormat)
+	ct, err := verification.ParseEmailTemplate(tmpl)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse email template: %w", err)
 	}
-	ct := &cachedTemplate{tmpl: t, subject: tmpl.Subject, contentType: contentType}
-	s.tmplCache.Store(typ, ct)
+	s.tmplCache.Store(key, ct)
 	return ct, nil
 }
 
@@ -192,7 +216,8 @@ func (s *Sender) sendMessage(client *smtp.Client, to string, msg []byte) error {
 }
 
 // buildMessage constructs the raw RFC 5322 message bytes with required Date and Message-ID headers.
-func (s *Sender) buildMessage(to, subject, contentType, body string) []byte {
+// An HTML body with a plain text alternative is sent as multipart/alternative.
+func (s *Sender) buildMessage(to string, content *verification.EmailContent) []byte {
 	now := time.Now()
 	var b strings.Builder
 	b.WriteString("From: ")
@@ -208,15 +233,50 @@ func (s *Sender) buildMessage(to, subject, contentType, body string) []byte {
 	b.WriteString(messageID(now, s.config.From))
 	b.WriteString(">\r\n")
 	b.WriteString("Subject: ")
-	b.WriteString(mime.QEncoding.Encode("UTF-8", subject))
+	b.WriteString(mime.QEncoding.Encode("UTF-8", content.Subject))
 	b.WriteString("\r\n")
 	b.WriteString("MIME-Version: 1.0\r\n")
-	b.WriteString("Content-Type: ")
+	switch {
+	case content.HTMLBody != "" && content.TextBody != "":
+		// The last part is the preferred one.
+		boundary := randomBoundary()
+		b.WriteString("Content-Type: multipart/alternative; boundary=\"")
+		b.WriteString(boundary)
+		b.WriteString("\"\r\n\r\n")
+		writePart(&b, boundary, "text/plain", content.TextBody)
+		writePart(&b, boundary, "text/html", content.HTMLBody)
+		b.WriteString("--")
+		b.WriteString(boundary)
+		b.WriteString("--\r\n")
+	case content.HTMLBody != "":
+		b.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+		b.WriteString(content.HTMLBody)
+	default:
+		b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+		b.WriteString(content.TextBody)
+	}
+	return []byte(b.String())
+}
+
+// writePart writes a quoted-printable part of a multipart body.
+func writePart(b *strings.Builder, boundary, contentType, body string) {
+	b.WriteString("--")
+	b.WriteString(boundary)
+	b.WriteString("\r\nContent-Type: ")
 	b.WriteString(contentType)
-	b.WriteString("; charset=UTF-8\r\n")
+	b.WriteString("; charset=UTF-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+	w := quotedprintable.NewWriter(b)
+	_, _ = w.Write([]byte(body))
+	_ = w.Close()
 	b.WriteString("\r\n")
-	b.WriteString(body)
-	return []byte(b.String())
+}
+
+// randomBoundary returns a multipart boundary starting with "=_", quoted-printable
+// escapes "=" so it cannot occur in the parts.
+func randomBoundary() string {
+	rb := make([]byte, 12)
+	_, _ = rand.Read(rb)
+	return "=_" + hex.EncodeToString(rb)
 }
 
 // messageID generates a globally unique RFC 5322 Message-ID.
@@ -0,0 +1,278 @@
+package verification
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLPlaceholder is the bind parameter style of a SQL database.
+type SQLPlaceholder int
+
+const (
+	// PlaceholderQuestion binds ? parameters, e.g. MySQL and SQLite.
+	PlaceholderQuestion SQLPlaceholder = iota
+	// PlaceholderDollar binds $1 parameters, e.g. PostgreSQL.
+	PlaceholderDollar
+)
+
+// SQLDialect is the upsert and delete syntax of a SQL database.
+type SQLDialect int
+
+const (
+	// DialectPostgres upserts with ON CONFLICT and deletes with RETURNING, e.g. PostgreSQL
+	// and SQLite.
+	DialectPostgres SQLDialect = iota
+	// DialectMySQL upserts with ON DUPLICATE KEY and locks with SELECT ... FOR UPDATE,
+	// e.g. MySQL.
+	DialectMySQL
+)
+
+// SQLCodeStoreOptions configures a SQLCodeStore.
+type SQLCodeStoreOptions struct {
+	Table       string         // table name, default verification_codes
+	Placeholder SQLPlaceholder // bind parameter style
+	Dialect     SQLDialect     // upsert and delete syntax
+	Codec       Codec          // encodes the data column, JSONCodec when nil
+}
+
+func (o *SQLCodeStoreOptions) applyDefaultValue() {
+	if o.Table == "" {
+		o.Table = "verification_codes"
+	}
+	if o.Codec == nil {
+		o.Codec = JSONCodec
+	}
+}
+
+// SQLCodeStore[T] is a CodeCache backed by a SQL database, for deployments that keep
+// the codes out of Redis. The table is expected to look like (PostgreSQL):
+//
+//	CREATE TABLE verification_codes (
+//	    code_key   VARCHAR(512) PRIMARY KEY,
+//	    type       VARCHAR(64)  NOT NULL,
+//	    sequence   VARCHAR(64)  NOT NULL,
+//	    target     VARCHAR(255) NOT NULL,
+//	    digest     VARCHAR(128) NOT NULL,
+//	    data       BYTEA        NOT NULL,
+//	    expires_at BIGINT       NOT NULL -- unix milliseconds
+//	);
+//	CREATE INDEX verification_codes_expires_at ON verification_codes (expires_at);
+//
+// Expired rows are never returned, PurgeExpired or RunPurge deletes them.
+type SQLCodeStore[T VerificationCode] struct {
+	db   *sql.DB
+	opts SQLCodeStoreOptions
+}
+
+// NewSQLCodeStore creates a SQLCodeStore[T] on db.
+func NewSQLCodeStore[T VerificationCode](db *sql.DB, opts SQLCodeStoreOptions) *SQLCodeStore[T] {
+	opts.applyDefaultValue()
+	return &SQLCodeStore[T]{db: db, opts: opts}
+}
+
+// query replaces the ? parameters of q with the placeholder style of the store.
+func (s *SQLCodeStore[T]) query(q string) string {
+	q = strings.ReplaceAll(q, "{table}", s.opts.Table)
+	if s.opts.Placeholder != PlaceholderDollar {
+		return q
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Check pings the database, it implements the health checker of the store.
+func (s *SQLCodeStore[T]) Check(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("verification: sql ping failed: %w", err)
+	}
+	return nil
+}
+
+// Set stores code under key for expire, replacing a previous code under the key.
+func (s *SQLCodeStore[T]) Set(ctx context.Context, key string, code *T, expire time.Duration) error {
+	v := *code
+	any(&v).(interface{ clearValue() }).clearValue()
+	data, err := s.opts.Codec.Marshal(&v)
+	if err != nil {
+		return fmt.Errorf("verification: encode failed: %w", err)
+	}
+	c := any(v).(interface {
+		GetType() CodeType
+		GetSequence() string
+		GetDigest() string
+		LimitKeyParts() []string
+	})
+
+	q := `INSERT INTO {table} (code_key, type, sequence, target, digest, data, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) `
+	if s.opts.Dialect == DialectMySQL {
+		q += `ON DUPLICATE KEY UPDATE type = VALUES(type), sequence = VALUES(sequence),
+		target = VALUES(target), digest = VALUES(digest), data = VALUES(data), expires_at = VALUES(expires_at)`
+	} else {
+		q += `ON CONFLICT (code_key) DO UPDATE SET type = excluded.type, sequence = excluded.sequence,
+		target = excluded.target, digest = excluded.digest, data = excluded.data, expires_at = excluded.expires_at`
+	}
+	_, err = s.db.ExecContext(ctx, s.query(q),
+		key, string(c.GetType()), c.GetSequence(), strings.Join(c.LimitKeyParts(), ":"), c.GetDigest(),
+		data, timeNow().Add(expire).UnixMilli())
+	if err != nil {
+		return fmt.Errorf("verification: sql upsert failed: %w", err)
+	}
+	return nil
+}
+
+// Peek returns the unexpired code under key, or ErrCodeNotFound.
+func (s *SQLCodeStore[T]) Peek(ctx context.Context, key string) (*T, error) {
+	v, _, err := s.PeekWithTTL(ctx, key)
+	return v, err
+}
+
+// PeekWithTTL returns the unexpired code under key with its remaining validity.
+func (s *SQLCodeStore[T]) PeekWithTTL(ctx context.Context, key string) (*T, time.Duration, error) {
+	var (
+		data      []byte
+		expiresAt int64
+	)
+	now := timeNow().UnixMilli()
+	err := s.db.QueryRowContext(ctx,
+		s.query(`SELECT data, expires_at FROM {table} WHERE code_key = ? AND expires_at > ?`),
+		key, now).Scan(&data, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, ErrCodeNotFound
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("verification: sql select failed: %w", err)
+	}
+	var v T
+	if err = s.opts.Codec.Unmarshal(data, &v); err != nil {
+		return nil, 0, fmt.Errorf("verification: decode failed: %w", err)
+	}
+	return &v, time.Duration(expiresAt-now) * time.Millisecond, nil
+}
+
+// Delete deletes the unexpired code under key and reports whether it existed.
+func (s *SQLCodeStore[T]) Delete(ctx context.Context, key string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, s.query(`DELETE FROM {table} WHERE code_key = ? AND expires_at > ?`),
+		key, timeNow().UnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("verification: sql delete failed: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("verification: sql delete failed: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Consume atomically compares digest with the code under key and deletes it on match,
+// in a transaction so that a code is consumed once and a mismatch is told from a missing
+// code on the same row.
+func (s *SQLCodeStore[T]) Consume(ctx context.Context, key, digest string) (ConsumeDecision, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("verification: sql begin failed: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	now := timeNow().UnixMilli()
+	var decision ConsumeDecision
+	if s.opts.Dialect == DialectMySQL {
+		decision, err = s.consumeLocked(ctx, tx, key, digest, now)
+	} else {
+		decision, err = s.consumeReturning(ctx, tx, key, digest, now)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("verification: sql commit failed: %w", err)
+	}
+	return decision, nil
+}
+
+// consumeReturning deletes the matching code with DELETE ... RETURNING, it checks whether
+// a code exists only when none was deleted.
+func (s *SQLCodeStore[T]) consumeReturning(ctx context.Context, tx *sql.Tx, key, digest string, now int64,
+) (ConsumeDecision, error) {
+	var deleted string
+	err := tx.QueryRowContext(ctx, s.query(`DELETE FROM {table}
+		WHERE code_key = ? AND digest = ? AND expires_at > ? RETURNING code_key`), key, digest, now).Scan(&deleted)
+	if err == nil {
+		return ConsumeMatched, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("verification: sql delete failed: %w", err)
+	}
+	var one int
+	err = tx.QueryRowContext(ctx, s.query(`SELECT 1 FROM {table} WHERE code_key = ? AND expires_at > ?`),
+		key, now).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ConsumeNotFound, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("verification: sql select failed: %w", err)
+	}
+	return ConsumeMismatched, nil
+}
+
+// consumeLocked locks the code with SELECT ... FOR UPDATE and deletes it on match, for
+// the databases without DELETE ... RETURNING.
+func (s *SQLCodeStore[T]) consumeLocked(ctx context.Context, tx *sql.Tx, key, digest string, now int64,
+) (ConsumeDecision, error) {
+	var stored string
+	err := tx.QueryRowContext(ctx, s.query(`SELECT digest FROM {table}
+		WHERE code_key = ? AND expires_at > ? FOR UPDATE`), key, now).Scan(&stored)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ConsumeNotFound, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("verification: sql select failed: %w", err)
+	}
+	if stored != digest {
+		return ConsumeMismatched, nil
+	}
+	if _, err = tx.ExecContext(ctx, s.query(`DELETE FROM {table} WHERE code_key = ?`), key); err != nil {
+		return 0, fmt.Errorf("verification: sql delete failed: %w", err)
+	}
+	return ConsumeMatched, nil
+}
+
+// PurgeExpired deletes the expired codes and returns how many were deleted.
+func (s *SQLCodeStore[T]) PurgeExpired(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, s.query(`DELETE FROM {table} WHERE expires_at <= ?`),
+		timeNow().UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("verification: sql purge failed: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// RunPurge purges the expired codes every interval until ctx is done, purge errors
+// are passed to onError when it is not nil.
+func (s *SQLCodeStore[T]) RunPurge(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.PurgeExpired(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
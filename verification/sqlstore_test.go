@@ -0,0 +1,94 @@
+package verification
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+// newSQLCodeStore creates a SQLCodeStore on an in-memory SQLite database.
+func newSQLCodeStore(t *testing.T) (*SQLCodeStore[MobileCode], *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	_, err = db.Exec(`CREATE TABLE verification_codes (
+		code_key VARCHAR(512) PRIMARY KEY, type VARCHAR(64) NOT NULL, sequence VARCHAR(64) NOT NULL,
+		target VARCHAR(255) NOT NULL, digest VARCHAR(128) NOT NULL, data BLOB NOT NULL,
+		expires_at BIGINT NOT NULL)`)
+	require.NoError(t, err)
+	return NewSQLCodeStore[MobileCode](db, SQLCodeStoreOptions{}), db
+}
+
+func TestVerification_SQLCodeStore(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+	store, db := newSQLCodeStore(t)
+	require.NoError(t, store.Check(ctx))
+
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	gen := NewTestCodeGenerator("666666")
+	svc := NewOTPService[MobileCode](mobileTestConfig(10, 2), client, &fakeSMSSender{},
+		WithCodeCache[MobileCode](store))
+	mc, err := gen.NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	seq, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+
+	var target, digest string
+	require.NoError(t, db.QueryRow(`SELECT target, digest FROM verification_codes WHERE sequence = ?`, seq).
+		Scan(&target, &digest))
+	assert.Equal(t, "13800138000:86", target)
+	assert.Equal(t, hashCode("666666"), digest)
+
+	// Failures are counted by the limiter, the code is consumed once.
+	probe := mobileProbe(seq, "13800138000", "86")
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", probe), ErrCodeIncorrect)
+	require.NoError(t, svc.Verify(ctx, "666666", probe))
+	assert.ErrorIs(t, svc.Verify(ctx, "666666", probe), ErrCodeNotFound)
+
+	// Expired codes are invisible and purged.
+	mc, err = gen.NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	seq, err = svc.Send(ctx, mc)
+	require.NoError(t, err)
+	now = now.Add(5*time.Minute + time.Second)
+	assert.ErrorIs(t, svc.Verify(ctx, "666666", mobileProbe(seq, "13800138000", "86")), ErrCodeNotFound)
+	n, err := store.PurgeExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	// Set replaces the code under the key, Consume tells a mismatch from a missing code.
+	first, err := gen.NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	second, err := NewTestCodeGenerator("777777").NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	require.NoError(t, store.Set(ctx, "upsert", first, time.Minute))
+	require.NoError(t, store.Set(ctx, "upsert", second, time.Minute))
+	stored, err := store.Peek(ctx, "upsert")
+	require.NoError(t, err)
+	assert.Equal(t, second.GetSequence(), stored.GetSequence())
+	decision, err := store.Consume(ctx, "upsert", hashCode("666666"))
+	require.NoError(t, err)
+	assert.Equal(t, ConsumeMismatched, decision)
+	decision, err = store.Consume(ctx, "upsert", hashCode("777777"))
+	require.NoError(t, err)
+	assert.Equal(t, ConsumeMatched, decision)
+	decision, err = store.Consume(ctx, "upsert", hashCode("777777"))
+	require.NoError(t, err)
+	assert.Equal(t, ConsumeNotFound, decision)
+
+	pg := NewSQLCodeStore[MobileCode](db, SQLCodeStoreOptions{Table: "otp", Placeholder: PlaceholderDollar})
+	assert.Equal(t, "DELETE FROM otp WHERE code_key = $1 AND digest = $2",
+		pg.query("DELETE FROM {table} WHERE code_key = ? AND digest = ?"))
+}
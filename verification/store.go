@@ -2,52 +2,186 @@ package verification
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
+	"github.com/crypto-zero/go-biz/cache"
 	"github.com/redis/go-redis/v9"
 )
 
-// CodeStore[T] provides typed CRUD for verification codes backed by Redis + JSON.
-// The verification code is stored as a SHA-256 hash to prevent plaintext
+// consumeScript atomically compares the stored digest with the input digest in constant
+// time, deletes the code on match, and on mismatch counts a fixed-window failure when a
+// failure key is given, deleting the code once the failure limit is exceeded.
+var consumeScript = redis.NewScript(`
+local stored = redis.call('GET', KEYS[1])
+if not stored then
+  return {0, 0, 0}
+end
+local ok, code = pcall(cjson.decode, stored)
+if not ok then
+  return redis.error_reply('decode failed')
+end
+
+-- compare every byte so the time doesn't depend on the first differing one
+local function equal(a, b)
+  if type(a) ~= 'string' or #a ~= #b then
+    return false
+  end
+  local diff = 0
+  for i = 1, #a do
+    if a:byte(i) ~= b:byte(i) then
+      diff = diff + 1
+    end
+  end
+  return diff == 0
+end
+
+if equal(code['digest'], ARGV[1]) then
+  redis.call('DEL', unpack(KEYS))
+  return {1, 0, 0}
+end
+if #KEYS < 2 then
+  return {2, 0, 0}
+end
+
+local limit     = tonumber(ARGV[2])
+local window_ms = tonumber(ARGV[3])
+redis.call('SET', KEYS[2], 0, 'PX', window_ms, 'NX')
+local current = redis.call('INCR', KEYS[2])
+local ttl = redis.call('PTTL', KEYS[2])
+if ttl == -1 then
+  redis.call('PEXPIRE', KEYS[2], window_ms)
+  ttl = window_ms
+end
+if current > limit then
+  redis.call('DEL', KEYS[1], KEYS[2])
+  return {3, ttl, current}
+end
+return {2, ttl, current}
+`)
+
+// ConsumeDecision is the outcome of CodeStore.CompareAndConsume.
+type ConsumeDecision int
+
+const (
+	// ConsumeNotFound means no code is stored under the key.
+	ConsumeNotFound ConsumeDecision = iota
+	// ConsumeMatched means the digest matched and the code was deleted.
+	ConsumeMatched
+	// ConsumeMismatched means the digest did not match.
+	ConsumeMismatched
+	// ConsumeLimitExceeded means the digest did not match and the failure limit was
+	// exceeded, the code was deleted.
+	ConsumeLimitExceeded
+)
+
+// CodeCache[T] stores verification codes by key. CodeStore is the Redis implementation
+// and SQLCodeStore the SQL one.
+type CodeCache[T VerificationCode] interface {
+	// Check checks the backing storage is reachable.
+	Check(ctx context.Context) error
+	// Set stores code under key for expire.
+	Set(ctx context.Context, key string, code *T, expire time.Duration) error
+	// Peek returns the code under key, or ErrCodeNotFound.
+	Peek(ctx context.Context, key string) (*T, error)
+	// PeekWithTTL returns the code under key with its remaining validity.
+	PeekWithTTL(ctx context.Context, key string) (*T, time.Duration, error)
+	// Delete deletes the code under key and reports whether it existed.
+	Delete(ctx context.Context, key string) (bool, error)
+	// Consume atomically compares digest with the code under key and deletes it on match.
+	Consume(ctx context.Context, key, digest string) (ConsumeDecision, error)
+}
+
+var (
+	_ CodeCache[MobileCode] = (*CodeStore[MobileCode])(nil)
+	_ CodeCache[MobileCode] = (*SQLCodeStore[MobileCode])(nil)
+)
+
+// ConsumeResult is the result of CodeStore.CompareAndConsume.
+type ConsumeResult struct {
+	Decision ConsumeDecision
+	Failures int64         // failures counted in the window, with a failure key
+	RetryIn  time.Duration // time until the failure window resets, with a failure key
+}
+
+// CodeStore[T] provides typed CRUD for verification codes backed by Redis and a Codec,
+// JSON by default. The verification code is stored as a SHA-256 hash to prevent plaintext
 // exposure in the event of unauthorized Redis access.
 type CodeStore[T VerificationCode] struct {
 	client redis.UniversalClient
+	codec  Codec
+	cache  *cache.Cache[T]
 }
 
-// NewCodeStore creates a CodeStore[T] backed by the given Redis client.
+// NewCodeStore creates a CodeStore[T] backed by the given Redis client with JSONCodec.
 func NewCodeStore[T VerificationCode](client redis.UniversalClient) *CodeStore[T] {
-	return &CodeStore[T]{client: client}
+	return NewCodeStoreWithCodec[T](client, JSONCodec)
 }
 
-func (s *CodeStore[T]) Set(ctx context.Context, key string, code *T, expire time.Duration) error {
-	data, err := json.Marshal(code)
-	if err != nil {
-		return fmt.Errorf("verification: encode failed: %w", err)
+// NewCodeStoreWithCodec creates a CodeStore[T] encoding codes with codec, a nil codec
+// is JSONCodec.
+func NewCodeStoreWithCodec[T VerificationCode](client redis.UniversalClient, codec Codec) *CodeStore[T] {
+	if codec == nil {
+		codec = JSONCodec
+	}
+	return &CodeStore[T]{client: client, codec: codec, cache: cache.New[T](client, cache.Options{Codec: codec})}
+}
+
+// Check pings Redis, it implements the health checker of the store.
+func (s *CodeStore[T]) Check(ctx context.Context) error {
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("verification: redis ping failed: %w", err)
 	}
-	if err = s.client.Set(ctx, key, data, expire).Err(); err != nil {
-		return fmt.Errorf("verification: redis set failed: %w", err)
+	return nil
+}
+
+func (s *CodeStore[T]) Set(ctx context.Context, key string, code *T, expire time.Duration) error {
+	// The plaintext must never reach Redis, whatever fields the codec encodes.
+	v := *code
+	any(&v).(interface{ clearValue() }).clearValue()
+	if err := s.cache.Set(ctx, key, &v, expire); err != nil {
+		return fmt.Errorf("verification: %w", err)
 	}
 	return nil
 }
 
 func (s *CodeStore[T]) Peek(ctx context.Context, key string) (*T, error) {
-	data, err := s.client.Get(ctx, key).Bytes()
-	if errors.Is(err, redis.Nil) {
-		return nil, ErrCodeNotFound
-	}
+	v, err := s.cache.Get(ctx, key)
+	return v, codeCacheError(err)
+}
+
+// PeekWithTTL returns the code under key with its remaining validity, with GET and
+// PTTL in one pipeline.
+func (s *CodeStore[T]) PeekWithTTL(ctx context.Context, key string) (*T, time.Duration, error) {
+	v, ttl, err := s.cache.GetWithTTL(ctx, key)
 	if err != nil {
-		return nil, fmt.Errorf("verification: redis get failed: %w", err)
+		return nil, 0, codeCacheError(err)
 	}
+	return v, ttl, nil
+}
+
+// decode decodes a stored code.
+func (s *CodeStore[T]) decode(data []byte) (*T, error) {
 	var v T
-	if err = json.Unmarshal(data, &v); err != nil {
+	if err := s.codec.Unmarshal(data, &v); err != nil {
 		return nil, fmt.Errorf("verification: decode failed: %w", err)
 	}
 	return &v, nil
 }
 
+// codeCacheError converts the errors of the cache to the errors of the store.
+func codeCacheError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, cache.ErrNotFound):
+		return ErrCodeNotFound
+	default:
+		return fmt.Errorf("verification: %w", err)
+	}
+}
+
 func (s *CodeStore[T]) Delete(ctx context.Context, key string) (bool, error) {
 	n, err := s.client.Del(ctx, key).Result()
 	if err != nil {
@@ -55,3 +189,171 @@ func (s *CodeStore[T]) Delete(ctx context.Context, key string) (bool, error) {
 	}
 	return n > 0, nil
 }
+
+// Take atomically returns and deletes the code under key with GETDEL, or returns
+// ErrCodeNotFound. It needs Redis 6.2.
+func (s *CodeStore[T]) Take(ctx context.Context, key string) (*T, error) {
+	v, err := s.cache.GetDel(ctx, key)
+	return v, codeCacheError(err)
+}
+
+// Replace records key as the latest code of index and atomically deletes the code the
+// index pointed to before, the index expires after expire. It runs in a WATCH transaction
+// naming every key, on a Redis Cluster the index and the code keys must share a hash tag,
+// e.g. through the key prefix.
+func (s *CodeStore[T]) Replace(ctx context.Context, index, key string, expire time.Duration) error {
+	replace := func(tx *redis.Tx) error {
+		prev, err := tx.Get(ctx, index).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, index, key, expire)
+			if prev != "" && prev != key {
+				pipe.Del(ctx, prev)
+			}
+			return nil
+		})
+		return err
+	}
+	if err := s.watch(ctx, replace, index); err != nil {
+		return fmt.Errorf("verification: redis replace failed: %w", err)
+	}
+	return nil
+}
+
+// KeepRecent records key as the latest code of index and atomically deletes the codes
+// of index beyond the n most recent, the index expires after expire. It runs in a WATCH
+// transaction naming every key like Replace.
+func (s *CodeStore[T]) KeepRecent(ctx context.Context, index, key string, n int, expire time.Duration) error {
+	keep := func(tx *redis.Tx) error {
+		keys, err := tx.LRange(ctx, index, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+		recent := []string{key}
+		for _, k := range keys {
+			if k != key {
+				recent = append(recent, k)
+			}
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.LRem(ctx, index, 0, key)
+			pipe.LPush(ctx, index, key)
+			pipe.LTrim(ctx, index, 0, int64(n-1))
+			pipe.PExpire(ctx, index, expire)
+			if len(recent) > n {
+				pipe.Del(ctx, recent[n:]...)
+			}
+			return nil
+		})
+		return err
+	}
+	if err := s.watch(ctx, keep, index); err != nil {
+		return fmt.Errorf("verification: redis keep recent failed: %w", err)
+	}
+	return nil
+}
+
+// Consume atomically compares digest with the stored code and deletes it on match.
+func (s *CodeStore[T]) Consume(ctx context.Context, key, digest string) (ConsumeDecision, error) {
+	res, err := s.CompareAndConsume(ctx, key, digest, "", 0, 0)
+	return res.Decision, err
+}
+
+// CompareAndConsume atomically compares digest with the stored code and deletes it on
+// match. With a failureKey it also counts the mismatch in a fixed window of limit
+// failures and returns the failures with the time until the window resets, the failure
+// counter is cleared on match. On a Redis Cluster both keys must share a hash tag, e.g. through
+// the key prefix.
+//
+// JSON codes are compared by a single Lua script, other codecs are decoded in Go and
+// consumed in a WATCH transaction.
+func (s *CodeStore[T]) CompareAndConsume(ctx context.Context, key, digest, failureKey string,
+	limit int64, window time.Duration,
+) (ConsumeResult, error) {
+	if s.codec != JSONCodec {
+		return s.compareAndConsumeTx(ctx, key, digest, failureKey, limit, window)
+	}
+	keys := []string{key}
+	if failureKey != "" {
+		keys = append(keys, failureKey)
+	}
+	res, err := consumeScript.Run(ctx, s.client, keys, digest, limit, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return ConsumeResult{}, fmt.Errorf("verification: redis consume failed: %w", err)
+	}
+	return ConsumeResult{
+		Decision: ConsumeDecision(res[0]),
+		Failures: res[2],
+		RetryIn:  time.Duration(res[1]) * time.Millisecond,
+	}, nil
+}
+
+// maxWatchRetries bounds the retries of the WATCH transactions of the store.
+const maxWatchRetries = 3
+
+// watch runs fn in a WATCH transaction on keys, retried while another client changes them.
+func (s *CodeStore[T]) watch(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) error {
+	var err error
+	for i := 0; i < maxWatchRetries; i++ {
+		if err = s.client.Watch(ctx, fn, keys...); !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	return err
+}
+
+// compareAndConsumeTx is CompareAndConsume for codecs Lua can't decode.
+func (s *CodeStore[T]) compareAndConsumeTx(ctx context.Context, key, digest, failureKey string,
+	limit int64, window time.Duration,
+) (ConsumeResult, error) {
+	decision := ConsumeMismatched
+	consume := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			decision = ConsumeNotFound
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stored, err := s.decode(data)
+		if err != nil {
+			return err
+		}
+		if !equalCode(any(*stored).(interface{ GetDigest() string }).GetDigest(), digest) {
+			decision = ConsumeMismatched
+			return nil
+		}
+		decision = ConsumeMatched
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			if failureKey != "" {
+				pipe.Del(ctx, failureKey)
+			}
+			return nil
+		})
+		return err
+	}
+	if err := s.watch(ctx, consume, key); err != nil {
+		return ConsumeResult{}, fmt.Errorf("verification: redis consume failed: %w", err)
+	}
+	if decision != ConsumeMismatched || failureKey == "" {
+		return ConsumeResult{Decision: decision}, nil
+	}
+
+	res, err := allowScript.Run(ctx, s.client, []string{failureKey}, limit, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return ConsumeResult{}, fmt.Errorf("verification: redis consume failed: %w", err)
+	}
+	result := ConsumeResult{Decision: ConsumeMismatched, Failures: res[1],
+		RetryIn: time.Duration(res[3]) * time.Millisecond}
+	if res[0] != 1 {
+		if err = s.client.Del(ctx, key, failureKey).Err(); err != nil {
+			return ConsumeResult{}, fmt.Errorf("verification: redis del failed: %w", err)
+		}
+		result.Decision = ConsumeLimitExceeded
+	}
+	return result, nil
+}
@@ -0,0 +1,109 @@
+package verification
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	bizerrors "github.com/crypto-zero/go-biz/errors"
+)
+
+// ErrTemplateNotFound indicates that no template is configured for a code type.
+var ErrTemplateNotFound = bizerrors.New(500, "VERIFICATION_TEMPLATE_NOT_FOUND", "template not found")
+
+// LocalizedTemplateProvider is a TemplateProvider with templates per locale, the
+// senders use it for codes sent WithLocale.
+type LocalizedTemplateProvider[T Template] interface {
+	TemplateProvider[T]
+	// GetLocalizedTemplate returns the template of typ for locale or its fallbacks.
+	GetLocalizedTemplate(typ CodeType, locale string) (*T, error)
+}
+
+// LookupTemplate returns the template of typ for locale from provider, the default
+// template when locale is empty or provider has no locales.
+func LookupTemplate[T Template](provider TemplateProvider[T], typ CodeType, locale string) (*T, error) {
+	if lp, ok := provider.(LocalizedTemplateProvider[T]); ok && locale != "" {
+		return lp.GetLocalizedTemplate(typ, locale)
+	}
+	return provider.GetTemplate(typ)
+}
+
+// LocaleFallbacks returns the locales tried for locale, most specific first and the
+// default locale "" last, e.g. "zh-Hant-TW" gives zh-hant-tw, zh-hant, zh and "".
+// Tags are lower case with "_" replaced by "-".
+func LocaleFallbacks(locale string) []string {
+	locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	var locales []string
+	for locale != "" {
+		locales = append(locales, locale)
+		i := strings.LastIndexByte(locale, '-')
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return append(locales, "")
+}
+
+// templateEntry is the key of a template in a TemplateCatalog.
+type templateEntry struct {
+	typ    CodeType
+	locale string
+}
+
+// TemplateCatalog is a LocalizedTemplateProvider keeping templates by CodeType and
+// locale. A lookup falls back along LocaleFallbacks, e.g. zh-CN, zh and the default
+// template added with an empty locale.
+type TemplateCatalog[T Template] struct {
+	mu        sync.RWMutex
+	templates map[templateEntry]*T
+}
+
+// Compile-time assertion: TemplateCatalog implements LocalizedTemplateProvider[SMSTemplate].
+var _ LocalizedTemplateProvider[SMSTemplate] = (*TemplateCatalog[SMSTemplate])(nil)
+
+// NewTemplateCatalog creates an empty TemplateCatalog.
+func NewTemplateCatalog[T Template]() *TemplateCatalog[T] {
+	return &TemplateCatalog[T]{templates: map[templateEntry]*T{}}
+}
+
+// Add sets the template of typ for locale, an empty locale sets the default template.
+func (c *TemplateCatalog[T]) Add(typ CodeType, locale string, tmpl T) *TemplateCatalog[T] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.templates[templateEntry{typ: typ, locale: LocaleFallbacks(locale)[0]}] = &tmpl
+	return c
+}
+
+// GetTemplate returns the default template of typ, it implements TemplateProvider.
+func (c *TemplateCatalog[T]) GetTemplate(typ CodeType) (*T, error) {
+	return c.GetLocalizedTemplate(typ, "")
+}
+
+// GetLocalizedTemplate returns the template of typ for the first of the
+// LocaleFallbacks of locale with one, ErrTemplateNotFound without any.
+func (c *TemplateCatalog[T]) GetLocalizedTemplate(typ CodeType, locale string) (*T, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, l := range LocaleFallbacks(locale) {
+		if tmpl, ok := c.templates[templateEntry{typ: typ, locale: l}]; ok {
+			return tmpl, nil
+		}
+	}
+	return nil, ErrTemplateNotFound
+}
+
+// Validate validates all templates of the catalog, e.g. at startup, and returns the
+// errors of all invalid ones.
+func (c *TemplateCatalog[T]) Validate() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var errs []error
+	for entry, tmpl := range c.templates {
+		if err := any(*tmpl).(interface{ Validate() error }).Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("template %s (locale %q): %w", entry.typ, entry.locale, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,61 @@
+package verification
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_TemplateCatalog(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	assert.Equal(t, []string{"zh-hant-tw", "zh-hant", "zh", ""}, LocaleFallbacks("zh_Hant_TW"))
+	assert.Equal(t, []string{""}, LocaleFallbacks(""))
+
+	catalog := NewTemplateCatalog[SMSTemplate]().
+		Add("login", "", SMSTemplate{Code: "SMS_EN"}).
+		Add("login", "zh", SMSTemplate{Code: "SMS_ZH"}).
+		Add("login", "zh-TW", SMSTemplate{Code: "SMS_ZH_TW"})
+	for locale, want := range map[string]string{
+		"": "SMS_EN", "en-US": "SMS_EN", "zh-CN": "SMS_ZH", "zh": "SMS_ZH", "ZH_tw": "SMS_ZH_TW",
+	} {
+		tmpl, err := LookupTemplate[SMSTemplate](catalog, "login", locale)
+		require.NoError(t, err, locale)
+		assert.Equal(t, want, tmpl.Code, locale)
+	}
+	_, err := catalog.GetLocalizedTemplate("register", "zh-CN")
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+
+	// The locale of the send reaches the sender and is stored with the code.
+	fake := &fakeSMSSender{}
+	svc := NewOTPService[MobileCode](mobileTestConfig(10, 10), client, fake)
+	mc, err := NewTestCodeGenerator("666666").NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	seq, err := svc.Send(ctx, mc, WithLocale("zh-CN"))
+	require.NoError(t, err)
+	require.NotNil(t, fake.last)
+	assert.Equal(t, "zh-CN", fake.last.GetLocale())
+	stored, err := NewCodeStore[MobileCode](client).Peek(ctx,
+		NewCacheKeyBuilder("TEST").CodeKey("MOBILE", "LOGIN", seq, "13800138000", "86"))
+	require.NoError(t, err)
+	assert.Equal(t, "zh-CN", stored.Locale)
+}
+
+func TestVerification_TemplateValidate(t *testing.T) {
+	assert.NoError(t, SMSTemplate{ParamsFormat: `{"code":"{{.Code}}"}`}.Validate())
+	assert.ErrorIs(t, SMSTemplate{ParamsFormat: `{"code":"123"}`}.Validate(), ErrTemplateInvalid)
+	assert.NoError(t, EmailTemplate{Subject: "{{.AppName}} code", BodyFormat: "Code: {{.Code}}"}.Validate())
+	assert.ErrorIs(t, EmailTemplate{BodyFormat: "Code: {{.Code}}"}.Validate(), ErrTemplateInvalid)
+	assert.ErrorIs(t, EmailTemplate{Subject: "{{.Nope}}", BodyFormat: "{{.Code}}"}.Validate(), ErrTemplateInvalid)
+
+	catalog := NewTemplateCatalog[SMSTemplate]().
+		Add("login", "", SMSTemplate{ParamsFormat: `{"code":"{{.Code}}"}`}).
+		Add("login", "zh", SMSTemplate{ParamsFormat: `{"code":"{{.Mobile}}"}`})
+	err := catalog.Validate()
+	assert.ErrorIs(t, err, ErrTemplateInvalid)
+	assert.ErrorContains(t, err, `locale "zh"`)
+}
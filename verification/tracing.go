@@ -0,0 +1,94 @@
+package verification
+
+import (
+	"context"
+	"net"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the OpenTelemetry instrumentation scope of the package.
+const instrumentationName = "github.com/crypto-zero/go-biz/verification"
+
+// tracer creates the spans of the package with the global TracerProvider, they are
+// no-ops until the application installs one with otel.SetTracerProvider.
+var tracer = otel.Tracer(instrumentationName)
+
+// startSpan starts a span of a flow of the code of medium and typ.
+func startSpan(ctx context.Context, name, medium string, typ CodeType) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("verification.medium", medium),
+		attribute.String("verification.type", string(typ)),
+	))
+}
+
+// endSpan records the result of err and ends span. Only failures of the
+// infrastructure set the error status, rejections and wrong codes are expected.
+func endSpan(span trace.Span, err error) {
+	result := resultOf(err)
+	span.SetAttributes(attribute.String("verification.result", result))
+	if result == ResultError {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// redisTracingHook is the redis.Hook of NewRedisTracingHook.
+type redisTracingHook struct{}
+
+// NewRedisTracingHook returns a hook creating a client span for every command of a
+// client, including the Lua scripts of the stores and limiters, so the Redis time of
+// the send and verify spans is visible. Add it with client.AddHook.
+func NewRedisTracingHook() redis.Hook {
+	return redisTracingHook{}
+}
+
+// DialHook implements redis.Hook.
+func (redisTracingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+// ProcessHook implements redis.Hook.
+func (redisTracingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := startRedisSpan(ctx, cmd.Name())
+		err := next(ctx, cmd)
+		endRedisSpan(span, err)
+		return err
+	}
+}
+
+// ProcessPipelineHook implements redis.Hook.
+func (redisTracingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := startRedisSpan(ctx, "pipeline")
+		span.SetAttributes(attribute.Int("db.operation.batch.size", len(cmds)))
+		err := next(ctx, cmds)
+		endRedisSpan(span, err)
+		return err
+	}
+}
+
+// startRedisSpan starts the client span of a Redis command.
+func startRedisSpan(ctx context.Context, command string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "redis "+command, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system.name", "redis"),
+		attribute.String("db.operation.name", command),
+	))
+}
+
+// endRedisSpan ends the span of a Redis command, see redisResult for the errors.
+func endRedisSpan(span trace.Span, err error) {
+	if redisResult(err) == ResultError {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
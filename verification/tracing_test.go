@@ -0,0 +1,55 @@
+package verification
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestVerification_Tracing(t *testing.T) {
+	ctx := context.Background()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(prev)
+
+	client.AddHook(NewRedisTracingHook())
+	svc := NewOTPService[MobileCode](mobileTestConfig(10, 10), client, &fakeSMSSender{})
+	mc, err := NewTestCodeGenerator("666666").NewMobileCode("login", 1, "13800138000", "86")
+	require.NoError(t, err)
+	seq, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", mobileProbe(seq, "13800138000", "86")), ErrCodeIncorrect)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	send, deliver, verify := spans["verification.Send"], spans["verification.Deliver"], spans["verification.Verify"]
+	require.NotNil(t, send)
+	require.NotNil(t, deliver)
+	require.NotNil(t, verify)
+	assert.Equal(t, send.SpanContext().SpanID(), deliver.Parent().SpanID())
+	assert.Contains(t, verify.Attributes(), attribute.String("verification.result", ResultIncorrect))
+	assert.Equal(t, otelcodes.Unset, verify.Status().Code)
+
+	// The Redis commands are children of the flow spans.
+	var redisChildren int
+	for _, span := range recorder.Ended() {
+		if strings.HasPrefix(span.Name(), "redis ") && span.Parent().SpanID() == send.SpanContext().SpanID() {
+			redisChildren++
+		}
+	}
+	assert.Positive(t, redisChildren)
+}
@@ -82,6 +82,22 @@ func (f *fakeEmailSender) Send(_ context.Context, ec *EmailCode) error {
 	return nil
 }
 
+// countingSMSSender counts the sends.
+type countingSMSSender struct{ calls int }
+
+func (f *countingSMSSender) Send(context.Context, *MobileCode) error {
+	f.calls++
+	return nil
+}
+
+// failingSMSSender fails every send.
+type failingSMSSender struct{ calls int }
+
+func (f *failingSMSSender) Send(context.Context, *MobileCode) error {
+	f.calls++
+	return ErrSendFailed
+}
+
 // mobileTestConfig returns an OTPConfig for the mobile channel.
 func mobileTestConfig(maxSend, maxVerify int64) OTPConfig {
 	return OTPConfig{
@@ -274,13 +290,13 @@ func TestOTPServiceImpl_Integration_SendAndVerifyLimit(t *testing.T) {
 	err = svc.Verify(ctx, wrongCodeFor(code), mobileProbe(seq, "13800138000", "86"))
 	assert.ErrorIs(t, err, ErrMobileVerifyLimitExceeded)
 
-	// Fourth attempt — code is already deleted
+	// Fourth attempt — the sequence is locked out
 	err = svc.Verify(ctx, wrongCodeFor(code), mobileProbe(seq, "13800138000", "86"))
-	assert.ErrorIs(t, err, ErrCodeNotFound)
+	assert.ErrorIs(t, err, ErrMobileVerifyLimitExceeded)
 
 	// Correct code after limit should still fail
 	err = svc.Verify(ctx, code, mobileProbe(seq, "13800138000", "86"))
-	assert.ErrorIs(t, err, ErrCodeNotFound)
+	assert.ErrorIs(t, err, ErrMobileVerifyLimitExceeded)
 }
 
 func TestOTPServiceImpl_Integration_AdvancedCases(t *testing.T) {
@@ -458,7 +474,7 @@ func TestOTPServiceImpl_EmailOTP_VerifyLimitExceeded(t *testing.T) {
 
 	// Correct code after limit should fail
 	err = svc.Verify(ctx, code, emailProbe(seq, "user@example.com"))
-	assert.ErrorIs(t, err, ErrCodeNotFound)
+	assert.ErrorIs(t, err, ErrEmailVerifyLimitExceeded)
 }
 
 func TestOTPServiceImpl_EmailOTP_SendLimitExceeded(t *testing.T) {
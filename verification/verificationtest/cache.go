@@ -0,0 +1,170 @@
+// Package verificationtest provides in-memory fakes of the verification interfaces and
+// helpers reading the sent codes back, so services can unit test their OTP flows
+// without running Redis themselves.
+package verificationtest
+
+import (
+	"context"
+	"crypto/subtle"
+	"sync"
+	"time"
+
+	"github.com/crypto-zero/go-biz/verification"
+)
+
+// CodeCache[T] is a verification.CodeCache keeping the codes in memory. Like the
+// CodeStore the codes are stored JSON encoded, so the plaintext value is dropped.
+type CodeCache[T verification.CodeConstraint] struct {
+	mu     sync.Mutex
+	codes  map[string]cacheEntry
+	offset time.Duration
+	err    error
+}
+
+// cacheEntry is a stored code with its expiration.
+type cacheEntry struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// Compile-time assertion: CodeCache implements verification.CodeCache.
+var _ verification.CodeCache[verification.MobileCode] = (*CodeCache[verification.MobileCode])(nil)
+
+// NewCodeCache creates an empty CodeCache.
+func NewCodeCache[T verification.CodeConstraint]() *CodeCache[T] {
+	return &CodeCache[T]{codes: map[string]cacheEntry{}}
+}
+
+// Advance moves the clock of the cache by d, expiring the codes whose TTL elapsed.
+func (c *CodeCache[T]) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset += d
+}
+
+// FailWith makes every call fail with err, nil restores the cache.
+func (c *CodeCache[T]) FailWith(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+// Len returns the number of unexpired codes.
+func (c *CodeCache[T]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for key := range c.codes {
+		if _, ok := c.get(key); ok {
+			n++
+		}
+	}
+	return n
+}
+
+// now returns the time of the cache clock.
+func (c *CodeCache[T]) now() time.Time {
+	return time.Now().Add(c.offset)
+}
+
+// get returns the unexpired entry under key, deleting an expired one.
+func (c *CodeCache[T]) get(key string) (cacheEntry, bool) {
+	e, ok := c.codes[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	if !c.now().Before(e.expiresAt) {
+		delete(c.codes, key)
+		return cacheEntry{}, false
+	}
+	return e, true
+}
+
+// decode returns the code of e.
+func (c *CodeCache[T]) decode(e cacheEntry) (*T, error) {
+	code := new(T)
+	if err := verification.JSONCodec.Unmarshal(e.data, code); err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// Check implements verification.CodeCache.
+func (c *CodeCache[T]) Check(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Set implements verification.CodeCache.
+func (c *CodeCache[T]) Set(_ context.Context, key string, code *T, expire time.Duration) error {
+	data, err := verification.JSONCodec.Marshal(code)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	c.codes[key] = cacheEntry{data: data, expiresAt: c.now().Add(expire)}
+	return nil
+}
+
+// Peek implements verification.CodeCache.
+func (c *CodeCache[T]) Peek(ctx context.Context, key string) (*T, error) {
+	code, _, err := c.PeekWithTTL(ctx, key)
+	return code, err
+}
+
+// PeekWithTTL implements verification.CodeCache.
+func (c *CodeCache[T]) PeekWithTTL(_ context.Context, key string) (*T, time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, 0, c.err
+	}
+	e, ok := c.get(key)
+	if !ok {
+		return nil, 0, verification.ErrCodeNotFound
+	}
+	code, err := c.decode(e)
+	if err != nil {
+		return nil, 0, err
+	}
+	return code, e.expiresAt.Sub(c.now()), nil
+}
+
+// Delete implements verification.CodeCache.
+func (c *CodeCache[T]) Delete(_ context.Context, key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return false, c.err
+	}
+	_, ok := c.get(key)
+	delete(c.codes, key)
+	return ok, nil
+}
+
+// Consume implements verification.CodeCache.
+func (c *CodeCache[T]) Consume(_ context.Context, key, digest string) (verification.ConsumeDecision, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return verification.ConsumeNotFound, c.err
+	}
+	e, ok := c.get(key)
+	if !ok {
+		return verification.ConsumeNotFound, nil
+	}
+	code, err := c.decode(e)
+	if err != nil {
+		return verification.ConsumeNotFound, err
+	}
+	if subtle.ConstantTimeCompare([]byte((*code).GetDigest()), []byte(digest)) != 1 {
+		return verification.ConsumeMismatched, nil
+	}
+	delete(c.codes, key)
+	return verification.ConsumeMatched, nil
+}
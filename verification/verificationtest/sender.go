@@ -0,0 +1,96 @@
+package verificationtest
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/crypto-zero/go-biz/verification"
+)
+
+// Sender[T] is a verification.CodeSender recording the sent codes with their plaintext
+// values, so tests can read the code a user would receive.
+type Sender[T verification.CodeConstraint] struct {
+	mu    sync.Mutex
+	codes []T
+	err   error
+}
+
+// Compile-time assertion: Sender implements verification.CodeSender.
+var _ verification.CodeSender[verification.MobileCode] = (*Sender[verification.MobileCode])(nil)
+
+// NewSender creates a Sender.
+func NewSender[T verification.CodeConstraint]() *Sender[T] {
+	return &Sender[T]{}
+}
+
+// Send records code, or returns the error set by FailWith without recording it.
+func (s *Sender[T]) Send(_ context.Context, code *T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.codes = append(s.codes, *code)
+	return nil
+}
+
+// FailWith makes the sends fail with err, e.g. verification.ErrSendFailed, nil
+// restores the sender.
+func (s *Sender[T]) FailWith(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// Sent returns the recorded codes, the oldest first.
+func (s *Sender[T]) Sent() []T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]T(nil), s.codes...)
+}
+
+// Last returns the most recent code sent to target, the LimitKeyParts of the code
+// joined with ":" like verification.DryRunSender.Captured, e.g. "13800138000:86". An
+// empty target matches every code. It returns verification.ErrCodeNotFound without one.
+func (s *Sender[T]) Last(target string) (*T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.codes) - 1; i >= 0; i-- {
+		code := s.codes[i]
+		if target == "" || strings.Join(code.LimitKeyParts(), ":") == target {
+			return &code, nil
+		}
+	}
+	return nil, verification.ErrCodeNotFound
+}
+
+// LastCode returns the plaintext value and the sequence of the most recent code sent
+// to target, see Last.
+func (s *Sender[T]) LastCode(target string) (value, sequence string, err error) {
+	code, err := s.Last(target)
+	if err != nil {
+		return "", "", err
+	}
+	return (*code).GetValue(), (*code).GetSequence(), nil
+}
+
+// Reset drops the recorded codes.
+func (s *Sender[T]) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codes = nil
+}
+
+// NewGenerator creates a verification.CodeGenerator producing the fixed code with the
+// sequences "seq-1", "seq-2", ..., so tests can assert both. opts may override the
+// sequences with verification.WithSequence.
+func NewGenerator(code string, opts ...verification.GeneratorOption) verification.CodeGenerator {
+	var n atomic.Int64
+	seq := func() string { return "seq-" + strconv.FormatInt(n.Add(1), 10) }
+	return verification.NewTestCodeGenerator(code, append([]verification.GeneratorOption{
+		verification.WithSequence(seq),
+	}, opts...)...)
+}
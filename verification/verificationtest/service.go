@@ -0,0 +1,37 @@
+package verificationtest
+
+import (
+	"testing"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/crypto-zero/go-biz/verification"
+)
+
+// NewRedis starts an in-process Redis closed with the test. The rate limiters,
+// cooldowns and lockouts of the OTPService run on Redis, the returned server advances
+// their windows with FastForward.
+func NewRedis(t testing.TB) (redis.UniversalClient, *mr.Miniredis) {
+	t.Helper()
+	m, err := mr.Run()
+	if err != nil {
+		t.Fatalf("verificationtest: start redis: %v", err)
+	}
+	c := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	t.Cleanup(func() {
+		_ = c.Close()
+		m.Close()
+	})
+	return c, m
+}
+
+// NewOTPService creates an OTPService on NewRedis delivering the codes to sender, e.g.
+// a Sender read back with LastCode.
+func NewOTPService[T verification.CodeConstraint](t testing.TB, cfg verification.OTPConfig,
+	sender verification.CodeSender[T], opts ...verification.OTPServiceOption[T],
+) *verification.OTPService[T] {
+	t.Helper()
+	client, _ := NewRedis(t)
+	return verification.NewOTPService(cfg, client, sender, opts...)
+}
@@ -0,0 +1,58 @@
+package verificationtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/crypto-zero/go-biz/verification"
+)
+
+func TestOTPFlow(t *testing.T) {
+	ctx := context.Background()
+	cache := NewCodeCache[verification.MobileCode]()
+	sender := NewSender[verification.MobileCode]()
+	svc := NewOTPService(t, verification.DefaultOTPConfig("TEST"), sender,
+		verification.WithCodeCache(cache))
+	gen := NewGenerator("123456")
+
+	code, err := gen.NewMobileCode("LOGIN", 1, "13800138000", "86")
+	require.NoError(t, err)
+	seq, err := svc.Send(ctx, code)
+	require.NoError(t, err)
+	assert.Equal(t, "seq-1", seq)
+	assert.Equal(t, 1, cache.Len())
+
+	value, sent, err := sender.LastCode("13800138000:86")
+	require.NoError(t, err)
+	assert.Equal(t, "123456", value)
+	assert.Equal(t, seq, sent)
+	_, err = sender.Last("13900139000:86")
+	assert.ErrorIs(t, err, verification.ErrCodeNotFound)
+
+	probe := &verification.MobileCode{
+		Code:   verification.Code{Type: "LOGIN", Sequence: seq},
+		Mobile: "13800138000", CountryCode: "86",
+	}
+	assert.ErrorIs(t, svc.Verify(ctx, "654321", probe), verification.ErrCodeIncorrect)
+	require.NoError(t, svc.Verify(ctx, value, probe))
+	assert.ErrorIs(t, svc.Verify(ctx, value, probe), verification.ErrCodeNotFound)
+
+	code, err = gen.NewMobileCode("LOGIN", 1, "13900139000", "86")
+	require.NoError(t, err)
+	seq, err = svc.Send(ctx, code)
+	require.NoError(t, err)
+	cache.Advance(10 * time.Minute)
+	probe.Sequence, probe.Mobile = seq, "13900139000"
+	assert.ErrorIs(t, svc.Verify(ctx, "123456", probe), verification.ErrCodeNotFound)
+
+	sender.FailWith(verification.ErrSendFailed)
+	code, err = gen.NewMobileCode("LOGIN", 1, "13700137000", "86")
+	require.NoError(t, err)
+	_, err = svc.Send(ctx, code)
+	assert.ErrorIs(t, err, verification.ErrSendFailed)
+	assert.Len(t, sender.Sent(), 2)
+}
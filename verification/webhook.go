@@ -0,0 +1,273 @@
+package verification
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Events of a WebhookListener.
+const (
+	WebhookCodeSent     = "code.sent"
+	WebhookCodeVerified = "code.verified"
+	WebhookCodeLocked   = "code.locked" // The verify limit was exceeded and the code deleted
+)
+
+// WebhookSignatureHeader is the header of the signature of a webhook request, see
+// SignWebhook and VerifyWebhookSignature.
+const WebhookSignatureHeader = "X-Verification-Signature"
+
+// WebhookConfig configures a WebhookListener.
+type WebhookConfig struct {
+	URL            string
+	Secret         []byte        // HMAC-SHA256 key of the signatures
+	Events         []string      // Events to post, all when empty
+	IncludeTarget  bool          // Post the target as is, otherwise masked with MaskTarget
+	MaxAttempts    int           // Attempts per event, 5 when zero
+	InitialBackoff time.Duration // First retry delay, doubled per retry, 1s when zero
+	MaxBackoff     time.Duration // Maximum retry delay, 1m when zero
+	Timeout        time.Duration // Timeout of a request, 10s when zero
+	QueueSize      int           // Events buffered for delivery, 1024 when zero
+}
+
+func (c *WebhookConfig) applyDefaultValue() {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 5
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = time.Minute
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = 1024
+	}
+}
+
+// WebhookPayload is the JSON body of a webhook request. ID is the same for all
+// attempts of an event, receivers deduplicate retries with it.
+type WebhookPayload struct {
+	ID       string    `json:"id"`
+	Event    string    `json:"event"`
+	Medium   string    `json:"medium"`
+	Type     CodeType  `json:"type"`
+	Sequence string    `json:"sequence"`
+	UserID   int64     `json:"user_id,omitempty"`
+	Target   string    `json:"target"`
+	RetryIn  int64     `json:"retry_in_ms,omitempty"` // Lockout of code.locked
+	Time     time.Time `json:"time"`
+}
+
+// WebhookListener is a CodeEventListener posting signed JSON webhooks of the code
+// sent, verified and locked events, for downstream systems that cannot consume NATS.
+// Events are queued and posted by Run, a full queue drops events.
+type WebhookListener struct {
+	NopCodeEventListener
+	cfg    WebhookConfig
+	client *http.Client
+	logger *slog.Logger
+	events map[string]bool
+	queue  chan *WebhookPayload
+}
+
+// Compile-time assertion: WebhookListener implements CodeEventListener.
+var _ CodeEventListener = (*WebhookListener)(nil)
+
+// NewWebhookListener creates a WebhookListener, run it with go listener.Run(ctx). A
+// nil client uses http.DefaultClient, a nil logger slog.Default. It returns
+// ErrInvalidConfig without URL or Secret.
+func NewWebhookListener(cfg WebhookConfig, client *http.Client, logger *slog.Logger) (*WebhookListener, error) {
+	if cfg.URL == "" || len(cfg.Secret) == 0 {
+		return nil, fmt.Errorf("%w: webhook url or secret is empty", ErrInvalidConfig)
+	}
+	cfg.applyDefaultValue()
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	events := []string{WebhookCodeSent, WebhookCodeVerified, WebhookCodeLocked}
+	if len(cfg.Events) > 0 {
+		events = cfg.Events
+	}
+	l := &WebhookListener{
+		cfg:    cfg,
+		client: client,
+		logger: logger,
+		events: make(map[string]bool, len(events)),
+		queue:  make(chan *WebhookPayload, cfg.QueueSize),
+	}
+	for _, event := range events {
+		l.events[event] = true
+	}
+	return l, nil
+}
+
+// OnSent implements CodeEventListener.
+func (l *WebhookListener) OnSent(_ context.Context, e CodeEvent) {
+	l.enqueue(WebhookCodeSent, e)
+}
+
+// OnVerifySucceeded implements CodeEventListener.
+func (l *WebhookListener) OnVerifySucceeded(_ context.Context, e CodeEvent) {
+	l.enqueue(WebhookCodeVerified, e)
+}
+
+// OnLimited implements CodeEventListener, only the verify limit locks a code.
+func (l *WebhookListener) OnLimited(_ context.Context, e CodeEvent) {
+	if e.Limiter == "verify" {
+		l.enqueue(WebhookCodeLocked, e)
+	}
+}
+
+// enqueue queues event of e when it is posted.
+func (l *WebhookListener) enqueue(event string, e CodeEvent) {
+	if !l.events[event] {
+		return
+	}
+	target := e.Target
+	if !l.cfg.IncludeTarget {
+		target = MaskTarget(target)
+	}
+	p := &WebhookPayload{
+		ID:       e.Sequence + ":" + event,
+		Event:    event,
+		Medium:   e.Medium,
+		Type:     e.Type,
+		Sequence: e.Sequence,
+		UserID:   e.UserID,
+		Target:   target,
+		RetryIn:  e.RetryIn.Milliseconds(),
+		Time:     e.Time,
+	}
+	select {
+	case l.queue <- p:
+	default:
+		l.logger.Warn("verification webhook queue full, event dropped", "event", event, "id", p.ID)
+	}
+}
+
+// Run posts the queued events until ctx is done.
+func (l *WebhookListener) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case p := <-l.queue:
+			l.deliver(ctx, p)
+		}
+	}
+}
+
+// deliver posts p, retrying failures with exponential backoff and jitter.
+func (l *WebhookListener) deliver(ctx context.Context, p *WebhookPayload) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		l.logger.Error("verification webhook encode failed", "id", p.ID, "error", err)
+		return
+	}
+	backoff := l.cfg.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := l.post(ctx, p, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= l.cfg.MaxAttempts {
+			l.logger.Error("verification webhook failed", "id", p.ID, "attempts", attempt, "error", err)
+			return
+		}
+		timer := time.NewTimer(backoff/2 + rand.N(backoff/2+1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, l.cfg.MaxBackoff)
+	}
+}
+
+// post sends one attempt of p, it reports whether a failure is worth a retry: network
+// errors, 429 and 5xx responses.
+func (l *WebhookListener) post(ctx context.Context, p *WebhookPayload, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Verification-Event", p.Event)
+	req.Header.Set("X-Verification-Delivery", p.ID)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(l.cfg.Secret, timeNow().Unix(), body))
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("verification: webhook status %d", resp.StatusCode)
+}
+
+// SignWebhook returns the WebhookSignatureHeader of body sent at timestamp (Unix
+// seconds): "t=<timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>">".
+func SignWebhook(secret []byte, timestamp int64, body []byte) string {
+	ts := strconv.FormatInt(timestamp, 10)
+	return "t=" + ts + ",v1=" + webhookMAC(secret, ts, body)
+}
+
+// VerifyWebhookSignature checks header, the WebhookSignatureHeader of a received
+// webhook, against body. Signatures older than tolerance are rejected to prevent
+// replays, zero disables the check. It returns ErrSignatureInvalid.
+func VerifyWebhookSignature(secret []byte, header string, body []byte, tolerance time.Duration) error {
+	var ts, mac string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			mac = v
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || mac == "" {
+		return ErrSignatureInvalid
+	}
+	if tolerance > 0 && timeNow().Sub(time.Unix(sec, 0)).Abs() > tolerance {
+		return ErrSignatureInvalid
+	}
+	if !hmac.Equal([]byte(mac), []byte(webhookMAC(secret, ts, body))) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
+
+// webhookMAC returns the hex HMAC-SHA256 of "<ts>.<body>".
+func webhookMAC(secret []byte, ts string, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(ts))
+	h.Write([]byte{'.'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
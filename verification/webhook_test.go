@@ -0,0 +1,84 @@
+package verification
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_Webhook(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, cleanup, _ := getRedisClient(t)
+	defer cleanup()
+
+	secret := []byte("webhook-secret")
+	received := make(chan WebhookPayload, 10)
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !assert.NoError(t, VerifyWebhookSignature(secret, r.Header.Get(WebhookSignatureHeader), body, time.Minute)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// The first attempt fails and is retried.
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var p WebhookPayload
+		assert.NoError(t, json.Unmarshal(body, &p))
+		assert.Equal(t, p.Event, r.Header.Get("X-Verification-Event"))
+		received <- p
+	}))
+	defer server.Close()
+
+	_, err := NewWebhookListener(WebhookConfig{URL: server.URL}, nil, nil)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	hook, err := NewWebhookListener(WebhookConfig{URL: server.URL, Secret: secret, InitialBackoff: time.Millisecond},
+		server.Client(), nil)
+	require.NoError(t, err)
+	go hook.Run(ctx)
+
+	svc := NewOTPService[MobileCode](mobileTestConfig(10, 1), client, &fakeSMSSender{},
+		WithEventListener[MobileCode](hook))
+	mc, err := NewTestCodeGenerator("666666").NewMobileCode("login", 7, "13800138000", "86")
+	require.NoError(t, err)
+	seq, err := svc.Send(ctx, mc)
+	require.NoError(t, err)
+	assert.ErrorIs(t, svc.Verify(ctx, "000000", mobileProbe(seq, "13800138000", "86")), ErrCodeIncorrect)
+	require.Error(t, svc.Verify(ctx, "000000", mobileProbe(seq, "13800138000", "86")))
+
+	var events []WebhookPayload
+	for range 2 {
+		select {
+		case p := <-received:
+			events = append(events, p)
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook not received")
+		}
+	}
+	assert.Equal(t, WebhookCodeSent, events[0].Event)
+	assert.Equal(t, seq+":"+WebhookCodeSent, events[0].ID)
+	assert.Equal(t, "138****8000", events[0].Target)
+	assert.Equal(t, int64(7), events[0].UserID)
+	assert.Equal(t, WebhookCodeLocked, events[1].Event)
+	assert.Positive(t, events[1].RetryIn)
+	assert.Equal(t, int32(3), attempts.Load())
+
+	body := []byte(`{"id":"x"}`)
+	header := SignWebhook(secret, time.Now().Unix(), body)
+	assert.NoError(t, VerifyWebhookSignature(secret, header, body, time.Minute))
+	assert.ErrorIs(t, VerifyWebhookSignature([]byte("other"), header, body, time.Minute), ErrSignatureInvalid)
+	assert.ErrorIs(t, VerifyWebhookSignature(secret, header, []byte(`{}`), time.Minute), ErrSignatureInvalid)
+	old := SignWebhook(secret, time.Now().Add(-time.Hour).Unix(), body)
+	assert.ErrorIs(t, VerifyWebhookSignature(secret, old, body, time.Minute), ErrSignatureInvalid)
+}
@@ -0,0 +1,21 @@
+package wechat
+
+import (
+	"github.com/crypto-zero/go-biz/verification"
+	"github.com/google/wire"
+	"go.uber.org/fx"
+)
+
+// ProviderSet is the wire provider set of the WeChat Sender of mobile codes bound to
+// CodeSender[MobileCode]. The application provides the *Config and the Binding.
+var ProviderSet = wire.NewSet(
+	NewMobileSender,
+	wire.Bind(new(verification.CodeSender[verification.MobileCode]), new(*Sender[verification.MobileCode])),
+)
+
+// Module is the fx equivalent of ProviderSet.
+var Module = fx.Options(
+	fx.Provide(
+		fx.Annotate(NewMobileSender, fx.As(fx.Self()), fx.As(new(verification.CodeSender[verification.MobileCode]))),
+	),
+)
@@ -0,0 +1,341 @@
+package wechat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crypto-zero/go-biz/verification"
+)
+
+// ErrNotBound indicates a user without openid for the app of the sender, e.g. to fail
+// over to SMS with verification.WithFailover.
+var ErrNotBound = errors.New("wechat: user has no openid bound")
+
+// Kind is the kind of message the sender delivers.
+type Kind string
+
+const (
+	// KindOfficialAccount sends official account template messages.
+	KindOfficialAccount Kind = "official_account"
+	// KindMiniProgram sends mini program subscribe messages, the user must have
+	// subscribed to the template in the mini program.
+	KindMiniProgram Kind = "mini_program"
+)
+
+// DefaultBaseURL is the endpoint of the WeChat API.
+const DefaultBaseURL = "https://api.weixin.qq.com"
+
+// Config holds the WeChat app configuration, loadable from YAML or env.
+type Config struct {
+	AppID     string `json:"app_id" yaml:"app_id"`
+	AppSecret string `json:"app_secret" yaml:"app_secret"`
+	Kind      Kind   `json:"kind" yaml:"kind"`         // KindOfficialAccount (default) or KindMiniProgram
+	BaseURL   string `json:"base_url" yaml:"base_url"` // Optional API endpoint, DefaultBaseURL when empty
+	// MiniProgramState is the version of the mini program opened from subscribe
+	// messages: formal (default), trial or developer.
+	MiniProgramState string `json:"mini_program_state" yaml:"mini_program_state"`
+	// Templates maps code types to their message templates.
+	Templates map[verification.CodeType]Template `json:"templates" yaml:"templates"`
+	// Render sets {{.AppName}} and {{.TTLMinutes}} of the templates.
+	Render verification.RenderConfig `json:"render" yaml:"render"`
+}
+
+// Template is a WeChat message template. WeChat templates are not localized, the
+// locale of the codes is ignored.
+type Template struct {
+	TemplateID string `json:"template_id" yaml:"template_id"`
+	// Data maps the keywords of the template to text/templates of their values,
+	// rendered with verification.TemplateData, e.g.
+	// {"character_string1": "{{.Code}}", "time2": "{{.TTLMinutes}} minutes"}.
+	Data map[string]string `json:"data" yaml:"data"`
+	// URL is the optional page opened from an official account message.
+	URL string `json:"url" yaml:"url"`
+	// Page is the optional mini program page opened from a subscribe message.
+	Page string `json:"page" yaml:"page"`
+}
+
+// sampleCode is the code rendered by Validate, a template that does not output it does
+// not show the code.
+const sampleCode = "739184"
+
+// Validate checks the app credentials and kind are set and that every template parses
+// and renders the code.
+func (c *Config) Validate() error {
+	if c.AppID == "" || c.AppSecret == "" {
+		return fmt.Errorf("%w: wechat app id or secret is empty", verification.ErrInvalidConfig)
+	}
+	switch c.Kind {
+	case "", KindOfficialAccount, KindMiniProgram:
+	default:
+		return fmt.Errorf("%w: unknown wechat kind %q", verification.ErrInvalidConfig, c.Kind)
+	}
+	for typ, tmpl := range c.Templates {
+		if tmpl.TemplateID == "" {
+			return fmt.Errorf("%w: wechat template id of %s is empty", verification.ErrInvalidConfig, typ)
+		}
+		ct, err := parseTemplate(tmpl)
+		if err != nil {
+			return fmt.Errorf("%s: %w", typ, err)
+		}
+		data, err := ct.render(verification.TemplateData{Code: sampleCode, Value: sampleCode})
+		if err != nil {
+			return fmt.Errorf("%s: %w: %w", typ, verification.ErrTemplateInvalid, err)
+		}
+		if !strings.Contains(fmt.Sprint(data), sampleCode) {
+			return fmt.Errorf("%w: wechat template of %s does not render {{.Code}}", verification.ErrTemplateInvalid, typ)
+		}
+	}
+	return nil
+}
+
+// Endpoint returns the API endpoint of the config.
+func (c *Config) Endpoint() string {
+	if c.BaseURL != "" {
+		return strings.TrimSuffix(c.BaseURL, "/")
+	}
+	return DefaultBaseURL
+}
+
+// Binding resolves the openid of users, e.g. from the table recording their WeChat
+// logins. Official accounts and mini programs have different openids for the same
+// user, appID identifies the app of the sender.
+type Binding interface {
+	// OpenID returns the openid of userID for appID, or ErrNotBound.
+	OpenID(ctx context.Context, appID string, userID int64) (string, error)
+}
+
+// BindingFunc adapts a function to Binding.
+type BindingFunc func(ctx context.Context, appID string, userID int64) (string, error)
+
+// OpenID implements Binding.
+func (f BindingFunc) OpenID(ctx context.Context, appID string, userID int64) (string, error) {
+	return f(ctx, appID, userID)
+}
+
+// Sender implements CodeSender[T] with WeChat template or subscribe messages to the
+// openid of the UserID of the codes, e.g. for users who signed in with WeChat.
+type Sender[T verification.VerificationCode] struct {
+	config    *Config
+	binding   Binding
+	client    *http.Client
+	tmplCache sync.Map // map[verification.CodeType]*cachedTemplate
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// cachedTemplate holds a pre-parsed template alongside its metadata.
+type cachedTemplate struct {
+	id   string
+	data map[string]*verification.ContentTemplate
+	url  string
+	page string
+}
+
+// parseTemplate parses the values of t.
+func parseTemplate(t Template) (*cachedTemplate, error) {
+	ct := &cachedTemplate{id: t.TemplateID, data: map[string]*verification.ContentTemplate{}, url: t.URL, page: t.Page}
+	for key, value := range t.Data {
+		v, err := verification.ParseContentTemplate(key, value)
+		if err != nil {
+			return nil, err
+		}
+		ct.data[key] = v
+	}
+	return ct, nil
+}
+
+// render returns the data of the message for data.
+func (ct *cachedTemplate) render(data verification.TemplateData) (map[string]messageValue, error) {
+	values := make(map[string]messageValue, len(ct.data))
+	for key, tmpl := range ct.data {
+		v, err := tmpl.Render(data)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = messageValue{Value: v}
+	}
+	return values, nil
+}
+
+// messageValue is a keyword value of a message.
+type messageValue struct {
+	Value string `json:"value"`
+}
+
+// Compile-time assertion: Sender implements CodeSender[MobileCode].
+var _ verification.CodeSender[verification.MobileCode] = (*Sender[verification.MobileCode])(nil)
+
+// NewSender creates a new Sender.
+func NewSender[T verification.VerificationCode](config *Config, binding Binding) *Sender[T] {
+	return &Sender[T]{config: config, binding: binding, client: &http.Client{}}
+}
+
+// NewMobileSender creates a Sender of mobile codes, e.g. to route the codes of users
+// signed in with WeChat away from SMS.
+func NewMobileSender(config *Config, binding Binding) *Sender[verification.MobileCode] {
+	return NewSender[verification.MobileCode](config, binding)
+}
+
+// Send sends the code to the openid of its user.
+func (s *Sender[T]) Send(ctx context.Context, code *T) error {
+	c := any(code).(interface {
+		GetType() verification.CodeType
+		GetUserID() int64
+	})
+	ct, err := s.getTemplate(c.GetType())
+	if err != nil {
+		return err
+	}
+	openID, err := s.binding.OpenID(ctx, s.config.AppID, c.GetUserID())
+	if err != nil {
+		return err
+	}
+	if openID == "" {
+		return ErrNotBound
+	}
+	data, err := ct.render(verification.NewTemplateData(code, s.config.Render))
+	if err != nil {
+		return err
+	}
+
+	msg := map[string]any{"touser": openID, "template_id": ct.id, "data": data}
+	path := "/cgi-bin/message/template/send"
+	if s.config.Kind == KindMiniProgram {
+		path = "/cgi-bin/message/subscribe/send"
+		if ct.page != "" {
+			msg["page"] = ct.page
+		}
+		if s.config.MiniProgramState != "" {
+			msg["miniprogram_state"] = s.config.MiniProgramState
+		}
+	} else if ct.url != "" {
+		msg["url"] = ct.url
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode wechat message: %w", err)
+	}
+	if err = s.post(ctx, path, body); err != nil {
+		return fmt.Errorf("%w: %w", verification.ErrSendFailed, err)
+	}
+	return nil
+}
+
+// Check fetches an access token, it implements the health checker of the sender.
+func (s *Sender[T]) Check(ctx context.Context) error {
+	_, err := s.accessToken(ctx, true)
+	return err
+}
+
+// getTemplate returns a cached, pre-parsed template for the given code type.
+func (s *Sender[T]) getTemplate(typ verification.CodeType) (*cachedTemplate, error) {
+	if cached, ok := s.tmplCache.Load(typ); ok {
+		return cached.(*cachedTemplate), nil
+	}
+	tmpl, ok := s.config.Templates[typ]
+	if !ok {
+		return nil, fmt.Errorf("%w: wechat template of %s", verification.ErrTemplateNotFound, typ)
+	}
+	ct, err := parseTemplate(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse wechat template: %w", err)
+	}
+	s.tmplCache.Store(typ, ct)
+	return ct, nil
+}
+
+// apiError is the error of a WeChat API response.
+type apiError struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+// tokenExpired reports whether errCode rejects the access token, which is then fetched
+// again, e.g. after another process holding the same app fetched a new one.
+func tokenExpired(errCode int) bool {
+	return errCode == 40001 || errCode == 40014 || errCode == 42001
+}
+
+// post posts body to path with the access token, retrying once with a new token when
+// WeChat rejects it.
+func (s *Sender[T]) post(ctx context.Context, path string, body []byte) error {
+	for attempt := 0; ; attempt++ {
+		token, err := s.accessToken(ctx, attempt > 0)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			s.config.Endpoint()+path+"?access_token="+url.QueryEscape(token), bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("wechat new request failed: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		var res apiError
+		if err = s.do(req, &res); err != nil {
+			return err
+		}
+		if res.ErrCode == 0 {
+			return nil
+		}
+		if attempt == 0 && tokenExpired(res.ErrCode) {
+			continue
+		}
+		return fmt.Errorf("wechat request failed: errcode %d: %s", res.ErrCode, res.ErrMsg)
+	}
+}
+
+// accessToken returns the cached access token of the app, fetching a new one when it
+// expires within a minute or refresh is set.
+func (s *Sender[T]) accessToken(ctx context.Context, refresh bool) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !refresh && s.token != "" && time.Until(s.expiresAt) > time.Minute {
+		return s.token, nil
+	}
+	q := url.Values{"grant_type": {"client_credential"}, "appid": {s.config.AppID}, "secret": {s.config.AppSecret}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.config.Endpoint()+"/cgi-bin/token?"+q.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("wechat new request failed: %w", err)
+	}
+	var res struct {
+		apiError
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err = s.do(req, &res); err != nil {
+		return "", err
+	}
+	if res.ErrCode != 0 || res.AccessToken == "" {
+		return "", fmt.Errorf("wechat access token failed: errcode %d: %s", res.ErrCode, res.ErrMsg)
+	}
+	s.token, s.expiresAt = res.AccessToken, time.Now().Add(time.Duration(res.ExpiresIn)*time.Second)
+	return s.token, nil
+}
+
+// do sends the request and decodes the JSON response into v.
+func (s *Sender[T]) do(req *http.Request, v any) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("wechat request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("wechat request failed: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("wechat decode response failed: %w", err)
+	}
+	return nil
+}